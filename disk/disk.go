@@ -9,19 +9,31 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/diskfs/go-diskfs/filesystem"
+	"github.com/diskfs/go-diskfs/filesystem/exfat"
 	"github.com/diskfs/go-diskfs/filesystem/fat32"
 	"github.com/diskfs/go-diskfs/filesystem/iso9660"
 	"github.com/diskfs/go-diskfs/filesystem/squashfs"
 	"github.com/diskfs/go-diskfs/partition"
+	"github.com/diskfs/go-diskfs/partition/bsd"
+	"github.com/diskfs/go-diskfs/partition/gpt"
+	"github.com/diskfs/go-diskfs/partition/mbr"
+	"github.com/diskfs/go-diskfs/partition/part"
+	"github.com/diskfs/go-diskfs/util"
 )
 
 // Disk is a reference to a single disk block device or image that has been Create() or Open()
+//
+// File is the raw contents of the disk. For raw images and block devices, it is the underlying *os.File;
+// for image formats such as qcow2, it is the image implementation that presents the virtual disk,
+// and Closer is the underlying *os.File. Call Close when done with the Disk to release both.
 type Disk struct {
-	File              *os.File
+	File              util.File
+	Closer            io.Closer
 	Info              os.FileInfo
 	Type              Type
 	Size              int64
@@ -46,30 +58,95 @@ var (
 	errIncorrectOpenMode = errors.New("disk file or device not open for write")
 )
 
+// Close closes File, if it is an io.Closer, and then Closer, if set. For image formats, closing File
+// releases any backing files the image opened, such as the backing chain of a qcow2 image.
+// Once closed, the Disk can no longer be used.
+func (d *Disk) Close() error {
+	var err error
+	if c, ok := d.File.(io.Closer); ok {
+		err = c.Close()
+	}
+	if d.Closer != nil {
+		if e := d.Closer.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	d.File, d.Closer = nil, nil
+	return err
+}
+
 // GetPartitionTable retrieves a PartitionTable for a Disk
 //
 // If the table is able to be retrieved from the disk, it is saved in the instance.
+// If it is a GPT with a different logical sector size than the Disk, e.g. on an image made for a 4Kn
+// drive, LogicalBlocksize is changed to match it.
 //
 // returns an error if the Disk is invalid or does not exist, or the partition table is unknown
 func (d *Disk) GetPartitionTable() (partition.Table, error) {
-	t, err := partition.Read(d.File, int(d.LogicalBlocksize), int(d.PhysicalBlocksize))
+	t, sectorSize, err := partition.ReadDetectSectorSize(d.File, int(d.LogicalBlocksize), int(d.PhysicalBlocksize))
 	if err != nil {
 		return nil, err
 	}
+	if int64(sectorSize) != d.LogicalBlocksize {
+		log.Debugf("partition table uses logical sector size %d instead of %d", sectorSize, d.LogicalBlocksize)
+		d.LogicalBlocksize = int64(sectorSize)
+		if d.PhysicalBlocksize < d.LogicalBlocksize {
+			d.PhysicalBlocksize = d.LogicalBlocksize
+		}
+	}
 	d.Table = t
 	return t, nil
 }
 
+// partitionOpts options for writing a partition table with Partition()
+type partitionOpts struct {
+	force bool
+}
+
+// PartitionOpt func that process Partition options
+type PartitionOpt func(o *partitionOpts) error
+
+// WithForce writes the partition table even if verifying it finds problems, such as overlapping partitions
+func WithForce() PartitionOpt {
+	return func(o *partitionOpts) error {
+		o.force = true
+		return nil
+	}
+}
+
+// verifiableTable is a partition table that can check itself for problems before it is written
+type verifiableTable interface {
+	Verify(diskSize int64) []part.Problem
+}
+
 // Partition applies a partition.Table implementation to a Disk
 //
 // The Table can have zero, one or more Partitions, each of which is unique to its
 // implementation. E.g. MBR partitions in mbr.Table look different from GPT partitions in gpt.Table
 //
+// Before it is written, the table is verified, and a table with problems, e.g. overlapping partitions
+// or partitions beyond the end of the disk, returns an error unless WithForce() is passed.
+//
 // Actual writing of the table is delegated to the individual implementation
-func (d *Disk) Partition(table partition.Table) error {
+func (d *Disk) Partition(table partition.Table, opts ...PartitionOpt) error {
 	if !d.Writable {
 		return errIncorrectOpenMode
 	}
+	opt := &partitionOpts{}
+	for _, o := range opts {
+		if err := o(opt); err != nil {
+			return err
+		}
+	}
+	if v, ok := table.(verifiableTable); ok && !opt.force {
+		if problems := v.Verify(d.Size); len(problems) > 0 {
+			descriptions := make([]string, 0, len(problems))
+			for _, p := range problems {
+				descriptions = append(descriptions, p.String())
+			}
+			return fmt.Errorf("invalid partition table: %s", strings.Join(descriptions, "; "))
+		}
+	}
 	// fill in the uuid
 	err := table.Write(d.File, d.Size)
 	if err != nil {
@@ -87,6 +164,158 @@ func (d *Disk) Partition(table partition.Table) error {
 	return nil
 }
 
+// resizableTable is a partition table with structures tied to the end of the disk, such as the
+// secondary header and partition array of a GPT, which must move when the disk is resized
+type resizableTable interface {
+	Resize(size int64) error
+}
+
+// Resize grows or shrinks a disk image to newSize bytes, e.g. to enlarge a cloud image before its first boot.
+//
+// Partition table structures at the end of the disk, such as the secondary GPT header and partition array,
+// are moved to the new end, and the last usable sector is updated. Partitions themselves are left as they are,
+// and a shrink that would cut into an existing partition returns an error without changing anything.
+//
+// Only file-based disks whose File can be truncated, like the *os.File of a raw image, can be resized.
+func (d *Disk) Resize(newSize int64) error {
+	switch {
+	case !d.Writable:
+		return errIncorrectOpenMode
+	case d.Type == Device:
+		return errors.New("cannot resize a block device")
+	case newSize <= 0 || newSize%d.LogicalBlocksize != 0:
+		return fmt.Errorf("new size %d must be a positive multiple of the logical sector size %d", newSize, d.LogicalBlocksize)
+	}
+	truncater, ok := d.File.(interface{ Truncate(int64) error })
+	if !ok {
+		return fmt.Errorf("disk file of type %T cannot be resized", d.File)
+	}
+	if d.Table != nil {
+		for i, p := range d.Table.GetPartitions() {
+			if end := p.GetStart() + p.GetSize(); end > newSize {
+				return fmt.Errorf("partition %d ends at byte %d, beyond the new size %d", i+1, end, newSize)
+			}
+		}
+	}
+
+	// grow the file before writing the table at its new end, or write the table before shrinking the file
+	if newSize > d.Size {
+		if err := truncater.Truncate(newSize); err != nil {
+			return fmt.Errorf("unable to grow disk to %d bytes: %v", newSize, err)
+		}
+	}
+	if t, ok := d.Table.(resizableTable); ok {
+		if err := t.Resize(newSize); err != nil {
+			return fmt.Errorf("unable to resize partition table: %v", err)
+		}
+		if err := d.Table.Write(d.File, newSize); err != nil {
+			return fmt.Errorf("failed to write resized partition table: %v", err)
+		}
+	}
+	if newSize < d.Size {
+		if err := truncater.Truncate(newSize); err != nil {
+			return fmt.Errorf("unable to shrink disk to %d bytes: %v", newSize, err)
+		}
+	}
+	d.Size = newSize
+	if f, ok := d.File.(*os.File); ok {
+		if info, err := f.Stat(); err == nil {
+			d.Info = info
+		}
+	}
+	return nil
+}
+
+// ConvertToGPT converts the MBR partition table of the Disk to a GPT, in place. Partitions keep their
+// start and end, so their contents are untouched; see partition.MBRToGPT for how the table is converted.
+// The GPT is written with Partition(), and replaces the MBR with a protective MBR, keeping the boot code.
+func (d *Disk) ConvertToGPT() error {
+	if err := d.ensureTable(); err != nil {
+		return err
+	}
+	mbrTable, ok := d.Table.(*mbr.Table)
+	if !ok {
+		return fmt.Errorf("cannot convert partition table of type %s to gpt, only mbr", d.Table.Type())
+	}
+	gptTable, err := partition.MBRToGPT(mbrTable, d.Size)
+	if err != nil {
+		return fmt.Errorf("unable to convert partition table to gpt: %v", err)
+	}
+	return d.Partition(gptTable)
+}
+
+// ConvertToMBR converts the GPT of the Disk to an MBR partition table, in place. Partitions keep their
+// start and end, so their contents are untouched; see partition.GPTToMBR for how the table is converted.
+// The MBR is written with Partition(), and then the GPT headers are erased so the disk is seen as MBR.
+func (d *Disk) ConvertToMBR() error {
+	if err := d.ensureTable(); err != nil {
+		return err
+	}
+	gptTable, ok := d.Table.(*gpt.Table)
+	if !ok {
+		return fmt.Errorf("cannot convert partition table of type %s to mbr, only gpt", d.Table.Type())
+	}
+	mbrTable, err := partition.GPTToMBR(gptTable)
+	if err != nil {
+		return fmt.Errorf("unable to convert partition table to mbr: %v", err)
+	}
+	if err := d.Partition(mbrTable); err != nil {
+		return err
+	}
+	if err := gptTable.Erase(d.File); err != nil {
+		return fmt.Errorf("unable to erase gpt after writing mbr: %v", err)
+	}
+	if d.Type == Device {
+		if err := d.ReReadPartitionTable(); err != nil {
+			return fmt.Errorf("unable to re-read the partition table. Kernel still uses old partition table: %v", err)
+		}
+	}
+	return nil
+}
+
+// ensureTable reads the partition table from a writable disk, if it has not been read yet
+func (d *Disk) ensureTable() error {
+	if !d.Writable {
+		return errIncorrectOpenMode
+	}
+	if d.Table != nil {
+		return nil
+	}
+	if _, err := d.GetPartitionTable(); err != nil {
+		return fmt.Errorf("unable to read partition table: %v", err)
+	}
+	return nil
+}
+
+// GetDisklabel reads the BSD disklabel nested inside an MBR partition of the Disk, of type mbr.FreeBSD,
+// mbr.OpenBSD or mbr.NetBSD, or a GPT partition of type gpt.FreeBSDData, or, for partition 0, a disklabel
+// on the whole disk. Partitions are numbered from 1, as for GetFilesystem(). The partitions of the
+// disklabel have absolute offsets on the disk.
+//
+// To change the disklabel, call its Write() with the File and Size of the Disk.
+func (d *Disk) GetDisklabel(partition int) (*bsd.Table, error) {
+	if partition == 0 {
+		return bsd.Read(d.File, int(d.LogicalBlocksize), int(d.PhysicalBlocksize))
+	}
+	if d.Table == nil {
+		if _, err := d.GetPartitionTable(); err != nil {
+			return nil, fmt.Errorf("unable to read partition table: %v", err)
+		}
+	}
+	count := len(d.Table.GetPartitions())
+	if partition < 0 || partition > count {
+		return nil, fmt.Errorf("cannot read disklabel in partition %d, the partition table has %d partitions", partition, count)
+	}
+	switch table := d.Table.(type) {
+	case *mbr.Table:
+		return bsd.ReadFromMBR(d.File, table.Partitions[partition-1])
+	case *gpt.Table:
+		return bsd.ReadFromGPT(d.File, table.Partitions[partition-1])
+	default:
+		return nil, fmt.Errorf("cannot read disklabel inside a partition of a %s partition table, only mbr or gpt", d.Table.Type())
+	}
+}
+
 // WritePartitionContents writes the contents of an io.Reader to a given partition
 //
 // if successful, returns the number of bytes written
@@ -139,6 +368,8 @@ type FilesystemSpec struct {
 	FSType      filesystem.Type
 	VolumeLabel string
 	WorkDir     string
+	// FATType forces FAT12, FAT16 or FAT32 for filesystem.TypeFat32, instead of picking the variant from the size
+	FATType fat32.FATType
 }
 
 // CreateFilesystem creates a filesystem on a disk image, the equivalent of mkfs.
@@ -151,6 +382,8 @@ type FilesystemSpec struct {
 // Optional:
 //   - volume label for those filesystems that support it; under Linux this shows
 //     in '/dev/disks/by-label/<label>'
+//   - the variant of FAT, for filesystem.TypeFat32; by default it is picked from the size, so a small
+//     EFI System Partition that must be FAT32 needs fat32.FAT32
 //
 // if successful, returns a filesystem-implementing structure for the given filesystem type
 //
@@ -182,7 +415,9 @@ func (d *Disk) CreateFilesystem(spec FilesystemSpec) (filesystem.FileSystem, err
 
 	switch spec.FSType {
 	case filesystem.TypeFat32:
-		return fat32.Create(d.File, size, start, d.LogicalBlocksize, spec.VolumeLabel)
+		return fat32.Create(d.File, size, start, d.LogicalBlocksize, spec.VolumeLabel, fat32.WithFATType(spec.FATType))
+	case filesystem.TypeExFAT:
+		return exfat.Create(d.File, size, start, d.LogicalBlocksize, spec.VolumeLabel)
 	case filesystem.TypeISO9660:
 		return iso9660.Create(d.File, size, start, d.LogicalBlocksize, spec.WorkDir)
 	case filesystem.TypeSquashfs:
@@ -223,24 +458,36 @@ func (d *Disk) GetFilesystem(part int) (filesystem.FileSystem, error) {
 		start = partitions[part-1].GetStart()
 	}
 
+	// filesystems on a disk that is not writable are read-only
+	file := d.File
+	if !d.Writable {
+		file = util.NewReadOnlyFile(d.File, d.Size)
+	}
+
 	// just try each type
 	log.Debug("trying fat32")
-	fat32FS, err := fat32.Read(d.File, size, start, d.LogicalBlocksize)
+	fat32FS, err := fat32.Read(file, size, start, d.LogicalBlocksize)
 	if err == nil {
 		return fat32FS, nil
 	}
 	log.Debugf("fat32 failed: %v", err)
+	log.Debug("trying exfat")
+	exfatFS, err := exfat.Read(file, size, start, d.LogicalBlocksize)
+	if err == nil {
+		return exfatFS, nil
+	}
+	log.Debugf("exfat failed: %v", err)
 	pbs := d.PhysicalBlocksize
 	if d.DefaultBlocks {
 		pbs = 0
 	}
 	log.Debugf("trying iso9660 with physical block size %d", pbs)
-	iso9660FS, err := iso9660.Read(d.File, size, start, pbs)
+	iso9660FS, err := iso9660.Read(file, size, start, pbs)
 	if err == nil {
 		return iso9660FS, nil
 	}
 	log.Debugf("iso9660 failed: %v", err)
-	squashFS, err := squashfs.Read(d.File, size, start, d.LogicalBlocksize)
+	squashFS, err := squashfs.Read(file, size, start, d.LogicalBlocksize)
 	if err == nil {
 		return squashFS, nil
 	}
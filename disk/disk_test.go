@@ -8,6 +8,7 @@ package disk_test
 import (
 	"bytes"
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -16,8 +17,10 @@ import (
 	"github.com/diskfs/go-diskfs/disk"
 	"github.com/diskfs/go-diskfs/filesystem"
 	"github.com/diskfs/go-diskfs/partition"
+	"github.com/diskfs/go-diskfs/partition/bsd"
 	"github.com/diskfs/go-diskfs/partition/gpt"
 	"github.com/diskfs/go-diskfs/partition/mbr"
+	"github.com/diskfs/go-diskfs/util"
 )
 
 var (
@@ -87,6 +90,52 @@ func TestGetPartitionTable(t *testing.T) {
 	}
 }
 
+func TestGetPartitionTable4K(t *testing.T) {
+	f, err := tmpDisk("")
+	if err != nil {
+		t.Fatalf("error creating new temporary disk: %v", err)
+	}
+	defer f.Close()
+	if keepTmpFiles {
+		defer os.Remove(f.Name())
+	} else {
+		fmt.Println(f.Name())
+	}
+	fileInfo, err := f.Stat()
+	if err != nil {
+		t.Fatalf("error reading info on temporary disk: %v", err)
+	}
+	table := &gpt.Table{
+		LogicalSectorSize:  4096,
+		PhysicalSectorSize: 4096,
+		ProtectiveMBR:      true,
+		Partitions: []*gpt.Partition{
+			{Start: 256, End: 511, Type: gpt.LinuxFilesystem},
+		},
+	}
+	if err := table.Write(f, fileInfo.Size()); err != nil {
+		t.Fatalf("unexpected error writing table: %v", err)
+	}
+
+	d := &disk.Disk{
+		File:              f,
+		LogicalBlocksize:  512,
+		PhysicalBlocksize: 512,
+		Info:              fileInfo,
+		Size:              fileInfo.Size(),
+	}
+	read, err := d.GetPartitionTable()
+	if err != nil {
+		t.Fatalf("unexpected error reading table: %v", err)
+	}
+	if read.Type() != "gpt" {
+		t.Errorf("read table of type %s instead of gpt", read.Type())
+	}
+	if d.LogicalBlocksize != 4096 || d.PhysicalBlocksize != 4096 {
+		t.Errorf("disk has block sizes %d and %d instead of 4096", d.LogicalBlocksize, d.PhysicalBlocksize)
+	}
+}
+
 func TestPartition(t *testing.T) {
 	t.Run("gpt", func(t *testing.T) {
 		f, err := tmpDisk("")
@@ -172,6 +221,51 @@ func TestPartition(t *testing.T) {
 			t.Errorf("unexpected err: %v", err)
 		}
 	})
+	t.Run("invalid", func(t *testing.T) {
+		f, err := tmpDisk("")
+		if err != nil {
+			t.Fatalf("error creating new temporary disk: %v", err)
+		}
+		defer f.Close()
+
+		if keepTmpFiles {
+			defer os.Remove(f.Name())
+		} else {
+			fmt.Println(f.Name())
+		}
+
+		fileInfo, err := f.Stat()
+		if err != nil {
+			t.Fatalf("error reading info on temporary disk: %v", err)
+		}
+
+		d := &disk.Disk{
+			File:              f,
+			LogicalBlocksize:  512,
+			PhysicalBlocksize: 512,
+			Info:              fileInfo,
+			Writable:          true,
+			Size:              fileInfo.Size(),
+		}
+		table := &gpt.Table{
+			Partitions: []*gpt.Partition{
+				{Start: 2048, End: 8191, Type: gpt.LinuxFilesystem, Name: "one"},
+				{Start: 4096, End: 10239, Type: gpt.LinuxFilesystem, Name: "two"},
+			},
+			LogicalSectorSize: 512,
+		}
+		err = d.Partition(table)
+		expected := "invalid partition table: partition 2: overlaps partition 1"
+		if err == nil || err.Error() != expected {
+			t.Errorf("returned error %v instead of expected %s", err, expected)
+		}
+		if b, _ := os.ReadFile(f.Name()); bytes.Contains(b, []byte("EFI PART")) {
+			t.Errorf("invalid table was written")
+		}
+		if err := d.Partition(table, disk.WithForce()); err != nil {
+			t.Errorf("unexpected error forcing invalid table: %v", err)
+		}
+	})
 	t.Run("readonly", func(t *testing.T) {
 		d := &disk.Disk{
 			Writable: false,
@@ -184,6 +278,229 @@ func TestPartition(t *testing.T) {
 	})
 }
 
+func TestResize(t *testing.T) {
+	f, err := tmpDisk("")
+	if err != nil {
+		t.Fatalf("error creating new temporary disk: %v", err)
+	}
+	defer f.Close()
+	if keepTmpFiles {
+		defer os.Remove(f.Name())
+	} else {
+		fmt.Println(f.Name())
+	}
+	fileInfo, err := f.Stat()
+	if err != nil {
+		t.Fatalf("error reading info on temporary disk: %v", err)
+	}
+
+	d := &disk.Disk{
+		File:              f,
+		LogicalBlocksize:  512,
+		PhysicalBlocksize: 512,
+		Info:              fileInfo,
+		Writable:          true,
+		Size:              fileInfo.Size(),
+	}
+	// a 5MB partition, ending at 7MB
+	table := &gpt.Table{
+		Partitions: []*gpt.Partition{
+			{Start: 4096, End: 4096 + 10240 - 1, Type: gpt.LinuxFilesystem, Name: "data"},
+		},
+		LogicalSectorSize: 512,
+		ProtectiveMBR:     true,
+	}
+	if err := d.Partition(table); err != nil {
+		t.Fatalf("unexpected error partitioning disk: %v", err)
+	}
+
+	tests := []struct {
+		size int64
+		err  string
+	}{
+		{20 * 1024 * 1024, ""},
+		{6 * 1024 * 1024, "beyond the new size"},
+		// fits the partition, but not the secondary GPT after it
+		{7*1024*1024 + 512, "beyond the last usable sector"},
+		{8 * 1024 * 1024, ""},
+		{8*1024*1024 + 100, "multiple of the logical sector size"},
+	}
+	for _, tt := range tests {
+		err := d.Resize(tt.size)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("resize to %d returned error %v instead of expected %s", tt.size, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error resizing to %d: %v", tt.size, err)
+		}
+		info, err := f.Stat()
+		if err != nil {
+			t.Fatalf("error reading info on temporary disk: %v", err)
+		}
+		if info.Size() != tt.size || d.Size != tt.size {
+			t.Errorf("disk file is %d bytes and disk size %d instead of %d", info.Size(), d.Size, tt.size)
+		}
+		read, err := gpt.Read(f, 512, 512)
+		if err != nil {
+			t.Fatalf("unexpected error reading resized table: %v", err)
+		}
+		if !read.Health().OK() {
+			t.Errorf("resized table is not healthy: %+v", read.Health())
+		}
+		if p := read.Partitions[0]; p.Start != 4096 || p.End != 4096+10240-1 || p.Name != "data" {
+			t.Errorf("resized table has partition %#v instead of the original", p)
+		}
+		// the secondary GPT header is in the last sector
+		b := make([]byte, 8)
+		if _, err := f.ReadAt(b, tt.size-512); err != nil {
+			t.Fatalf("error reading last sector: %v", err)
+		}
+		if string(b) != "EFI PART" {
+			t.Errorf("last sector starts with %q instead of a GPT header", b)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	f, err := tmpDisk("")
+	if err != nil {
+		t.Fatalf("error creating new temporary disk: %v", err)
+	}
+	defer f.Close()
+	if keepTmpFiles {
+		defer os.Remove(f.Name())
+	} else {
+		fmt.Println(f.Name())
+	}
+	fileInfo, err := f.Stat()
+	if err != nil {
+		t.Fatalf("error reading info on temporary disk: %v", err)
+	}
+
+	d := &disk.Disk{
+		File:              f,
+		LogicalBlocksize:  512,
+		PhysicalBlocksize: 512,
+		Info:              fileInfo,
+		Writable:          true,
+		Size:              fileInfo.Size(),
+	}
+	table := &mbr.Table{
+		LogicalSectorSize:  512,
+		PhysicalSectorSize: 512,
+		Partitions: []*mbr.Partition{
+			{Bootable: true, Type: mbr.Linux, Start: 2048, Size: 10240},
+		},
+	}
+	if err := d.Partition(table); err != nil {
+		t.Fatalf("unexpected error partitioning disk: %v", err)
+	}
+	contents := []byte("partition contents")
+	if _, err := f.WriteAt(contents, 2048*512); err != nil {
+		t.Fatalf("error writing partition contents: %v", err)
+	}
+
+	check := func(tableType string) {
+		t.Helper()
+		read, err := partition.Read(f, 512, 512)
+		if err != nil {
+			t.Fatalf("unexpected error reading converted table: %v", err)
+		}
+		if read.Type() != tableType {
+			t.Errorf("converted table has type %s instead of %s", read.Type(), tableType)
+		}
+		parts := read.GetPartitions()
+		if parts[0].GetStart() != 2048*512 || parts[0].GetSize() != 10240*512 {
+			t.Errorf("converted partition at %d size %d instead of the original", parts[0].GetStart(), parts[0].GetSize())
+		}
+		b := make([]byte, len(contents))
+		if _, err := f.ReadAt(b, 2048*512); err != nil {
+			t.Fatalf("error reading partition contents: %v", err)
+		}
+		if !bytes.Equal(b, contents) {
+			t.Errorf("partition contents changed to %q", b)
+		}
+	}
+
+	if err := d.ConvertToMBR(); err == nil {
+		t.Errorf("converting an mbr disk to mbr did not return an error")
+	}
+	if err := d.ConvertToGPT(); err != nil {
+		t.Fatalf("unexpected error converting to gpt: %v", err)
+	}
+	check("gpt")
+	if p := d.Table.(*gpt.Table).Partitions[0]; p.Type != gpt.LinuxFilesystem {
+		t.Errorf("converted partition type %s instead of %s", p.Type, gpt.LinuxFilesystem)
+	}
+	if err := d.ConvertToMBR(); err != nil {
+		t.Fatalf("unexpected error converting to mbr: %v", err)
+	}
+	check("mbr")
+	if p := d.Table.(*mbr.Table).Partitions[0]; !p.Bootable || p.Type != mbr.Linux {
+		t.Errorf("converted partition %#v lost its type or active flag", p)
+	}
+}
+
+func TestGetDisklabel(t *testing.T) {
+	f, err := tmpDisk("")
+	if err != nil {
+		t.Fatalf("error creating new temporary disk: %v", err)
+	}
+	defer f.Close()
+	if keepTmpFiles {
+		defer os.Remove(f.Name())
+	} else {
+		fmt.Println(f.Name())
+	}
+	fileInfo, err := f.Stat()
+	if err != nil {
+		t.Fatalf("error reading info on temporary disk: %v", err)
+	}
+
+	d := &disk.Disk{
+		File:              f,
+		LogicalBlocksize:  512,
+		PhysicalBlocksize: 512,
+		Info:              fileInfo,
+		Writable:          true,
+		Size:              fileInfo.Size(),
+	}
+	table := &mbr.Table{
+		Partitions: []*mbr.Partition{
+			{Type: mbr.Linux, Start: 2048, Size: 2048},
+			{Type: mbr.FreeBSD, Start: 4096, Size: 16384},
+		},
+	}
+	if err := d.Partition(table); err != nil {
+		t.Fatalf("unexpected error partitioning disk: %v", err)
+	}
+	label := &bsd.Table{
+		Start:           4096,
+		Size:            16384,
+		RelativeOffsets: true,
+		Partitions: []*bsd.Partition{
+			{Start: 4096 + 16, Size: 16368, Type: bsd.FFS},
+		},
+	}
+	if err := label.Write(d.File, d.Size); err != nil {
+		t.Fatalf("unexpected error writing disklabel: %v", err)
+	}
+
+	if _, err := d.GetDisklabel(1); err == nil {
+		t.Errorf("reading a disklabel from a Linux partition did not return an error")
+	}
+	read, err := d.GetDisklabel(2)
+	if err != nil {
+		t.Fatalf("unexpected error reading disklabel: %v", err)
+	}
+	if start := read.GetPartitions()[0].GetStart(); start != (4096+16)*512 {
+		t.Errorf("partition a starts at %d instead of %d", start, (4096+16)*512)
+	}
+}
+
 func TestWritePartitionContents(t *testing.T) {
 	t.Run("gpt", func(t *testing.T) {
 		oneMB := uint64(1024 * 1024)
@@ -252,6 +569,51 @@ func TestWritePartitionContents(t *testing.T) {
 			})
 		}
 	})
+	t.Run("invalid", func(t *testing.T) {
+		f, err := tmpDisk("")
+		if err != nil {
+			t.Fatalf("error creating new temporary disk: %v", err)
+		}
+		defer f.Close()
+
+		if keepTmpFiles {
+			defer os.Remove(f.Name())
+		} else {
+			fmt.Println(f.Name())
+		}
+
+		fileInfo, err := f.Stat()
+		if err != nil {
+			t.Fatalf("error reading info on temporary disk: %v", err)
+		}
+
+		d := &disk.Disk{
+			File:              f,
+			LogicalBlocksize:  512,
+			PhysicalBlocksize: 512,
+			Info:              fileInfo,
+			Writable:          true,
+			Size:              fileInfo.Size(),
+		}
+		table := &gpt.Table{
+			Partitions: []*gpt.Partition{
+				{Start: 2048, End: 8191, Type: gpt.LinuxFilesystem, Name: "one"},
+				{Start: 4096, End: 10239, Type: gpt.LinuxFilesystem, Name: "two"},
+			},
+			LogicalSectorSize: 512,
+		}
+		err = d.Partition(table)
+		expected := "invalid partition table: partition 2: overlaps partition 1"
+		if err == nil || err.Error() != expected {
+			t.Errorf("returned error %v instead of expected %s", err, expected)
+		}
+		if b, _ := os.ReadFile(f.Name()); bytes.Contains(b, []byte("EFI PART")) {
+			t.Errorf("invalid table was written")
+		}
+		if err := d.Partition(table, disk.WithForce()); err != nil {
+			t.Errorf("unexpected error forcing invalid table: %v", err)
+		}
+	})
 	t.Run("readonly", func(t *testing.T) {
 		d := &disk.Disk{
 			Writable: false,
@@ -529,6 +891,51 @@ func TestCreateFilesystem(t *testing.T) {
 			t.Errorf("returned filesystem was unexpectedly nil")
 		}
 	})
+	t.Run("invalid", func(t *testing.T) {
+		f, err := tmpDisk("")
+		if err != nil {
+			t.Fatalf("error creating new temporary disk: %v", err)
+		}
+		defer f.Close()
+
+		if keepTmpFiles {
+			defer os.Remove(f.Name())
+		} else {
+			fmt.Println(f.Name())
+		}
+
+		fileInfo, err := f.Stat()
+		if err != nil {
+			t.Fatalf("error reading info on temporary disk: %v", err)
+		}
+
+		d := &disk.Disk{
+			File:              f,
+			LogicalBlocksize:  512,
+			PhysicalBlocksize: 512,
+			Info:              fileInfo,
+			Writable:          true,
+			Size:              fileInfo.Size(),
+		}
+		table := &gpt.Table{
+			Partitions: []*gpt.Partition{
+				{Start: 2048, End: 8191, Type: gpt.LinuxFilesystem, Name: "one"},
+				{Start: 4096, End: 10239, Type: gpt.LinuxFilesystem, Name: "two"},
+			},
+			LogicalSectorSize: 512,
+		}
+		err = d.Partition(table)
+		expected := "invalid partition table: partition 2: overlaps partition 1"
+		if err == nil || err.Error() != expected {
+			t.Errorf("returned error %v instead of expected %s", err, expected)
+		}
+		if b, _ := os.ReadFile(f.Name()); bytes.Contains(b, []byte("EFI PART")) {
+			t.Errorf("invalid table was written")
+		}
+		if err := d.Partition(table, disk.WithForce()); err != nil {
+			t.Errorf("unexpected error forcing invalid table: %v", err)
+		}
+	})
 	t.Run("readonly", func(t *testing.T) {
 		d := &disk.Disk{
 			Writable: false,
@@ -654,3 +1061,324 @@ func TestGetFilesystem(t *testing.T) {
 		}
 	})
 }
+
+func TestFindPartition(t *testing.T) {
+	f, err := tmpDisk("")
+	if err != nil {
+		t.Fatalf("error creating new temporary disk: %v", err)
+	}
+	defer f.Close()
+	if keepTmpFiles {
+		defer os.Remove(f.Name())
+	} else {
+		fmt.Println(f.Name())
+	}
+	fileInfo, err := f.Stat()
+	if err != nil {
+		t.Fatalf("error reading info on temporary disk: %v", err)
+	}
+	d := &disk.Disk{
+		File:              f,
+		LogicalBlocksize:  512,
+		PhysicalBlocksize: 512,
+		Info:              fileInfo,
+		Writable:          true,
+		Size:              fileInfo.Size(),
+	}
+	table := &gpt.Table{
+		Partitions: []*gpt.Partition{
+			{Start: 2048, End: 10239, Type: gpt.EFISystemPartition, Name: "EFI", GUID: "5CA3360B-5DE6-4FCF-B4CE-419CEE433B51"},
+			{Start: 10240, End: 14335, Type: gpt.LinuxFilesystem, Name: "root", GUID: "74335E03-835D-4E1A-9542-B4D8D23AC001"},
+			{Start: 14336, End: 18431, Type: gpt.LinuxFilesystem, Name: "data"},
+		},
+		LogicalSectorSize: 512,
+		ProtectiveMBR:     true,
+	}
+	if err := d.Partition(table); err != nil {
+		t.Fatalf("unexpected error partitioning disk: %v", err)
+	}
+	// look up in the table as read from the disk
+	d.Table = nil
+
+	tests := []struct {
+		selector disk.PartitionSelector
+		index    int
+		err      string
+	}{
+		{disk.ByName("root"), 2, ""},
+		{disk.ByGUID("74335e03-835d-4e1a-9542-b4d8d23ac001"), 2, ""},
+		{disk.ByType(gpt.EFISystemPartition), 1, ""},
+		{disk.ByName("swap"), -1, `no partition has name "swap"`},
+		{disk.ByType(gpt.LinuxFilesystem), -1, `partitions 2 and 3 both have type "0FC63DAF-8483-4772-8E79-3D69D8477DE4"`},
+		{disk.ByType(gpt.Unused), -1, "no partition has type"},
+		{disk.PartitionSelector{}, -1, "cannot find a partition without a selector"},
+	}
+	for _, tt := range tests {
+		index, p, err := d.FindPartition(tt.selector)
+		switch {
+		case tt.err != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.err)):
+			t.Errorf("%v returned error %v instead of %s", tt.selector, err, tt.err)
+		case tt.err == "" && err != nil:
+			t.Errorf("%v returned unexpected error: %v", tt.selector, err)
+		case index != tt.index:
+			t.Errorf("%v returned partition %d instead of %d", tt.selector, index, tt.index)
+		case tt.err == "" && p.GetStart() != int64(table.Partitions[index-1].Start)*512:
+			t.Errorf("%v returned partition starting at %d", tt.selector, p.GetStart())
+		}
+	}
+
+	t.Run("contents", func(t *testing.T) {
+		b := make([]byte, 4096*512)
+		if _, err := rand.Read(b); err != nil {
+			t.Fatalf("error generating contents: %v", err)
+		}
+		if _, err := d.WritePartitionContentsBy(disk.ByName("data"), bytes.NewReader(b)); err != nil {
+			t.Fatalf("unexpected error writing contents: %v", err)
+		}
+		var out bytes.Buffer
+		if _, err := d.ReadPartitionContentsBy(disk.ByName("data"), &out); err != nil {
+			t.Fatalf("unexpected error reading contents: %v", err)
+		}
+		if !bytes.Equal(out.Bytes(), b) {
+			t.Errorf("read contents differ from those written")
+		}
+		if _, err := d.ReadPartitionContentsBy(disk.ByName("missing"), &out); err == nil {
+			t.Errorf("no error reading contents of a missing partition")
+		}
+	})
+	t.Run("filesystem", func(t *testing.T) {
+		if _, err := d.CreateFilesystemBy(disk.ByType(gpt.EFISystemPartition), disk.FilesystemSpec{FSType: filesystem.TypeFat32, VolumeLabel: "EFI"}); err != nil {
+			t.Fatalf("unexpected error creating filesystem: %v", err)
+		}
+		fs, err := d.GetFilesystemBy(disk.ByName("EFI"))
+		if err != nil {
+			t.Fatalf("unexpected error getting filesystem: %v", err)
+		}
+		if fs.Type() != filesystem.TypeFat32 {
+			t.Errorf("filesystem has type %v instead of fat32", fs.Type())
+		}
+	})
+	t.Run("disklabel", func(t *testing.T) {
+		table.Partitions[2].Type = gpt.FreeBSDData
+		if err := d.Partition(table); err != nil {
+			t.Fatalf("unexpected error partitioning disk: %v", err)
+		}
+		label := &bsd.Table{
+			Start:           14336,
+			Size:            4096,
+			RelativeOffsets: true,
+			Partitions: []*bsd.Partition{
+				{Start: 14336 + 16, Size: 4080, Type: bsd.FFS},
+			},
+		}
+		if err := label.Write(d.File, d.Size); err != nil {
+			t.Fatalf("unexpected error writing disklabel: %v", err)
+		}
+		read, err := d.GetDisklabelBy(disk.ByName("data"))
+		if err != nil {
+			t.Fatalf("unexpected error reading disklabel: %v", err)
+		}
+		if start := read.GetPartitions()[0].GetStart(); start != (14336+16)*512 {
+			t.Errorf("partition a starts at %d instead of %d", start, (14336+16)*512)
+		}
+		if _, err := d.GetDisklabelBy(disk.ByName("root")); err == nil {
+			t.Errorf("reading a disklabel from a Linux partition did not return an error")
+		}
+	})
+	t.Run("mbr", func(t *testing.T) {
+		d.Table = &mbr.Table{}
+		expected := "cannot find a partition by name in a mbr partition table, only gpt"
+		if _, _, err := d.FindPartition(disk.ByName("root")); err == nil || err.Error() != expected {
+			t.Errorf("returned error %v instead of %s", err, expected)
+		}
+	})
+}
+
+// failingFile fails every write at or after byte failAt
+type failingFile struct {
+	util.File
+	failAt int64
+}
+
+func (f failingFile) WriteAt(b []byte, off int64) (int, error) {
+	if off >= f.failAt {
+		return 0, errors.New("injected write failure")
+	}
+	return f.File.WriteAt(b, off)
+}
+
+func TestMovePartition(t *testing.T) {
+	f, err := tmpDisk("")
+	if err != nil {
+		t.Fatalf("error creating new temporary disk: %v", err)
+	}
+	defer f.Close()
+	if keepTmpFiles {
+		defer os.Remove(f.Name())
+	} else {
+		fmt.Println(f.Name())
+	}
+	fileInfo, err := f.Stat()
+	if err != nil {
+		t.Fatalf("error reading info on temporary disk: %v", err)
+	}
+	d := &disk.Disk{
+		File:              f,
+		LogicalBlocksize:  512,
+		PhysicalBlocksize: 512,
+		Info:              fileInfo,
+		Writable:          true,
+		Size:              fileInfo.Size(),
+	}
+	table := &gpt.Table{
+		Partitions: []*gpt.Partition{
+			{Start: 2048, End: 4095, Type: gpt.LinuxFilesystem, Name: "one"},
+			{Start: 8192, End: 10239, Type: gpt.LinuxFilesystem, Name: "two"},
+		},
+		LogicalSectorSize: 512,
+		ProtectiveMBR:     true,
+	}
+	if err := d.Partition(table); err != nil {
+		t.Fatalf("unexpected error partitioning disk: %v", err)
+	}
+	contents := make([]byte, 2048*512)
+	if _, err := rand.Read(contents); err != nil {
+		t.Fatalf("error generating contents: %v", err)
+	}
+	if _, err := d.WritePartitionContents(1, bytes.NewReader(contents)); err != nil {
+		t.Fatalf("unexpected error writing contents: %v", err)
+	}
+	// check both the table as read back from the disk, and the contents at the new location
+	check := func(start, end uint64) {
+		t.Helper()
+		read, err := gpt.Read(f, 512, 512)
+		if err != nil {
+			t.Fatalf("unexpected error reading table: %v", err)
+		}
+		if p := read.Partitions[0]; p.Start != start || p.End != end || p.Name != "one" {
+			t.Errorf("partition 1 is at %d-%d instead of %d-%d", p.Start, p.End, start, end)
+		}
+		b := make([]byte, len(contents))
+		if _, err := f.ReadAt(b, int64(start)*512); err != nil {
+			t.Fatalf("error reading contents: %v", err)
+		}
+		if !bytes.Equal(b, contents) {
+			t.Errorf("contents at sector %d differ from those written", start)
+		}
+	}
+
+	t.Run("forward", func(t *testing.T) {
+		var calls int
+		var copied, total int64
+		progress := func(c, tot int64) { calls, copied, total = calls+1, c, tot }
+		if err := d.MovePartition(1, 3072*512, disk.WithChunkSize(64*1024), disk.WithProgress(progress)); err != nil {
+			t.Fatalf("unexpected error moving partition: %v", err)
+		}
+		if calls != 16 || copied != int64(len(contents)) || total != int64(len(contents)) {
+			t.Errorf("progress called %d times, last with %d of %d", calls, copied, total)
+		}
+		check(3072, 5119)
+	})
+	t.Run("backward", func(t *testing.T) {
+		if err := d.MovePartition(1, 2560*512, disk.WithChunkSize(100*512)); err != nil {
+			t.Fatalf("unexpected error moving partition: %v", err)
+		}
+		check(2560, 4607)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		tests := []struct {
+			start int64
+			err   string
+		}{
+			{7168 * 512, "cannot move or resize partition 1: partition 2: overlaps partition 1"},
+			{20000 * 512, "cannot move or resize partition 1: partition 1: ends at sector 22047"},
+			{2560*512 + 100, "start 1310820 and size 1048576 must be multiples of the logical sector size 512"},
+		}
+		for _, tt := range tests {
+			err := d.MovePartition(1, tt.start)
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+				t.Errorf("move to %d returned error %v instead of %s", tt.start, err, tt.err)
+			}
+		}
+		if err := d.MovePartition(3, 0); err == nil || err.Error() != "partition 3 does not exist" {
+			t.Errorf("returned error %v for a missing partition", err)
+		}
+		if err := d.MovePartition(1, 2048*512, disk.WithChunkSize(0)); err == nil || err.Error() != "chunk size must be positive, not 0" {
+			t.Errorf("returned error %v for chunk size 0", err)
+		}
+		check(2560, 4607)
+	})
+	t.Run("resize", func(t *testing.T) {
+		if err := d.ResizePartition(1, 5632*512); err != nil {
+			t.Fatalf("unexpected error resizing partition: %v", err)
+		}
+		check(2560, 8191)
+		if err := d.ResizePartition(1, 5633*512); err == nil || !strings.Contains(err.Error(), "overlaps partition 1") {
+			t.Errorf("returned error %v for overlapping resize", err)
+		}
+		if err := d.ResizePartition(1, 2048*512); err != nil {
+			t.Fatalf("unexpected error resizing partition: %v", err)
+		}
+		check(2560, 4607)
+	})
+	t.Run("by selector", func(t *testing.T) {
+		if err := d.MovePartitionBy(disk.ByName("one"), 3072*512); err != nil {
+			t.Fatalf("unexpected error moving partition: %v", err)
+		}
+		check(3072, 5119)
+		if err := d.ResizePartitionBy(disk.ByName("one"), 4096*512); err != nil {
+			t.Fatalf("unexpected error resizing partition: %v", err)
+		}
+		check(3072, 7167)
+		if err := d.ResizePartitionBy(disk.ByName("one"), 2048*512); err != nil {
+			t.Fatalf("unexpected error resizing partition: %v", err)
+		}
+		if err := d.MovePartitionBy(disk.ByName("one"), 2560*512); err != nil {
+			t.Fatalf("unexpected error moving partition: %v", err)
+		}
+		check(2560, 4607)
+		if err := d.MovePartitionBy(disk.ByName("missing"), 2048*512); err == nil || err.Error() != `no partition has name "missing"` {
+			t.Errorf("returned error %v moving a missing partition", err)
+		}
+		if err := d.ResizePartitionBy(disk.ByName("missing"), 2048*512); err == nil || err.Error() != `no partition has name "missing"` {
+			t.Errorf("returned error %v resizing a missing partition", err)
+		}
+	})
+	t.Run("failed copy", func(t *testing.T) {
+		d.File = failingFile{File: f, failAt: 5120*512 + 64*1024}
+		defer func() { d.File = f }()
+		if err := d.MovePartition(1, 5120*512, disk.WithChunkSize(64*1024)); err == nil || !strings.Contains(err.Error(), "injected write failure") {
+			t.Fatalf("returned error %v instead of the write failure", err)
+		}
+		// the table of the Disk still matches the one on disk
+		if p := d.Table.(*gpt.Table).Partitions[0]; p.Start != 2560 || p.End != 4607 {
+			t.Errorf("partition 1 is at %d-%d in the table of the Disk after a failed move", p.Start, p.End)
+		}
+		check(2560, 4607)
+	})
+	t.Run("mbr", func(t *testing.T) {
+		d.Table = &mbr.Table{
+			LogicalSectorSize: 512,
+			Partitions: []*mbr.Partition{
+				{Start: 2048, Size: 8192, Type: mbr.ExtendedLBA},
+				{},
+				{},
+				{},
+				{Start: 4096, Size: 2048, Type: mbr.Linux},
+			},
+		}
+		if err := d.MovePartition(1, 4096*512); err == nil || err.Error() != "cannot move extended partition 1" {
+			t.Errorf("returned error %v moving an extended partition", err)
+		}
+		if err := d.MovePartition(5, 6144*512); err != nil {
+			t.Errorf("unexpected error moving a logical partition: %v", err)
+		}
+		read, err := mbr.Read(f, 512, 512)
+		if err != nil {
+			t.Fatalf("unexpected error reading table: %v", err)
+		}
+		if logical := read.LogicalPartitions(); len(logical) != 1 || logical[0].Start != 6144 {
+			t.Errorf("logical partitions after move: %+v", logical)
+		}
+	})
+}
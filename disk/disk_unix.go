@@ -18,7 +18,11 @@ const (
 //
 // It is done via an ioctl call with request as BLKRRPART.
 func (d *Disk) ReReadPartitionTable() error {
-	fd := d.File.Fd()
+	f, ok := d.File.(interface{ Fd() uintptr })
+	if !ok {
+		return fmt.Errorf("unable to re-read partition table: disk is not backed by an OS file")
+	}
+	fd := f.Fd()
 	_, err := unix.IoctlGetInt(int(fd), blkrrpart)
 	if err != nil {
 		return fmt.Errorf("unable to re-read partition table: %v", err)
@@ -0,0 +1,158 @@
+package disk
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/diskfs/go-diskfs/filesystem"
+	"github.com/diskfs/go-diskfs/partition/bsd"
+	"github.com/diskfs/go-diskfs/partition/gpt"
+	"github.com/diskfs/go-diskfs/partition/part"
+)
+
+// PartitionSelector selects a partition of a GPT disk by its name, partition GUID or type GUID, instead of
+// by its index. Create one with ByName(), ByGUID() or ByType().
+type PartitionSelector struct {
+	field string // what is matched, for errors
+	value string
+	match func(p *gpt.Partition) bool
+}
+
+// ByName select the partition with a GPT partition name, as /dev/disk/by-partlabel does
+func ByName(name string) PartitionSelector {
+	return PartitionSelector{
+		field: "name",
+		value: name,
+		match: func(p *gpt.Partition) bool { return p.Name == name },
+	}
+}
+
+// ByGUID select the partition with a partition GUID, as /dev/disk/by-partuuid does. Case is ignored.
+func ByGUID(guid string) PartitionSelector {
+	return PartitionSelector{
+		field: "GUID",
+		value: guid,
+		match: func(p *gpt.Partition) bool { return strings.EqualFold(p.GUID, guid) },
+	}
+}
+
+// ByType select the partition with a type GUID, e.g. gpt.EFISystemPartition. Case is ignored.
+func ByType(partitionType gpt.Type) PartitionSelector {
+	return PartitionSelector{
+		field: "type",
+		value: string(partitionType),
+		match: func(p *gpt.Partition) bool { return strings.EqualFold(string(p.Type), string(partitionType)) },
+	}
+}
+
+func (s PartitionSelector) String() string {
+	return fmt.Sprintf("%s %q", s.field, s.value)
+}
+
+// FindPartition finds the partition of a GPT disk that matches the selector, reading the partition table
+// if it has not been read yet.
+//
+// if successful, returns the index of the partition, from 1, as for the index-based methods, and the partition
+//
+// returns an error if the disk does not have a GPT, or if no partition or more than one partition matches
+func (d *Disk) FindPartition(selector PartitionSelector) (int, part.Partition, error) {
+	if selector.match == nil {
+		return -1, nil, errors.New("cannot find a partition without a selector, use ByName(), ByGUID() or ByType()")
+	}
+	if d.Table == nil {
+		if _, err := d.GetPartitionTable(); err != nil {
+			return -1, nil, fmt.Errorf("unable to read partition table: %v", err)
+		}
+	}
+	table, ok := d.Table.(*gpt.Table)
+	if !ok {
+		return -1, nil, fmt.Errorf("cannot find a partition by %s in a %s partition table, only gpt", selector.field, d.Table.Type())
+	}
+	index := -1
+	for i, p := range table.Partitions {
+		if p == nil || p.Type == gpt.Unused || !selector.match(p) {
+			continue
+		}
+		if index != -1 {
+			return -1, nil, fmt.Errorf("partitions %d and %d both have %s", index, i+1, selector)
+		}
+		index = i + 1
+	}
+	if index == -1 {
+		return -1, nil, fmt.Errorf("no partition has %s", selector)
+	}
+	return index, table.Partitions[index-1], nil
+}
+
+// WritePartitionContentsBy writes the contents of an io.Reader to the partition that matches the selector,
+// see WritePartitionContents() and FindPartition()
+func (d *Disk) WritePartitionContentsBy(selector PartitionSelector, reader io.Reader) (int64, error) {
+	index, _, err := d.FindPartition(selector)
+	if err != nil {
+		return -1, err
+	}
+	return d.WritePartitionContents(index, reader)
+}
+
+// ReadPartitionContentsBy reads the contents of the partition that matches the selector to an io.Writer,
+// see ReadPartitionContents() and FindPartition()
+func (d *Disk) ReadPartitionContentsBy(selector PartitionSelector, writer io.Writer) (int64, error) {
+	index, _, err := d.FindPartition(selector)
+	if err != nil {
+		return -1, err
+	}
+	return d.ReadPartitionContents(index, writer)
+}
+
+// CreateFilesystemBy creates a filesystem on the partition that matches the selector, see CreateFilesystem()
+// and FindPartition(). The Partition of the spec is ignored.
+func (d *Disk) CreateFilesystemBy(selector PartitionSelector, spec FilesystemSpec) (filesystem.FileSystem, error) {
+	index, _, err := d.FindPartition(selector)
+	if err != nil {
+		return nil, err
+	}
+	spec.Partition = index
+	return d.CreateFilesystem(spec)
+}
+
+// GetFilesystemBy gets the filesystem that already exists on the partition that matches the selector, see
+// GetFilesystem() and FindPartition()
+func (d *Disk) GetFilesystemBy(selector PartitionSelector) (filesystem.FileSystem, error) {
+	index, _, err := d.FindPartition(selector)
+	if err != nil {
+		return nil, err
+	}
+	return d.GetFilesystem(index)
+}
+
+// MovePartitionBy moves the partition that matches the selector to start at byte start, see MovePartition()
+// and FindPartition()
+func (d *Disk) MovePartitionBy(selector PartitionSelector, start int64, opts ...MoveOpt) error {
+	index, _, err := d.FindPartition(selector)
+	if err != nil {
+		return err
+	}
+	return d.MovePartition(index, start, opts...)
+}
+
+// ResizePartitionBy changes the size of the partition that matches the selector to size bytes, see
+// ResizePartition() and FindPartition()
+func (d *Disk) ResizePartitionBy(selector PartitionSelector, size int64) error {
+	index, _, err := d.FindPartition(selector)
+	if err != nil {
+		return err
+	}
+	return d.ResizePartition(index, size)
+}
+
+// GetDisklabelBy reads the BSD disklabel nested inside the partition that matches the selector, see
+// GetDisklabel() and FindPartition()
+func (d *Disk) GetDisklabelBy(selector PartitionSelector) (*bsd.Table, error) {
+	index, _, err := d.FindPartition(selector)
+	if err != nil {
+		return nil, err
+	}
+	return d.GetDisklabel(index)
+}
@@ -0,0 +1,194 @@
+package disk
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/diskfs/go-diskfs/partition/gpt"
+	"github.com/diskfs/go-diskfs/partition/mbr"
+	"github.com/diskfs/go-diskfs/util"
+)
+
+// defaultMoveChunkSize how much of the contents of a partition is copied at a time when it moves
+const defaultMoveChunkSize = 1024 * 1024
+
+type moveOpts struct {
+	chunkSize int64
+	progress  func(copied, total int64)
+}
+
+// MoveOpt func that process MovePartition options
+type MoveOpt func(o *moveOpts) error
+
+// WithChunkSize copy the contents of a moving partition size bytes at a time, instead of 1MiB
+func WithChunkSize(size int64) MoveOpt {
+	return func(o *moveOpts) error {
+		if size <= 0 {
+			return fmt.Errorf("chunk size must be positive, not %d", size)
+		}
+		o.chunkSize = size
+		return nil
+	}
+}
+
+// WithProgress call progress after each chunk of the contents of a moving partition is copied, with the
+// bytes copied so far and the total to copy
+func WithProgress(progress func(copied, total int64)) MoveOpt {
+	return func(o *moveOpts) error {
+		o.progress = progress
+		return nil
+	}
+}
+
+// MovePartition moves a partition of the Disk to start at byte start, copying its contents along with it,
+// and then rewrites the partition table. Partitions are numbered from 1, as for GetFilesystem(). The
+// contents are copied in chunks, from the end when the partition moves to a later overlapping location,
+// so overlapping moves are safe.
+//
+// The copy is not atomic: if it is interrupted, part of the contents may be at the new location while
+// the table still points to the old one. If the copy fails, the partition is restored to its old location
+// in the Table of the Disk, to match the table on disk, but an overlapping move cut short leaves the
+// contents partly moved, with neither copy complete.
+//
+// returns an error, without changing anything, if the partition would overlap another one or lie outside
+// the usable area of the disk, or start is not a multiple of the logical sector size. The extended
+// partition of an MBR, with the logical partitions inside it, cannot be moved.
+func (d *Disk) MovePartition(partition int, start int64, opts ...MoveOpt) error {
+	opt := &moveOpts{chunkSize: defaultMoveChunkSize}
+	for _, o := range opts {
+		if err := o(opt); err != nil {
+			return err
+		}
+	}
+	oldStart, size, restore, err := d.relocatePartition(partition, start, -1)
+	if err != nil {
+		return err
+	}
+	if start != oldStart {
+		if err := copyRange(d.File, oldStart, start, size, opt); err != nil {
+			restore()
+			return fmt.Errorf("error moving contents of partition %d: %v", partition, err)
+		}
+	}
+	return d.Partition(d.Table)
+}
+
+// ResizePartition changes the size of a partition of the Disk to size bytes, keeping its start, and then
+// rewrites the partition table. The contents of the partition stay where they are; a filesystem in it
+// is not resized.
+//
+// returns an error, without changing anything, if the partition would overlap another one or lie outside
+// the usable area of the disk, or size is not a multiple of the logical sector size
+func (d *Disk) ResizePartition(partition int, size int64) error {
+	if _, _, _, err := d.relocatePartition(partition, -1, size); err != nil {
+		return err
+	}
+	return d.Partition(d.Table)
+}
+
+// relocatePartition change the start and size in bytes of a partition in the table of the Disk, keeping
+// either one when it is -1, and verify the table. If the table has problems, the partition is restored.
+//
+// returns the original start, the size that is kept when moving, and a func that restores the partition
+// to its original location, for when it cannot be moved after all
+func (d *Disk) relocatePartition(partition int, start, size int64) (oldStart, keptSize int64, restore func(), err error) {
+	if err := d.ensureTable(); err != nil {
+		return -1, -1, nil, err
+	}
+	var sectorSize int64
+	switch table := d.Table.(type) {
+	case *gpt.Table:
+		if partition < 1 || partition > len(table.Partitions) || table.Partitions[partition-1].Type == gpt.Unused {
+			return -1, -1, nil, fmt.Errorf("partition %d does not exist", partition)
+		}
+		p := table.Partitions[partition-1]
+		sectorSize = int64(table.LogicalSectorSize)
+		oldStart, keptSize = int64(p.Start)*sectorSize, int64(p.End-p.Start+1)*sectorSize
+		saved := *p
+		restore = func() { *p = saved }
+		if start, size, err = newLocation(start, size, oldStart, keptSize, sectorSize); err != nil {
+			return -1, -1, nil, err
+		}
+		p.Start = uint64(start / sectorSize)
+		p.End = uint64((start+size)/sectorSize) - 1
+		p.Size = uint64(size)
+	case *mbr.Table:
+		if partition < 1 || partition > len(table.Partitions) || table.Partitions[partition-1].Type == mbr.Empty {
+			return -1, -1, nil, fmt.Errorf("partition %d does not exist", partition)
+		}
+		p := table.Partitions[partition-1]
+		sectorSize = int64(table.LogicalSectorSize)
+		oldStart, keptSize = int64(p.Start)*sectorSize, int64(p.Size)*sectorSize
+		if start >= 0 && start != oldStart && (p.Type == mbr.ExtendedCHS || p.Type == mbr.ExtendedLBA || p.Type == mbr.LinuxExtended) {
+			return -1, -1, nil, fmt.Errorf("cannot move extended partition %d", partition)
+		}
+		saved := *p
+		restore = func() { *p = saved }
+		if start, size, err = newLocation(start, size, oldStart, keptSize, sectorSize); err != nil {
+			return -1, -1, nil, err
+		}
+		if (start+size)/sectorSize > 1<<32 {
+			return -1, -1, nil, fmt.Errorf("partition %d would end beyond what an MBR can address", partition)
+		}
+		p.Start = uint32(start / sectorSize)
+		p.Size = uint32(size / sectorSize)
+	default:
+		return -1, -1, nil, fmt.Errorf("cannot move or resize a partition in a %s partition table, only gpt or mbr", d.Table.Type())
+	}
+	if v, ok := d.Table.(verifiableTable); ok {
+		if problems := v.Verify(d.Size); len(problems) > 0 {
+			restore()
+			descriptions := make([]string, 0, len(problems))
+			for _, p := range problems {
+				descriptions = append(descriptions, p.String())
+			}
+			return -1, -1, nil, fmt.Errorf("cannot move or resize partition %d: %s", partition, strings.Join(descriptions, "; "))
+		}
+	}
+	return oldStart, keptSize, restore, nil
+}
+
+// newLocation the start and size in bytes of a partition, keeping the current one for a value of -1
+func newLocation(start, size, currentStart, currentSize, sectorSize int64) (newStart, newSize int64, err error) {
+	if start < 0 {
+		start = currentStart
+	}
+	if size < 0 {
+		size = currentSize
+	}
+	if start%sectorSize != 0 || size%sectorSize != 0 {
+		return -1, -1, fmt.Errorf("start %d and size %d must be multiples of the logical sector size %d", start, size, sectorSize)
+	}
+	if size == 0 {
+		return -1, -1, fmt.Errorf("size must be positive")
+	}
+	return start, size, nil
+}
+
+// copyRange copy length bytes of f from src to dst in chunks, from the end if dst is inside the source
+// range, so that overlapping ranges are copied safely
+func copyRange(f util.File, src, dst, length int64, opt *moveOpts) error {
+	backwards := dst > src && dst < src+length
+	buf := make([]byte, opt.chunkSize)
+	for copied := int64(0); copied < length; {
+		n := length - copied
+		if n > opt.chunkSize {
+			n = opt.chunkSize
+		}
+		offset := copied
+		if backwards {
+			offset = length - copied - n
+		}
+		if _, err := f.ReadAt(buf[:n], src+offset); err != nil {
+			return fmt.Errorf("error reading %d bytes at %d: %v", n, src+offset, err)
+		}
+		if _, err := f.WriteAt(buf[:n], dst+offset); err != nil {
+			return fmt.Errorf("error writing %d bytes at %d: %v", n, dst+offset, err)
+		}
+		copied += n
+		if opt.progress != nil {
+			opt.progress(copied, length)
+		}
+	}
+	return nil
+}
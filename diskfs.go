@@ -105,11 +105,17 @@ package diskfs
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/diskfs/go-diskfs/disk"
+	"github.com/diskfs/go-diskfs/image/qcow2"
+	"github.com/diskfs/go-diskfs/image/vhd"
+	"github.com/diskfs/go-diskfs/image/vhdx"
+	"github.com/diskfs/go-diskfs/image/vmdk"
+	"github.com/diskfs/go-diskfs/util"
 )
 
 // when we use a disk image with a GPT, we cannot get the logical sector size from the disk via the kernel
@@ -128,13 +134,28 @@ type Format int
 const (
 	// Raw disk format for basic raw disk
 	Raw Format = iota
+	// Qcow2 QEMU copy-on-write version 2 image format, see github.com/diskfs/go-diskfs/image/qcow2
+	Qcow2
+	// VHD fixed Microsoft Virtual Hard Disk, as accepted by Azure, see github.com/diskfs/go-diskfs/image/vhd.
+	// Azure requires the size to be a multiple of 1 MiB, and Create returns an error for any other size.
+	VHD
+	// VHDDynamic dynamically allocated Microsoft Virtual Hard Disk
+	VHDDynamic
+	// VHDX fixed Hyper-V VHDX image, see github.com/diskfs/go-diskfs/image/vhdx
+	VHDX
+	// VHDXDynamic dynamically allocated Hyper-V VHDX image
+	VHDXDynamic
+	// VMDK monolithicSparse VMware image, see github.com/diskfs/go-diskfs/image/vmdk.
+	// Use vmdk.ExportStreamOptimized to produce a streamOptimized image for OVA packages.
+	VMDK
 )
 
 // OpenModeOption represents file open modes
 type OpenModeOption int
 
 const (
-	// ReadOnly open file in read only mode
+	// ReadOnly open file in read only mode. Access is shared, i.e. not exclusive, so disks and images in use
+	// by another process can be inspected. The Disk is not writable, and filesystems on it are read-only.
 	ReadOnly OpenModeOption = iota
 	// ReadWriteExclusive open file in read-write exclusive mode
 	ReadWriteExclusive
@@ -180,8 +201,49 @@ func writableMode(mode OpenModeOption) bool {
 	return false
 }
 
+// image is a disk image format that presents a virtual disk of its own size
+type image interface {
+	util.File
+	Size() int64
+}
+
+// openImage detects a known disk image format in a regular file.
+// Returns nil if the file is not in a known image format, i.e. it is a raw disk image.
+func openImage(f *os.File) (image, error) {
+	switch {
+	case qcow2.IsQcow2(f):
+		img, err := qcow2.Open(f)
+		if err != nil {
+			return nil, fmt.Errorf("could not open qcow2 image %s: %v", f.Name(), err)
+		}
+		return img, nil
+	case vhdx.IsVHDX(f):
+		img, err := vhdx.Open(f)
+		if err != nil {
+			return nil, fmt.Errorf("could not open VHDX image %s: %v", f.Name(), err)
+		}
+		return img, nil
+	case vmdk.IsVMDK(f):
+		img, err := vmdk.Open(f)
+		if err != nil {
+			return nil, fmt.Errorf("could not open VMDK image %s: %v", f.Name(), err)
+		}
+		return img, nil
+	case vhd.IsVHD(f):
+		// checked last, as the VHD footer is at the end of the file, where any other format could have data
+		img, err := vhd.Open(f)
+		if err != nil {
+			return nil, fmt.Errorf("could not open VHD image %s: %v", f.Name(), err)
+		}
+		return img, nil
+	}
+	return nil, nil
+}
+
 func initDisk(f *os.File, openMode OpenModeOption, sectorSize SectorSize) (*disk.Disk, error) {
 	var (
+		backend       util.File = f
+		closer        io.Closer
 		diskType      disk.Type
 		size          int64
 		lblksize      = int64(defaultBlocksize)
@@ -206,6 +268,20 @@ func initDisk(f *os.File, openMode OpenModeOption, sectorSize SectorSize) (*disk
 		log.Debug("initDisk(): regular file")
 		diskType = disk.File
 		size = devInfo.Size()
+		img, err := openImage(f)
+		if err != nil {
+			return nil, err
+		}
+		if img != nil {
+			backend = img
+			closer = f
+			size = img.Size()
+			// images that record the sector size of their virtual disk
+			if sized, ok := img.(interface{ LogicalSectorSize() int64 }); ok && sectorSize == SectorSizeDefault {
+				lblksize = sized.LogicalSectorSize()
+				pblksize = lblksize
+			}
+		}
 		if size <= 0 {
 			return nil, fmt.Errorf("could not get file size for device %s", f.Name())
 		}
@@ -232,8 +308,9 @@ func initDisk(f *os.File, openMode OpenModeOption, sectorSize SectorSize) (*disk
 
 	writable := writableMode(openMode)
 
-	ret := &disk.Disk{
-		File:              f,
+	return newDisk(&disk.Disk{
+		File:              backend,
+		Closer:            closer,
 		Info:              devInfo,
 		Type:              diskType,
 		Size:              size,
@@ -241,16 +318,19 @@ func initDisk(f *os.File, openMode OpenModeOption, sectorSize SectorSize) (*disk
 		PhysicalBlocksize: pblksize,
 		Writable:          writable,
 		DefaultBlocks:     defaultBlocks,
-	}
+	}), nil
+}
 
+// newDisk completes the initialization of a Disk by reading its partition table
+func newDisk(d *disk.Disk) *disk.Disk {
 	// try to initialize the partition table.
 	// we ignore errors, because it is perfectly fine to open a disk
 	// and use it before it has a partition table. This is solely
 	// a convenience.
-	if table, err := ret.GetPartitionTable(); err == nil && table != nil {
-		ret.Table = table
+	if table, err := d.GetPartitionTable(); err == nil && table != nil {
+		d.Table = table
 	}
-	return ret, nil
+	return d
 }
 
 func checkDevice(device string) error {
@@ -301,6 +381,7 @@ func WithSectorSize(sectorSize SectorSize) OpenOpt {
 // Should pass a path to a block device e.g. /dev/sda or a path to a file /tmp/foo.img
 // The provided device must exist at the time you call Open().
 // Use OpenOpt to control options, such as sector size or open mode.
+// Call Close() on the returned Disk to release the device, and any backing files of an image.
 func Open(device string, opts ...OpenOpt) (*disk.Disk, error) {
 	err := checkDevice(device)
 	if err != nil {
@@ -321,15 +402,66 @@ func Open(device string, opts ...OpenOpt) (*disk.Disk, error) {
 
 	f, err := os.OpenFile(device, m, 0o600)
 	if err != nil {
-		return nil, fmt.Errorf("could not open device %s exclusively for writing", device)
+		return nil, fmt.Errorf("could not open device %s %s: %v", device, opt.mode, errors.Unwrap(err))
 	}
 	// return our disk
-	return initDisk(f, ReadWriteExclusive, opt.sectorSize)
+	return initDisk(f, opt.mode, opt.sectorSize)
+}
+
+// OpenBackend creates a Disk from any util.File, rather than a path: an in-memory buffer, a network-backed
+// implementation, an image format opened with one of the github.com/diskfs/go-diskfs/image packages, or
+// a plain io.ReaderAt wrapped with util.NewReadOnlyFile.
+//
+// size is the size of the disk in bytes. If it is 0, it is found by seeking to the end of the backend.
+//
+// The backend is used as-is: image formats are not detected, and there is no device to query for the sector
+// size, so it comes from WithSectorSize, defaulting to 512. WithOpenMode determines whether the Disk is writable.
+// Close() on the returned Disk closes the backend if it is an io.Closer.
+func OpenBackend(backend util.File, size int64, opts ...OpenOpt) (*disk.Disk, error) {
+	if backend == nil {
+		return nil, errors.New("must pass a backend")
+	}
+	opt := openOptsDefaults()
+	for _, o := range opts {
+		if err := o(opt); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := openModeOptions[opt.mode]; !ok {
+		return nil, errors.New("unsupported file open mode")
+	}
+	if size == 0 {
+		end, err := backend.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, fmt.Errorf("could not get size of backend: %v", err)
+		}
+		size = end
+	}
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid disk size %d", size)
+	}
+	blksize := int64(defaultBlocksize)
+	if opt.sectorSize != SectorSizeDefault {
+		blksize = int64(opt.sectorSize)
+	}
+	return newDisk(&disk.Disk{
+		File:              backend,
+		Type:              disk.File,
+		Size:              size,
+		LogicalBlocksize:  blksize,
+		PhysicalBlocksize: blksize,
+		Writable:          writableMode(opt.mode),
+		DefaultBlocks:     opt.sectorSize == SectorSizeDefault,
+	}), nil
 }
 
 // Create a Disk from a path to a device
 // Should pass a path to a block device e.g. /dev/sda or a path to a file /tmp/foo.img
 // The provided device must not exist at the time you call Create()
+//
+// The format determines how the disk is stored in the file: Raw stores the disk as-is, while image
+// formats such as Qcow2, VHD, VHDX and VMDK create an image with a virtual disk of the given size.
+// Call Close() on the returned Disk when done with it.
 func Create(device string, size int64, format Format, sectorSize SectorSize) (*disk.Disk, error) {
 	if device == "" {
 		return nil, errors.New("must pass device name")
@@ -337,13 +469,41 @@ func Create(device string, size int64, format Format, sectorSize SectorSize) (*d
 	if size <= 0 {
 		return nil, errors.New("must pass valid device size to create")
 	}
+	switch format {
+	case Raw, Qcow2, VHD, VHDDynamic, VHDX, VHDXDynamic, VMDK:
+	default:
+		return nil, fmt.Errorf("unsupported disk format %d", format)
+	}
 	f, err := os.OpenFile(device, os.O_RDWR|os.O_EXCL|os.O_CREATE, 0o666)
 	if err != nil {
 		return nil, fmt.Errorf("could not create device %s: %v", device, errors.Unwrap(err))
 	}
-	err = os.Truncate(device, size)
-	if err != nil {
-		return nil, fmt.Errorf("could not expand device %s to size %d: %v", device, size, errors.Unwrap(err))
+	switch format {
+	case Raw:
+		err = os.Truncate(device, size)
+		if err != nil {
+			return nil, fmt.Errorf("could not expand device %s to size %d: %v", device, size, errors.Unwrap(err))
+		}
+	case Qcow2:
+		if _, err := qcow2.Create(f, size, ""); err != nil {
+			return nil, fmt.Errorf("could not create qcow2 image %s: %v", device, err)
+		}
+	case VHD, VHDDynamic:
+		diskType := vhd.DiskTypeFixed
+		if format == VHDDynamic {
+			diskType = vhd.DiskTypeDynamic
+		}
+		if _, err := vhd.Create(f, size, diskType); err != nil {
+			return nil, fmt.Errorf("could not create VHD image %s: %v", device, err)
+		}
+	case VHDX, VHDXDynamic:
+		if _, err := vhdx.Create(f, size, format == VHDX, int64(sectorSize)); err != nil {
+			return nil, fmt.Errorf("could not create VHDX image %s: %v", device, err)
+		}
+	case VMDK:
+		if _, err := vmdk.Create(f, size); err != nil {
+			return nil, fmt.Errorf("could not create VMDK image %s: %v", device, err)
+		}
 	}
 	// return our disk
 	return initDisk(f, ReadWriteExclusive, sectorSize)
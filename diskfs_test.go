@@ -1,8 +1,10 @@
 package diskfs_test
 
 import (
+	"bytes"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -11,6 +13,11 @@ import (
 
 	diskfs "github.com/diskfs/go-diskfs"
 	"github.com/diskfs/go-diskfs/disk"
+	"github.com/diskfs/go-diskfs/filesystem"
+	"github.com/diskfs/go-diskfs/image/qcow2"
+	"github.com/diskfs/go-diskfs/partition/gpt"
+	"github.com/diskfs/go-diskfs/testhelper"
+	"github.com/diskfs/go-diskfs/util"
 )
 
 const oneMB = 10 * 1024 * 1024
@@ -113,6 +120,13 @@ func TestCreate(t *testing.T) {
 		{"10MB with default sector size", "disk", 10 * oneMB, diskfs.Raw, diskfs.SectorSizeDefault, &disk.Disk{LogicalBlocksize: 512, PhysicalBlocksize: 512, Size: 10 * oneMB, Type: disk.File}, nil},
 		{"10MB with 512 sector size", "disk", 10 * oneMB, diskfs.Raw, diskfs.SectorSize512, &disk.Disk{LogicalBlocksize: 512, PhysicalBlocksize: 512, Size: 10 * oneMB, Type: disk.File}, nil},
 		{"10MB with 2048 sector size", "disk", 10 * oneMB, diskfs.Raw, diskfs.SectorSize4k, &disk.Disk{LogicalBlocksize: 4096, PhysicalBlocksize: 4096, Size: 10 * oneMB, Type: disk.File}, nil},
+		{"10MB qcow2", "disk", 10 * oneMB, diskfs.Qcow2, diskfs.SectorSizeDefault, &disk.Disk{LogicalBlocksize: 512, PhysicalBlocksize: 512, Size: 10 * oneMB, Type: disk.File}, nil},
+		{"10MB vhd", "disk", 10 * oneMB, diskfs.VHD, diskfs.SectorSizeDefault, &disk.Disk{LogicalBlocksize: 512, PhysicalBlocksize: 512, Size: 10 * oneMB, Type: disk.File}, nil},
+		{"10MB vhdx with 4k sector size", "disk", 10 * oneMB, diskfs.VHDXDynamic, diskfs.SectorSize4k, &disk.Disk{LogicalBlocksize: 4096, PhysicalBlocksize: 4096, Size: 10 * oneMB, Type: disk.File}, nil},
+		{"10MB vmdk", "disk", 10 * oneMB, diskfs.VMDK, diskfs.SectorSizeDefault, &disk.Disk{LogicalBlocksize: 512, PhysicalBlocksize: 512, Size: 10 * oneMB, Type: disk.File}, nil},
+		{"vhd with invalid size", "disk", 10*oneMB + 1, diskfs.VHD, diskfs.SectorSizeDefault, nil, fmt.Errorf("could not create VHD image")},
+		{"vhd with size not a multiple of 1 MiB", "disk", 10*oneMB + 512, diskfs.VHD, diskfs.SectorSizeDefault, nil, fmt.Errorf("could not create VHD image")},
+		{"unknown format", "disk", 10 * oneMB, diskfs.Format(-1), diskfs.SectorSizeDefault, nil, fmt.Errorf("unsupported disk format")},
 	}
 
 	for i, tt := range tests {
@@ -136,3 +150,226 @@ func testTmpFilename(t *testing.T, prefix, suffix string) string {
 	_, _ = rand.Read(randBytes)
 	return filepath.Join(os.TempDir(), prefix+hex.EncodeToString(randBytes)+suffix)
 }
+
+func TestImageFormats(t *testing.T) {
+	tests := []struct {
+		name   string
+		format diskfs.Format
+		sparse bool // whether the image file is smaller than the virtual disk
+	}{
+		{"qcow2", diskfs.Qcow2, true},
+		{"vhd", diskfs.VHD, false},
+		{"vhd dynamic", diskfs.VHDDynamic, true},
+		{"vhdx", diskfs.VHDX, false},
+		{"vhdx dynamic", diskfs.VHDXDynamic, true},
+		{"vmdk", diskfs.VMDK, true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			filename := testTmpFilename(t, "diskfs_test", ".img")
+			defer os.RemoveAll(filename)
+			size := int64(100 * oneMB)
+			d, err := diskfs.Create(filename, size, tt.format, diskfs.SectorSizeDefault)
+			if err != nil {
+				t.Fatalf("unexpected error creating %s disk: %v", tt.name, err)
+			}
+			table := &gpt.Table{
+				Partitions: []*gpt.Partition{
+					{Start: 2048, End: 20479, Type: gpt.EFISystemPartition, Name: "EFI System"},
+				},
+				LogicalSectorSize: 512,
+				ProtectiveMBR:     true,
+			}
+			if err := d.Partition(table); err != nil {
+				t.Fatalf("unexpected error partitioning %s disk: %v", tt.name, err)
+			}
+			fs, err := d.CreateFilesystem(disk.FilesystemSpec{Partition: 1, FSType: filesystem.TypeFat32, VolumeLabel: "IMAGE"})
+			if err != nil {
+				t.Fatalf("unexpected error creating filesystem: %v", err)
+			}
+			if err := fs.Mkdir("/EFI/BOOT"); err != nil {
+				t.Fatalf("unexpected error making directory: %v", err)
+			}
+
+			// sparse formats only hold what was written
+			info, err := os.Stat(filename)
+			if err != nil {
+				t.Fatalf("unable to stat image: %v", err)
+			}
+			if tt.sparse && info.Size() >= size {
+				t.Errorf("%s image is %d bytes, not smaller than its virtual size %d", tt.name, info.Size(), size)
+			}
+			if !tt.sparse && info.Size() <= size {
+				t.Errorf("%s image is %d bytes, not larger than its virtual size %d", tt.name, info.Size(), size)
+			}
+
+			// reopen, and find the same partition table and filesystem
+			d2, err := diskfs.Open(filename, diskfs.WithOpenMode(diskfs.ReadOnly))
+			if err != nil {
+				t.Fatalf("unexpected error opening %s disk: %v", tt.name, err)
+			}
+			if d2.Size != size {
+				t.Errorf("mismatched size, actual %d expected %d", d2.Size, size)
+			}
+			if d2.Table == nil || d2.Table.Type() != "gpt" {
+				t.Fatalf("did not find gpt partition table in %s disk", tt.name)
+			}
+			fs2, err := d2.GetFilesystem(1)
+			if err != nil {
+				t.Fatalf("unexpected error reading filesystem: %v", err)
+			}
+			if _, err := fs2.ReadDir("/EFI/BOOT"); err != nil {
+				t.Errorf("unexpected error reading directory: %v", err)
+			}
+		})
+	}
+}
+
+func TestOpenBackend(t *testing.T) {
+	size := int64(20 * 1024 * 1024)
+	buf := make([]byte, size)
+	mem := &testhelper.FileImpl{
+		Reader: func(b []byte, offset int64) (int, error) {
+			return copy(b, buf[offset:]), nil
+		},
+		Writer: func(b []byte, offset int64) (int, error) {
+			return copy(buf[offset:], b), nil
+		},
+	}
+
+	if _, err := diskfs.OpenBackend(nil, size); err == nil {
+		t.Errorf("nil backend did not return an error")
+	}
+	if _, err := diskfs.OpenBackend(mem, -1); err == nil {
+		t.Errorf("invalid size did not return an error")
+	}
+
+	d, err := diskfs.OpenBackend(mem, size)
+	if err != nil {
+		t.Fatalf("unexpected error opening in-memory disk: %v", err)
+	}
+	if d.Size != size || d.LogicalBlocksize != 512 || !d.Writable || d.Type != disk.File {
+		t.Errorf("unexpected disk %#v", d)
+	}
+	table := &gpt.Table{
+		Partitions: []*gpt.Partition{
+			{Start: 2048, End: 20479, Type: gpt.EFISystemPartition, Name: "EFI System"},
+		},
+		LogicalSectorSize: 512,
+		ProtectiveMBR:     true,
+	}
+	if err := d.Partition(table); err != nil {
+		t.Fatalf("unexpected error partitioning in-memory disk: %v", err)
+	}
+	fs, err := d.CreateFilesystem(disk.FilesystemSpec{Partition: 1, FSType: filesystem.TypeFat32, VolumeLabel: "MEMORY"})
+	if err != nil {
+		t.Fatalf("unexpected error creating filesystem: %v", err)
+	}
+	if err := fs.Mkdir("/EFI/BOOT"); err != nil {
+		t.Fatalf("unexpected error making directory: %v", err)
+	}
+
+	// a plain io.ReaderAt, with the size found from it
+	ro, err := diskfs.OpenBackend(util.NewReadOnlyFile(bytes.NewReader(buf), size), 0, diskfs.WithOpenMode(diskfs.ReadOnly))
+	if err != nil {
+		t.Fatalf("unexpected error opening read-only disk: %v", err)
+	}
+	if ro.Size != size {
+		t.Errorf("mismatched size, actual %d expected %d", ro.Size, size)
+	}
+	if ro.Writable {
+		t.Errorf("read-only disk is writable")
+	}
+	if ro.Table == nil || ro.Table.Type() != "gpt" {
+		t.Fatalf("did not find gpt partition table in read-only disk")
+	}
+	fs2, err := ro.GetFilesystem(1)
+	if err != nil {
+		t.Fatalf("unexpected error reading filesystem: %v", err)
+	}
+	if _, err := fs2.ReadDir("/EFI/BOOT"); err != nil {
+		t.Errorf("unexpected error reading directory: %v", err)
+	}
+	if err := ro.Partition(table); err == nil {
+		t.Errorf("partitioning a read-only disk did not return an error")
+	}
+}
+
+func TestOpenReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "disk.img")
+	d, err := diskfs.Create(path, 20*1024*1024, diskfs.Raw, diskfs.SectorSizeDefault)
+	if err != nil {
+		t.Fatalf("unexpected error creating disk: %v", err)
+	}
+	if _, err := d.CreateFilesystem(disk.FilesystemSpec{Partition: 0, FSType: filesystem.TypeFat32}); err != nil {
+		t.Fatalf("unexpected error creating filesystem: %v", err)
+	}
+
+	// the disk is still held open for writing, and can be inspected with shared access
+	ro, err := diskfs.Open(path, diskfs.WithOpenMode(diskfs.ReadOnly))
+	if err != nil {
+		t.Fatalf("unexpected error opening disk read-only: %v", err)
+	}
+	if ro.Writable {
+		t.Errorf("disk opened read-only is writable")
+	}
+	fs, err := ro.GetFilesystem(0)
+	if err != nil {
+		t.Fatalf("unexpected error reading filesystem: %v", err)
+	}
+	if _, err := fs.ReadDir("/"); err != nil {
+		t.Errorf("unexpected error reading directory: %v", err)
+	}
+	if err := fs.Mkdir("/foo"); !errors.Is(err, filesystem.ErrReadOnlyFilesystem) {
+		t.Errorf("Mkdir returned %v instead of %v", err, filesystem.ErrReadOnlyFilesystem)
+	}
+
+	rw, err := diskfs.Open(path)
+	if err != nil {
+		t.Fatalf("unexpected error opening disk: %v", err)
+	}
+	if !rw.Writable {
+		t.Errorf("disk opened with default mode is not writable")
+	}
+}
+
+func TestClose(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "base.img"), make([]byte, 10*1024*1024), 0o600); err != nil {
+		t.Fatalf("unable to write backing file: %v", err)
+	}
+	f, err := os.Create(filepath.Join(dir, "overlay.qcow2"))
+	if err != nil {
+		t.Fatalf("unable to create image file: %v", err)
+	}
+	img, err := qcow2.Create(f, 10*1024*1024, "base.img")
+	if err != nil {
+		t.Fatalf("unexpected error creating image: %v", err)
+	}
+	_ = img.Close()
+	_ = f.Close()
+
+	// the image and its backing file are both open until the disk is closed
+	fds, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skipf("cannot count open files: %v", err)
+	}
+	d, err := diskfs.Open(f.Name(), diskfs.WithOpenMode(diskfs.ReadOnly))
+	if err != nil {
+		t.Fatalf("unexpected error opening disk: %v", err)
+	}
+	if _, ok := d.File.(*qcow2.Image); !ok {
+		t.Fatalf("disk backend is %T instead of *qcow2.Image", d.File)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatalf("unexpected error closing disk: %v", err)
+	}
+	after, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Fatalf("cannot count open files: %v", err)
+	}
+	if len(after) != len(fds) {
+		t.Errorf("%d files open after closing the disk instead of %d", len(after), len(fds))
+	}
+}
@@ -0,0 +1,28 @@
+package exfat
+
+// bitmap the allocation bitmap, with a bit set for every cluster in use, starting with cluster 2
+type bitmap struct {
+	bits         []byte
+	firstCluster uint32
+}
+
+// bitmapSize the size in bytes of the allocation bitmap of a number of clusters
+func bitmapSize(clusterCount uint32) uint64 {
+	return (uint64(clusterCount) + 7) / 8
+}
+
+// isAllocated if a cluster is in use
+func (b *bitmap) isAllocated(cluster uint32) bool {
+	i := cluster - 2
+	return b.bits[i/8]&(1<<(i%8)) != 0
+}
+
+// set mark a cluster as in use or free
+func (b *bitmap) set(cluster uint32, allocated bool) {
+	i := cluster - 2
+	if allocated {
+		b.bits[i/8] |= 1 << (i % 8)
+	} else {
+		b.bits[i/8] &^= 1 << (i % 8)
+	}
+}
@@ -0,0 +1,202 @@
+package exfat
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	fileSystemName        = "EXFAT   "
+	fileSystemRevision    = 0x0100
+	bootSignature         = 0xaa55
+	extendedBootSignature = 0xaa550000
+	// the main and backup boot regions are 12 sectors each: the boot sector, 8 extended boot sectors,
+	// the OEM parameters, a reserved sector and the checksum sector
+	bootRegionSectors   = 12
+	bootChecksumSector  = 11
+	minBytesPerSectorSh = 9
+	maxBytesPerSectorSh = 12
+	// the largest cluster exFAT allows, 32MB
+	maxClusterShift = 25
+	// volume flags
+	volumeFlagActiveFat   = 0x1
+	volumeFlagVolumeDirty = 0x2
+	// percent in use when it is not known
+	percentInUseUnknown = 0xff
+)
+
+// bootSector the exFAT Main Boot Sector, the first sector of the boot region
+type bootSector struct {
+	partitionOffset             uint64 // PartitionOffset sectors from the start of the media to the volume, or 0 to ignore
+	volumeLength                uint64 // VolumeLength size of the volume in sectors
+	fatOffset                   uint32 // FatOffset sectors from the start of the volume to the first FAT
+	fatLength                   uint32 // FatLength sectors in each FAT
+	clusterHeapOffset           uint32 // ClusterHeapOffset sectors from the start of the volume to cluster 2
+	clusterCount                uint32 // ClusterCount clusters in the cluster heap
+	firstClusterOfRootDirectory uint32 // FirstClusterOfRootDirectory where the root directory starts
+	volumeSerialNumber          uint32 // VolumeSerialNumber usually generated from the date and time of creation
+	fileSystemRevision          uint16 // FileSystemRevision major version in the high byte, minor in the low
+	volumeFlags                 uint16 // VolumeFlags ActiveFat, VolumeDirty and MediaFailure
+	bytesPerSectorShift         uint8  // BytesPerSectorShift log2 of the bytes per sector, 9 to 12
+	sectorsPerClusterShift      uint8  // SectorsPerClusterShift log2 of the sectors per cluster
+	numberOfFats                uint8  // NumberOfFats 1, or 2 for TexFAT
+	driveSelect                 uint8  // DriveSelect the INT 13h drive number, 0x80
+	percentInUse                uint8  // PercentInUse of the cluster heap, or 0xff if not known
+	bootCode                    []byte // BootCode 390 bytes of boot code
+}
+
+func (bs *bootSector) equal(a *bootSector) bool {
+	if (bs == nil && a != nil) || (a == nil && bs != nil) {
+		return false
+	}
+	if bs == nil && a == nil {
+		return true
+	}
+	return bs.partitionOffset == a.partitionOffset &&
+		bs.volumeLength == a.volumeLength &&
+		bs.fatOffset == a.fatOffset &&
+		bs.fatLength == a.fatLength &&
+		bs.clusterHeapOffset == a.clusterHeapOffset &&
+		bs.clusterCount == a.clusterCount &&
+		bs.firstClusterOfRootDirectory == a.firstClusterOfRootDirectory &&
+		bs.volumeSerialNumber == a.volumeSerialNumber &&
+		bs.fileSystemRevision == a.fileSystemRevision &&
+		bs.volumeFlags == a.volumeFlags &&
+		bs.bytesPerSectorShift == a.bytesPerSectorShift &&
+		bs.sectorsPerClusterShift == a.sectorsPerClusterShift &&
+		bs.numberOfFats == a.numberOfFats &&
+		bs.driveSelect == a.driveSelect &&
+		bs.percentInUse == a.percentInUse
+}
+
+// bootSectorFromBytes read the Main Boot Sector from the first 512 bytes of a volume
+func bootSectorFromBytes(b []byte) (*bootSector, error) {
+	if len(b) < 512 {
+		return nil, fmt.Errorf("cannot read exFAT boot sector from %d bytes, must be at least 512", len(b))
+	}
+	if string(b[3:11]) != fileSystemName {
+		return nil, fmt.Errorf("invalid file system name %q, expected %q", b[3:11], fileSystemName)
+	}
+	if signature := binary.LittleEndian.Uint16(b[510:512]); signature != bootSignature {
+		return nil, fmt.Errorf("invalid boot sector signature 0x%04x, expected 0x%04x", signature, bootSignature)
+	}
+	for i, c := range b[11:64] {
+		if c != 0 {
+			return nil, fmt.Errorf("byte %d of the boot sector must be zero, but is 0x%02x", 11+i, c)
+		}
+	}
+	bs := bootSector{
+		partitionOffset:             binary.LittleEndian.Uint64(b[64:72]),
+		volumeLength:                binary.LittleEndian.Uint64(b[72:80]),
+		fatOffset:                   binary.LittleEndian.Uint32(b[80:84]),
+		fatLength:                   binary.LittleEndian.Uint32(b[84:88]),
+		clusterHeapOffset:           binary.LittleEndian.Uint32(b[88:92]),
+		clusterCount:                binary.LittleEndian.Uint32(b[92:96]),
+		firstClusterOfRootDirectory: binary.LittleEndian.Uint32(b[96:100]),
+		volumeSerialNumber:          binary.LittleEndian.Uint32(b[100:104]),
+		fileSystemRevision:          binary.LittleEndian.Uint16(b[104:106]),
+		volumeFlags:                 binary.LittleEndian.Uint16(b[106:108]),
+		bytesPerSectorShift:         b[108],
+		sectorsPerClusterShift:      b[109],
+		numberOfFats:                b[110],
+		driveSelect:                 b[111],
+		percentInUse:                b[112],
+		bootCode:                    append([]byte{}, b[120:510]...),
+	}
+	switch {
+	case bs.fileSystemRevision>>8 != 1:
+		return nil, fmt.Errorf("unsupported exFAT revision %d.%02d", bs.fileSystemRevision>>8, bs.fileSystemRevision&0xff)
+	case bs.bytesPerSectorShift < minBytesPerSectorSh || bs.bytesPerSectorShift > maxBytesPerSectorSh:
+		return nil, fmt.Errorf("invalid bytes per sector shift %d, must be between %d and %d", bs.bytesPerSectorShift, minBytesPerSectorSh, maxBytesPerSectorSh)
+	case bs.bytesPerSectorShift+bs.sectorsPerClusterShift > maxClusterShift:
+		return nil, fmt.Errorf("invalid sectors per cluster shift %d, clusters are larger than 32MB", bs.sectorsPerClusterShift)
+	case bs.numberOfFats != 1 && bs.numberOfFats != 2:
+		return nil, fmt.Errorf("invalid number of FATs %d, must be 1 or 2", bs.numberOfFats)
+	case bs.firstClusterOfRootDirectory < 2 || bs.firstClusterOfRootDirectory > bs.clusterCount+1:
+		return nil, fmt.Errorf("invalid first cluster of root directory %d", bs.firstClusterOfRootDirectory)
+	}
+	return &bs, nil
+}
+
+// toBytes returns the Main Boot Sector as a full sector of bytes ready to write to disk
+func (bs *bootSector) toBytes() []byte {
+	b := make([]byte, bs.bytesPerSector())
+	copy(b[0:3], []byte{0xeb, 0x76, 0x90})
+	copy(b[3:11], fileSystemName)
+	binary.LittleEndian.PutUint64(b[64:72], bs.partitionOffset)
+	binary.LittleEndian.PutUint64(b[72:80], bs.volumeLength)
+	binary.LittleEndian.PutUint32(b[80:84], bs.fatOffset)
+	binary.LittleEndian.PutUint32(b[84:88], bs.fatLength)
+	binary.LittleEndian.PutUint32(b[88:92], bs.clusterHeapOffset)
+	binary.LittleEndian.PutUint32(b[92:96], bs.clusterCount)
+	binary.LittleEndian.PutUint32(b[96:100], bs.firstClusterOfRootDirectory)
+	binary.LittleEndian.PutUint32(b[100:104], bs.volumeSerialNumber)
+	binary.LittleEndian.PutUint16(b[104:106], bs.fileSystemRevision)
+	binary.LittleEndian.PutUint16(b[106:108], bs.volumeFlags)
+	b[108] = bs.bytesPerSectorShift
+	b[109] = bs.sectorsPerClusterShift
+	b[110] = bs.numberOfFats
+	b[111] = bs.driveSelect
+	b[112] = bs.percentInUse
+	copy(b[120:510], bs.bootCode)
+	binary.LittleEndian.PutUint16(b[510:512], bootSignature)
+	return b
+}
+
+// bootRegionBytes the 12 sectors of a boot region: the boot sector, extended boot sectors without boot code,
+// empty OEM parameters and reserved sectors, and the checksum sector
+func (bs *bootSector) bootRegionBytes() []byte {
+	sectorSize := bs.bytesPerSector()
+	b := make([]byte, bootRegionSectors*sectorSize)
+	copy(b, bs.toBytes())
+	for i := 1; i <= 8; i++ {
+		binary.LittleEndian.PutUint32(b[(i+1)*sectorSize-4:(i+1)*sectorSize], extendedBootSignature)
+	}
+	checksum := bootChecksum(b[:bootChecksumSector*sectorSize])
+	for i := bootChecksumSector * sectorSize; i < len(b); i += 4 {
+		binary.LittleEndian.PutUint32(b[i:i+4], checksum)
+	}
+	return b
+}
+
+// bytesPerSector the size of a sector in bytes
+func (bs *bootSector) bytesPerSector() int {
+	return 1 << bs.bytesPerSectorShift
+}
+
+// bytesPerCluster the size of a cluster in bytes
+func (bs *bootSector) bytesPerCluster() int {
+	return 1 << (bs.bytesPerSectorShift + bs.sectorsPerClusterShift)
+}
+
+// activeFat the index of the FAT and allocation bitmap in use, 1 only for TexFAT with the second one active
+func (bs *bootSector) activeFat() int {
+	if bs.numberOfFats == 2 && bs.volumeFlags&volumeFlagActiveFat != 0 {
+		return 1
+	}
+	return 0
+}
+
+// bootChecksum the checksum of the first 11 sectors of a boot region, which skips the VolumeFlags and
+// PercentInUse fields of the boot sector, as they change without the checksum being updated
+func bootChecksum(b []byte) uint32 {
+	var checksum uint32
+	for i, c := range b {
+		if i == 106 || i == 107 || i == 112 {
+			continue
+		}
+		checksum = (checksum<<31 | checksum>>1) + uint32(c)
+	}
+	return checksum
+}
+
+// verifyBootRegion check the checksum sector of a boot region
+func verifyBootRegion(b []byte, sectorSize int) error {
+	checksum := bootChecksum(b[:bootChecksumSector*sectorSize])
+	for i := bootChecksumSector * sectorSize; i < bootRegionSectors*sectorSize; i += 4 {
+		if stored := binary.LittleEndian.Uint32(b[i : i+4]); stored != checksum {
+			return fmt.Errorf("boot region checksum 0x%08x does not match stored 0x%08x", checksum, stored)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package exfat
+
+import (
+	"strings"
+	"testing"
+)
+
+func getValidBootSector() *bootSector {
+	return &bootSector{
+		partitionOffset:             2048,
+		volumeLength:                20480,
+		fatOffset:                   24,
+		fatLength:                   40,
+		clusterHeapOffset:           64,
+		clusterCount:                2552,
+		firstClusterOfRootDirectory: 5,
+		volumeSerialNumber:          0x12345678,
+		fileSystemRevision:          fileSystemRevision,
+		bytesPerSectorShift:         9,
+		sectorsPerClusterShift:      3,
+		numberOfFats:                1,
+		driveSelect:                 0x80,
+		percentInUse:                percentInUseUnknown,
+		bootCode:                    []byte{},
+	}
+}
+
+func TestBootSectorFromBytes(t *testing.T) {
+	valid := getValidBootSector()
+	b := valid.toBytes()
+	bs, err := bootSectorFromBytes(b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bs.equal(valid) {
+		t.Errorf("mismatched boot sector, actual %#v expected %#v", bs, valid)
+	}
+
+	tests := []struct {
+		change   func(b []byte)
+		expected string
+	}{
+		{func(b []byte) { copy(b[3:11], "NTFS    ") }, "invalid file system name"},
+		{func(b []byte) { b[511] = 0 }, "invalid boot sector signature"},
+		{func(b []byte) { b[20] = 1 }, "byte 20 of the boot sector must be zero"},
+		{func(b []byte) { b[105] = 2 }, "unsupported exFAT revision 2.00"},
+		{func(b []byte) { b[108] = 13 }, "invalid bytes per sector shift 13"},
+		{func(b []byte) { b[109] = 17 }, "invalid sectors per cluster shift 17"},
+		{func(b []byte) { b[110] = 3 }, "invalid number of FATs 3"},
+		{func(b []byte) { b[96] = 0 }, "invalid first cluster of root directory 0"},
+	}
+	for _, tt := range tests {
+		b := valid.toBytes()
+		tt.change(b)
+		if _, err := bootSectorFromBytes(b); err == nil || !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Errorf("returned error %v instead of %q", err, tt.expected)
+		}
+	}
+}
+
+func TestBootRegion(t *testing.T) {
+	bs := getValidBootSector()
+	b := bs.bootRegionBytes()
+	if len(b) != bootRegionSectors*512 {
+		t.Fatalf("boot region of %d bytes instead of %d", len(b), bootRegionSectors*512)
+	}
+	if err := verifyBootRegion(b, 512); err != nil {
+		t.Errorf("unexpected error verifying boot region: %v", err)
+	}
+	// the volume flags and percent in use change without the checksum changing
+	b[106], b[112] = volumeFlagVolumeDirty, 42
+	if err := verifyBootRegion(b, 512); err != nil {
+		t.Errorf("unexpected error verifying boot region with changed flags: %v", err)
+	}
+	b[100]++
+	if err := verifyBootRegion(b, 512); err == nil {
+		t.Errorf("changed serial number did not fail the checksum")
+	}
+	bs.numberOfFats, bs.volumeFlags = 2, volumeFlagActiveFat
+	if bs.activeFat() != 1 {
+		t.Errorf("active FAT %d instead of 1", bs.activeFat())
+	}
+}
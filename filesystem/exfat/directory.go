@@ -0,0 +1,31 @@
+package exfat
+
+// Directory represents a single directory in an exFAT filesystem
+type Directory struct {
+	entry   *directoryEntry // entry of the directory in its parent, nil for the root directory
+	parent  *Directory
+	entries []*directoryEntry
+}
+
+// entriesToBytes convert our entries to raw bytes. The zeroes that pad them to whole clusters end the directory.
+func (d *Directory) entriesToBytes(upcase upcaseTable) ([]byte, error) {
+	b := make([]byte, 0)
+	for _, de := range d.entries {
+		b2, err := de.toBytes(upcase)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, b2...)
+	}
+	return b, nil
+}
+
+// find the entry of a file or directory by name, without regard to case, or nil if there is none
+func (d *Directory) find(name string, upcase upcaseTable) *directoryEntry {
+	for _, e := range d.entries {
+		if e.isFile() && upcase.equalFold(utf16Name(e.name), utf16Name(name)) {
+			return e
+		}
+	}
+	return nil
+}
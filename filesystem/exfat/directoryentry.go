@@ -0,0 +1,310 @@
+package exfat
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	bytesPerEntry = 32
+	// entry types. The high bit is set on entries in use, and cleared when they are deleted
+	entryTypeEndOfDirectory   uint8 = 0x00
+	entryTypeInUse            uint8 = 0x80
+	entryTypeAllocationBitmap uint8 = 0x81
+	entryTypeUpcaseTable      uint8 = 0x82
+	entryTypeVolumeLabel      uint8 = 0x83
+	entryTypeFile             uint8 = 0x85
+	entryTypeStreamExtension  uint8 = 0xc0
+	entryTypeFileName         uint8 = 0xc1
+	// file attributes
+	attrReadOnly  uint16 = 0x01
+	attrHidden    uint16 = 0x02
+	attrSystem    uint16 = 0x04
+	attrDirectory uint16 = 0x10
+	attrArchive   uint16 = 0x20
+	// general secondary flags of the stream extension
+	flagAllocationPossible uint8 = 0x01
+	flagNoFatChain         uint8 = 0x02
+	// limits of names
+	charsPerFileNameEntry = 15
+	maxFileNameLength     = 255
+	maxVolumeLabelLength  = 11
+	// the UTC offset of a timestamp is valid
+	utcOffsetValid uint8 = 0x80
+)
+
+// directoryEntry a file or directory, from its entry set of a File entry, a Stream Extension entry and File Name
+// entries. Other entries of a directory, such as the allocation bitmap and volume label in the root directory,
+// are kept as raw bytes so that they are written back as they were read.
+type directoryEntry struct {
+	raw             []byte // raw a single entry other than a file entry set, or nil
+	name            string
+	attributes      uint16
+	createTime      time.Time
+	modifyTime      time.Time
+	accessTime      time.Time
+	firstCluster    uint32
+	dataLength      uint64
+	validDataLength uint64
+	noFatChain      bool     // noFatChain the clusters are contiguous, and have no chain in the FAT
+	extensions      [][]byte // extensions secondary entries after the file names, such as vendor extensions, as read
+}
+
+// isFile if the entry is a file entry set, a file or a directory
+func (de *directoryEntry) isFile() bool {
+	return de.raw == nil
+}
+
+// isDir if the entry is a directory
+func (de *directoryEntry) isDir() bool {
+	return de.raw == nil && de.attributes&attrDirectory != 0
+}
+
+// entryType the type of the entry, its first byte
+func (de *directoryEntry) entryType() uint8 {
+	if de.raw == nil {
+		return entryTypeFile
+	}
+	return de.raw[0]
+}
+
+// parseDirEntries read the entries of a directory, up to the end of directory entry. Deleted entries are skipped.
+func parseDirEntries(b []byte) ([]*directoryEntry, error) {
+	entries := make([]*directoryEntry, 0, 20)
+	for i := 0; i+bytesPerEntry <= len(b); {
+		entryType := b[i]
+		switch {
+		case entryType == entryTypeEndOfDirectory:
+			return entries, nil
+		case entryType&entryTypeInUse == 0:
+			i += bytesPerEntry
+		case entryType == entryTypeFile:
+			setLength := (int(b[i+1]) + 1) * bytesPerEntry
+			if i+setLength > len(b) {
+				return nil, fmt.Errorf("entry set at byte %d runs past the end of the directory", i)
+			}
+			de, err := entrySetFromBytes(b[i : i+setLength])
+			if err != nil {
+				return nil, fmt.Errorf("invalid entry set at byte %d: %v", i, err)
+			}
+			entries = append(entries, de)
+			i += setLength
+		case entryType&0x40 != 0:
+			// a secondary entry without its primary entry; ignore it, as a driver would
+			i += bytesPerEntry
+		default:
+			entries = append(entries, &directoryEntry{raw: append([]byte{}, b[i:i+bytesPerEntry]...)})
+			i += bytesPerEntry
+		}
+	}
+	return entries, nil
+}
+
+// entrySetFromBytes read a file entry set: a File entry followed by its secondary entries
+func entrySetFromBytes(b []byte) (*directoryEntry, error) {
+	if checksum, stored := entrySetChecksum(b), binary.LittleEndian.Uint16(b[2:4]); checksum != stored {
+		return nil, fmt.Errorf("checksum 0x%04x does not match stored 0x%04x", checksum, stored)
+	}
+	if len(b) < 3*bytesPerEntry || b[bytesPerEntry] != entryTypeStreamExtension {
+		return nil, fmt.Errorf("file entry is not followed by a stream extension and file name")
+	}
+	stream := b[bytesPerEntry : 2*bytesPerEntry]
+	de := directoryEntry{
+		attributes:      binary.LittleEndian.Uint16(b[4:6]),
+		createTime:      timestampToTime(binary.LittleEndian.Uint32(b[8:12]), b[20], b[22]),
+		modifyTime:      timestampToTime(binary.LittleEndian.Uint32(b[12:16]), b[21], b[23]),
+		accessTime:      timestampToTime(binary.LittleEndian.Uint32(b[16:20]), 0, b[24]),
+		noFatChain:      stream[1]&flagNoFatChain != 0,
+		validDataLength: binary.LittleEndian.Uint64(stream[8:16]),
+		firstCluster:    binary.LittleEndian.Uint32(stream[20:24]),
+		dataLength:      binary.LittleEndian.Uint64(stream[24:32]),
+	}
+	nameLength := int(stream[3])
+	name := make([]uint16, 0, nameLength)
+	i := 2 * bytesPerEntry
+	for ; i < len(b) && b[i] == entryTypeFileName && len(name) < nameLength; i += bytesPerEntry {
+		for j := 2; j < bytesPerEntry && len(name) < nameLength; j += 2 {
+			name = append(name, binary.LittleEndian.Uint16(b[i+j:i+j+2]))
+		}
+	}
+	if len(name) != nameLength {
+		return nil, fmt.Errorf("file name has %d characters instead of %d", len(name), nameLength)
+	}
+	de.name = string(utf16.Decode(name))
+	for ; i < len(b); i += bytesPerEntry {
+		de.extensions = append(de.extensions, append([]byte{}, b[i:i+bytesPerEntry]...))
+	}
+	return &de, nil
+}
+
+// toBytes the entry as stored in a directory, a whole entry set for a file or directory
+func (de *directoryEntry) toBytes(upcase upcaseTable) ([]byte, error) {
+	if de.raw != nil {
+		return de.raw, nil
+	}
+	name := utf16Name(de.name)
+	if len(name) == 0 || len(name) > maxFileNameLength {
+		return nil, fmt.Errorf("invalid file name length %d, must be between 1 and %d", len(name), maxFileNameLength)
+	}
+	nameEntries := (len(name) + charsPerFileNameEntry - 1) / charsPerFileNameEntry
+	secondaryCount := 1 + nameEntries + len(de.extensions)
+	b := make([]byte, (secondaryCount+1)*bytesPerEntry)
+
+	b[0] = entryTypeFile
+	b[1] = uint8(secondaryCount)
+	binary.LittleEndian.PutUint16(b[4:6], de.attributes)
+	var ts uint32
+	ts, b[20], b[22] = timeToTimestamp(de.createTime)
+	binary.LittleEndian.PutUint32(b[8:12], ts)
+	ts, b[21], b[23] = timeToTimestamp(de.modifyTime)
+	binary.LittleEndian.PutUint32(b[12:16], ts)
+	ts, _, b[24] = timeToTimestamp(de.accessTime)
+	binary.LittleEndian.PutUint32(b[16:20], ts)
+
+	stream := b[bytesPerEntry : 2*bytesPerEntry]
+	stream[0] = entryTypeStreamExtension
+	stream[1] = flagAllocationPossible
+	if de.noFatChain {
+		stream[1] |= flagNoFatChain
+	}
+	stream[3] = uint8(len(name))
+	binary.LittleEndian.PutUint16(stream[4:6], nameHash(upcase.upcase(name)))
+	binary.LittleEndian.PutUint64(stream[8:16], de.validDataLength)
+	binary.LittleEndian.PutUint32(stream[20:24], de.firstCluster)
+	binary.LittleEndian.PutUint64(stream[24:32], de.dataLength)
+
+	for i, c := range name {
+		entry := (2 + i/charsPerFileNameEntry) * bytesPerEntry
+		b[entry] = entryTypeFileName
+		offset := entry + 2 + (i%charsPerFileNameEntry)*2
+		binary.LittleEndian.PutUint16(b[offset:offset+2], c)
+	}
+	for i, ext := range de.extensions {
+		copy(b[(2+nameEntries+i)*bytesPerEntry:], ext)
+	}
+
+	binary.LittleEndian.PutUint16(b[2:4], entrySetChecksum(b))
+	return b, nil
+}
+
+// entrySetChecksum the checksum of an entry set, which skips the checksum field of the File entry
+func entrySetChecksum(b []byte) uint16 {
+	var checksum uint16
+	for i, c := range b {
+		if i == 2 || i == 3 {
+			continue
+		}
+		checksum = (checksum<<15 | checksum>>1) + uint16(c)
+	}
+	return checksum
+}
+
+// nameHash the hash of the up-cased file name, kept in the stream extension to speed up looking up names
+func nameHash(upcased []uint16) uint16 {
+	var hash uint16
+	for _, c := range upcased {
+		hash = (hash<<15 | hash>>1) + c&0xff
+		hash = (hash<<15 | hash>>1) + c>>8
+	}
+	return hash
+}
+
+// utf16Name a name as the UTF-16 code units exFAT stores
+func utf16Name(name string) []uint16 {
+	return utf16.Encode([]rune(name))
+}
+
+// validateName check that a name can be used for a file or directory
+func validateName(name string) error {
+	if name == "." || name == ".." {
+		return fmt.Errorf("invalid file name %q", name)
+	}
+	if l := len(utf16Name(name)); l == 0 || l > maxFileNameLength {
+		return fmt.Errorf("invalid file name length %d, must be between 1 and %d", l, maxFileNameLength)
+	}
+	for _, c := range name {
+		switch {
+		case c < 0x20, c == '"', c == '*', c == '/', c == ':', c == '<', c == '>', c == '?', c == '\\', c == '|':
+			return fmt.Errorf("invalid character %q in file name %q", c, name)
+		}
+	}
+	return nil
+}
+
+// volumeLabelEntry a Volume Label entry for a label of up to 11 characters
+func volumeLabelEntry(label string) ([]byte, error) {
+	chars := utf16.Encode([]rune(label))
+	if len(chars) > maxVolumeLabelLength {
+		return nil, fmt.Errorf("invalid volume label: too long at %d characters, maximum is %d", len(chars), maxVolumeLabelLength)
+	}
+	b := make([]byte, bytesPerEntry)
+	b[0] = entryTypeVolumeLabel
+	b[1] = uint8(len(chars))
+	for i, c := range chars {
+		binary.LittleEndian.PutUint16(b[2+i*2:4+i*2], c)
+	}
+	return b, nil
+}
+
+// volumeLabel the label of a Volume Label entry
+func volumeLabel(b []byte) string {
+	count := int(b[1])
+	if count > maxVolumeLabelLength {
+		count = maxVolumeLabelLength
+	}
+	chars := make([]uint16, count)
+	for i := range chars {
+		chars[i] = binary.LittleEndian.Uint16(b[2+i*2 : 4+i*2])
+	}
+	return string(utf16.Decode(chars))
+}
+
+// allocationEntry an Allocation Bitmap or Up-case Table entry, which point to the clusters of their data
+func allocationEntry(entryType uint8, firstCluster uint32, dataLength uint64) []byte {
+	b := make([]byte, bytesPerEntry)
+	b[0] = entryType
+	binary.LittleEndian.PutUint32(b[20:24], firstCluster)
+	binary.LittleEndian.PutUint64(b[24:32], dataLength)
+	return b
+}
+
+// timestampToTime convert an exFAT timestamp, with its 10ms increment and UTC offset, to a time. Timestamps
+// without a valid UTC offset are taken as UTC.
+func timestampToTime(ts uint32, increment10ms, utcOffset uint8) time.Time {
+	t := time.Date(
+		int(ts>>25)+1980,
+		time.Month(ts>>21&0x0f),
+		int(ts>>16&0x1f),
+		int(ts>>11&0x1f),
+		int(ts>>5&0x3f),
+		int(ts&0x1f)*2,
+		0, time.UTC)
+	t = t.Add(time.Duration(increment10ms) * 10 * time.Millisecond)
+	if utcOffset&utcOffsetValid != 0 {
+		// a signed 7-bit count of 15 minute intervals
+		offset := int(int8(utcOffset<<1) >> 1)
+		t = t.Add(-time.Duration(offset) * 15 * time.Minute)
+	}
+	return t
+}
+
+// timeToTimestamp convert a time to an exFAT timestamp in UTC, its 10ms increment and UTC offset
+func timeToTimestamp(t time.Time) (ts uint32, increment10ms, utcOffset uint8) {
+	t = t.UTC()
+	switch {
+	case t.Year() < 1980:
+		t = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+	case t.Year() > 2107:
+		t = time.Date(2107, 12, 31, 23, 59, 59, 0, time.UTC)
+	}
+	ts = uint32(t.Year()-1980)<<25 |
+		uint32(t.Month())<<21 |
+		uint32(t.Day())<<16 |
+		uint32(t.Hour())<<11 |
+		uint32(t.Minute())<<5 |
+		uint32(t.Second()/2)
+	increment10ms = uint8(t.Second()%2*100 + t.Nanosecond()/10000000)
+	return ts, increment10ms, utcOffsetValid
+}
@@ -0,0 +1,78 @@
+package exfat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEntrySet(t *testing.T) {
+	upcase := newUpcaseTable()
+	modified := time.Date(2023, 7, 14, 10, 21, 33, 470_000_000, time.UTC)
+	de := &directoryEntry{
+		name:            "A long file name with ünïcode.txt",
+		attributes:      attrArchive,
+		createTime:      modified.Add(-time.Hour),
+		modifyTime:      modified,
+		accessTime:      modified.Truncate(2 * time.Second),
+		firstCluster:    17,
+		dataLength:      10000,
+		validDataLength: 8000,
+		noFatChain:      true,
+	}
+	b, err := de.toBytes(upcase)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// a file entry, a stream extension and 3 file name entries for 33 characters
+	if len(b) != 5*bytesPerEntry || b[1] != 4 {
+		t.Fatalf("entry set of %d bytes with %d secondary entries", len(b), b[1])
+	}
+	if hash := binary.LittleEndian.Uint16(b[36:38]); hash != nameHash(upcase.upcase(utf16Name(strings.ToUpper(de.name)))) {
+		t.Errorf("name hash 0x%04x is not the same as that of the upper case name", hash)
+	}
+	parsed, err := entrySetFromBytes(b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if parsed.name != de.name || parsed.attributes != de.attributes || parsed.firstCluster != de.firstCluster ||
+		parsed.dataLength != de.dataLength || parsed.validDataLength != de.validDataLength || !parsed.noFatChain {
+		t.Errorf("mismatched entry, actual %#v expected %#v", parsed, de)
+	}
+	for _, times := range [][2]time.Time{{parsed.createTime, de.createTime}, {parsed.modifyTime, de.modifyTime}, {parsed.accessTime, de.accessTime}} {
+		if !times[0].Equal(times[1]) {
+			t.Errorf("time %v instead of %v", times[0], times[1])
+		}
+	}
+
+	b[bytesPerEntry+24]++
+	if _, err := entrySetFromBytes(b); err == nil || !strings.HasPrefix(err.Error(), "checksum") {
+		t.Errorf("changed entry set returned error %v instead of a checksum error", err)
+	}
+}
+
+func TestParseDirEntries(t *testing.T) {
+	upcase := newUpcaseTable()
+	label, _ := volumeLabelEntry("CAMERA")
+	file, _ := (&directoryEntry{name: "deleted"}).toBytes(upcase)
+	for i := 0; i < len(file); i += bytesPerEntry {
+		file[i] &^= entryTypeInUse
+	}
+	dir, _ := (&directoryEntry{name: "DCIM", attributes: attrDirectory}).toBytes(upcase)
+	b := bytes.Join([][]byte{label, file, dir, make([]byte, bytesPerEntry), label}, nil)
+	entries, err := parseDirEntries(b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("read %d entries instead of 2", len(entries))
+	}
+	if entries[0].entryType() != entryTypeVolumeLabel || volumeLabel(entries[0].raw) != "CAMERA" {
+		t.Errorf("first entry is not the volume label CAMERA")
+	}
+	if !entries[1].isDir() || entries[1].name != "DCIM" {
+		t.Errorf("second entry is not the directory DCIM")
+	}
+}
@@ -0,0 +1,12 @@
+// Package exfat provides utilities to interact with, manipulate and create an exFAT filesystem on a block device or
+// a disk image, as used on SDXC cards and large USB drives.
+//
+// Files are always written with a cluster chain in the FAT; contiguous files without one, as written by other
+// implementations, are read, and given a chain when they change size. Only one FAT is used, so TexFAT
+// volumes with two are read and written through their active FAT only.
+//
+// references:
+//
+//	https://learn.microsoft.com/en-us/windows/win32/fileio/exfat-specification
+//	https://en.wikipedia.org/wiki/ExFAT
+package exfat
@@ -0,0 +1,796 @@
+package exfat
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/diskfs/go-diskfs/filesystem"
+	"github.com/diskfs/go-diskfs/util"
+)
+
+// SectorSize512 is the sector size in bytes used when Create or Read are given a blocksize of 0
+const SectorSize512 int64 = 512
+
+// FileSystem implements the FileSystem interface
+type FileSystem struct {
+	bootSector      bootSector
+	table           table
+	bitmap          bitmap
+	upcase          upcaseTable
+	bytesPerSector  int
+	bytesPerCluster int
+	size            int64
+	start           int64
+	file            util.File
+	readOnly        bool
+}
+
+// Create creates an exFAT filesystem in a given file or device
+//
+// requires the util.File where to create the filesystem, size is the size of the filesystem in bytes,
+// start is how far in bytes from the beginning of the util.File to create the filesystem,
+// and blocksize is is the logical blocksize to use for creating the filesystem
+//
+// note that you are *not* required to create the filesystem on the entire disk. You could have a disk of size
+// 20GB, and create a small filesystem of size 50MB that begins 2GB into the disk.
+// This is extremely useful for creating filesystems on disk partitions.
+//
+// Note, however, that it is much easier to do this using the higher-level APIs at github.com/diskfs/go-diskfs
+// which allow you to work directly with partitions, rather than having to calculate (and hopefully not make any errors)
+// where a partition starts and ends.
+//
+// If the provided blocksize is 0, it will use the default of 512 bytes. Otherwise it must be 512, 1024, 2048 or 4096.
+// Clusters are sized as Microsoft's format does: 4KB up to 256MB, 32KB up to 32GB, and 128KB above that.
+func Create(f util.File, size, start, blocksize int64, volumeLabel string) (*FileSystem, error) {
+	shift, err := sectorShift(blocksize)
+	if err != nil {
+		return nil, err
+	}
+	if size < MinSize {
+		return nil, fmt.Errorf("requested size is smaller than minimum allowed exFAT, requested %d minimum %d", size, MinSize)
+	}
+	bytesPerSector := int64(1) << shift
+
+	var clusterSize int64
+	switch {
+	case size <= 256*MB:
+		clusterSize = 4 * KB
+	case size <= 32*GB:
+		clusterSize = 32 * KB
+	default:
+		clusterSize = 128 * KB
+	}
+	if clusterSize < bytesPerSector {
+		clusterSize = bytesPerSector
+	}
+	clusterShift := uint8(0)
+	for int64(1)<<clusterShift < clusterSize/bytesPerSector {
+		clusterShift++
+	}
+	sectorsPerCluster := uint64(1) << clusterShift
+
+	/*
+		layout: the main and backup boot regions, then the FAT, then the cluster heap; the FAT and the cluster
+		heap start on a cluster boundary, which keeps clusters aligned to the erase blocks of flash media.
+		The FAT is sized for every cluster that could fit after it, which may leave a few unused entries.
+	*/
+	totalSectors := uint64(size) / uint64(bytesPerSector)
+	fatOffset := roundUp(2*bootRegionSectors, sectorsPerCluster)
+	if fatOffset >= totalSectors {
+		return nil, fmt.Errorf("requested size %d is too small for exFAT with %d byte clusters", size, clusterSize)
+	}
+	maxClusters := (totalSectors - fatOffset) / sectorsPerCluster
+	if maxClusters > maxClusterCount {
+		maxClusters = maxClusterCount
+	}
+	fatLength := roundUp((maxClusters+2)*4, uint64(bytesPerSector)) / uint64(bytesPerSector)
+	clusterHeapOffset := roundUp(fatOffset+fatLength, sectorsPerCluster)
+	if clusterHeapOffset >= totalSectors {
+		return nil, fmt.Errorf("requested size %d is too small for exFAT with %d byte clusters", size, clusterSize)
+	}
+	clusterCount := (totalSectors - clusterHeapOffset) / sectorsPerCluster
+	if clusterCount > maxClusterCount {
+		clusterCount = maxClusterCount
+	}
+
+	// FAT filesystems use time-of-day of creation as a volume ID
+	now := time.Now()
+	volid := uint32(now.Unix()<<20 | (now.UnixNano() / 1000000))
+
+	fs := &FileSystem{
+		bootSector: bootSector{
+			partitionOffset:        uint64(start) / uint64(bytesPerSector),
+			volumeLength:           totalSectors,
+			fatOffset:              uint32(fatOffset),
+			fatLength:              uint32(fatLength),
+			clusterHeapOffset:      uint32(clusterHeapOffset),
+			clusterCount:           uint32(clusterCount),
+			volumeSerialNumber:     volid,
+			fileSystemRevision:     fileSystemRevision,
+			bytesPerSectorShift:    shift,
+			sectorsPerClusterShift: clusterShift,
+			numberOfFats:           1,
+			driveSelect:            0x80,
+			percentInUse:           percentInUseUnknown,
+			bootCode:               []byte{},
+		},
+		table:           *newTable(uint32(clusterCount)),
+		bitmap:          bitmap{bits: make([]byte, bitmapSize(uint32(clusterCount)))},
+		upcase:          newUpcaseTable(),
+		bytesPerSector:  int(bytesPerSector),
+		bytesPerCluster: int(clusterSize),
+		size:            size,
+		start:           start,
+		file:            f,
+	}
+
+	// the allocation bitmap, up-case table and root directory take the first clusters, each in a chain
+	upcaseBytes := fs.upcase.bytes()
+	var chains [3][]uint32
+	for i, length := range []uint64{bitmapSize(uint32(clusterCount)), uint64(len(upcaseBytes)), uint64(clusterSize)} {
+		chains[i], err = fs.allocate(nil, true, length)
+		if err != nil {
+			return nil, fmt.Errorf("requested size %d is too small for exFAT: %v", size, err)
+		}
+	}
+	fs.bitmap.firstCluster = chains[0][0]
+	fs.bootSector.firstClusterOfRootDirectory = chains[2][0]
+
+	// write the boot regions
+	bootRegion := fs.bootSector.bootRegionBytes()
+	for _, offset := range []int64{0, int64(len(bootRegion))} {
+		if _, err := f.WriteAt(bootRegion, fs.start+offset); err != nil {
+			return nil, fmt.Errorf("failed to write the boot region: %v", err)
+		}
+	}
+	// write the whole FAT, with zeroes after the last entry
+	fatBytes := make([]byte, fatLength*uint64(bytesPerSector))
+	copy(fatBytes, fs.table.bytes(0, uint32(clusterCount)+1))
+	if _, err := f.WriteAt(fatBytes, fs.start+int64(fatOffset)*bytesPerSector); err != nil {
+		return nil, fmt.Errorf("failed to write the file allocation table: %v", err)
+	}
+	// write the allocation bitmap, the up-case table, and an empty root directory
+	for i, b := range [][]byte{fs.bitmap.bits, upcaseBytes, make([]byte, clusterSize)} {
+		if err := fs.writeClusters(chains[i], 0, b); err != nil {
+			return nil, fmt.Errorf("failed to write the allocation bitmap, up-case table and root directory: %v", err)
+		}
+	}
+
+	root := &Directory{
+		entries: []*directoryEntry{
+			{raw: allocationEntry(entryTypeAllocationBitmap, chains[0][0], bitmapSize(uint32(clusterCount)))},
+			{raw: allocationEntry(entryTypeUpcaseTable, chains[1][0], uint64(len(upcaseBytes)))},
+		},
+	}
+	// the checksum of the up-case table follows the entry type and reserved bytes
+	binary.LittleEndian.PutUint32(root.entries[1].raw[4:8], tableChecksum(upcaseBytes))
+	if err := fs.writeDirectoryEntries(root); err != nil {
+		return nil, fmt.Errorf("error writing root directory to disk: %v", err)
+	}
+
+	// set the volume label
+	if err := fs.SetLabel(volumeLabel); err != nil {
+		return nil, fmt.Errorf("failed to set volume label to '%s': %v", volumeLabel, err)
+	}
+
+	return fs, nil
+}
+
+// Read reads a filesystem from a given disk.
+//
+// requires the util.File where to read the filesystem, size is the size of the filesystem in bytes,
+// start is how far in bytes from the beginning of the util.File the filesystem is expected to begin,
+// and blocksize is is the logical blocksize of the filesystem
+//
+// note that you are *not* required to read a filesystem on the entire disk. You could have a disk of size
+// 20GB, and a small filesystem of size 50MB that begins 2GB into the disk.
+// This is extremely useful for working with filesystems on disk partitions.
+//
+// If the provided blocksize is 0, the sector size is taken from the filesystem. Otherwise it must match it.
+//
+// If the file is read-only, as reported by util.IsReadOnly, e.g. the file of a disk opened in read-only mode,
+// the filesystem is read-only as well: changing it returns filesystem.ErrReadOnlyFilesystem.
+func Read(file util.File, size, start, blocksize int64) (*FileSystem, error) {
+	if _, err := sectorShift(blocksize); err != nil {
+		return nil, err
+	}
+	if size < MinSize {
+		return nil, fmt.Errorf("requested size is smaller than minimum allowed exFAT size %d", MinSize)
+	}
+
+	// read the boot sector, and then the whole boot region to check its checksum
+	b := make([]byte, SectorSize512)
+	if n, err := file.ReadAt(b, start); err != nil || n != len(b) {
+		return nil, fmt.Errorf("could not read boot sector from file: %v", err)
+	}
+	bs, err := bootSectorFromBytes(b)
+	if err != nil {
+		return nil, fmt.Errorf("error reading exFAT boot sector: %v", err)
+	}
+	bytesPerSector := bs.bytesPerSector()
+	if blocksize > 0 && blocksize != int64(bytesPerSector) {
+		return nil, fmt.Errorf("blocksize %d does not match the exFAT sector size %d", blocksize, bytesPerSector)
+	}
+	if bs.volumeLength*uint64(bytesPerSector) > uint64(size) {
+		return nil, fmt.Errorf("exFAT volume of %d sectors of %d bytes is larger than the requested size %d", bs.volumeLength, bytesPerSector, size)
+	}
+	b = make([]byte, bootRegionSectors*bytesPerSector)
+	if n, err := file.ReadAt(b, start); err != nil || n != len(b) {
+		return nil, fmt.Errorf("could not read boot region from file: %v", err)
+	}
+	if err := verifyBootRegion(b, bytesPerSector); err != nil {
+		return nil, fmt.Errorf("invalid exFAT boot region: %v", err)
+	}
+
+	fs := &FileSystem{
+		bootSector:      *bs,
+		bytesPerSector:  bytesPerSector,
+		bytesPerCluster: bs.bytesPerCluster(),
+		size:            size,
+		start:           start,
+		file:            file,
+		readOnly:        util.IsReadOnly(file),
+	}
+	b = make([]byte, (uint64(bs.clusterCount)+2)*4)
+	if _, err := file.ReadAt(b, fs.fatStart()); err != nil {
+		return nil, fmt.Errorf("could not read file allocation table: %v", err)
+	}
+	fs.table = *tableFromBytes(b, bs.clusterCount)
+
+	// the root directory has the allocation bitmap and the up-case table
+	root, err := fs.readDirectory(&Directory{})
+	if err != nil {
+		return nil, fmt.Errorf("could not read root directory: %v", err)
+	}
+	var bitmapEntry, upcaseEntry []byte
+	for _, e := range root.entries {
+		switch {
+		case e.entryType() == entryTypeAllocationBitmap && int(e.raw[1]&1) == bs.activeFat():
+			bitmapEntry = e.raw
+		case e.entryType() == entryTypeUpcaseTable:
+			upcaseEntry = e.raw
+		}
+	}
+	if bitmapEntry == nil || upcaseEntry == nil {
+		return nil, errors.New("root directory has no allocation bitmap or up-case table")
+	}
+	fs.bitmap.firstCluster = binary.LittleEndian.Uint32(bitmapEntry[20:24])
+	if fs.bitmap.bits, err = fs.readAllocation(bitmapEntry); err != nil {
+		return nil, fmt.Errorf("could not read allocation bitmap: %v", err)
+	}
+	if uint64(len(fs.bitmap.bits)) < bitmapSize(bs.clusterCount) {
+		return nil, fmt.Errorf("allocation bitmap of %d bytes is too small for %d clusters", len(fs.bitmap.bits), bs.clusterCount)
+	}
+	upcaseBytes, err := fs.readAllocation(upcaseEntry)
+	if err != nil {
+		return nil, fmt.Errorf("could not read up-case table: %v", err)
+	}
+	if checksum, stored := tableChecksum(upcaseBytes), binary.LittleEndian.Uint32(upcaseEntry[4:8]); checksum != stored {
+		return nil, fmt.Errorf("up-case table checksum 0x%08x does not match stored 0x%08x", checksum, stored)
+	}
+	if fs.upcase, err = upcaseTableFromBytes(upcaseBytes); err != nil {
+		return nil, fmt.Errorf("could not read up-case table: %v", err)
+	}
+
+	return fs, nil
+}
+
+// readAllocation read the data an Allocation Bitmap or Up-case Table entry points to
+func (fs *FileSystem) readAllocation(entry []byte) ([]byte, error) {
+	length := binary.LittleEndian.Uint64(entry[24:32])
+	if length > uint64(fs.bootSector.clusterCount)*uint64(fs.bytesPerCluster) {
+		return nil, fmt.Errorf("invalid data length %d", length)
+	}
+	clusters, err := fs.getClusterList(binary.LittleEndian.Uint32(entry[20:24]), length, false)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, length)
+	if err := fs.readClusters(clusters, 0, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Type returns the type code for the filesystem. Always returns filesystem.TypeExFAT
+func (fs *FileSystem) Type() filesystem.Type {
+	return filesystem.TypeExFAT
+}
+
+// Mkdir make a directory at the given path. It is equivalent to `mkdir -p`, i.e. idempotent, in that:
+//
+// * It will make the entire tree path if it does not exist
+// * It will not return an error if the path already exists
+func (fs *FileSystem) Mkdir(p string) error {
+	if fs.readOnly {
+		return fmt.Errorf("cannot make directory %s: %w", p, filesystem.ErrReadOnlyFilesystem)
+	}
+	_, err := fs.readDirWithMkdir(p, true)
+	return err
+}
+
+// ReadDir return the contents of a given directory in a given filesystem.
+//
+// Returns a slice of os.FileInfo with all of the entries in the directory.
+//
+// Will return an error if the directory does not exist or is a regular file and not a directory
+func (fs *FileSystem) ReadDir(p string) ([]os.FileInfo, error) {
+	dir, err := fs.readDirWithMkdir(p, false)
+	if err != nil {
+		return nil, fmt.Errorf("error reading directory %s: %v", p, err)
+	}
+	ret := make([]os.FileInfo, 0, len(dir.entries))
+	for _, e := range dir.entries {
+		if !e.isFile() {
+			continue
+		}
+		ret = append(ret, FileInfo{
+			modTime: e.modifyTime,
+			name:    e.name,
+			size:    int64(e.dataLength),
+			isDir:   e.isDir(),
+		})
+	}
+	return ret, nil
+}
+
+// OpenFile returns an io.ReadWriter from which you can read the contents of a file
+// or write contents to the file
+//
+// accepts normal os.OpenFile flags
+//
+// returns an error if the file does not exist, or if flags that would change the file are passed
+// on a read-only filesystem
+func (fs *FileSystem) OpenFile(p string, flag int) (filesystem.File, error) {
+	if fs.readOnly && flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, fmt.Errorf("cannot open %s for writing: %w", p, filesystem.ErrReadOnlyFilesystem)
+	}
+	dir := path.Dir(p)
+	filename := path.Base(p)
+	// if the dir == filename, then it is just /
+	if dir == filename {
+		return nil, fmt.Errorf("cannot open directory %s as file", p)
+	}
+	parentDir, err := fs.readDirWithMkdir(dir, false)
+	if err != nil {
+		return nil, fmt.Errorf("could not read directory entries for %s", dir)
+	}
+	targetEntry := parentDir.find(filename, fs.upcase)
+	if targetEntry != nil && targetEntry.isDir() {
+		return nil, fmt.Errorf("cannot open directory %s as file", p)
+	}
+
+	// if the file does not exist, and is not opened for os.O_CREATE, return an error
+	if targetEntry == nil {
+		if flag&os.O_CREATE == 0 {
+			return nil, fmt.Errorf("target file %s does not exist and was not asked to create", p)
+		}
+		// else create it, with no clusters until it is written to
+		if targetEntry, err = parentDir.createEntry(filename, attrArchive); err != nil {
+			return nil, fmt.Errorf("failed to create file %s: %v", p, err)
+		}
+		if err := fs.writeDirectoryEntries(parentDir); err != nil {
+			return nil, fmt.Errorf("error writing directory file %s to disk: %v", p, err)
+		}
+	}
+
+	// what if we were asked to truncate the file?
+	if flag&os.O_TRUNC == os.O_TRUNC && targetEntry.dataLength != 0 {
+		clusters, err := fs.getClusterList(targetEntry.firstCluster, targetEntry.dataLength, targetEntry.noFatChain)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get list of clusters for file: %v", err)
+		}
+		if _, err := fs.allocate(clusters, !targetEntry.noFatChain, 0); err != nil {
+			return nil, fmt.Errorf("unable to free clusters of file: %v", err)
+		}
+		targetEntry.setClusters(nil)
+		targetEntry.dataLength, targetEntry.validDataLength = 0, 0
+		if err := fs.writeDirectoryEntries(parentDir); err != nil {
+			return nil, fmt.Errorf("error writing directory file %s to disk: %v", p, err)
+		}
+	}
+	offset := int64(0)
+	if flag&os.O_APPEND == os.O_APPEND {
+		offset = int64(targetEntry.dataLength)
+	}
+	return &File{
+		directoryEntry: targetEntry,
+		isReadWrite:    flag&(os.O_RDWR|os.O_WRONLY) != 0,
+		isAppend:       flag&os.O_APPEND != 0,
+		offset:         offset,
+		filesystem:     fs,
+		parent:         parentDir,
+	}, nil
+}
+
+// Label get the label of the filesystem from the Volume Label entry of the root directory, or "" if there is none
+func (fs *FileSystem) Label() string {
+	root, err := fs.readDirectory(&Directory{})
+	if err != nil {
+		return ""
+	}
+	for _, e := range root.entries {
+		if e.entryType() == entryTypeVolumeLabel {
+			return volumeLabel(e.raw)
+		}
+	}
+	return ""
+}
+
+// SetLabel changes the filesystem label, of up to 11 characters. An empty label removes it.
+func (fs *FileSystem) SetLabel(label string) error {
+	if fs.readOnly {
+		return fmt.Errorf("cannot set label: %w", filesystem.ErrReadOnlyFilesystem)
+	}
+	entry, err := volumeLabelEntry(label)
+	if err != nil {
+		return err
+	}
+	root, err := fs.readDirectory(&Directory{})
+	if err != nil {
+		return fmt.Errorf("failed to locate root directory: %v", err)
+	}
+	// replace any label entry, and leave it out for an empty label
+	entries := make([]*directoryEntry, 0, len(root.entries)+1)
+	for _, e := range root.entries {
+		if e.entryType() != entryTypeVolumeLabel {
+			entries = append(entries, e)
+		}
+	}
+	if label != "" {
+		entries = append(entries, &directoryEntry{raw: entry})
+	}
+	root.entries = entries
+	if err := fs.writeDirectoryEntries(root); err != nil {
+		return fmt.Errorf("failed to save the root directory to disk: %v", err)
+	}
+	return nil
+}
+
+// readDirectory read the entries of a directory
+func (fs *FileSystem) readDirectory(dir *Directory) (*Directory, error) {
+	clusters, err := fs.dirClusters(dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read cluster list: %v", err)
+	}
+	b := make([]byte, len(clusters)*fs.bytesPerCluster)
+	if err := fs.readClusters(clusters, 0, b); err != nil {
+		return nil, err
+	}
+	if dir.entries, err = parseDirEntries(b); err != nil {
+		return nil, err
+	}
+	return dir, nil
+}
+
+// writeDirectoryEntries write the entries of a directory, growing it when they do not fit. A subdirectory that
+// grows has its size changed in the entry of its parent, which is written as well.
+func (fs *FileSystem) writeDirectoryEntries(dir *Directory) error {
+	b, err := dir.entriesToBytes(fs.upcase)
+	if err != nil {
+		return fmt.Errorf("could not create a valid byte stream for exFAT entries: %v", err)
+	}
+	clusters, err := fs.dirClusters(dir)
+	if err != nil {
+		return fmt.Errorf("unable to get clusters for directory: %v", err)
+	}
+	if len(b) > len(clusters)*fs.bytesPerCluster {
+		chained := dir.entry == nil || !dir.entry.noFatChain
+		clusters, err = fs.allocate(clusters, chained, uint64(len(b)))
+		if err != nil {
+			return fmt.Errorf("unable to allocate space for directory entries: %v", err)
+		}
+		if dir.entry != nil {
+			dir.entry.setClusters(clusters)
+			dir.entry.dataLength = uint64(len(clusters) * fs.bytesPerCluster)
+			dir.entry.validDataLength = dir.entry.dataLength
+			if err := fs.writeDirectoryEntries(dir.parent); err != nil {
+				return err
+			}
+		}
+	}
+	// pad with zeroes, which end the directory
+	b = append(b, make([]byte, len(clusters)*fs.bytesPerCluster-len(b))...)
+	if err := fs.writeClusters(clusters, 0, b); err != nil {
+		return fmt.Errorf("error writing directory entries: %v", err)
+	}
+	return nil
+}
+
+// dirClusters the clusters of a directory; those of the root directory are always chained in the FAT
+func (fs *FileSystem) dirClusters(dir *Directory) ([]uint32, error) {
+	if dir.entry == nil {
+		return fs.getClusterList(fs.bootSector.firstClusterOfRootDirectory, 0, false)
+	}
+	return fs.getClusterList(dir.entry.firstCluster, dir.entry.dataLength, dir.entry.noFatChain)
+}
+
+// createEntry create an empty file or directory entry in a directory, and return the handle to it
+func (d *Directory) createEntry(name string, attributes uint16) (*directoryEntry, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	entry := &directoryEntry{
+		name:       name,
+		attributes: attributes,
+		createTime: now,
+		modifyTime: now,
+		accessTime: now,
+	}
+	d.entries = append(d.entries, entry)
+	return entry, nil
+}
+
+// mkSubdir make a subdirectory of a single empty cluster
+func (fs *FileSystem) mkSubdir(parent *Directory, name string) (*directoryEntry, error) {
+	clusters, err := fs.allocate(nil, true, uint64(fs.bytesPerCluster))
+	if err != nil {
+		return nil, fmt.Errorf("could not allocate disk space for directory %s: %v", name, err)
+	}
+	if err := fs.writeClusters(clusters, 0, make([]byte, fs.bytesPerCluster)); err != nil {
+		return nil, fmt.Errorf("could not clear directory %s: %v", name, err)
+	}
+	entry, err := parent.createEntry(name, attrDirectory)
+	if err != nil {
+		return nil, err
+	}
+	entry.setClusters(clusters)
+	entry.dataLength = uint64(fs.bytesPerCluster)
+	entry.validDataLength = entry.dataLength
+	return entry, nil
+}
+
+// readDirWithMkdir - walks down a directory tree to the last entry
+// if it does not exist, it may or may not make it
+func (fs *FileSystem) readDirWithMkdir(p string, doMake bool) (*Directory, error) {
+	paths, err := splitPath(p)
+	if err != nil {
+		return nil, err
+	}
+	currentDir, err := fs.readDirectory(&Directory{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory %s", "/")
+	}
+	for i, subp := range paths {
+		subPath := "/" + path.Join(paths[:i+1]...)
+		e := currentDir.find(subp, fs.upcase)
+		switch {
+		case e != nil && !e.isDir():
+			return nil, fmt.Errorf("cannot create directory at %s since it is a file", subPath)
+		case e == nil && !doMake:
+			return nil, fmt.Errorf("path %s not found", subPath)
+		case e == nil:
+			if e, err = fs.mkSubdir(currentDir, subp); err != nil {
+				return nil, fmt.Errorf("failed to create subdirectory %s: %v", subPath, err)
+			}
+			if err := fs.writeDirectoryEntries(currentDir); err != nil {
+				return nil, fmt.Errorf("error writing directory entries to disk: %v", err)
+			}
+		}
+		if currentDir, err = fs.readDirectory(&Directory{entry: e, parent: currentDir}); err != nil {
+			return nil, fmt.Errorf("failed to read directory %s", subPath)
+		}
+	}
+	return currentDir, nil
+}
+
+// getClusterList the clusters of a chain from its first cluster, following the FAT, or for a contiguous chain
+// with no FAT entries, as many clusters as hold length bytes. A first cluster of 0 is an empty chain.
+func (fs *FileSystem) getClusterList(first uint32, length uint64, noFatChain bool) ([]uint32, error) {
+	if first == 0 {
+		return nil, nil
+	}
+	maxCluster := fs.bootSector.clusterCount + 1
+	if first < 2 || first > maxCluster {
+		return nil, fmt.Errorf("invalid start cluster: %d", first)
+	}
+	if noFatChain {
+		count := (length + uint64(fs.bytesPerCluster) - 1) / uint64(fs.bytesPerCluster)
+		if uint64(first)+count-1 > uint64(maxCluster) {
+			return nil, fmt.Errorf("contiguous chain of %d clusters at %d runs past the last cluster", count, first)
+		}
+		clusters := make([]uint32, count)
+		for i := range clusters {
+			clusters[i] = first + uint32(i)
+		}
+		return clusters, nil
+	}
+	clusters := make([]uint32, 0, 5)
+	for cluster := first; !isEoc(cluster); cluster = fs.table.entries[cluster] {
+		if cluster < 2 || cluster > maxCluster || len(clusters) > int(fs.bootSector.clusterCount) {
+			return nil, fmt.Errorf("invalid cluster chain at %d", cluster)
+		}
+		clusters = append(clusters, cluster)
+	}
+	return clusters, nil
+}
+
+// allocate resize a chain of clusters to hold size bytes, allocating clusters that are free in the allocation
+// bitmap or freeing those no longer needed, and returns the clusters of the new chain. New clusters follow the
+// last of the chain where they can, to keep files contiguous. The chain is written to the FAT, all of it when
+// chained is false, as the existing clusters were contiguous without FAT entries.
+func (fs *FileSystem) allocate(clusters []uint32, chained bool, size uint64) ([]uint32, error) {
+	count := int((size + uint64(fs.bytesPerCluster) - 1) / uint64(fs.bytesPerCluster))
+	if count == len(clusters) && chained {
+		return clusters, nil
+	}
+	clusterCount := fs.bootSector.clusterCount
+	changed := make([]uint32, 0, 20)
+	kept := len(clusters)
+	if count < kept {
+		kept = count
+	}
+
+	switch {
+	case count > len(clusters):
+		hint := uint32(2)
+		if len(clusters) > 0 {
+			hint = clusters[len(clusters)-1] + 1
+		}
+		allocated := make([]uint32, 0, count-len(clusters))
+		for i := uint32(0); i < clusterCount && len(allocated) < count-len(clusters); i++ {
+			cluster := (hint-2+i)%clusterCount + 2
+			if !fs.bitmap.isAllocated(cluster) {
+				allocated = append(allocated, cluster)
+			}
+		}
+		if len(allocated) < count-len(clusters) {
+			return nil, errors.New("no space left on device")
+		}
+		for _, cluster := range allocated {
+			fs.bitmap.set(cluster, true)
+		}
+		changed = append(changed, allocated...)
+		clusters = append(clusters, allocated...)
+	case count < len(clusters):
+		for _, cluster := range clusters[count:] {
+			fs.bitmap.set(cluster, false)
+			fs.table.entries[cluster] = 0
+			changed = append(changed, cluster)
+		}
+		clusters = clusters[:count]
+	}
+
+	// link the chain from the last of the clusters kept, or from the start if they were not chained
+	first := 0
+	if chained && kept > 0 {
+		first = kept - 1
+	}
+	for i := first; i < len(clusters); i++ {
+		next := eocMarker
+		if i < len(clusters)-1 {
+			next = clusters[i+1]
+		}
+		fs.table.entries[clusters[i]] = next
+		changed = append(changed, clusters[i])
+	}
+
+	if err := fs.writeFat(changed); err != nil {
+		return nil, fmt.Errorf("failed to write the file allocation table: %v", err)
+	}
+	if err := fs.writeBitmap(changed); err != nil {
+		return nil, fmt.Errorf("failed to write the allocation bitmap: %v", err)
+	}
+	return clusters, nil
+}
+
+// fatStart the location in the file of the active FAT
+func (fs *FileSystem) fatStart() int64 {
+	bs := fs.bootSector
+	sector := int64(bs.fatOffset) + int64(bs.activeFat())*int64(bs.fatLength)
+	return fs.start + sector*int64(fs.bytesPerSector)
+}
+
+// writeFat write the FAT entries of changed clusters, in runs of adjacent entries
+func (fs *FileSystem) writeFat(changed []uint32) error {
+	sort.Slice(changed, func(i, j int) bool { return changed[i] < changed[j] })
+	for i := 0; i < len(changed); {
+		j := i
+		for j+1 < len(changed) && changed[j+1] <= changed[j]+1 {
+			j++
+		}
+		b := fs.table.bytes(changed[i], changed[j])
+		if _, err := fs.file.WriteAt(b, fs.fatStart()+int64(changed[i])*4); err != nil {
+			return err
+		}
+		i = j + 1
+	}
+	return nil
+}
+
+// writeBitmap write the bytes of the allocation bitmap with the bits of changed clusters
+func (fs *FileSystem) writeBitmap(changed []uint32) error {
+	// while creating the filesystem, the bitmap has no clusters yet, and is written whole once it does
+	if len(changed) == 0 || fs.bitmap.firstCluster == 0 {
+		return nil
+	}
+	low, high := changed[0], changed[0]
+	for _, c := range changed {
+		if c < low {
+			low = c
+		}
+		if c > high {
+			high = c
+		}
+	}
+	first, last := (low-2)/8, (high-2)/8
+	clusters, err := fs.getClusterList(fs.bitmap.firstCluster, uint64(len(fs.bitmap.bits)), false)
+	if err != nil {
+		return err
+	}
+	return fs.writeClusters(clusters, int64(first), fs.bitmap.bits[first:last+1])
+}
+
+// clusterLocation the location in the file of a cluster
+func (fs *FileSystem) clusterLocation(cluster uint32) int64 {
+	heap := int64(fs.bootSector.clusterHeapOffset) * int64(fs.bytesPerSector)
+	return fs.start + heap + int64(cluster-2)*int64(fs.bytesPerCluster)
+}
+
+// readClusters read len(b) bytes at offset in the data of a chain of clusters
+func (fs *FileSystem) readClusters(clusters []uint32, offset int64, b []byte) error {
+	return fs.clusterIO(clusters, offset, b, fs.file.ReadAt)
+}
+
+// writeClusters write b at offset in the data of a chain of clusters
+func (fs *FileSystem) writeClusters(clusters []uint32, offset int64, b []byte) error {
+	return fs.clusterIO(clusters, offset, b, fs.file.WriteAt)
+}
+
+// clusterIO read or write b at offset in the data of a chain of clusters, a cluster at a time
+func (fs *FileSystem) clusterIO(clusters []uint32, offset int64, b []byte, transfer func([]byte, int64) (int, error)) error {
+	bytesPerCluster := int64(fs.bytesPerCluster)
+	for done := 0; done < len(b); {
+		index := (offset + int64(done)) / bytesPerCluster
+		if index >= int64(len(clusters)) {
+			return fmt.Errorf("offset %d is past the end of the %d clusters", offset+int64(done), len(clusters))
+		}
+		within := (offset + int64(done)) % bytesPerCluster
+		n := int(bytesPerCluster - within)
+		if n > len(b)-done {
+			n = len(b) - done
+		}
+		count, err := transfer(b[done:done+n], fs.clusterLocation(clusters[index])+within)
+		if err != nil {
+			return err
+		}
+		if count != n {
+			return fmt.Errorf("transferred %d bytes of cluster %d instead of %d", count, clusters[index], n)
+		}
+		done += n
+	}
+	return nil
+}
+
+// setClusters set the first cluster of an entry for its new chain of clusters, which is always in the FAT
+func (de *directoryEntry) setClusters(clusters []uint32) {
+	de.firstCluster = 0
+	if len(clusters) > 0 {
+		de.firstCluster = clusters[0]
+	}
+	de.noFatChain = false
+}
+
+// sectorShift the log2 of a blocksize, which must be a valid exFAT sector size, or 0 for 512 bytes
+func sectorShift(blocksize int64) (uint8, error) {
+	if blocksize == 0 {
+		blocksize = SectorSize512
+	}
+	for shift := uint8(minBytesPerSectorSh); shift <= maxBytesPerSectorSh; shift++ {
+		if blocksize == int64(1)<<shift {
+			return shift, nil
+		}
+	}
+	return 0, fmt.Errorf("blocksize for exFAT must be 512, 1024, 2048 or 4096 bytes, or 0, not %d", blocksize)
+}
+
+// roundUp round a number up to a multiple
+func roundUp(n, multiple uint64) uint64 {
+	return (n + multiple - 1) / multiple * multiple
+}
@@ -0,0 +1,292 @@
+package exfat_test
+
+/*
+ These tests the exported functions
+ We want to do full-in tests with files
+*/
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/diskfs/go-diskfs/filesystem"
+	"github.com/diskfs/go-diskfs/filesystem/exfat"
+	"github.com/diskfs/go-diskfs/util"
+)
+
+func tmpExFAT(t *testing.T, size int64) *os.File {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "exfat_test")
+	if err != nil {
+		t.Fatalf("unable to create tempfile: %v", err)
+	}
+	t.Cleanup(func() { f.Close() })
+	if err := f.Truncate(size); err != nil {
+		t.Fatalf("unable to size tempfile: %v", err)
+	}
+	return f
+}
+
+func TestExFATCreate(t *testing.T) {
+	tests := []struct {
+		blocksize int64
+		filesize  int64
+		err       error
+	}{
+		{500, 10 * exfat.MB, fmt.Errorf("blocksize for exFAT must be")},
+		{513, 10 * exfat.MB, fmt.Errorf("blocksize for exFAT must be")},
+		{512, exfat.MinSize - 1, fmt.Errorf("requested size is smaller than minimum allowed exFAT")},
+		{0, 10 * exfat.MB, nil},
+		{512, exfat.MinSize, nil},
+		{4096, 10 * exfat.MB, nil},
+		{512, 300 * exfat.MB, nil},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(fmt.Sprintf("blocksize %d filesize %d", tt.blocksize, tt.filesize), func(t *testing.T) {
+			for _, pre := range []int64{0, 1024 * 1024} {
+				f := tmpExFAT(t, tt.filesize+pre)
+				fs, err := exfat.Create(f, tt.filesize, pre, tt.blocksize, "camera")
+				switch {
+				case (err == nil && tt.err != nil) || (err != nil && tt.err == nil) || (err != nil && tt.err != nil && !strings.HasPrefix(err.Error(), tt.err.Error())):
+					t.Fatalf("Create(%s, %d, %d, %d): mismatched errors\nactual %v\nexpected %v", f.Name(), tt.filesize, pre, tt.blocksize, err, tt.err)
+				case err != nil:
+					return
+				case fs.Type() != filesystem.TypeExFAT:
+					t.Errorf("Create returned filesystem of type %v", fs.Type())
+				}
+				fs, err = exfat.Read(f, tt.filesize, pre, tt.blocksize)
+				if err != nil {
+					t.Fatalf("error reading created filesystem: %v", err)
+				}
+				if label := fs.Label(); label != "camera" {
+					t.Errorf("label %q instead of %q", label, "camera")
+				}
+				entries, err := fs.ReadDir("/")
+				if err != nil || len(entries) != 0 {
+					t.Errorf("new filesystem has %d entries, %v", len(entries), err)
+				}
+			}
+		})
+	}
+}
+
+func TestExFATRead(t *testing.T) {
+	f := tmpExFAT(t, 10*exfat.MB)
+	if _, err := exfat.Read(f, 10*exfat.MB, 0, 512); err == nil || !strings.Contains(err.Error(), "invalid file system name") {
+		t.Errorf("reading an empty file returned %v", err)
+	}
+	if _, err := exfat.Create(f, 10*exfat.MB, 0, 512, ""); err != nil {
+		t.Fatalf("error creating filesystem: %v", err)
+	}
+	if _, err := exfat.Read(f, 10*exfat.MB, 0, 4096); err == nil || !strings.Contains(err.Error(), "does not match the exFAT sector size") {
+		t.Errorf("reading with the wrong blocksize returned %v", err)
+	}
+	if _, err := exfat.Read(f, 5*exfat.MB, 0, 512); err == nil || !strings.Contains(err.Error(), "is larger than the requested size") {
+		t.Errorf("reading with a smaller size returned %v", err)
+	}
+	// a change to the boot sector must be caught by the boot region checksum
+	if _, err := f.WriteAt([]byte{0x42}, 120); err != nil {
+		t.Fatalf("error changing boot sector: %v", err)
+	}
+	if _, err := exfat.Read(f, 10*exfat.MB, 0, 512); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("reading with a corrupt boot region returned %v", err)
+	}
+}
+
+func TestExFATFiles(t *testing.T) {
+	size := 20 * exfat.MB
+	f := tmpExFAT(t, size)
+	fs, err := exfat.Create(f, size, 0, 512, "")
+	if err != nil {
+		t.Fatalf("error creating filesystem: %v", err)
+	}
+
+	// more files than fit in a cluster in the root directory and in a subdirectory, with names of several
+	// file name entries
+	contents := map[string][]byte{}
+	for _, dir := range []string{"/", "/DCIM/100CANON/"} {
+		if err := fs.Mkdir(dir); err != nil {
+			t.Fatalf("error making directory %s: %v", dir, err)
+		}
+		for i := 0; i < 60; i++ {
+			p := fmt.Sprintf("%sa rather long file name for a picture número %d.jpg", dir, i)
+			b := make([]byte, 3000*i)
+			_, _ = rand.Read(b)
+			contents[p] = b
+			rw, err := fs.OpenFile(p, os.O_CREATE|os.O_RDWR)
+			if err != nil {
+				t.Fatalf("error creating %s: %v", p, err)
+			}
+			// write in two parts, to extend the cluster chain
+			if _, err := rw.Write(b[:len(b)/2]); err != nil {
+				t.Fatalf("error writing %s: %v", p, err)
+			}
+			if _, err := rw.Write(b[len(b)/2:]); err != nil {
+				t.Fatalf("error writing %s: %v", p, err)
+			}
+		}
+	}
+
+	fs, err = exfat.Read(f, size, 0, 512)
+	if err != nil {
+		t.Fatalf("error reading filesystem: %v", err)
+	}
+	for p, b := range contents {
+		// names are not case sensitive
+		file, err := fs.OpenFile(strings.ToUpper(p), os.O_RDONLY)
+		if err != nil {
+			t.Fatalf("error opening %s: %v", p, err)
+		}
+		read, err := io.ReadAll(file)
+		if err != nil || !bytes.Equal(read, b) {
+			t.Errorf("read %d bytes of %s, %v instead of the %d bytes written", len(read), p, err, len(b))
+		}
+	}
+	entries, err := fs.ReadDir("/DCIM/100CANON")
+	if err != nil || len(entries) != 60 {
+		t.Fatalf("read %d entries of /DCIM/100CANON, %v instead of 60", len(entries), err)
+	}
+	if entries[7].Name() != "a rather long file name for a picture número 7.jpg" || entries[7].Size() != 21000 || entries[7].IsDir() {
+		t.Errorf("unexpected entry %s of size %d", entries[7].Name(), entries[7].Size())
+	}
+	entries, err = fs.ReadDir("/")
+	if err != nil || len(entries) != 61 || !entries[60].IsDir() {
+		t.Errorf("read %d entries of /, %v instead of 61", len(entries), err)
+	}
+
+	t.Run("truncate and append", func(t *testing.T) {
+		p := "/DCIM/100CANON/a rather long file name for a picture número 10.jpg"
+		rw, err := fs.OpenFile(p, os.O_RDWR|os.O_TRUNC)
+		if err != nil {
+			t.Fatalf("error truncating %s: %v", p, err)
+		}
+		if _, err := rw.Write([]byte("short")); err != nil {
+			t.Fatalf("error writing %s: %v", p, err)
+		}
+		rw, err = fs.OpenFile(p, os.O_RDWR|os.O_APPEND)
+		if err != nil {
+			t.Fatalf("error opening %s to append: %v", p, err)
+		}
+		if _, err := rw.Write([]byte(" and more")); err != nil {
+			t.Fatalf("error writing %s: %v", p, err)
+		}
+		// writing past the end leaves zeroes in between
+		rw, err = fs.OpenFile(p, os.O_RDWR)
+		if err != nil {
+			t.Fatalf("error opening %s: %v", p, err)
+		}
+		if _, err := rw.Seek(20, io.SeekStart); err != nil {
+			t.Fatalf("error seeking %s: %v", p, err)
+		}
+		if _, err := rw.Write([]byte("end")); err != nil {
+			t.Fatalf("error writing %s: %v", p, err)
+		}
+		fs, err := exfat.Read(f, size, 0, 512)
+		if err != nil {
+			t.Fatalf("error reading filesystem: %v", err)
+		}
+		file, err := fs.OpenFile(p, os.O_RDONLY)
+		if err != nil {
+			t.Fatalf("error opening %s: %v", p, err)
+		}
+		read, err := io.ReadAll(file)
+		expected := "short and more\x00\x00\x00\x00\x00\x00end"
+		if err != nil || string(read) != expected {
+			t.Errorf("read %q, %v instead of %q", read, err, expected)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		if _, err := fs.OpenFile("/missing", os.O_RDONLY); err == nil {
+			t.Error("opening a missing file did not return an error")
+		}
+		if _, err := fs.OpenFile("/DCIM", os.O_RDONLY); err == nil || !strings.Contains(err.Error(), "cannot open directory") {
+			t.Errorf("opening a directory returned %v", err)
+		}
+		if _, err := fs.OpenFile("/bad:name", os.O_CREATE|os.O_RDWR); err == nil || !strings.Contains(err.Error(), "invalid character") {
+			t.Errorf("creating a file with an invalid name returned %v", err)
+		}
+		p := "/a rather long file name for a picture número 1.jpg/sub"
+		if err := fs.Mkdir(p); err == nil || !strings.Contains(err.Error(), "since it is a file") {
+			t.Errorf("making a directory under a file returned %v", err)
+		}
+		if err := fs.SetLabel("a label that is too long"); err == nil {
+			t.Error("setting a label that is too long did not return an error")
+		}
+	})
+
+	t.Run("no space left", func(t *testing.T) {
+		rw, err := fs.OpenFile("/large", os.O_CREATE|os.O_RDWR)
+		if err != nil {
+			t.Fatalf("error creating file: %v", err)
+		}
+		if _, err := rw.Write(make([]byte, size)); err == nil || !strings.Contains(err.Error(), "no space left on device") {
+			t.Errorf("writing more than fits returned %v", err)
+		}
+	})
+}
+
+func TestExFATLabel(t *testing.T) {
+	f := tmpExFAT(t, 10*exfat.MB)
+	fs, err := exfat.Create(f, 10*exfat.MB, 0, 512, "")
+	if err != nil {
+		t.Fatalf("error creating filesystem: %v", err)
+	}
+	for _, label := range []string{"", "SD-ÇARD", "", "eleven char"} {
+		if err := fs.SetLabel(label); err != nil {
+			t.Fatalf("error setting label %q: %v", label, err)
+		}
+		fs, err := exfat.Read(f, 10*exfat.MB, 0, 512)
+		if err != nil {
+			t.Fatalf("error reading filesystem: %v", err)
+		}
+		if actual := fs.Label(); actual != label {
+			t.Errorf("label %q instead of %q", actual, label)
+		}
+	}
+}
+
+func TestExFATReadOnly(t *testing.T) {
+	size := 10 * exfat.MB
+	f := tmpExFAT(t, size)
+	fs, err := exfat.Create(f, size, 0, 512, "")
+	if err != nil {
+		t.Fatalf("error creating filesystem: %v", err)
+	}
+	rw, err := fs.OpenFile("/existing", os.O_CREATE|os.O_RDWR)
+	if err != nil {
+		t.Fatalf("error creating file: %v", err)
+	}
+	if _, err := rw.Write([]byte("contents")); err != nil {
+		t.Fatalf("error writing file: %v", err)
+	}
+
+	ro, err := exfat.Read(util.NewReadOnlyFile(f, size), size, 0, 512)
+	if err != nil {
+		t.Fatalf("error reading filesystem: %v", err)
+	}
+	file, err := ro.OpenFile("/existing", os.O_RDONLY)
+	if err != nil {
+		t.Fatalf("unexpected error opening file read-only: %v", err)
+	}
+	b, err := io.ReadAll(file)
+	if err != nil || string(b) != "contents" {
+		t.Errorf("read %q, %v instead of file contents", b, err)
+	}
+	if err := ro.Mkdir("/new"); !errors.Is(err, filesystem.ErrReadOnlyFilesystem) {
+		t.Errorf("Mkdir returned %v instead of %v", err, filesystem.ErrReadOnlyFilesystem)
+	}
+	if err := ro.SetLabel("LABEL"); !errors.Is(err, filesystem.ErrReadOnlyFilesystem) {
+		t.Errorf("SetLabel returned %v instead of %v", err, filesystem.ErrReadOnlyFilesystem)
+	}
+	if _, err := ro.OpenFile("/file", os.O_CREATE|os.O_RDWR); !errors.Is(err, filesystem.ErrReadOnlyFilesystem) {
+		t.Errorf("OpenFile returned %v instead of %v", err, filesystem.ErrReadOnlyFilesystem)
+	}
+}
@@ -0,0 +1,152 @@
+package exfat
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// File represents a single file in an exFAT filesystem
+type File struct {
+	*directoryEntry
+	isReadWrite bool
+	isAppend    bool
+	offset      int64
+	parent      *Directory
+	filesystem  *FileSystem
+}
+
+// Read reads up to len(b) bytes from the File.
+// It returns the number of bytes read and any error encountered.
+// At end of file, Read returns 0, io.EOF
+// reads from the last known offset in the file from last read or write
+// and increments the offset by the number of bytes read.
+// Use Seek() to set at a particular point
+func (fl *File) Read(b []byte) (int, error) {
+	if fl == nil || fl.filesystem == nil {
+		return 0, os.ErrClosed
+	}
+	fs := fl.filesystem
+	size := int64(fl.dataLength) - fl.offset
+	// if there is nothing left to read, just return EOF
+	if size <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(b)) < size {
+		size = int64(len(b))
+	}
+	clusters, err := fs.getClusterList(fl.firstCluster, fl.dataLength, fl.noFatChain)
+	if err != nil {
+		return 0, fmt.Errorf("unable to get list of clusters for file: %v", err)
+	}
+	// anything past the valid data length reads as zeroes
+	toRead := size
+	if valid := int64(fl.validDataLength) - fl.offset; valid < toRead {
+		toRead = valid
+	}
+	if toRead > 0 {
+		if err := fs.readClusters(clusters, fl.offset, b[:toRead]); err != nil {
+			return 0, fmt.Errorf("unable to read file: %v", err)
+		}
+	} else {
+		toRead = 0
+	}
+	for i := toRead; i < size; i++ {
+		b[i] = 0
+	}
+
+	fl.offset += size
+	var retErr error
+	if fl.offset >= int64(fl.dataLength) {
+		retErr = io.EOF
+	}
+	return int(size), retErr
+}
+
+// Write writes len(b) bytes to the File.
+// It returns the number of bytes written and an error, if any.
+// returns a non-nil error when n != len(b)
+// writes to the last known offset in the file from last read or write
+// and increments the offset by the number of bytes read.
+// Use Seek() to set at a particular point
+func (fl *File) Write(p []byte) (int, error) {
+	if fl == nil || fl.filesystem == nil {
+		return 0, os.ErrClosed
+	}
+	fs := fl.filesystem
+	// if the file was not opened RDWR, nothing we can do
+	if !fl.isReadWrite {
+		return 0, fmt.Errorf("cannot write to file opened read-only")
+	}
+	if fl.isAppend {
+		fl.offset = int64(fl.dataLength)
+	}
+	// what is the new file size?
+	end := fl.offset + int64(len(p))
+	newSize := end
+	if newSize < int64(fl.dataLength) {
+		newSize = int64(fl.dataLength)
+	}
+	// 1- ensure we have space and clusters
+	clusters, err := fs.getClusterList(fl.firstCluster, fl.dataLength, fl.noFatChain)
+	if err != nil {
+		return 0, fmt.Errorf("unable to get list of clusters for file: %v", err)
+	}
+	clusters, err = fs.allocate(clusters, !fl.noFatChain, uint64(newSize))
+	if err != nil {
+		return 0, fmt.Errorf("unable to allocate clusters for file: %v", err)
+	}
+	fl.setClusters(clusters)
+	fl.dataLength = uint64(newSize)
+
+	// 2- zero anything between the valid data and where we write, so that it does not read as old contents
+	if gap := fl.offset - int64(fl.validDataLength); gap > 0 {
+		if err := fs.writeClusters(clusters, int64(fl.validDataLength), make([]byte, gap)); err != nil {
+			return 0, fmt.Errorf("unable to write to file: %v", err)
+		}
+	}
+	// 3- write the content for the file
+	if err := fs.writeClusters(clusters, fl.offset, p); err != nil {
+		return 0, fmt.Errorf("unable to write to file: %v", err)
+	}
+	if uint64(end) > fl.validDataLength {
+		fl.validDataLength = uint64(end)
+	}
+	fl.offset = end
+	fl.modifyTime = time.Now()
+
+	// update the parent that we have changed the file size
+	if err := fs.writeDirectoryEntries(fl.parent); err != nil {
+		return 0, fmt.Errorf("error writing directory entries to disk: %v", err)
+	}
+
+	return len(p), nil
+}
+
+// Seek set the offset to a particular point in the file
+func (fl *File) Seek(offset int64, whence int) (int64, error) {
+	if fl == nil || fl.filesystem == nil {
+		return 0, os.ErrClosed
+	}
+	newOffset := int64(0)
+	switch whence {
+	case io.SeekStart:
+		newOffset = offset
+	case io.SeekEnd:
+		newOffset = int64(fl.dataLength) + offset
+	case io.SeekCurrent:
+		newOffset = fl.offset + offset
+	}
+	if newOffset < 0 {
+		return fl.offset, fmt.Errorf("cannot set offset %d before start of file", offset)
+	}
+	fl.offset = newOffset
+	return fl.offset, nil
+}
+
+// Close close the file
+func (fl *File) Close() error {
+	fl.filesystem = nil
+	return nil
+}
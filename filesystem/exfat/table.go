@@ -0,0 +1,56 @@
+package exfat
+
+import (
+	"encoding/binary"
+)
+
+const (
+	// fatID the first entry of the FAT, the media type 0xf8 with all other bits set
+	fatID = uint32(0xfffffff8)
+	// eocMarker ends a cluster chain; exFAT has only the one value
+	eocMarker = uint32(0xffffffff)
+	// badCluster marks a cluster that cannot be used
+	badCluster = uint32(0xfffffff7)
+	// maxClusterCount the most clusters an exFAT volume can have
+	maxClusterCount = 0xfffffff5
+)
+
+// table an exFAT file allocation table. Unlike FAT32, a cluster that is in use may have no entry, when it is part
+// of a contiguous file marked NoFatChain; the allocation bitmap is the record of which clusters are free.
+type table struct {
+	entries []uint32
+}
+
+// tableFromBytes read a FAT with an entry for every cluster of the volume, plus the 2 reserved entries
+func tableFromBytes(b []byte, clusterCount uint32) *table {
+	t := table{entries: make([]uint32, clusterCount+2)}
+	for i := range t.entries {
+		if (i+1)*4 > len(b) {
+			break
+		}
+		t.entries[i] = binary.LittleEndian.Uint32(b[i*4 : i*4+4])
+	}
+	return &t
+}
+
+// newTable an empty FAT for a number of clusters
+func newTable(clusterCount uint32) *table {
+	t := table{entries: make([]uint32, clusterCount+2)}
+	t.entries[0] = fatID
+	t.entries[1] = eocMarker
+	return &t
+}
+
+// bytes the entries from first to last, inclusive, ready to be written to disk at entry first
+func (t *table) bytes(first, last uint32) []byte {
+	b := make([]byte, (last-first+1)*4)
+	for i := first; i <= last; i++ {
+		binary.LittleEndian.PutUint32(b[(i-first)*4:(i-first)*4+4], t.entries[i])
+	}
+	return b
+}
+
+// isEoc if an entry ends a cluster chain
+func isEoc(entry uint32) bool {
+	return entry == eocMarker
+}
@@ -0,0 +1,113 @@
+package exfat
+
+import (
+	"encoding/binary"
+	"fmt"
+	"unicode"
+)
+
+// upcaseTable maps every UTF-16 code unit to its upper case, which exFAT uses to compare file names
+// without regard to case and to calculate their hashes
+type upcaseTable []uint16
+
+// identityRun the marker, in a compressed up-case table, of a run of code units that map to themselves,
+// followed by the length of the run
+const identityRun = 0xffff
+
+// newUpcaseTable the up-case table Create writes, from the case mappings of the unicode package.
+// Code units whose upper case is not a single code unit map to themselves.
+func newUpcaseTable() upcaseTable {
+	t := make(upcaseTable, 0x10000)
+	for i := range t {
+		t[i] = uint16(i)
+		upper := unicode.ToUpper(rune(i))
+		if upper <= 0xffff && !(i >= 0xd800 && i <= 0xdfff) {
+			t[i] = uint16(upper)
+		}
+	}
+	return t
+}
+
+// upcaseTableFromBytes read an up-case table, compressed or not, as stored on disk. Code units past the end
+// of the table map to themselves.
+func upcaseTableFromBytes(b []byte) (upcaseTable, error) {
+	if len(b)%2 != 0 {
+		return nil, fmt.Errorf("invalid up-case table of odd length %d", len(b))
+	}
+	t := make(upcaseTable, 0x10000)
+	for i := range t {
+		t[i] = uint16(i)
+	}
+	index := 0
+	for i := 0; i < len(b) && index < len(t); i += 2 {
+		val := binary.LittleEndian.Uint16(b[i : i+2])
+		if val == identityRun && i+4 <= len(b) {
+			i += 2
+			index += int(binary.LittleEndian.Uint16(b[i : i+2]))
+			continue
+		}
+		t[index] = val
+		index++
+	}
+	return t, nil
+}
+
+// bytes the up-case table as stored on disk, compressed with every run of code units that map to themselves
+// of 3 or more replaced by a marker and the length of the run
+func (t upcaseTable) bytes() []byte {
+	b := make([]byte, 0, 6000)
+	for i := 0; i < len(t); {
+		if t[i] != uint16(i) {
+			b = binary.LittleEndian.AppendUint16(b, t[i])
+			i++
+			continue
+		}
+		run := 0
+		for i+run < len(t) && t[i+run] == uint16(i+run) && run < 0xffff {
+			run++
+		}
+		if run < 3 {
+			// a marker and length take more space than a short run itself
+			for ; run > 0; run-- {
+				b = binary.LittleEndian.AppendUint16(b, t[i])
+				i++
+			}
+			continue
+		}
+		b = binary.LittleEndian.AppendUint16(b, identityRun)
+		b = binary.LittleEndian.AppendUint16(b, uint16(run))
+		i += run
+	}
+	return b
+}
+
+// upcase the upper case of a name, as UTF-16 code units
+func (t upcaseTable) upcase(name []uint16) []uint16 {
+	upper := make([]uint16, len(name))
+	for i, c := range name {
+		upper[i] = t[c]
+	}
+	return upper
+}
+
+// equalFold if two names are the same without regard to case
+func (t upcaseTable) equalFold(a, b []uint16) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if t[a[i]] != t[b[i]] {
+			return false
+		}
+	}
+	return true
+}
+
+// tableChecksum the checksum of the up-case table as stored on disk, kept in its directory entry
+func tableChecksum(b []byte) uint32 {
+	var checksum uint32
+	for _, c := range b {
+		checksum = (checksum<<31 | checksum>>1) + uint32(c)
+	}
+	return checksum
+}
@@ -0,0 +1,44 @@
+package exfat
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestUpcaseTable(t *testing.T) {
+	table := newUpcaseTable()
+	for c, expected := range map[uint16]uint16{'a': 'A', 'Z': 'Z', 0xe9: 0xc9, 0x3c9: 0x3a9, 0x0131: 0x49, '1': '1', 0xd800: 0xd800} {
+		if actual := table[c]; actual != expected {
+			t.Errorf("up-case of 0x%04x is 0x%04x instead of 0x%04x", c, actual, expected)
+		}
+	}
+	b := table.bytes()
+	// compressed, it is much smaller than the 128KB of a full table
+	if len(b) > 8192 {
+		t.Errorf("compressed table of %d bytes", len(b))
+	}
+	parsed, err := upcaseTableFromBytes(b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := range table {
+		if parsed[i] != table[i] {
+			t.Fatalf("parsed up-case of 0x%04x is 0x%04x instead of 0x%04x", i, parsed[i], table[i])
+		}
+	}
+	// an uncompressed table of only the first 128 characters
+	b = make([]byte, 256)
+	for i := 0; i < 128; i++ {
+		binary.LittleEndian.PutUint16(b[i*2:], table[i])
+	}
+	parsed, err = upcaseTableFromBytes(b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if parsed['a'] != 'A' || parsed[0xe9] != 0xe9 {
+		t.Errorf("uncompressed partial table maps a to %c and é to %c", parsed['a'], parsed[0xe9])
+	}
+	if !table.equalFold(utf16Name("Número"), utf16Name("NÚMERO")) || table.equalFold(utf16Name("a"), utf16Name("b")) {
+		t.Errorf("names are not compared without regard to case")
+	}
+}
@@ -0,0 +1,44 @@
+package exfat
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	// KB represents one KB
+	KB int64 = 1024
+	// MB represents one MB
+	MB int64 = 1024 * KB
+	// GB represents one GB
+	GB int64 = 1024 * MB
+	// TB represents one TB
+	TB int64 = 1024 * GB
+	// MinSize is the minimum size of an exFAT filesystem in bytes
+	MinSize int64 = MB
+)
+
+func universalizePath(p string) (string, error) {
+	// globalize the separator
+	ps := strings.ReplaceAll(p, "\\", "/")
+	if ps == "" || ps[0] != '/' {
+		return "", errors.New("must use absolute paths")
+	}
+	return ps, nil
+}
+
+func splitPath(p string) ([]string, error) {
+	ps, err := universalizePath(p)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Split(ps, "/")
+	// eliminate empty parts
+	ret := make([]string, 0)
+	for _, sub := range parts {
+		if sub != "" {
+			ret = append(ret, sub)
+		}
+	}
+	return ret, nil
+}
@@ -1,6 +1,8 @@
 package fat32
 
 import (
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -22,6 +24,19 @@ func (d *Directory) entriesFromBytes(b []byte) error {
 
 // entriesToBytes convert our entries to raw bytes
 func (d *Directory) entriesToBytes(bytesPerCluster int) ([]byte, error) {
+	b, err := d.entryBytes()
+	if err != nil {
+		return nil, err
+	}
+	remainder := len(b) % bytesPerCluster
+	extra := bytesPerCluster - remainder
+	zeroes := make([]byte, extra)
+	b = append(b, zeroes...)
+	return b, nil
+}
+
+// entryBytes convert our entries to raw bytes, without padding
+func (d *Directory) entryBytes() ([]byte, error) {
 	b := make([]byte, 0)
 	for _, de := range d.entries {
 		b2, err := de.toBytes()
@@ -30,23 +45,17 @@ func (d *Directory) entriesToBytes(bytesPerCluster int) ([]byte, error) {
 		}
 		b = append(b, b2...)
 	}
-	remainder := len(b) % bytesPerCluster
-	extra := bytesPerCluster - remainder
-	zeroes := make([]byte, extra)
-	b = append(b, zeroes...)
 	return b, nil
 }
 
 // createEntry creates an entry in the given directory, and returns the handle to it
 func (d *Directory) createEntry(name string, cluster uint32, dir bool) (*directoryEntry, error) {
 	// is it a long filename or a short filename?
-	var isLFN bool
-	// TODO: convertLfnSfn does not calculate if the short name conflicts and thus shoukld increment the last character
-	//       that should happen here, once we can look in the directory entry
-	shortName, extension, isLFN, _ := convertLfnSfn(name)
+	shortName, extension, isLFN, isTruncated := convertLfnSfn(name)
 	lfn := ""
 	if isLFN {
 		lfn = name
+		shortName = d.uniqueShortName(shortName, extension, isTruncated)
 	}
 
 	// allocate a slot for the new filename in the existing directory
@@ -70,6 +79,45 @@ func (d *Directory) createEntry(name string, cluster uint32, dir bool) (*directo
 	return &entry, nil
 }
 
+// uniqueShortName the short name for a long filename, with the lowest ~N tail that no other entry in the
+// directory has with the same extension. A name that did not need a tail keeps it free if it can.
+func (d *Directory) uniqueShortName(shortName, extension string, isTruncated bool) string {
+	taken := map[string]bool{}
+	for _, e := range d.entries {
+		if !e.isVolumeLabel {
+			taken[strings.ToUpper(e.filenameShort)+"."+strings.ToUpper(e.fileExtension)] = true
+		}
+	}
+	base := shortName
+	if isTruncated {
+		// convertLfnSfn already gave it the tail ~1
+		base = shortName[:strings.LastIndex(shortName, "~")]
+	} else if !taken[shortName+"."+extension] {
+		return shortName
+	}
+	for n := 1; ; n++ {
+		tail := "~" + strconv.Itoa(n)
+		candidate := base
+		if len(candidate)+len(tail) > 8 {
+			candidate = candidate[:8-len(tail)]
+		}
+		candidate += tail
+		if !taken[candidate+"."+extension] {
+			return candidate
+		}
+	}
+}
+
+// removeEntry removes an entry from the directory
+func (d *Directory) removeEntry(entry *directoryEntry) {
+	for i, e := range d.entries {
+		if e == entry {
+			d.entries = append(d.entries[:i], d.entries[i+1:]...)
+			return
+		}
+	}
+}
+
 // createVolumeLabel create a volume label entry in the given directory, and return the handle to it
 func (d *Directory) createVolumeLabel(name string) (*directoryEntry, error) {
 	// allocate a slot for the new filename in the existing directory
@@ -137,3 +137,40 @@ func TestDirectoryCreateEntry(t *testing.T) {
 		}
 	}
 }
+
+func TestDirectoryUniqueShortName(t *testing.T) {
+	d := &Directory{
+		entries: []*directoryEntry{
+			{filenameShort: "LONGFI~1", fileExtension: "TXT"},
+			{filenameShort: "LONGFI~2", fileExtension: "TXT"},
+			{filenameShort: "LONGFI~1", fileExtension: "DAT"},
+			{filenameShort: "AB", fileExtension: "TXT"},
+			{filenameShort: "VERYLO~9", fileExtension: ""},
+			{filenameShort: "LABEL   ", fileExtension: "   ", isVolumeLabel: true},
+		},
+	}
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"longfilename.txt", "LONGFI~3"},
+		{"longfilename.dat", "LONGFI~2"},
+		{"longfilename.bin", "LONGFI~1"},
+		{"a b.txt", "AB~1"},
+		{"a b.dat", "AB"},
+		{"verylongname", "VERYLO~1"},
+	}
+	for _, tt := range tests {
+		shortName, extension, _, isTruncated := convertLfnSfn(tt.name)
+		if actual := d.uniqueShortName(shortName, extension, isTruncated); actual != tt.expected {
+			t.Errorf("uniqueShortName(%s): %s instead of %s", tt.name, actual, tt.expected)
+		}
+	}
+	// the tail gets longer, shortening the rest of the name
+	for n := 3; n <= 9; n++ {
+		d.entries = append(d.entries, &directoryEntry{filenameShort: fmt.Sprintf("LONGFI~%d", n), fileExtension: "TXT"})
+	}
+	if actual := d.uniqueShortName("LONGFI~1", "TXT", true); actual != "LONGF~10" {
+		t.Errorf("uniqueShortName with 9 taken: %s instead of LONGF~10", actual)
+	}
+}
@@ -1,6 +1,9 @@
 // Package fat32 provides utilities to interact with, manipulate and create a FAT32 filesystem on a block device or
 // a disk image.
 //
+// FAT12 and FAT16 filesystems, as on floppy disks and other small volumes, are read and created as well. Create
+// picks the variant from the size of the filesystem, unless one is given with WithFATType.
+//
 // references:
 //
 //	https://en.wikipedia.org/wiki/Design_of_the_FAT_file_system
@@ -0,0 +1,140 @@
+package fat32
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// dos40EBPB is the DOS 4.0 Extended BIOS Parameter Block, used by FAT12 and FAT16
+type dos40EBPB struct {
+	dos331BPB             *dos331BPB // Dos331BPB holds the embedded DOS 3.31 BIOS Parameter BLock
+	driveNumber           uint8      // DriveNumber is the code for the relative position and type of this drive in the system
+	reservedFlags         uint8      // ReservedFlags are flags used by the operating system and/or BIOS for various purposes
+	extendedBootSignature uint8      // ExtendedBootSignature contains the flag as to whether this is a short (32-byte) or long (51-byte) DOS 4.0 EBPB
+	volumeSerialNumber    uint32     // VolumeSerialNumber usually generated by some form of date and time
+	volumeLabel           string     // VolumeLabel, an arbitrary 11-byte string
+	fileSystemType        string     // FileSystemType is the 8-byte string holding the name of the file system type
+}
+
+func (bpb *dos40EBPB) equal(a *dos40EBPB) bool {
+	if (bpb == nil && a != nil) || (a == nil && bpb != nil) {
+		return false
+	}
+	if bpb == nil && a == nil {
+		return true
+	}
+	return bpb.dos331BPB.equal(a.dos331BPB) &&
+		bpb.driveNumber == a.driveNumber &&
+		bpb.reservedFlags == a.reservedFlags &&
+		bpb.extendedBootSignature == a.extendedBootSignature &&
+		bpb.volumeSerialNumber == a.volumeSerialNumber &&
+		bpb.volumeLabel == a.volumeLabel &&
+		bpb.fileSystemType == a.fileSystemType
+}
+
+// dos40EBPBFromBytes reads the FAT12 or FAT16 Extended BIOS Parameter Block from a slice of exactly 51 bytes,
+// the size of the long format. Returns the size of the EBPB actually found, 32 or 51 bytes.
+func dos40EBPBFromBytes(b []byte) (*dos40EBPB, int, error) {
+	if b == nil || len(b) != 51 {
+		return nil, 0, errors.New("cannot read DOS 4.0 EBPB from invalid byte slice, must be precisely 51 bytes ")
+	}
+	bpb := dos40EBPB{}
+	size := 0
+
+	// extract the embedded DOS 3.31 BPB
+	dos331bpb, err := dos331BPBFromBytes(b[0:25])
+	if err != nil {
+		return nil, 0, fmt.Errorf("could not read embedded DOS 3.31 BPB: %v", err)
+	}
+	bpb.dos331BPB = dos331bpb
+
+	bpb.driveNumber = b[25]
+	bpb.reservedFlags = b[26]
+	extendedSignature := b[27]
+	bpb.extendedBootSignature = extendedSignature
+	// same byte order as the DOS 7.1 EBPB
+	bpb.volumeSerialNumber = binary.BigEndian.Uint32(b[28:32])
+
+	switch extendedSignature {
+	case shortDos71EBPB:
+		size = 32
+	case longDos71EBPB:
+		size = 51
+		// remove padding from each
+		re := regexp.MustCompile(" +$")
+		bpb.volumeLabel = re.ReplaceAllString(string(b[32:43]), "")
+		bpb.fileSystemType = re.ReplaceAllString(string(b[43:51]), "")
+	default:
+		return nil, size, fmt.Errorf("unknown DOS 4.0 EBPB Signature: %v", extendedSignature)
+	}
+
+	return &bpb, size, nil
+}
+
+// toBytes returns the Extended BIOS Parameter Block in a slice of bytes directly ready to
+// write to disk
+func (bpb *dos40EBPB) toBytes() ([]byte, error) {
+	var b []byte
+	switch bpb.extendedBootSignature {
+	case shortDos71EBPB:
+		b = make([]byte, 32)
+	case longDos71EBPB:
+		b = make([]byte, 51)
+		label := bpb.volumeLabel
+		if len(label) > 11 {
+			return nil, fmt.Errorf("invalid volume label: too long at %d characters, maximum is %d", len(label), 11)
+		}
+		if len(label) != len([]rune(label)) {
+			return nil, fmt.Errorf("invalid volume label: non-ascii characters")
+		}
+		// pad with 0x20 = " "
+		copy(b[32:43], fmt.Sprintf("%-11s", label))
+		fstype := bpb.fileSystemType
+		if len(fstype) > 8 {
+			return nil, fmt.Errorf("invalid filesystem type: too long at %d characters, maximum is %d", len(fstype), 8)
+		}
+		if len(fstype) != len([]rune(fstype)) {
+			return nil, fmt.Errorf("invalid filesystem type: non-ascii characters")
+		}
+		copy(b[43:51], fmt.Sprintf("%-8s", fstype))
+	default:
+		return nil, fmt.Errorf("unknown DOS 4.0 EBPB Signature: %v", bpb.extendedBootSignature)
+	}
+	copy(b[0:25], bpb.dos331BPB.toBytes())
+	b[25] = bpb.driveNumber
+	b[26] = bpb.reservedFlags
+	b[27] = bpb.extendedBootSignature
+	binary.BigEndian.PutUint32(b[28:32], bpb.volumeSerialNumber)
+
+	return b, nil
+}
+
+// dos71EBPB the fields of the EBPB in a DOS 7.1 EBPB, which the filesystem uses for every variant of FAT,
+// with the 16-bit sectors per FAT of the DOS 2.0 BPB as its sectors per FAT
+func (bpb *dos40EBPB) dos71EBPB() *dos71EBPB {
+	return &dos71EBPB{
+		dos331BPB:             bpb.dos331BPB,
+		sectorsPerFat:         uint32(bpb.dos331BPB.dos20BPB.sectorsPerFat),
+		driveNumber:           bpb.driveNumber,
+		reservedFlags:         bpb.reservedFlags,
+		extendedBootSignature: bpb.extendedBootSignature,
+		volumeSerialNumber:    bpb.volumeSerialNumber,
+		volumeLabel:           bpb.volumeLabel,
+		fileSystemType:        bpb.fileSystemType,
+	}
+}
+
+// dos40EBPB the DOS 4.0 EBPB with the fields of a DOS 7.1 EBPB, for writing a FAT12 or FAT16 boot sector
+func (bpb *dos71EBPB) dos40EBPB() *dos40EBPB {
+	return &dos40EBPB{
+		dos331BPB:             bpb.dos331BPB,
+		driveNumber:           bpb.driveNumber,
+		reservedFlags:         bpb.reservedFlags,
+		extendedBootSignature: bpb.extendedBootSignature,
+		volumeSerialNumber:    bpb.volumeSerialNumber,
+		volumeLabel:           bpb.volumeLabel,
+		fileSystemType:        bpb.fileSystemType,
+	}
+}
@@ -0,0 +1,87 @@
+package fat32
+
+import (
+	"strings"
+	"testing"
+)
+
+func getValidDos40EBPB() *dos40EBPB {
+	return &dos40EBPB{
+		dos331BPB:             getValidDos331BPB(),
+		driveNumber:           128,
+		reservedFlags:         0x00,
+		extendedBootSignature: 0x29,
+		volumeSerialNumber:    2712131608,
+		volumeLabel:           "go-diskfs",
+		fileSystemType:        "FAT16",
+	}
+}
+
+func TestDos40EBPBFromBytes(t *testing.T) {
+	t.Run("mismatched length", func(t *testing.T) {
+		bpb, size, err := dos40EBPBFromBytes(make([]byte, 50))
+		if err == nil {
+			t.Fatalf("Did not return expected error")
+		}
+		if bpb != nil {
+			t.Fatalf("returned bpb was non-nil")
+		}
+		if size > 0 {
+			t.Errorf("read %d bytes instead of 0", size)
+		}
+		expected := "cannot read DOS 4.0 EBPB from invalid byte slice"
+		if !strings.HasPrefix(err.Error(), expected) {
+			t.Errorf("error type %s instead of expected %s", err.Error(), expected)
+		}
+	})
+	t.Run("invalid signature", func(t *testing.T) {
+		b, err := getValidDos40EBPB().toBytes()
+		if err != nil {
+			t.Fatalf("error converting EBPB to bytes: %v", err)
+		}
+		b[27] = 0x30
+		_, _, err = dos40EBPBFromBytes(b)
+		expected := "unknown DOS 4.0 EBPB Signature"
+		if err == nil || !strings.HasPrefix(err.Error(), expected) {
+			t.Errorf("returned error %v instead of expected %s", err, expected)
+		}
+	})
+	for _, signature := range []uint8{shortDos71EBPB, longDos71EBPB} {
+		valid := getValidDos40EBPB()
+		valid.extendedBootSignature = signature
+		expectedSize := 51
+		if signature == shortDos71EBPB {
+			valid.volumeLabel, valid.fileSystemType = "", ""
+			expectedSize = 32
+		}
+		b, err := valid.toBytes()
+		if err != nil {
+			t.Fatalf("error converting EBPB to bytes: %v", err)
+		}
+		if len(b) != expectedSize {
+			t.Errorf("toBytes returned %d bytes instead of %d", len(b), expectedSize)
+		}
+		b = append(b, make([]byte, 51-len(b))...)
+		bpb, size, err := dos40EBPBFromBytes(b)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if size != expectedSize {
+			t.Errorf("read %d bytes instead of %d", size, expectedSize)
+		}
+		if !bpb.equal(valid) {
+			t.Errorf("mismatched EBPB, actual %#v expected %#v", bpb, valid)
+		}
+	}
+}
+
+func TestDos40EBPBDos71EBPB(t *testing.T) {
+	valid := getValidDos40EBPB()
+	ebpb := valid.dos71EBPB()
+	if ebpb.sectorsPerFat != uint32(valid.dos331BPB.dos20BPB.sectorsPerFat) {
+		t.Errorf("sectors per FAT %d instead of %d from the DOS 2.0 BPB", ebpb.sectorsPerFat, valid.dos331BPB.dos20BPB.sectorsPerFat)
+	}
+	if bpb := ebpb.dos40EBPB(); !bpb.equal(valid) {
+		t.Errorf("mismatched EBPB after conversion, actual %#v expected %#v", bpb, valid)
+	}
+}
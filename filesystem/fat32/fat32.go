@@ -61,6 +61,7 @@ type FileSystem struct {
 	size            int64
 	start           int64
 	file            util.File
+	readOnly        bool
 }
 
 // Equal compare if two filesystems are equal
@@ -88,7 +89,10 @@ func (fs *FileSystem) Equal(a *FileSystem) bool {
 //
 // If the provided blocksize is 0, it will use the default of 512 bytes. If it is any number other than 0
 // or 512, it will return an error.
-func Create(f util.File, size, start, blocksize int64, volumeLabel string) (*FileSystem, error) {
+//
+// The variant of FAT is picked from the size, as Microsoft's format does: FAT12 up to about 4MB, FAT16 up to 512MB,
+// and FAT32 above that. Pass WithFATType to create a specific variant, e.g. FAT32 for an EFI System Partition.
+func Create(f util.File, size, start, blocksize int64, volumeLabel string, opts ...CreateOpt) (*FileSystem, error) {
 	// blocksize must be <=0 or exactly SectorSize512 or error
 	if blocksize != int64(SectorSize512) && blocksize > 0 {
 		return nil, fmt.Errorf("blocksize for FAT32 must be either 512 bytes or 0, not %d", blocksize)
@@ -99,11 +103,29 @@ func Create(f util.File, size, start, blocksize int64, volumeLabel string) (*Fil
 	if size < blocksize*4 {
 		return nil, fmt.Errorf("requested size is smaller than minimum allowed FAT32, requested %d minimum %d", size, blocksize*4)
 	}
+	o := &createOpts{}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	fatType := o.fatType
+	if fatType == FATAuto {
+		fatType = autoFATType(uint32(size / int64(SectorSize512)))
+	}
 	// FAT filesystems use time-of-day of creation as a volume ID
 	now := time.Now()
 	// because we like the fudges other people did for uniqueness
 	volid := uint32(now.Unix()<<20 | (now.UnixNano() / 1000000))
 
+	if fatType != FAT32 {
+		fs, err := newFat1216FileSystem(f, size, start, fatType, volid)
+		if err != nil {
+			return nil, err
+		}
+		return fs.format(volumeLabel)
+	}
+
 	fsisPrimarySector := uint16(1)
 	backupBootSector := uint16(6)
 
@@ -251,6 +273,92 @@ func Create(f util.File, size, start, blocksize int64, volumeLabel string) (*Fil
 		file:            f,
 	}
 
+	return fs.format(volumeLabel)
+}
+
+// newFat1216FileSystem the layout of a new FAT12 or FAT16 filesystem, with 1 reserved sector, 2 FATs and
+// a fixed size root directory between the FATs and the data clusters
+func newFat1216FileSystem(f util.File, size, start int64, fatType FATType, volid uint32) (*FileSystem, error) {
+	totalSectors := uint32(size / int64(SectorSize512))
+	layout, err := newFat1216Layout(fatType, totalSectors)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create %s filesystem of %d bytes: %v", fatType, size, err)
+	}
+	reservedSectors := uint16(1)
+	mediaType := uint8(MediaFixedDisk)
+
+	dos20bpb := dos20BPB{
+		sectorsPerCluster:    layout.sectorsPerCluster,
+		reservedSectors:      reservedSectors,
+		fatCount:             2,
+		mediaType:            mediaType,
+		bytesPerSector:       SectorSize512,
+		rootDirectoryEntries: layout.rootDirEntries,
+		sectorsPerFat:        layout.sectorsPerFat,
+	}
+	dos331bpb := dos331BPB{
+		dos20BPB:        &dos20bpb,
+		heads:           1,
+		sectorsPerTrack: 1,
+		hiddenSectors:   0,
+	}
+	// the 16-bit total sectors is used when it is large enough, as for a floppy disk
+	if totalSectors < 0x10000 {
+		dos20bpb.totalSectors = uint16(totalSectors)
+	} else {
+		dos331bpb.totalSectors = totalSectors
+	}
+	fileSystemType := fileSystemTypeFAT16
+	fatID, eocMarker := uint32(0xff00)+uint32(mediaType), uint32(0xffff)
+	if fatType == FAT12 {
+		fileSystemType = fileSystemTypeFAT12
+		fatID, eocMarker = uint32(0xf00)+uint32(mediaType), uint32(0xfff)
+	}
+	ebpb := dos71EBPB{
+		dos331BPB:             &dos331bpb,
+		extendedBootSignature: longDos71EBPB,
+		volumeSerialNumber:    volid,
+		volumeLabel:           "NO NAME    ",
+		fileSystemType:        fileSystemType,
+		driveNumber:           128,
+		sectorsPerFat:         uint32(layout.sectorsPerFat),
+	}
+	bs := msDosBootSector{
+		oemName:            "godiskfs",
+		jumpInstruction:    [3]byte{0xeb, 0x3c, 0x90},
+		bootCode:           []byte{},
+		biosParameterBlock: &ebpb,
+		fatType:            fatType,
+	}
+
+	fatSize := uint32(layout.sectorsPerFat) * uint32(SectorSize512)
+	fat := table{
+		fatID:        fatID,
+		eocMarker:    eocMarker,
+		unusedMarker: 0,
+		size:         fatSize,
+		// the root directory is not in a cluster, so all of the clusters are free
+		rootDirCluster: 0,
+		clusters:       map[uint32]uint32{},
+		maxCluster:     layout.clusters + 2,
+		fatType:        fatType,
+	}
+	dataStart := uint32(reservedSectors)*uint32(SectorSize512) + 2*fatSize + rootDirSectors(layout.rootDirEntries)*uint32(SectorSize512)
+
+	return &FileSystem{
+		bootSector:      bs,
+		table:           fat,
+		dataStart:       dataStart,
+		bytesPerCluster: int(layout.sectorsPerCluster) * int(SectorSize512),
+		start:           start,
+		size:            size,
+		file:            f,
+	}, nil
+}
+
+// format write the boot sector, FS Information Sector, FATs and an empty root directory with the volume label
+// of a new filesystem
+func (fs *FileSystem) format(volumeLabel string) (*FileSystem, error) {
 	// write the boot sector
 	if err := fs.writeBootSector(); err != nil {
 		return nil, fmt.Errorf("failed to write the boot sector: %v", err)
@@ -267,18 +375,21 @@ func Create(f util.File, size, start, blocksize int64, volumeLabel string) (*Fil
 	}
 
 	// create root directory
-	// be sure to zero out the root cluster, so we do not pick up phantom
-	// entries.
-	clusterStart := fs.start + int64(fs.dataStart)
-	// length of cluster in bytes
-	tmpb := make([]byte, fs.bytesPerCluster)
-	// zero out the root directory cluster
-	written, err := f.WriteAt(tmpb, clusterStart)
+	// be sure to zero out the root cluster, or the fixed size root directory of FAT12 and FAT16,
+	// so we do not pick up phantom entries.
+	rootStart := fs.start + int64(fs.dataStart)
+	rootSize := fs.bytesPerCluster
+	if start, size := fs.fixedRootDir(); size > 0 {
+		rootStart, rootSize = fs.start+start, size
+	}
+	tmpb := make([]byte, rootSize)
+	// zero out the root directory
+	written, err := fs.file.WriteAt(tmpb, rootStart)
 	if err != nil {
 		return nil, fmt.Errorf("failed to zero out root directory: %v", err)
 	}
-	if written != len(tmpb) || written != fs.bytesPerCluster {
-		return nil, fmt.Errorf("incomplete zero out of root directory, wrote %d bytes instead of expected %d for cluster size %d", written, len(tmpb), fs.bytesPerCluster)
+	if written != len(tmpb) {
+		return nil, fmt.Errorf("incomplete zero out of root directory, wrote %d bytes instead of expected %d", written, len(tmpb))
 	}
 
 	// create a volumelabel entry in the root directory
@@ -320,6 +431,9 @@ func Create(f util.File, size, start, blocksize int64, volumeLabel string) (*Fil
 //
 // If the provided blocksize is 0, it will use the default of 512 bytes. If it is any number other than 0
 // or 512, it will return an error.
+//
+// If the file is read-only, as reported by util.IsReadOnly, e.g. the file of a disk opened in read-only mode,
+// the filesystem is read-only as well: changing it returns filesystem.ErrReadOnlyFilesystem.
 func Read(file util.File, size, start, blocksize int64) (*FileSystem, error) {
 	// blocksize must be <=0 or exactly SectorSize512 or error
 	if blocksize != int64(SectorSize512) && blocksize > 0 {
@@ -355,29 +469,43 @@ func Read(file util.File, size, start, blocksize int64) (*FileSystem, error) {
 	fatPrimaryStart := uint64(reservedSectors) * uint64(SectorSize512)
 	fatSecondaryStart := fatPrimaryStart + uint64(fatSize)
 
-	fsisBytes := make([]byte, 512)
-	read, err := file.ReadAt(fsisBytes, int64(bs.biosParameterBlock.fsInformationSector)*blocksize+start)
-	if err != nil {
-		return nil, fmt.Errorf("unable to read bytes for FSInformationSector: %v", err)
-	}
-	if read != 512 {
-		return nil, fmt.Errorf("read %d bytes instead of expected %d for FS Information Sector", read, 512)
-	}
-	fsis, err := fsInformationSectorFromBytes(fsisBytes)
-	if err != nil {
-		return nil, fmt.Errorf("error reading FileSystem Information Sector: %v", err)
+	fatType := bs.fatTypeOrFAT32()
+
+	// only FAT32 has an FS Information Sector
+	fsis := &FSInformationSector{}
+	if fatType == FAT32 {
+		fsisBytes := make([]byte, 512)
+		read, err := file.ReadAt(fsisBytes, int64(bs.biosParameterBlock.fsInformationSector)*blocksize+start)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read bytes for FSInformationSector: %v", err)
+		}
+		if read != 512 {
+			return nil, fmt.Errorf("read %d bytes instead of expected %d for FS Information Sector", read, 512)
+		}
+		fsis, err = fsInformationSectorFromBytes(fsisBytes)
+		if err != nil {
+			return nil, fmt.Errorf("error reading FileSystem Information Sector: %v", err)
+		}
 	}
 
 	b := make([]byte, fatSize)
 	_, _ = file.ReadAt(b, int64(fatPrimaryStart)+start)
-	fat := tableFromBytes(b)
+	fat := tableFromBytesOfType(b, fatType)
 
 	_, _ = file.ReadAt(b, int64(fatSecondaryStart)+start)
-	fat2 := tableFromBytes(b)
+	fat2 := tableFromBytesOfType(b, fatType)
 	if !fat.equal(fat2) {
 		return nil, errors.New("fat tables did not much")
 	}
 	dataStart := uint32(fatSecondaryStart) + fat.size
+	if fatType != FAT32 {
+		// the FAT usually has room for more entries than there are clusters
+		clusters := fat1216Clusters(bs.biosParameterBlock.dos331BPB)
+		if fat.maxCluster > clusters+2 {
+			fat.maxCluster = clusters + 2
+		}
+		dataStart += rootDirSectors(bs.biosParameterBlock.dos331BPB.dos20BPB.rootDirectoryEntries) * uint32(SectorSize512)
+	}
 
 	return &FileSystem{
 		bootSector:      *bs,
@@ -388,6 +516,7 @@ func Read(file util.File, size, start, blocksize int64) (*FileSystem, error) {
 		start:           start,
 		size:            size,
 		file:            file,
+		readOnly:        util.IsReadOnly(file),
 	}, nil
 }
 
@@ -429,6 +558,10 @@ func (fs *FileSystem) writeBootSector() error {
 }
 
 func (fs *FileSystem) writeFsis() error {
+	// only FAT32 has an FS Information Sector
+	if fs.FATType() != FAT32 {
+		return nil
+	}
 	fsInformationSector := fs.bootSector.biosParameterBlock.fsInformationSector
 	backupBootSector := fs.bootSector.biosParameterBlock.backupBootSector
 	fsisPrimary := int64(fsInformationSector * uint16(SectorSize512))
@@ -471,11 +604,36 @@ func (fs *FileSystem) Type() filesystem.Type {
 	return filesystem.TypeFat32
 }
 
+// FATType returns the variant of FAT of the filesystem, FAT12, FAT16 or FAT32
+func (fs *FileSystem) FATType() FATType {
+	return fs.bootSector.fatTypeOrFAT32()
+}
+
+// fixedRootDir the location in bytes from the start of the filesystem, and the size in bytes, of the fixed size
+// root directory of FAT12 and FAT16, which follows the FATs. The size is 0 for FAT32, whose root directory is
+// a cluster chain.
+func (fs *FileSystem) fixedRootDir() (int64, int) {
+	if fs.FATType() == FAT32 {
+		return 0, 0
+	}
+	bpb20 := fs.bootSector.biosParameterBlock.dos331BPB.dos20BPB
+	start := int64(bpb20.reservedSectors)*int64(SectorSize512) + int64(bpb20.fatCount)*int64(fs.table.size)
+	return start, int(bpb20.rootDirectoryEntries) * bytesPerSlot
+}
+
+// isFixedRootDir if a directory is the fixed size root directory of FAT12 and FAT16
+func (fs *FileSystem) isFixedRootDir(dir *Directory) bool {
+	return dir.clusterLocation == 0 && fs.FATType() != FAT32
+}
+
 // Mkdir make a directory at the given path. It is equivalent to `mkdir -p`, i.e. idempotent, in that:
 //
 // * It will make the entire tree path if it does not exist
 // * It will not return an error if the path already exists
 func (fs *FileSystem) Mkdir(p string) error {
+	if fs.readOnly {
+		return fmt.Errorf("cannot make directory %s: %w", p, filesystem.ErrReadOnlyFilesystem)
+	}
 	_, _, err := fs.readDirWithMkdir(p, true)
 	// we are not interesting in returning the entries
 	return err
@@ -523,8 +681,12 @@ func (fs *FileSystem) ReadDir(p string) ([]os.FileInfo, error) {
 //
 // accepts normal os.OpenFile flags
 //
-// returns an error if the file does not exist
+// returns an error if the file does not exist, or if flags that would change the file are passed
+// on a read-only filesystem
 func (fs *FileSystem) OpenFile(p string, flag int) (filesystem.File, error) {
+	if fs.readOnly && flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, fmt.Errorf("cannot open %s for writing: %w", p, filesystem.ErrReadOnlyFilesystem)
+	}
 	// get the path
 	dir := path.Dir(p)
 	filename := path.Base(p)
@@ -599,6 +761,232 @@ func (fs *FileSystem) OpenFile(p string, flag int) (filesystem.File, error) {
 	}, nil
 }
 
+// Remove removes the file or empty directory at the given path, freeing its clusters.
+//
+// Will return an error if the path does not exist, or if it is a directory that is not empty; use RemoveAll
+// to remove a directory and everything in it.
+func (fs *FileSystem) Remove(p string) error {
+	return fs.remove(p, false)
+}
+
+// RemoveAll removes the file or directory at the given path, including any children of a directory,
+// freeing their clusters. It is equivalent to `rm -rf`, in that it does not return an error if the
+// path does not exist.
+func (fs *FileSystem) RemoveAll(p string) error {
+	return fs.remove(p, true)
+}
+
+// remove removes the entry at the given path from its parent directory, and frees its clusters and,
+// if recursive, those of all of its children
+func (fs *FileSystem) remove(p string, recursive bool) error {
+	if fs.readOnly {
+		return fmt.Errorf("cannot remove %s: %w", p, filesystem.ErrReadOnlyFilesystem)
+	}
+	dir := path.Dir(p)
+	filename := path.Base(p)
+	// if the dir == filename, then it is just /
+	if dir == filename {
+		return fmt.Errorf("cannot remove root directory %s", p)
+	}
+	if filename == "." || filename == ".." {
+		return fmt.Errorf("cannot remove %s", p)
+	}
+	parentDir, entries, err := fs.readDirWithMkdir(dir, false)
+	if err != nil {
+		if recursive {
+			return nil
+		}
+		return fmt.Errorf("could not read directory entries for %s", dir)
+	}
+	targetEntry := findEntry(entries, filename)
+	if targetEntry == nil {
+		if recursive {
+			return nil
+		}
+		return fmt.Errorf("target %s does not exist", p)
+	}
+
+	if targetEntry.isSubdirectory && !recursive {
+		empty, err := fs.isEmptyDir(targetEntry)
+		if err != nil {
+			return fmt.Errorf("could not read directory %s: %v", p, err)
+		}
+		if !empty {
+			return fmt.Errorf("cannot remove directory %s: directory not empty", p)
+		}
+	}
+
+	freed, err := fs.freeEntry(targetEntry)
+	if err != nil {
+		return fmt.Errorf("could not free clusters of %s: %v", p, err)
+	}
+
+	// removing the entry from its parent clears it and its long filename slots when the parent is written
+	parentDir.removeEntry(targetEntry)
+	if err := fs.writeDirectoryEntries(parentDir); err != nil {
+		return fmt.Errorf("error writing directory entries to disk: %v", err)
+	}
+
+	return fs.writeFreedClusters(freed)
+}
+
+// Rename renames, and if the parent directories differ moves, the file or directory at oldpath to newpath.
+//
+// If newpath already exists and is a file, it is replaced: its directory is written with the new entry instead
+// of the old one before the clusters of the replaced file are freed, so that newpath always refers to one or the
+// other. The short name is chosen anew, with a ~N tail that is unique in the directory of newpath.
+// Will return an error if newpath is an existing directory, or if a directory would be moved into itself.
+func (fs *FileSystem) Rename(oldpath, newpath string) error {
+	if fs.readOnly {
+		return fmt.Errorf("cannot rename %s: %w", oldpath, filesystem.ErrReadOnlyFilesystem)
+	}
+	oldDir, oldName := path.Dir(oldpath), path.Base(oldpath)
+	newDir, newName := path.Dir(newpath), path.Base(newpath)
+	// if the dir == filename, then it is just /
+	if oldDir == oldName || newDir == newName {
+		return fmt.Errorf("cannot rename root directory")
+	}
+	for _, name := range []string{oldName, newName} {
+		if name == "." || name == ".." {
+			return fmt.Errorf("cannot rename %s to %s", oldpath, newpath)
+		}
+	}
+
+	oldParent, oldEntries, err := fs.readDirWithMkdir(oldDir, false)
+	if err != nil {
+		return fmt.Errorf("could not read directory entries for %s", oldDir)
+	}
+	sourceEntry := findEntry(oldEntries, oldName)
+	if sourceEntry == nil {
+		return fmt.Errorf("source %s does not exist", oldpath)
+	}
+	if sourceEntry.isSubdirectory {
+		cleanOld, cleanNew := path.Clean("/"+oldpath), path.Clean("/"+newpath)
+		if strings.HasPrefix(cleanNew, cleanOld+"/") {
+			return fmt.Errorf("cannot move directory %s into itself at %s", oldpath, newpath)
+		}
+	}
+
+	newParent, newEntries, err := fs.readDirWithMkdir(newDir, false)
+	if err != nil {
+		return fmt.Errorf("could not read directory entries for %s", newDir)
+	}
+	sameParent := newParent.clusterLocation == oldParent.clusterLocation
+	if sameParent {
+		// work on the one copy of the entries, so that the changes to both are written together
+		newParent, newEntries = oldParent, oldEntries
+	}
+	targetEntry := findEntry(newEntries, newName)
+	if targetEntry == sourceEntry {
+		// renamed to itself, or to the same name with a different case
+		targetEntry = nil
+	}
+	if targetEntry != nil {
+		if targetEntry.isSubdirectory {
+			return fmt.Errorf("cannot rename %s to %s: target is a directory", oldpath, newpath)
+		}
+		if sourceEntry.isSubdirectory {
+			return fmt.Errorf("cannot rename directory %s to %s: target is a file", oldpath, newpath)
+		}
+	}
+
+	// take the replaced and the renamed entries out first, so that their short names are free to be reused
+	if targetEntry != nil {
+		newParent.removeEntry(targetEntry)
+	}
+	if sameParent {
+		newParent.removeEntry(sourceEntry)
+	}
+	// the new entry recomputes the short name, and with it the checksum of the long filename slots
+	renamed, err := newParent.createEntry(newName, sourceEntry.clusterLocation, sourceEntry.isSubdirectory)
+	if err != nil {
+		return fmt.Errorf("failed to create directory entry for %s: %v", newpath, err)
+	}
+	renamed.fileSize = sourceEntry.fileSize
+	renamed.createTime = sourceEntry.createTime
+	renamed.modifyTime = sourceEntry.modifyTime
+	renamed.accessTime = sourceEntry.accessTime
+	renamed.isReadOnly = sourceEntry.isReadOnly
+	renamed.isHidden = sourceEntry.isHidden
+	renamed.isSystem = sourceEntry.isSystem
+	renamed.isArchiveDirty = sourceEntry.isArchiveDirty
+	// write the new entry before removing the old one, so that a failure leaves the file reachable
+	if err := fs.writeDirectoryEntries(newParent); err != nil {
+		return fmt.Errorf("error writing directory entries to disk: %v", err)
+	}
+	if !sameParent {
+		oldParent.removeEntry(sourceEntry)
+		if err := fs.writeDirectoryEntries(oldParent); err != nil {
+			return fmt.Errorf("error writing directory entries to disk: %v", err)
+		}
+		if sourceEntry.isSubdirectory {
+			if err := fs.setParentDirectory(renamed, newParent); err != nil {
+				return fmt.Errorf("error updating parent of directory %s: %v", newpath, err)
+			}
+		}
+	}
+
+	if targetEntry == nil {
+		return nil
+	}
+	freed, err := fs.freeEntry(targetEntry)
+	if err != nil {
+		return fmt.Errorf("could not free clusters of replaced %s: %v", newpath, err)
+	}
+	return fs.writeFreedClusters(freed)
+}
+
+// findEntry find the file or directory with the given long or short name among the entries of a directory
+func findEntry(entries []*directoryEntry, name string) *directoryEntry {
+	for _, e := range entries {
+		if e.isVolumeLabel {
+			continue
+		}
+		shortName := e.filenameShort
+		if e.fileExtension != "" {
+			shortName += "." + e.fileExtension
+		}
+		if e.filenameLong == name || shortName == name {
+			return e
+		}
+	}
+	return nil
+}
+
+// isEmptyDir if a directory has no entries other than . and ..
+func (fs *FileSystem) isEmptyDir(entry *directoryEntry) (bool, error) {
+	children, err := fs.readDirectory(&Directory{directoryEntry: *entry})
+	if err != nil {
+		return false, err
+	}
+	for _, e := range children {
+		if e.filenameShort != "." && e.filenameShort != ".." {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// setParentDirectory point the .. entry of a directory that was moved at its new parent
+func (fs *FileSystem) setParentDirectory(entry *directoryEntry, parent *Directory) error {
+	dir := &Directory{directoryEntry: *entry}
+	children, err := fs.readDirectory(dir)
+	if err != nil {
+		return fmt.Errorf("could not read directory: %v", err)
+	}
+	parentDirectoryCluster := parent.clusterLocation
+	if parentDirectoryCluster == fs.table.rootDirCluster {
+		// references to the root directory (cluster 2 on FAT32) must be stored as 0
+		parentDirectoryCluster = 0
+	}
+	for _, e := range children {
+		if e.filenameShort == ".." {
+			e.clusterLocation = parentDirectoryCluster
+		}
+	}
+	return fs.writeDirectoryEntries(dir)
+}
+
 // Label get the label of the filesystem from the secial file in the root directory.
 // The label stored in the boot sector is ignored to mimic Windows behavior which
 // only stores and reads the label from the special file in the root directory.
@@ -628,6 +1016,9 @@ func (fs *FileSystem) Label() string {
 
 // SetLabel changes the filesystem label
 func (fs *FileSystem) SetLabel(volumeLabel string) error {
+	if fs.readOnly {
+		return fmt.Errorf("cannot set label: %w", filesystem.ErrReadOnlyFilesystem)
+	}
 	if volumeLabel == "" {
 		volumeLabel = "NO NAME"
 	}
@@ -713,6 +1104,15 @@ func (fs *FileSystem) getClusterList(firstCluster uint32) ([]uint32, error) {
 
 // read directory entries for a given cluster
 func (fs *FileSystem) readDirectory(dir *Directory) ([]*directoryEntry, error) {
+	if fs.isFixedRootDir(dir) {
+		rootStart, rootSize := fs.fixedRootDir()
+		b := make([]byte, rootSize)
+		_, _ = fs.file.ReadAt(b, fs.start+rootStart)
+		if err := dir.entriesFromBytes(b); err != nil {
+			return nil, err
+		}
+		return dir.entries, nil
+	}
 	clusterList, err := fs.getClusterList(dir.clusterLocation)
 	if err != nil {
 		return nil, fmt.Errorf("could not read cluster list: %v", err)
@@ -748,6 +1148,9 @@ func (fs *FileSystem) mkSubdir(parent *Directory, name string) (*directoryEntry,
 }
 
 func (fs *FileSystem) writeDirectoryEntries(dir *Directory) error {
+	if fs.isFixedRootDir(dir) {
+		return fs.writeFixedRootDir(dir)
+	}
 	// we need to save the entries of theparent
 	b, err := dir.entriesToBytes(fs.bytesPerCluster)
 	if err != nil {
@@ -767,6 +1170,10 @@ func (fs *FileSystem) writeDirectoryEntries(dir *Directory) error {
 		}
 		clusterList = clusters
 	}
+	// entries that were removed leave the clusters at the end empty, which must be cleared
+	if len(b) < len(clusterList)*fs.bytesPerCluster {
+		b = append(b, make([]byte, len(clusterList)*fs.bytesPerCluster-len(b))...)
+	}
 	// now write everything out to the cluster list
 	// read the data from all of the cluster entries in the list
 	for i, cluster := range clusterList {
@@ -784,6 +1191,27 @@ func (fs *FileSystem) writeDirectoryEntries(dir *Directory) error {
 	return nil
 }
 
+// writeFixedRootDir write the entries of the fixed size root directory of FAT12 and FAT16, which cannot grow
+func (fs *FileSystem) writeFixedRootDir(dir *Directory) error {
+	b, err := dir.entryBytes()
+	if err != nil {
+		return fmt.Errorf("could not create a valid byte stream for root directory entries: %v", err)
+	}
+	rootStart, rootSize := fs.fixedRootDir()
+	if len(b) > rootSize {
+		return fmt.Errorf("root directory is full, entries need %d bytes but it has %d", len(b), rootSize)
+	}
+	b = append(b, make([]byte, rootSize-len(b))...)
+	written, err := fs.file.WriteAt(b, fs.start+rootStart)
+	if err != nil {
+		return fmt.Errorf("error writing root directory entries: %v", err)
+	}
+	if written != rootSize {
+		return fmt.Errorf("wrote %d bytes of root directory instead of expected %d", written, rootSize)
+	}
+	return nil
+}
+
 // mkFile make a file in a directory
 func (fs *FileSystem) mkFile(parent *Directory, name string) (*directoryEntry, error) {
 	// get a cluster chain for the file
@@ -852,8 +1280,8 @@ func (fs *FileSystem) readDirWithMkdir(p string, doMake bool) (*Directory, []*di
 				}
 				// make a basic entry for the new subdir
 				parentDirectoryCluster := currentDir.clusterLocation
-				if parentDirectoryCluster == 2 {
-					// references to the root directory (cluster 2) must be stored as 0
+				if parentDirectoryCluster == fs.table.rootDirCluster {
+					// references to the root directory (cluster 2 on FAT32) must be stored as 0
 					parentDirectoryCluster = 0
 				}
 				dir := &Directory{
@@ -969,6 +1397,7 @@ func (fs *FileSystem) allocateSpace(size uint64, previous uint32) ([]uint32, err
 
 		// update the FSIS
 		lastAllocatedCluster = allocated[len(allocated)-1]
+		fs.adjustFreeClusters(-len(allocated))
 	} else {
 		var (
 			lastAlloc   int
@@ -987,11 +1416,13 @@ func (fs *FileSystem) allocateSpace(size uint64, previous uint32) ([]uint32, err
 		// unmark all of the unused ones
 		lastAllocatedCluster = fs.fsis.lastAllocatedCluster
 		for _, cl := range deallocated {
-			allClusters[cl] = fs.table.unusedMarker
+			// remove them entirely, so that they can be allocated again
+			delete(allClusters, cl)
 			if cl == lastAllocatedCluster {
 				lastAllocatedCluster--
 			}
 		}
+		fs.adjustFreeClusters(len(deallocated))
 	}
 
 	// update the FSIS
@@ -1009,6 +1440,78 @@ func (fs *FileSystem) allocateSpace(size uint64, previous uint32) ([]uint32, err
 	return append(clusters, allocated...), nil
 }
 
+// freeEntry frees the clusters of a file or directory, and of all of the children of a directory, in the
+// in-memory FAT. Returns the clusters that were freed, to pass to writeFreedClusters.
+func (fs *FileSystem) freeEntry(entry *directoryEntry) ([]uint32, error) {
+	var freed []uint32
+	if entry.isSubdirectory {
+		children, err := fs.readDirectory(&Directory{directoryEntry: *entry})
+		if err != nil {
+			return nil, fmt.Errorf("could not read directory: %v", err)
+		}
+		for _, e := range children {
+			if e.filenameShort == "." || e.filenameShort == ".." || e.isVolumeLabel {
+				continue
+			}
+			clusters, err := fs.freeEntry(e)
+			if err != nil {
+				return nil, err
+			}
+			freed = append(freed, clusters...)
+		}
+	}
+	// an empty file may have no clusters at all
+	if entry.clusterLocation < 2 {
+		return freed, nil
+	}
+	clusters, err := fs.getClusterList(entry.clusterLocation)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get cluster list: %v", err)
+	}
+	for _, cl := range clusters {
+		delete(fs.table.clusters, cl)
+	}
+	return append(freed, clusters...), nil
+}
+
+// writeFreedClusters update the FSIS for clusters that were freed, and write it and the FAT tables to disk
+func (fs *FileSystem) writeFreedClusters(freed []uint32) error {
+	fs.adjustFreeClusters(len(freed))
+	// if the most recently allocated cluster was freed, step back to the closest one still in use
+	lastAllocatedCluster := fs.fsis.lastAllocatedCluster
+	if lastAllocatedCluster != unknownlastAllocatedCluster {
+		for lastAllocatedCluster > 2 {
+			if _, ok := fs.table.clusters[lastAllocatedCluster]; ok {
+				break
+			}
+			lastAllocatedCluster--
+		}
+		fs.fsis.lastAllocatedCluster = lastAllocatedCluster
+	}
+	if err := fs.writeFsis(); err != nil {
+		return fmt.Errorf("failed to write the file system information sector: %v", err)
+	}
+	if err := fs.writeFat(); err != nil {
+		return fmt.Errorf("failed to write the file allocation table: %v", err)
+	}
+	return nil
+}
+
+// adjustFreeClusters change the count of free clusters in the FSIS by the clusters freed, or allocated if
+// negative, unless the count is unknown
+func (fs *FileSystem) adjustFreeClusters(delta int) {
+	count := fs.fsis.freeDataClustersCount
+	if count == unknownFreeDataClusterCount {
+		return
+	}
+	if delta < 0 && uint32(-delta) > count {
+		// the count was wrong to begin with
+		fs.fsis.freeDataClustersCount = 0
+		return
+	}
+	fs.fsis.freeDataClustersCount = uint32(int64(count) + int64(delta))
+}
+
 func abs(x int) int {
 	if x < 0 {
 		return -x
@@ -348,3 +348,113 @@ func TestFat32ReadDirWithMkdir(t *testing.T) {
 		}
 	}
 }
+
+func TestFat32RenameParentDirectory(t *testing.T) {
+	size := int64(10 * MB)
+	f, err := os.CreateTemp(t.TempDir(), "fat32_rename_test")
+	if err != nil {
+		t.Fatalf("unable to create tempfile: %v", err)
+	}
+	defer f.Close()
+	if err := f.Truncate(size); err != nil {
+		t.Fatalf("unable to size tempfile: %v", err)
+	}
+	fs, err := Create(f, size, 0, 512, "go-diskfs", WithFATType(FAT32))
+	if err != nil {
+		t.Fatalf("error creating filesystem: %v", err)
+	}
+	for _, p := range []string{"/a/b", "/c"} {
+		if err := fs.Mkdir(p); err != nil {
+			t.Fatalf("error making directory %s: %v", p, err)
+		}
+	}
+	parentCluster := func(p string) uint32 {
+		_, entries, err := fs.readDirWithMkdir(p, false)
+		if err != nil {
+			t.Fatalf("error reading directory %s: %v", p, err)
+		}
+		for _, e := range entries {
+			if e.filenameShort == ".." {
+				return e.clusterLocation
+			}
+		}
+		t.Fatalf("directory %s has no .. entry", p)
+		return 0
+	}
+	tests := []struct {
+		oldpath, newpath string
+		parent           string
+	}{
+		{"/a/b", "/c/b", "/c"},
+		{"/c/b", "/b", "/"},
+	}
+	for _, tt := range tests {
+		if err := fs.Rename(tt.oldpath, tt.newpath); err != nil {
+			t.Fatalf("error renaming %s to %s: %v", tt.oldpath, tt.newpath, err)
+		}
+		// references to the root directory are stored as 0
+		var expected uint32
+		if tt.parent != "/" {
+			parent, _, err := fs.readDirWithMkdir(tt.parent, false)
+			if err != nil {
+				t.Fatalf("error reading directory %s: %v", tt.parent, err)
+			}
+			expected = parent.clusterLocation
+		}
+		if actual := parentCluster(tt.newpath); actual != expected {
+			t.Errorf("after renaming %s to %s, .. points to cluster %d instead of %d", tt.oldpath, tt.newpath, actual, expected)
+		}
+	}
+}
+
+func TestFat32FreeClusterCount(t *testing.T) {
+	size := int64(10 * MB)
+	f, err := os.CreateTemp(t.TempDir(), "fat32_free_test")
+	if err != nil {
+		t.Fatalf("unable to create tempfile: %v", err)
+	}
+	defer f.Close()
+	if err := f.Truncate(size); err != nil {
+		t.Fatalf("unable to size tempfile: %v", err)
+	}
+	fs, err := Create(f, size, 0, 512, "go-diskfs", WithFATType(FAT32))
+	if err != nil {
+		t.Fatalf("error creating filesystem: %v", err)
+	}
+	const seeded = 100000
+	fs.fsis.freeDataClustersCount = seeded
+	expectFree := func(expected uint32) {
+		t.Helper()
+		if fs.fsis.freeDataClustersCount != expected {
+			t.Errorf("free cluster count is %d instead of %d", fs.fsis.freeDataClustersCount, expected)
+		}
+		read, err := Read(f, size, 0, 512)
+		if err != nil {
+			t.Fatalf("error reading filesystem: %v", err)
+		}
+		if read.fsis.freeDataClustersCount != expected {
+			t.Errorf("free cluster count on disk is %d instead of %d", read.fsis.freeDataClustersCount, expected)
+		}
+	}
+
+	// a file of 50 clusters
+	rw, err := fs.OpenFile("/file.bin", os.O_CREATE|os.O_RDWR)
+	if err != nil {
+		t.Fatalf("error creating file: %v", err)
+	}
+	if _, err := rw.Write(make([]byte, 50*fs.bytesPerCluster)); err != nil {
+		t.Fatalf("error writing file: %v", err)
+	}
+	expectFree(seeded - 50)
+
+	// truncating frees all but the first cluster
+	if _, err := fs.OpenFile("/file.bin", os.O_RDWR|os.O_TRUNC); err != nil {
+		t.Fatalf("error truncating file: %v", err)
+	}
+	expectFree(seeded - 1)
+
+	if err := fs.Remove("/file.bin"); err != nil {
+		t.Fatalf("error removing file: %v", err)
+	}
+	expectFree(seeded)
+}
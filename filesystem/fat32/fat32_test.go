@@ -8,9 +8,11 @@ package fat32_test
 import (
 	"bytes"
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"strings"
 	"testing"
 
@@ -947,3 +949,452 @@ func TestFat32Label(t *testing.T) {
 		}
 	})
 }
+
+func TestFat32ReadOnly(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "fat32_readonly")
+	if err != nil {
+		t.Fatalf("unable to create tempfile: %v", err)
+	}
+	defer f.Close()
+	size := int64(10 * 1024 * 1024)
+	fs, err := fat32.Create(f, size, 0, 512, "")
+	if err != nil {
+		t.Fatalf("error creating filesystem: %v", err)
+	}
+	rw, err := fs.OpenFile("/existing", os.O_CREATE|os.O_RDWR)
+	if err != nil {
+		t.Fatalf("error creating file: %v", err)
+	}
+	if _, err := rw.Write([]byte("contents")); err != nil {
+		t.Fatalf("error writing file: %v", err)
+	}
+
+	ro, err := fat32.Read(util.NewReadOnlyFile(f, size), size, 0, 512)
+	if err != nil {
+		t.Fatalf("error reading filesystem: %v", err)
+	}
+	if _, err := ro.ReadDir("/"); err != nil {
+		t.Errorf("unexpected error reading directory: %v", err)
+	}
+	file, err := ro.OpenFile("/existing", os.O_RDONLY)
+	if err != nil {
+		t.Fatalf("unexpected error opening file read-only: %v", err)
+	}
+	b, err := io.ReadAll(file)
+	if err != nil || string(b) != "contents" {
+		t.Errorf("read %q, %v instead of file contents", b, err)
+	}
+	if err := ro.Mkdir("/new"); !errors.Is(err, filesystem.ErrReadOnlyFilesystem) {
+		t.Errorf("Mkdir returned %v instead of %v", err, filesystem.ErrReadOnlyFilesystem)
+	}
+	if err := ro.SetLabel("LABEL"); !errors.Is(err, filesystem.ErrReadOnlyFilesystem) {
+		t.Errorf("SetLabel returned %v instead of %v", err, filesystem.ErrReadOnlyFilesystem)
+	}
+	for _, flag := range []int{os.O_RDWR, os.O_WRONLY, os.O_CREATE | os.O_RDWR, os.O_APPEND} {
+		if _, err := ro.OpenFile("/file", flag); !errors.Is(err, filesystem.ErrReadOnlyFilesystem) {
+			t.Errorf("OpenFile with mode %s returned %v instead of %v", getOpenMode(flag), err, filesystem.ErrReadOnlyFilesystem)
+		}
+	}
+}
+
+func TestFat1216(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int64
+		opts     []fat32.CreateOpt
+		fatType  fat32.FATType
+		expected string
+	}{
+		{"floppy auto", 1474560, nil, fat32.FAT12, ""},
+		{"small auto", 10 * fat32.MB, nil, fat32.FAT16, ""},
+		{"large auto", 600 * fat32.MB, nil, fat32.FAT32, ""},
+		{"forced FAT12", 100 * fat32.MB, []fat32.CreateOpt{fat32.WithFATType(fat32.FAT12)}, fat32.FAT12, ""},
+		{"forced FAT16", 300 * fat32.MB, []fat32.CreateOpt{fat32.WithFATType(fat32.FAT16)}, fat32.FAT16, ""},
+		{"forced FAT32", 10 * fat32.MB, []fat32.CreateOpt{fat32.WithFATType(fat32.FAT32)}, fat32.FAT32, ""},
+		{"FAT16 too small", 1474560, []fat32.CreateOpt{fat32.WithFATType(fat32.FAT16)}, 0, "cannot create FAT16 filesystem"},
+		{"FAT12 too large", 200 * fat32.MB, []fat32.CreateOpt{fat32.WithFATType(fat32.FAT12)}, 0, "cannot create FAT12 filesystem"},
+		{"unknown type", 10 * fat32.MB, []fat32.CreateOpt{fat32.WithFATType(fat32.FATType(7))}, 0, "unknown FAT type 7"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := os.CreateTemp(t.TempDir(), "fat1216_test")
+			if err != nil {
+				t.Fatalf("unable to create tempfile: %v", err)
+			}
+			defer f.Close()
+			if err := f.Truncate(tt.size); err != nil {
+				t.Fatalf("unable to size tempfile: %v", err)
+			}
+			fs, err := fat32.Create(f, tt.size, 0, 512, "go-diskfs", tt.opts...)
+			if tt.expected != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expected) {
+					t.Fatalf("Create returned %v instead of error %q", err, tt.expected)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error creating filesystem: %v", err)
+			}
+			if fs.FATType() != tt.fatType {
+				t.Errorf("created %s instead of %s", fs.FATType(), tt.fatType)
+			}
+
+			// more files than fit in a cluster in the root directory and in a subdirectory
+			contents := map[string][]byte{}
+			for _, dir := range []string{"/", "/EFI/BOOT/"} {
+				if err := fs.Mkdir(dir); err != nil {
+					t.Fatalf("error making directory %s: %v", dir, err)
+				}
+				for i := 0; i < 40; i++ {
+					p := fmt.Sprintf("%sa long file name %d.txt", dir, i)
+					b := make([]byte, 100*i+1)
+					_, _ = rand.Read(b)
+					contents[p] = b
+					rw, err := fs.OpenFile(p, os.O_CREATE|os.O_RDWR)
+					if err != nil {
+						t.Fatalf("error creating %s: %v", p, err)
+					}
+					if _, err := rw.Write(b); err != nil {
+						t.Fatalf("error writing %s: %v", p, err)
+					}
+				}
+			}
+
+			fs, err = fat32.Read(f, tt.size, 0, 512)
+			if err != nil {
+				t.Fatalf("error reading filesystem: %v", err)
+			}
+			if fs.FATType() != tt.fatType {
+				t.Errorf("read %s instead of %s", fs.FATType(), tt.fatType)
+			}
+			if label := fs.Label(); label != "go-diskfs" {
+				t.Errorf("label %q instead of %q", label, "go-diskfs")
+			}
+			for p, b := range contents {
+				file, err := fs.OpenFile(p, os.O_RDONLY)
+				if err != nil {
+					t.Fatalf("error opening %s: %v", p, err)
+				}
+				read := make([]byte, len(b))
+				if _, err := io.ReadFull(file, read); err != nil || !bytes.Equal(read, b) {
+					t.Errorf("read of %s returned %v or different contents than the %d bytes written", p, err, len(b))
+				}
+			}
+			entries, err := fs.ReadDir("/EFI/BOOT")
+			if err != nil || len(entries) != 42 {
+				t.Errorf("read %d entries of /EFI/BOOT, %v instead of 42", len(entries), err)
+			}
+		})
+	}
+
+	t.Run("full root directory", func(t *testing.T) {
+		f, err := os.CreateTemp(t.TempDir(), "fat1216_test")
+		if err != nil {
+			t.Fatalf("unable to create tempfile: %v", err)
+		}
+		defer f.Close()
+		fs, err := fat32.Create(f, 1474560, 0, 512, "")
+		if err != nil {
+			t.Fatalf("error creating filesystem: %v", err)
+		}
+		// 224 entries, one of which is the volume label
+		for i := 0; i < 223; i++ {
+			if _, err := fs.OpenFile(fmt.Sprintf("/F%d", i), os.O_CREATE|os.O_RDWR); err != nil {
+				t.Fatalf("error creating file %d: %v", i, err)
+			}
+		}
+		_, err = fs.OpenFile("/LAST", os.O_CREATE|os.O_RDWR)
+		if err == nil || !strings.Contains(err.Error(), "root directory is full") {
+			t.Errorf("creating a file in a full root directory returned %v", err)
+		}
+	})
+}
+
+func TestFat32Remove(t *testing.T) {
+	for _, fatType := range []fat32.FATType{fat32.FAT16, fat32.FAT32} {
+		fatType := fatType
+		t.Run(fatType.String(), func(t *testing.T) {
+			size := int64(10 * fat32.MB)
+			f, err := os.CreateTemp(t.TempDir(), "fat32_remove_test")
+			if err != nil {
+				t.Fatalf("unable to create tempfile: %v", err)
+			}
+			defer f.Close()
+			if err := f.Truncate(size); err != nil {
+				t.Fatalf("unable to size tempfile: %v", err)
+			}
+			fs, err := fat32.Create(f, size, 0, 512, "go-diskfs", fat32.WithFATType(fatType))
+			if err != nil {
+				t.Fatalf("error creating filesystem: %v", err)
+			}
+			writeFile := func(p string, size int) error {
+				rw, err := fs.OpenFile(p, os.O_CREATE|os.O_RDWR)
+				if err != nil {
+					return err
+				}
+				_, err = rw.Write(make([]byte, size))
+				return err
+			}
+
+			// more files than fit in a cluster, so that removing them shrinks the directory
+			if err := fs.Mkdir("/dir/sub"); err != nil {
+				t.Fatalf("error making directory: %v", err)
+			}
+			for i := 0; i < 30; i++ {
+				if err := writeFile(fmt.Sprintf("/dir/a long file name %d.txt", i), 1000*i); err != nil {
+					t.Fatalf("error writing file %d: %v", i, err)
+				}
+			}
+			for _, p := range []string{"/dir/sub/file.txt", "/keep.txt", "/remove me.txt"} {
+				if err := writeFile(p, 5000); err != nil {
+					t.Fatalf("error writing %s: %v", p, err)
+				}
+			}
+
+			errorTests := []struct {
+				path     string
+				expected string
+			}{
+				{"/", "cannot remove root directory"},
+				{"/missing.txt", "target /missing.txt does not exist"},
+				{"/missing/file.txt", "could not read directory entries"},
+				{"/dir", "cannot remove directory /dir: directory not empty"},
+			}
+			for _, tt := range errorTests {
+				if err := fs.Remove(tt.path); err == nil || !strings.Contains(err.Error(), tt.expected) {
+					t.Errorf("Remove(%s) returned %v instead of error %q", tt.path, err, tt.expected)
+				}
+			}
+
+			if err := fs.Remove("/remove me.txt"); err != nil {
+				t.Fatalf("error removing file: %v", err)
+			}
+			for i := 0; i < 30; i += 2 {
+				if err := fs.Remove(fmt.Sprintf("/dir/a long file name %d.txt", i)); err != nil {
+					t.Fatalf("error removing file %d: %v", i, err)
+				}
+			}
+			if err := fs.Remove("/dir/sub/file.txt"); err != nil {
+				t.Fatalf("error removing file in subdirectory: %v", err)
+			}
+			if err := fs.Remove("/dir/sub"); err != nil {
+				t.Fatalf("error removing empty directory: %v", err)
+			}
+			entries, err := fs.ReadDir("/dir")
+			if err != nil {
+				t.Fatalf("error reading directory: %v", err)
+			}
+			// the 15 odd files, plus . and ..
+			if len(entries) != 17 {
+				t.Errorf("directory has %d entries instead of 17", len(entries))
+			}
+			for _, e := range entries {
+				if e.Name() == "sub" || strings.HasSuffix(e.Name(), "0.txt") {
+					t.Errorf("removed entry %s still in directory", e.Name())
+				}
+			}
+
+			if err := fs.RemoveAll("/dir"); err != nil {
+				t.Fatalf("error removing directory tree: %v", err)
+			}
+			if err := fs.RemoveAll("/missing/file.txt"); err != nil {
+				t.Errorf("RemoveAll of missing path returned error: %v", err)
+			}
+
+			// read the filesystem back to check the changes are on disk
+			fs, err = fat32.Read(f, size, 0, 512)
+			if err != nil {
+				t.Fatalf("error reading filesystem: %v", err)
+			}
+			entries, err = fs.ReadDir("/")
+			if err != nil {
+				t.Fatalf("error reading root directory: %v", err)
+			}
+			names := map[string]bool{}
+			for _, e := range entries {
+				names[e.Name()] = true
+			}
+			if !names["keep.txt"] || names["remove me.txt"] || names["dir"] {
+				t.Errorf("root directory has entries %v, expected keep.txt but not dir or remove me.txt", names)
+			}
+
+			// freed clusters are available again: the volume only fits one file of this size at a time
+			for i := 0; i < 3; i++ {
+				if err := writeFile("/big.bin", int(size)*2/3); err != nil {
+					t.Fatalf("error writing large file %d: %v", i, err)
+				}
+				if err := fs.Remove("/big.bin"); err != nil {
+					t.Fatalf("error removing large file %d: %v", i, err)
+				}
+			}
+		})
+	}
+}
+
+func TestFat32Rename(t *testing.T) {
+	for _, fatType := range []fat32.FATType{fat32.FAT16, fat32.FAT32} {
+		fatType := fatType
+		t.Run(fatType.String(), func(t *testing.T) {
+			size := int64(10 * fat32.MB)
+			f, err := os.CreateTemp(t.TempDir(), "fat32_rename_test")
+			if err != nil {
+				t.Fatalf("unable to create tempfile: %v", err)
+			}
+			defer f.Close()
+			if err := f.Truncate(size); err != nil {
+				t.Fatalf("unable to size tempfile: %v", err)
+			}
+			fs, err := fat32.Create(f, size, 0, 512, "go-diskfs", fat32.WithFATType(fatType))
+			if err != nil {
+				t.Fatalf("error creating filesystem: %v", err)
+			}
+			writeFile := func(p string, b []byte) {
+				rw, err := fs.OpenFile(p, os.O_CREATE|os.O_RDWR|os.O_TRUNC)
+				if err != nil {
+					t.Fatalf("error opening %s: %v", p, err)
+				}
+				if _, err := rw.Write(b); err != nil {
+					t.Fatalf("error writing %s: %v", p, err)
+				}
+			}
+			readFile := func(p string) []byte {
+				rw, err := fs.OpenFile(p, os.O_RDONLY)
+				if err != nil {
+					t.Fatalf("error opening %s: %v", p, err)
+				}
+				var b []byte
+				infos, err := fs.ReadDir(path.Dir(p))
+				if err != nil {
+					t.Fatalf("error reading directory of %s: %v", p, err)
+				}
+				for _, info := range infos {
+					if info.Name() == path.Base(p) {
+						b = make([]byte, info.Size())
+					}
+				}
+				if _, err := io.ReadFull(rw, b); err != nil {
+					t.Fatalf("error reading %s: %v", p, err)
+				}
+				return b
+			}
+			exists := func(p string) bool {
+				_, err := fs.OpenFile(p, os.O_RDONLY)
+				return err == nil
+			}
+
+			if err := fs.Mkdir("/EFI/BOOT"); err != nil {
+				t.Fatalf("error making directory: %v", err)
+			}
+			if err := fs.Mkdir("/other"); err != nil {
+				t.Fatalf("error making directory: %v", err)
+			}
+			config := []byte("timeout=5\n")
+			newConfig := []byte("timeout=10\ndefault=linux\n")
+			writeFile("/EFI/BOOT/config.txt", config)
+			writeFile("/EFI/BOOT/config.tmp", newConfig)
+			writeFile("/EFI/BOOT/grubx64.efi", make([]byte, 3000))
+
+			errorTests := []struct {
+				oldpath, newpath string
+				expected         string
+			}{
+				{"/", "/root", "cannot rename root directory"},
+				{"/missing.txt", "/found.txt", "source /missing.txt does not exist"},
+				{"/EFI/BOOT/config.txt", "/missing/config.txt", "could not read directory entries for /missing"},
+				{"/EFI/BOOT/config.txt", "/EFI", "target is a directory"},
+				{"/other", "/EFI/BOOT/config.txt", "target is a file"},
+				{"/EFI", "/EFI/BOOT/EFI", "into itself"},
+			}
+			for _, tt := range errorTests {
+				if err := fs.Rename(tt.oldpath, tt.newpath); err == nil || !strings.Contains(err.Error(), tt.expected) {
+					t.Errorf("Rename(%s, %s) returned %v instead of error %q", tt.oldpath, tt.newpath, err, tt.expected)
+				}
+			}
+
+			// replace a file in the same directory
+			if err := fs.Rename("/EFI/BOOT/config.tmp", "/EFI/BOOT/config.txt"); err != nil {
+				t.Fatalf("error replacing config: %v", err)
+			}
+			if exists("/EFI/BOOT/config.tmp") {
+				t.Errorf("renamed file still exists at old path")
+			}
+			if b := readFile("/EFI/BOOT/config.txt"); !bytes.Equal(b, newConfig) {
+				t.Errorf("replaced file has contents %q instead of %q", b, newConfig)
+			}
+
+			// a long name, in another directory
+			if err := fs.Rename("/EFI/BOOT/grubx64.efi", "/other/a much longer file name.efi"); err != nil {
+				t.Fatalf("error moving file: %v", err)
+			}
+			if exists("/EFI/BOOT/grubx64.efi") || !exists("/other/a much longer file name.efi") || !exists("/other/AMUCHL~1.EFI") {
+				t.Errorf("moved file not found at its long and short name")
+			}
+
+			// a directory to another parent, whose .. must follow it
+			if err := fs.Rename("/EFI/BOOT", "/other/boot"); err != nil {
+				t.Fatalf("error moving directory: %v", err)
+			}
+			if err := fs.Mkdir("/other/boot/sub"); err != nil {
+				t.Fatalf("error making directory in moved directory: %v", err)
+			}
+
+			fs, err = fat32.Read(f, size, 0, 512)
+			if err != nil {
+				t.Fatalf("error reading filesystem: %v", err)
+			}
+			if b := readFile("/other/boot/config.txt"); !bytes.Equal(b, newConfig) {
+				t.Errorf("file in moved directory has contents %q instead of %q", b, newConfig)
+			}
+			entries, err := fs.ReadDir("/EFI")
+			if err != nil {
+				t.Fatalf("error reading directory: %v", err)
+			}
+			if len(entries) != 2 {
+				t.Errorf("old parent directory has %d entries instead of . and ..", len(entries))
+			}
+			if err := fs.Rename("/other/boot", "/boot"); err != nil {
+				t.Fatalf("error moving directory to root: %v", err)
+			}
+			if err := fs.Rename("/boot/config.txt", "/boot/CONFIG.TXT"); err != nil {
+				t.Fatalf("error renaming file to its short name: %v", err)
+			}
+			if b := readFile("/boot/CONFIG.TXT"); !bytes.Equal(b, newConfig) {
+				t.Errorf("file renamed to its short name has contents %q instead of %q", b, newConfig)
+			}
+
+			// renamed files get short names that are unique in their new directory
+			if err := fs.Mkdir("/d"); err != nil {
+				t.Fatalf("error making directory: %v", err)
+			}
+			names := map[string][]byte{}
+			for _, p := range []string{"/d/longfilename0.txt", "/d/longfilename1.txt", "/longfilenameX.txt"} {
+				names[p] = []byte(p)
+				writeFile(p, names[p])
+			}
+			if err := fs.Rename("/d/longfilename0.txt", "/longfilename0.txt"); err != nil {
+				t.Fatalf("error moving file: %v", err)
+			}
+			if err := fs.Rename("/d/longfilename1.txt", "/longfilenameX.txt"); err != nil {
+				t.Fatalf("error replacing file: %v", err)
+			}
+			infos, err := fs.ReadDir("/")
+			if err != nil {
+				t.Fatalf("error reading root directory: %v", err)
+			}
+			shortNames := map[string]string{}
+			for _, info := range infos {
+				shortName := info.(fat32.FileInfo).ShortName()
+				if other, ok := shortNames[shortName]; ok {
+					t.Errorf("%s and %s both have the short name %s", other, info.Name(), shortName)
+				}
+				shortNames[shortName] = info.Name()
+			}
+			for long, expected := range map[string][]byte{"/longfilename0.txt": names["/d/longfilename0.txt"], "/longfilenameX.txt": names["/d/longfilename1.txt"]} {
+				if b := readFile(long); !bytes.Equal(b, expected) {
+					t.Errorf("%s has contents %q instead of %q", long, b, expected)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package fat32
+
+import "fmt"
+
+// FATType is the variant of FAT: FAT12, FAT16 or FAT32, which differ in the size of the entries in the file
+// allocation table, and so in how many clusters a filesystem can have
+type FATType int
+
+const (
+	// FATAuto picks the variant from the size of the filesystem, as Microsoft's format does
+	FATAuto FATType = iota
+	// FAT12 has 12-bit table entries, for floppy disks and other filesystems of less than 4085 clusters
+	FAT12
+	// FAT16 has 16-bit table entries, for filesystems of 4085 to 65524 clusters
+	FAT16
+	// FAT32 has 28-bit table entries, for filesystems of 65525 clusters or more
+	FAT32
+)
+
+func (t FATType) String() string {
+	switch t {
+	case FAT12:
+		return "FAT12"
+	case FAT16:
+		return "FAT16"
+	case FAT32:
+		return "FAT32"
+	default:
+		return "auto"
+	}
+}
+
+const (
+	// the variant of a filesystem is determined only by its count of clusters
+	maxFat12Clusters = 4084
+	maxFat16Clusters = 65524
+	// largest filesystems, in sectors, for which Create picks FAT12 and FAT16 by default, see fatgen103.pdf
+	autoFat12MaxSectors = 8400
+	autoFat16MaxSectors = 1048576
+	// largest cluster, in sectors, that Create uses for FAT12 and FAT16, 32KB
+	maxSectorsPerCluster1216 = 64
+	// entries in the fixed size root directory of FAT12 and FAT16, which has no cluster chain
+	rootDirEntriesFat12 = 224
+	rootDirEntriesFat16 = 512
+	// FileSystemType strings in the DOS 4.0 EBPB of FAT12 and FAT16
+	fileSystemTypeFAT12 = "FAT12   "
+	fileSystemTypeFAT16 = "FAT16   "
+)
+
+type createOpts struct {
+	fatType FATType
+}
+
+// CreateOpt func that process Create options
+type CreateOpt func(o *createOpts) error
+
+// WithFATType create the filesystem as FAT12, FAT16 or FAT32, rather than picking the variant from its size.
+// Returns an error from Create if the filesystem is too small or too large for the variant.
+func WithFATType(fatType FATType) CreateOpt {
+	return func(o *createOpts) error {
+		if fatType < FATAuto || fatType > FAT32 {
+			return fmt.Errorf("unknown FAT type %d", fatType)
+		}
+		o.fatType = fatType
+		return nil
+	}
+}
+
+// autoFATType the variant Create picks for a filesystem of totalSectors
+func autoFATType(totalSectors uint32) FATType {
+	switch {
+	case totalSectors <= autoFat12MaxSectors:
+		return FAT12
+	case totalSectors <= autoFat16MaxSectors:
+		return FAT16
+	default:
+		return FAT32
+	}
+}
+
+// fatTypeFromClusters the variant of a filesystem with a count of clusters
+func fatTypeFromClusters(clusters uint32) FATType {
+	switch {
+	case clusters <= maxFat12Clusters:
+		return FAT12
+	case clusters <= maxFat16Clusters:
+		return FAT16
+	default:
+		return FAT32
+	}
+}
+
+// fat1216Clusters the count of clusters of a FAT12 or FAT16 filesystem, from its BPB
+func fat1216Clusters(bpb *dos331BPB) uint32 {
+	bpb20 := bpb.dos20BPB
+	totalSectors := uint32(bpb20.totalSectors)
+	if totalSectors == 0 {
+		totalSectors = bpb.totalSectors
+	}
+	overhead := uint32(bpb20.reservedSectors) + uint32(bpb20.fatCount)*uint32(bpb20.sectorsPerFat) + rootDirSectors(bpb20.rootDirectoryEntries)
+	if bpb20.sectorsPerCluster == 0 || totalSectors <= overhead {
+		return 0
+	}
+	return (totalSectors - overhead) / uint32(bpb20.sectorsPerCluster)
+}
+
+// fat1216Layout the layout of a FAT12 or FAT16 filesystem
+type fat1216Layout struct {
+	sectorsPerCluster uint8
+	rootDirEntries    uint16
+	sectorsPerFat     uint16
+	clusters          uint32
+}
+
+// rootDirSectors the sectors taken by a fixed size root directory of a number of entries
+func rootDirSectors(entries uint16) uint32 {
+	return (uint32(entries)*uint32(bytesPerSlot) + uint32(SectorSize512) - 1) / uint32(SectorSize512)
+}
+
+// newFat1216Layout calculate the layout of a FAT12 or FAT16 filesystem of totalSectors, with 1 reserved sector
+// and 2 FATs. Clusters start at the size Microsoft's format uses for FAT16, or 1 sector for FAT12, and are
+// made larger or smaller to keep the count of clusters within what the variant allows.
+func newFat1216Layout(fatType FATType, totalSectors uint32) (*fat1216Layout, error) {
+	layout := &fat1216Layout{sectorsPerCluster: 1, rootDirEntries: rootDirEntriesFat16}
+	minClusters, maxClusters := uint32(maxFat12Clusters+1), uint32(maxFat16Clusters)
+	if fatType == FAT12 {
+		layout.rootDirEntries = rootDirEntriesFat12
+		minClusters, maxClusters = 1, maxFat12Clusters
+	} else {
+		switch {
+		case totalSectors <= 32680:
+			layout.sectorsPerCluster = 2
+		case totalSectors <= 262144:
+			layout.sectorsPerCluster = 4
+		case totalSectors <= 524288:
+			layout.sectorsPerCluster = 8
+		case totalSectors <= 1048576:
+			layout.sectorsPerCluster = 16
+		case totalSectors <= 2097152:
+			layout.sectorsPerCluster = 32
+		default:
+			layout.sectorsPerCluster = 64
+		}
+	}
+	if err := layout.fit(fatType, totalSectors); err != nil {
+		return nil, err
+	}
+	for layout.clusters > maxClusters {
+		if layout.sectorsPerCluster >= maxSectorsPerCluster1216 {
+			return nil, fmt.Errorf("%d sectors is too large for %s", totalSectors, fatType)
+		}
+		layout.sectorsPerCluster *= 2
+		if err := layout.fit(fatType, totalSectors); err != nil {
+			return nil, err
+		}
+	}
+	for layout.clusters < minClusters && layout.sectorsPerCluster > 1 {
+		layout.sectorsPerCluster /= 2
+		if err := layout.fit(fatType, totalSectors); err != nil {
+			return nil, err
+		}
+	}
+	if layout.clusters < minClusters || layout.clusters > maxClusters {
+		return nil, fmt.Errorf("%d sectors is too small for %s, which needs at least %d clusters", totalSectors, fatType, minClusters)
+	}
+	return layout, nil
+}
+
+// fit size the FATs for the sectors per cluster of the layout, growing them until they have an entry for
+// every cluster left over, plus the 2 reserved entries
+func (l *fat1216Layout) fit(fatType FATType, totalSectors uint32) error {
+	overhead := 1 + rootDirSectors(l.rootDirEntries)
+	for l.sectorsPerFat = 1; ; l.sectorsPerFat++ {
+		fatSectors := 2 * uint32(l.sectorsPerFat)
+		if totalSectors <= overhead+fatSectors {
+			return fmt.Errorf("%d sectors is too small for %s", totalSectors, fatType)
+		}
+		l.clusters = (totalSectors - overhead - fatSectors) / uint32(l.sectorsPerCluster)
+		if fatBytes(fatType, l.clusters+2) <= uint32(l.sectorsPerFat)*uint32(SectorSize512) {
+			return nil
+		}
+	}
+}
+
+// fatBytes the size in bytes of a FAT with a number of entries
+func fatBytes(fatType FATType, entries uint32) uint32 {
+	switch fatType {
+	case FAT12:
+		return (entries*3 + 1) / 2
+	case FAT16:
+		return entries * 2
+	default:
+		return entries * 4
+	}
+}
@@ -13,8 +13,9 @@ const msDosBootSectorSignature uint16 = 0x55aa
 type msDosBootSector struct {
 	jumpInstruction    [3]byte    // JumpInstruction is the instruction set to jump to for booting
 	oemName            string     // OEMName is the 8-byte OEM Name
-	biosParameterBlock *dos71EBPB // BIOSParameterBlock is the FAT32 Extended BIOS Parameter Block
+	biosParameterBlock *dos71EBPB // BIOSParameterBlock is the FAT32 Extended BIOS Parameter Block, or the fields of the DOS 4.0 EBPB for FAT12 and FAT16
 	bootCode           []byte     // BootCode represents the actual boot code
+	fatType            FATType    // FATType is the variant of FAT, which determines the layout of the EBPB; FAT32 if not set
 }
 
 func (m *msDosBootSector) equal(a *msDosBootSector) bool {
@@ -40,12 +41,29 @@ func msDosBootSectorFromBytes(b []byte) (*msDosBootSector, error) {
 	copy(bs.jumpInstruction[:], b[0:3])
 	// extract the OEM name
 	bs.oemName = string(b[3:11])
-	// extract the EBPB and its size
-	bpb, bpbSize, err := dos71EBPBFromBytes(b[11:90])
-	if err != nil {
-		return nil, fmt.Errorf("could not read FAT32 BIOS Parameter Block from boot sector: %v", err)
+	// extract the EBPB and its size. FAT32 has no sectors per FAT in the DOS 2.0 BPB, but FAT12 and FAT16 do,
+	// and have a DOS 4.0 EBPB instead of a DOS 7.1 one
+	var bpbSize int
+	if binary.LittleEndian.Uint16(b[22:24]) != 0 {
+		bpb, size, err := dos40EBPBFromBytes(b[11:62])
+		if err != nil {
+			return nil, fmt.Errorf("could not read FAT12/FAT16 BIOS Parameter Block from boot sector: %v", err)
+		}
+		bs.biosParameterBlock = bpb.dos71EBPB()
+		bpbSize = size
+		bs.fatType = fatTypeFromClusters(fat1216Clusters(bpb.dos331BPB))
+		if bs.fatType == FAT32 {
+			return nil, fmt.Errorf("FAT12/FAT16 BIOS Parameter Block describes %d clusters, more than the maximum %d", fat1216Clusters(bpb.dos331BPB), maxFat16Clusters)
+		}
+	} else {
+		bpb, size, err := dos71EBPBFromBytes(b[11:90])
+		if err != nil {
+			return nil, fmt.Errorf("could not read FAT32 BIOS Parameter Block from boot sector: %v", err)
+		}
+		bs.biosParameterBlock = bpb
+		bpbSize = size
+		bs.fatType = FAT32
 	}
-	bs.biosParameterBlock = bpb
 
 	// we have the size of the EBPB, we can figure out the size of the boot code
 	bootSectorStart := 11 + bpbSize
@@ -81,9 +99,17 @@ func (m *msDosBootSector) toBytes() ([]byte, error) {
 	copy(b[3:11], oemName)
 
 	// bytes for the EBPB
-	bpbBytes, err := m.biosParameterBlock.toBytes()
+	var (
+		bpbBytes []byte
+		err      error
+	)
+	if m.fatType == FAT12 || m.fatType == FAT16 {
+		bpbBytes, err = m.biosParameterBlock.dos40EBPB().toBytes()
+	} else {
+		bpbBytes, err = m.biosParameterBlock.toBytes()
+	}
 	if err != nil {
-		return nil, fmt.Errorf("error getting FAT32 EBPB: %v", err)
+		return nil, fmt.Errorf("error getting %s EBPB: %v", m.fatTypeOrFAT32(), err)
 	}
 	copy(b[11:], bpbBytes)
 	bpbLen := len(bpbBytes)
@@ -99,3 +125,11 @@ func (m *msDosBootSector) toBytes() ([]byte, error) {
 
 	return b, nil
 }
+
+// fatTypeOrFAT32 the variant of FAT of the boot sector, FAT32 if not set
+func (m *msDosBootSector) fatTypeOrFAT32() FATType {
+	if m.fatType == FATAuto {
+		return FAT32
+	}
+	return m.fatType
+}
@@ -5,7 +5,7 @@ import (
 	"reflect"
 )
 
-// table a FAT32 table
+// table a file allocation table, of FAT12, FAT16 or FAT32
 type table struct {
 	fatID          uint32
 	eocMarker      uint32
@@ -14,6 +14,7 @@ type table struct {
 	rootDirCluster uint32
 	size           uint32
 	maxCluster     uint32
+	fatType        FATType // size of the entries, FAT32 if not set
 }
 
 func (t *table) equal(a *table) bool {
@@ -37,6 +38,34 @@ func (t *table) equal(a *table) bool {
 */
 
 func tableFromBytes(b []byte) *table {
+	return tableFromBytesOfType(b, FAT32)
+}
+
+// tableFromBytesOfType read a table with the entries of a variant of FAT. The FAT12 and FAT16 end-of-chain
+// markers are always the largest values, as the second entry of their table may hold flags.
+func tableFromBytesOfType(b []byte, fatType FATType) *table {
+	if fatType == FAT12 || fatType == FAT16 {
+		t := table{
+			size:           uint32(len(b)),
+			clusters:       map[uint32]uint32{},
+			rootDirCluster: 0, // FAT12 and FAT16 have a fixed size root directory outside of the clusters
+			fatType:        fatType,
+		}
+		if fatType == FAT12 {
+			t.eocMarker = 0xfff
+			t.maxCluster = uint32(len(b)) * 2 / 3
+		} else {
+			t.eocMarker = 0xffff
+			t.maxCluster = uint32(len(b)) / 2
+		}
+		t.fatID = t.entry(b, 0)
+		for i := uint32(2); i < t.maxCluster; i++ {
+			if val := t.entry(b, i); val != 0 {
+				t.clusters[i] = val
+			}
+		}
+		return &t
+	}
 	t := table{
 		fatID:          binary.LittleEndian.Uint32(b[0:4]),
 		eocMarker:      binary.LittleEndian.Uint32(b[4:8]),
@@ -58,10 +87,19 @@ func tableFromBytes(b []byte) *table {
 	return &t
 }
 
-// bytes returns a FAT32 table as bytes ready to be written to disk
+// bytes returns a FAT table as bytes ready to be written to disk
 func (t *table) bytes() []byte {
 	b := make([]byte, t.size)
 
+	if t.fatType == FAT12 || t.fatType == FAT16 {
+		t.putEntry(b, 0, t.fatID)
+		t.putEntry(b, 1, t.eocMarker)
+		for i := uint32(2); i < t.maxCluster; i++ {
+			t.putEntry(b, i, t.clusters[i])
+		}
+		return b
+	}
+
 	// FAT ID and fixed values
 	binary.LittleEndian.PutUint32(b[0:4], t.fatID)
 	// End-of-Cluster marker
@@ -82,5 +120,40 @@ func (t *table) bytes() []byte {
 }
 
 func (t *table) isEoc(cluster uint32) bool {
-	return cluster&0xFFFFFF8 == 0xFFFFFF8
+	switch t.fatType {
+	case FAT12:
+		return cluster >= 0xff8
+	case FAT16:
+		return cluster >= 0xfff8
+	default:
+		return cluster&0xFFFFFF8 == 0xFFFFFF8
+	}
+}
+
+// entry the value of entry i of a FAT12 or FAT16 table. FAT12 packs two 12-bit entries in every 3 bytes.
+func (t *table) entry(b []byte, i uint32) uint32 {
+	if t.fatType == FAT16 {
+		return uint32(binary.LittleEndian.Uint16(b[i*2 : i*2+2]))
+	}
+	val := uint32(binary.LittleEndian.Uint16(b[i*3/2 : i*3/2+2]))
+	if i%2 == 1 {
+		return val >> 4
+	}
+	return val & 0xfff
+}
+
+// putEntry set the value of entry i of a FAT12 or FAT16 table, keeping the other half of a shared FAT12 byte
+func (t *table) putEntry(b []byte, i, val uint32) {
+	if t.fatType == FAT16 {
+		binary.LittleEndian.PutUint16(b[i*2:i*2+2], uint16(val))
+		return
+	}
+	start := i * 3 / 2
+	cur := binary.LittleEndian.Uint16(b[start : start+2])
+	if i%2 == 1 {
+		cur = cur&0x000f | uint16(val&0xfff)<<4
+	} else {
+		cur = cur&0xf000 | uint16(val&0xfff)
+	}
+	binary.LittleEndian.PutUint16(b[start:start+2], cur)
 }
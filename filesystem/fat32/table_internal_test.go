@@ -231,3 +231,33 @@ func TestFat32TableIsEoc(t *testing.T) {
 		}
 	}
 }
+
+func TestFat1216TableBytes(t *testing.T) {
+	tests := []struct {
+		fatType FATType
+		table   *table
+		b       []byte
+	}{
+		{FAT12, &table{fatID: 0xff8, eocMarker: 0xfff, size: 9, maxCluster: 6, fatType: FAT12,
+			clusters: map[uint32]uint32{2: 3, 3: 0xfff, 4: 0xabc, 5: 0xfff}},
+			[]byte{0xf8, 0xff, 0xff, 0x03, 0xf0, 0xff, 0xbc, 0xfa, 0xff}},
+		{FAT16, &table{fatID: 0xfff8, eocMarker: 0xffff, size: 10, maxCluster: 5, fatType: FAT16,
+			clusters: map[uint32]uint32{2: 3, 3: 0xffff, 4: 0xabcd}},
+			[]byte{0xf8, 0xff, 0xff, 0xff, 0x03, 0x00, 0xff, 0xff, 0xcd, 0xab}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fatType.String(), func(t *testing.T) {
+			b := tt.table.bytes()
+			if !bytes.Equal(b, tt.b) {
+				t.Errorf("bytes() returned % x instead of % x", b, tt.b)
+			}
+			parsed := tableFromBytesOfType(tt.b, tt.fatType)
+			if !parsed.equal(tt.table) {
+				t.Errorf("tableFromBytesOfType returned %#v instead of %#v", parsed, tt.table)
+			}
+			if !parsed.isEoc(tt.table.eocMarker) || parsed.isEoc(3) {
+				t.Errorf("isEoc does not match %s end-of-chain markers", tt.fatType)
+			}
+		})
+	}
+}
@@ -3,9 +3,13 @@
 package filesystem
 
 import (
+	"errors"
 	"os"
 )
 
+// ErrReadOnlyFilesystem is returned when trying to change a filesystem that was opened read-only
+var ErrReadOnlyFilesystem = errors.New("read-only filesystem")
+
 // FileSystem is a reference to a single filesystem on a disk
 type FileSystem interface {
 	// Type return the type of filesystem
@@ -34,4 +38,6 @@ const (
 	TypeISO9660
 	// TypeSquashfs is a squashfs filesystem
 	TypeSquashfs
+	// TypeExFAT is an exFAT filesystem
+	TypeExFAT
 )
@@ -0,0 +1,19 @@
+// Package qcow2 provides an implementation of the QEMU Copy-On-Write version 2 and 3 (qcow2) disk image format.
+//
+// A qcow2 image stores the guest-visible ("virtual") disk in clusters that are allocated on first write,
+// located through a two-level lookup (L1 and L2 tables), and tracked by reference counts. Unallocated
+// clusters read as zeroes, or from a backing file if the image has one.
+//
+// qcow2.Image implements util.File from github.com/diskfs/go-diskfs/util over the virtual disk, so
+// that it can be used anywhere a raw disk image can be used, e.g. for partition tables and filesystems.
+//
+// Normally, the best way to interact with a qcow2 image is to use the github.com/diskfs/go-diskfs package,
+// which detects qcow2 images on Open(), and creates them when Create() is passed diskfs.Qcow2.
+//
+// Not supported: encryption, external data files, extended L2 entries, and compression types other
+// than deflate. Compressed clusters can be read, and are rewritten uncompressed when written.
+//
+// references:
+//
+//	https://gitlab.com/qemu-project/qemu/-/blob/master/docs/interop/qcow2.txt
+package qcow2
@@ -0,0 +1,162 @@
+package qcow2
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	// qcow2Magic is the magic number "QFI\xfb" at the beginning of every qcow2 image
+	qcow2Magic uint32 = 0x514649fb
+
+	headerV2Length = 72
+	headerV3Length = 104
+
+	minClusterBits     = 9
+	maxClusterBits     = 21
+	defaultClusterBits = 16
+
+	// defaultRefcountOrder gives 16-bit refcounts, the only width for version 2 images
+	defaultRefcountOrder = 4
+
+	// header extension types
+	extensionEnd           uint32 = 0x00000000
+	extensionBackingFormat uint32 = 0xe2792aca
+)
+
+// incompatible feature bits
+const (
+	incompatibleDirty        uint64 = 1 << 0
+	incompatibleCorrupt      uint64 = 1 << 1
+	incompatibleExternalData uint64 = 1 << 2
+	incompatibleCompression  uint64 = 1 << 3
+	incompatibleExtendedL2   uint64 = 1 << 4
+)
+
+// header is the qcow2 image header, stored big-endian at the beginning of cluster 0
+type header struct {
+	version               uint32
+	backingFileOffset     uint64
+	backingFileSize       uint32
+	clusterBits           uint32
+	size                  uint64 // virtual size in bytes
+	cryptMethod           uint32
+	l1Size                uint32 // number of entries in the active L1 table
+	l1TableOffset         uint64
+	refcountTableOffset   uint64
+	refcountTableClusters uint32
+	nbSnapshots           uint32
+	snapshotsOffset       uint64
+	// version 3 only
+	incompatibleFeatures uint64
+	compatibleFeatures   uint64
+	autoclearFeatures    uint64
+	refcountOrder        uint32
+	headerLength         uint32
+}
+
+func headerFromBytes(b []byte) (*header, error) {
+	if len(b) < headerV2Length {
+		return nil, fmt.Errorf("header was %d bytes instead of minimum %d", len(b), headerV2Length)
+	}
+	if magic := binary.BigEndian.Uint32(b[0:4]); magic != qcow2Magic {
+		return nil, fmt.Errorf("invalid qcow2 magic %x", magic)
+	}
+	h := &header{
+		version:               binary.BigEndian.Uint32(b[4:8]),
+		backingFileOffset:     binary.BigEndian.Uint64(b[8:16]),
+		backingFileSize:       binary.BigEndian.Uint32(b[16:20]),
+		clusterBits:           binary.BigEndian.Uint32(b[20:24]),
+		size:                  binary.BigEndian.Uint64(b[24:32]),
+		cryptMethod:           binary.BigEndian.Uint32(b[32:36]),
+		l1Size:                binary.BigEndian.Uint32(b[36:40]),
+		l1TableOffset:         binary.BigEndian.Uint64(b[40:48]),
+		refcountTableOffset:   binary.BigEndian.Uint64(b[48:56]),
+		refcountTableClusters: binary.BigEndian.Uint32(b[56:60]),
+		nbSnapshots:           binary.BigEndian.Uint32(b[60:64]),
+		snapshotsOffset:       binary.BigEndian.Uint64(b[64:72]),
+		refcountOrder:         defaultRefcountOrder,
+		headerLength:          headerV2Length,
+	}
+	switch h.version {
+	case 2:
+	case 3:
+		if len(b) < headerV3Length {
+			return nil, fmt.Errorf("version 3 header was %d bytes instead of minimum %d", len(b), headerV3Length)
+		}
+		h.incompatibleFeatures = binary.BigEndian.Uint64(b[72:80])
+		h.compatibleFeatures = binary.BigEndian.Uint64(b[80:88])
+		h.autoclearFeatures = binary.BigEndian.Uint64(b[88:96])
+		h.refcountOrder = binary.BigEndian.Uint32(b[96:100])
+		h.headerLength = binary.BigEndian.Uint32(b[100:104])
+		if h.headerLength < headerV3Length {
+			return nil, fmt.Errorf("invalid version 3 header length %d", h.headerLength)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported qcow2 version %d", h.version)
+	}
+	if h.clusterBits < minClusterBits || h.clusterBits > maxClusterBits {
+		return nil, fmt.Errorf("invalid cluster bits %d, must be between %d and %d", h.clusterBits, minClusterBits, maxClusterBits)
+	}
+	return h, nil
+}
+
+// toBytes returns the header, without extensions, ready to be written at the beginning of the image
+func (h *header) toBytes() []byte {
+	length := headerV2Length
+	if h.version >= 3 {
+		length = int(h.headerLength)
+	}
+	b := make([]byte, length)
+	binary.BigEndian.PutUint32(b[0:4], qcow2Magic)
+	binary.BigEndian.PutUint32(b[4:8], h.version)
+	binary.BigEndian.PutUint64(b[8:16], h.backingFileOffset)
+	binary.BigEndian.PutUint32(b[16:20], h.backingFileSize)
+	binary.BigEndian.PutUint32(b[20:24], h.clusterBits)
+	binary.BigEndian.PutUint64(b[24:32], h.size)
+	binary.BigEndian.PutUint32(b[32:36], h.cryptMethod)
+	binary.BigEndian.PutUint32(b[36:40], h.l1Size)
+	binary.BigEndian.PutUint64(b[40:48], h.l1TableOffset)
+	binary.BigEndian.PutUint64(b[48:56], h.refcountTableOffset)
+	binary.BigEndian.PutUint32(b[56:60], h.refcountTableClusters)
+	binary.BigEndian.PutUint32(b[60:64], h.nbSnapshots)
+	binary.BigEndian.PutUint64(b[64:72], h.snapshotsOffset)
+	if h.version >= 3 {
+		binary.BigEndian.PutUint64(b[72:80], h.incompatibleFeatures)
+		binary.BigEndian.PutUint64(b[80:88], h.compatibleFeatures)
+		binary.BigEndian.PutUint64(b[88:96], h.autoclearFeatures)
+		binary.BigEndian.PutUint32(b[96:100], h.refcountOrder)
+		binary.BigEndian.PutUint32(b[100:104], h.headerLength)
+	}
+	return b
+}
+
+// extensionsFromBytes reads the header extensions that follow the header, returning them by type.
+// b must start at the first extension.
+func extensionsFromBytes(b []byte) (map[uint32][]byte, error) {
+	ext := map[uint32][]byte{}
+	for pos := 0; pos+8 <= len(b); {
+		extType := binary.BigEndian.Uint32(b[pos : pos+4])
+		extLen := int(binary.BigEndian.Uint32(b[pos+4 : pos+8]))
+		if extType == extensionEnd {
+			return ext, nil
+		}
+		pos += 8
+		if pos+extLen > len(b) {
+			return nil, fmt.Errorf("header extension %x of length %d overruns the first cluster", extType, extLen)
+		}
+		ext[extType] = b[pos : pos+extLen]
+		// extensions are padded to 8 bytes
+		pos += (extLen + 7) &^ 7
+	}
+	return nil, fmt.Errorf("header extensions are not terminated")
+}
+
+// extensionToBytes returns a single header extension, padded to a multiple of 8 bytes
+func extensionToBytes(extType uint32, data []byte) []byte {
+	b := make([]byte, 8+(len(data)+7)&^7)
+	binary.BigEndian.PutUint32(b[0:4], extType)
+	binary.BigEndian.PutUint32(b[4:8], uint32(len(data)))
+	copy(b[8:], data)
+	return b
+}
@@ -0,0 +1,196 @@
+package qcow2
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"os"
+	"testing"
+)
+
+func TestHeaderToFromBytes(t *testing.T) {
+	h := &header{
+		version:               3,
+		backingFileOffset:     120,
+		backingFileSize:       8,
+		clusterBits:           16,
+		size:                  10 * 1024 * 1024,
+		l1Size:                1,
+		l1TableOffset:         0x30000,
+		refcountTableOffset:   0x10000,
+		refcountTableClusters: 1,
+		refcountOrder:         4,
+		headerLength:          headerV3Length,
+	}
+	b := h.toBytes()
+	if len(b) != headerV3Length {
+		t.Fatalf("header was %d bytes instead of %d", len(b), headerV3Length)
+	}
+	h2, err := headerFromBytes(b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *h2 != *h {
+		t.Errorf("mismatched header, actual %#v expected %#v", h2, h)
+	}
+
+	// version 2 headers have implied values for the version 3 fields
+	h.version = 2
+	b = h.toBytes()
+	if len(b) != headerV2Length {
+		t.Fatalf("header was %d bytes instead of %d", len(b), headerV2Length)
+	}
+	h2, err = headerFromBytes(b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if h2.refcountOrder != defaultRefcountOrder || h2.headerLength != headerV2Length {
+		t.Errorf("version 2 header has refcount order %d and length %d", h2.refcountOrder, h2.headerLength)
+	}
+
+	b[20] = 0xff
+	if _, err := headerFromBytes(b); err == nil {
+		t.Errorf("invalid cluster bits did not return an error")
+	}
+}
+
+func TestExtensions(t *testing.T) {
+	b := extensionToBytes(extensionBackingFormat, []byte("qcow2"))
+	if len(b) != 16 {
+		t.Errorf("extension was %d bytes instead of padded 16", len(b))
+	}
+	b = append(b, extensionToBytes(extensionEnd, nil)...)
+	ext, err := extensionsFromBytes(b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(ext[extensionBackingFormat]) != "qcow2" {
+		t.Errorf("mismatched backing format extension %q", ext[extensionBackingFormat])
+	}
+	if _, err := extensionsFromBytes(b[:16]); err == nil {
+		t.Errorf("unterminated extensions did not return an error")
+	}
+}
+
+func TestCompressedCluster(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "compressed")
+	if err != nil {
+		t.Fatalf("unable to create file: %v", err)
+	}
+	defer f.Close()
+	img, err := Create(f, 1024*1024, "")
+	if err != nil {
+		t.Fatalf("unexpected error creating image: %v", err)
+	}
+
+	// write a compressed cluster by hand at the end of the file, and point the first L2 entry at it
+	data := bytes.Repeat([]byte("compressible "), int(img.clusterSize)/13+1)[:img.clusterSize]
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.BestCompression)
+	_, _ = w.Write(data)
+	_ = w.Close()
+	host, err := img.allocCluster()
+	if err != nil {
+		t.Fatalf("unable to allocate cluster: %v", err)
+	}
+	if _, err := f.WriteAt(buf.Bytes(), host); err != nil {
+		t.Fatalf("unable to write compressed data: %v", err)
+	}
+	l2, err := img.l2TableForWrite(0)
+	if err != nil {
+		t.Fatalf("unable to allocate L2 table: %v", err)
+	}
+	x := 62 - (img.header.clusterBits - 8)
+	sectors := uint64((buf.Len()+511)/512 - 1)
+	entry := entryCompressed | sectors<<x | uint64(host)
+	eb := make([]byte, 8)
+	binary.BigEndian.PutUint64(eb, entry)
+	if _, err := f.WriteAt(eb, l2); err != nil {
+		t.Fatalf("unable to write L2 entry: %v", err)
+	}
+
+	read := make([]byte, img.clusterSize)
+	if _, err := img.ReadAt(read, 0); err != nil {
+		t.Fatalf("unexpected error reading compressed cluster: %v", err)
+	}
+	if !bytes.Equal(read, data) {
+		t.Fatalf("compressed cluster did not decompress to original data")
+	}
+
+	// writing to it rewrites the cluster uncompressed and keeps the rest of the data
+	if _, err := img.WriteAt([]byte("X"), 5); err != nil {
+		t.Fatalf("unexpected error writing compressed cluster: %v", err)
+	}
+	data[5] = 'X'
+	if _, err := img.ReadAt(read, 0); err != nil {
+		t.Fatalf("unexpected error reading: %v", err)
+	}
+	if !bytes.Equal(read, data) {
+		t.Errorf("rewritten compressed cluster has wrong contents")
+	}
+	refcount, err := img.getRefcount(host)
+	if err != nil {
+		t.Fatalf("unexpected error reading refcount: %v", err)
+	}
+	if refcount != 0 {
+		t.Errorf("refcount of released compressed cluster is %d instead of 0", refcount)
+	}
+}
+
+func TestPreallocatedZeroCluster(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "zero")
+	if err != nil {
+		t.Fatalf("unable to create file: %v", err)
+	}
+	defer f.Close()
+	img, err := Create(f, 1024*1024, "")
+	if err != nil {
+		t.Fatalf("unexpected error creating image: %v", err)
+	}
+
+	// fill the first cluster with data, then flag its L2 entry as zero, keeping the host cluster
+	stale := bytes.Repeat([]byte{0xff}, int(img.clusterSize))
+	if _, err := img.WriteAt(stale, 0); err != nil {
+		t.Fatalf("unexpected error writing: %v", err)
+	}
+	l2, err := img.l2TableForWrite(0)
+	if err != nil {
+		t.Fatalf("unable to find L2 table: %v", err)
+	}
+	entry, err := img.readUint64(l2)
+	if err != nil {
+		t.Fatalf("unable to read L2 entry: %v", err)
+	}
+	if err := img.writeUint64(l2, entry|entryZero); err != nil {
+		t.Fatalf("unable to write L2 entry: %v", err)
+	}
+
+	read := make([]byte, img.clusterSize)
+	if _, err := img.ReadAt(read, 0); err != nil {
+		t.Fatalf("unexpected error reading zero cluster: %v", err)
+	}
+	if !bytes.Equal(read, make([]byte, len(read))) {
+		t.Fatalf("preallocated zero cluster did not read as zeroes")
+	}
+
+	// a partial write zeroes the rest of the cluster, in place, and clears the flag
+	patch := []byte("partial")
+	if _, err := img.WriteAt(patch, 100); err != nil {
+		t.Fatalf("unexpected error writing zero cluster: %v", err)
+	}
+	expected := make([]byte, img.clusterSize)
+	copy(expected[100:], patch)
+	if _, err := img.ReadAt(read, 0); err != nil {
+		t.Fatalf("unexpected error reading: %v", err)
+	}
+	if !bytes.Equal(read, expected) {
+		t.Errorf("partially written zero cluster has wrong contents")
+	}
+	after, err := img.readUint64(l2)
+	if err != nil {
+		t.Fatalf("unable to read L2 entry: %v", err)
+	}
+	if after != entry {
+		t.Errorf("L2 entry is %x instead of %x", after, entry)
+	}
+}
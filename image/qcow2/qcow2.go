@@ -0,0 +1,716 @@
+package qcow2
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/diskfs/go-diskfs/util"
+)
+
+const (
+	// entryOffsetMask extracts the host offset from L1, L2 and refcount table entries
+	entryOffsetMask uint64 = 0x00fffffffffffe00
+	// entryCopied marks an L1 or L2 entry whose cluster has a refcount of exactly 1, and so can be written in place
+	entryCopied uint64 = 1 << 63
+	// entryCompressed marks an L2 entry whose cluster is compressed
+	entryCompressed uint64 = 1 << 62
+	// entryZero marks a version 3 L2 entry whose cluster reads as all zeroes
+	entryZero uint64 = 1 << 0
+)
+
+// Image is a qcow2 image. It implements util.File, reading and writing the virtual disk.
+type Image struct {
+	file          util.File
+	header        *header
+	clusterSize   int64
+	l2Entries     uint64 // number of entries in each L2 table
+	l1            []uint64
+	refcountTable []uint64
+	refcountBits  uint64
+	end           int64 // offset in the host file at which the next cluster is allocated
+	pos           int64 // position for Seek
+	backing       util.File
+	backingSize   int64
+	backingName   string
+	backingFormat string
+	backingCloser io.Closer
+	// the most recently decompressed cluster, by L2 entry
+	compressedEntry uint64
+	compressedData  []byte
+}
+
+// IsQcow2 reports whether the given util.File starts with the qcow2 magic number
+func IsQcow2(f util.File) bool {
+	b := make([]byte, 4)
+	if n, err := f.ReadAt(b, 0); err != nil || n != len(b) {
+		return false
+	}
+	return binary.BigEndian.Uint32(b) == qcow2Magic
+}
+
+// Create creates a new, empty qcow2 version 3 image of the given virtual size in bytes, writing it to f,
+// which should be empty.
+//
+// If backingFile is not empty, clusters that have not been written in the new image are read from
+// the backing file, which can be a raw or qcow2 image. A relative backingFile is relative to the
+// directory of f. The backing file is never written.
+func Create(f util.File, size int64, backingFile string) (*Image, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid virtual size %d", size)
+	}
+	clusterBits := uint32(defaultClusterBits)
+	clusterSize := int64(1) << clusterBits
+	l2Entries := clusterSize / 8
+	l1Size := (size + clusterSize*l2Entries - 1) / (clusterSize * l2Entries)
+	l1Clusters := (l1Size*8 + clusterSize - 1) / clusterSize
+
+	// layout: header, refcount table, first refcount block, L1 table
+	refcountTableOffset := clusterSize
+	refcountBlockOffset := 2 * clusterSize
+	l1Offset := 3 * clusterSize
+	usedClusters := 3 + l1Clusters
+
+	h := &header{
+		version:               3,
+		clusterBits:           clusterBits,
+		size:                  uint64(size),
+		l1Size:                uint32(l1Size),
+		l1TableOffset:         uint64(l1Offset),
+		refcountTableOffset:   uint64(refcountTableOffset),
+		refcountTableClusters: 1,
+		refcountOrder:         defaultRefcountOrder,
+		headerLength:          headerV3Length,
+	}
+
+	// header cluster: header, extensions, backing file name
+	hb := h.toBytes()
+	if backingFile != "" {
+		backing, backingSize, closer, err := openBacking(f, backingFile, "")
+		if err != nil {
+			return nil, err
+		}
+		backingFormat := "raw"
+		if _, ok := backing.(*Image); ok {
+			backingFormat = "qcow2"
+		}
+		_ = closer.Close()
+		if backingSize > size {
+			return nil, fmt.Errorf("backing file %s of %d bytes is larger than the image size %d", backingFile, backingSize, size)
+		}
+		hb = append(hb, extensionToBytes(extensionBackingFormat, []byte(backingFormat))...)
+		hb = append(hb, extensionToBytes(extensionEnd, nil)...)
+		h.backingFileOffset = uint64(len(hb))
+		h.backingFileSize = uint32(len(backingFile))
+		hb = append(hb, backingFile...)
+		copy(hb, h.toBytes())
+	} else {
+		hb = append(hb, extensionToBytes(extensionEnd, nil)...)
+	}
+	if int64(len(hb)) > clusterSize {
+		return nil, fmt.Errorf("backing file name %s is too long", backingFile)
+	}
+
+	b := make([]byte, usedClusters*clusterSize)
+	copy(b, hb)
+	binary.BigEndian.PutUint64(b[refcountTableOffset:], uint64(refcountBlockOffset))
+	for i := int64(0); i < usedClusters; i++ {
+		binary.BigEndian.PutUint16(b[refcountBlockOffset+i*2:], 1)
+	}
+	written, err := f.WriteAt(b, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error writing qcow2 metadata: %v", err)
+	}
+	if written != len(b) {
+		return nil, fmt.Errorf("wrote %d bytes of qcow2 metadata instead of %d", written, len(b))
+	}
+	return Open(f)
+}
+
+// Open opens an existing qcow2 image stored in f.
+//
+// If the image has a backing file, it is opened read-only; call Close() to release it.
+func Open(f util.File) (*Image, error) {
+	b := make([]byte, headerV3Length)
+	n, err := f.ReadAt(b, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("error reading qcow2 header: %v", err)
+	}
+	h, err := headerFromBytes(b[:n])
+	if err != nil {
+		return nil, fmt.Errorf("error reading qcow2 header: %v", err)
+	}
+	switch {
+	case h.cryptMethod != 0:
+		return nil, errors.New("encrypted qcow2 images are not supported")
+	case h.incompatibleFeatures&incompatibleDirty != 0:
+		return nil, errors.New("qcow2 image is marked dirty, refcounts must be repaired first")
+	case h.incompatibleFeatures&incompatibleCorrupt != 0:
+		return nil, errors.New("qcow2 image is marked corrupt")
+	case h.incompatibleFeatures&incompatibleExternalData != 0:
+		return nil, errors.New("qcow2 images with external data files are not supported")
+	case h.incompatibleFeatures&incompatibleCompression != 0:
+		return nil, errors.New("qcow2 compression types other than deflate are not supported")
+	case h.incompatibleFeatures&incompatibleExtendedL2 != 0:
+		return nil, errors.New("qcow2 images with extended L2 entries are not supported")
+	case h.incompatibleFeatures != 0:
+		return nil, fmt.Errorf("unsupported qcow2 incompatible features %x", h.incompatibleFeatures)
+	case h.refcountOrder < 3 || h.refcountOrder > 6:
+		return nil, fmt.Errorf("unsupported refcount width of %d bits", 1<<h.refcountOrder)
+	}
+
+	img := &Image{
+		file:         f,
+		header:       h,
+		clusterSize:  int64(1) << h.clusterBits,
+		l2Entries:    uint64(1) << (h.clusterBits - 3),
+		refcountBits: uint64(1) << h.refcountOrder,
+	}
+
+	// the L1 table
+	l1b := make([]byte, int64(h.l1Size)*8)
+	if err := img.readFull(l1b, int64(h.l1TableOffset)); err != nil {
+		return nil, fmt.Errorf("error reading L1 table: %v", err)
+	}
+	img.l1 = make([]uint64, h.l1Size)
+	for i := range img.l1 {
+		img.l1[i] = binary.BigEndian.Uint64(l1b[i*8:])
+	}
+
+	// the refcount table
+	rtb := make([]byte, int64(h.refcountTableClusters)*img.clusterSize)
+	if err := img.readFull(rtb, int64(h.refcountTableOffset)); err != nil {
+		return nil, fmt.Errorf("error reading refcount table: %v", err)
+	}
+	img.refcountTable = make([]uint64, len(rtb)/8)
+	for i := range img.refcountTable {
+		img.refcountTable[i] = binary.BigEndian.Uint64(rtb[i*8:])
+	}
+
+	// new clusters go at the end of the file
+	end, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find end of qcow2 image: %v", err)
+	}
+	img.end = (end + img.clusterSize - 1) &^ (img.clusterSize - 1)
+
+	if h.backingFileOffset != 0 {
+		name := make([]byte, h.backingFileSize)
+		if err := img.readFull(name, int64(h.backingFileOffset)); err != nil {
+			return nil, fmt.Errorf("error reading backing file name: %v", err)
+		}
+		img.backingName = string(name)
+		// the extensions follow the header, up to the backing file name
+		if h.backingFileOffset <= uint64(h.headerLength) || h.backingFileOffset > uint64(img.clusterSize) {
+			return nil, fmt.Errorf("invalid backing file name offset %d", h.backingFileOffset)
+		}
+		eb := make([]byte, h.backingFileOffset-uint64(h.headerLength))
+		if err := img.readFull(eb, int64(h.headerLength)); err != nil {
+			return nil, fmt.Errorf("error reading header extensions: %v", err)
+		}
+		ext, err := extensionsFromBytes(eb)
+		if err != nil {
+			return nil, fmt.Errorf("error reading header extensions: %v", err)
+		}
+		img.backingFormat = string(ext[extensionBackingFormat])
+		backing, backingSize, closer, err := openBacking(f, img.backingName, img.backingFormat)
+		if err != nil {
+			return nil, err
+		}
+		img.backing = backing
+		img.backingSize = backingSize
+		img.backingCloser = closer
+	}
+	return img, nil
+}
+
+// openBacking opens a backing file read-only, relative to the directory of the image if it is
+// a relative path, and returns it as a util.File together with its virtual size. The format is
+// "raw" or "qcow2" as given by the backing format header extension, or "" to detect it.
+func openBacking(f util.File, name, format string) (util.File, int64, io.Closer, error) {
+	if format != "" && format != "raw" && format != "qcow2" {
+		return nil, 0, nil, fmt.Errorf("unsupported format %q of backing file %s", format, name)
+	}
+	p := name
+	if named, ok := f.(interface{ Name() string }); ok && !filepath.IsAbs(p) {
+		p = filepath.Join(filepath.Dir(named.Name()), p)
+	}
+	bf, err := os.Open(p)
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("unable to open backing file %s: %v", name, err)
+	}
+	if format == "qcow2" || (format == "" && IsQcow2(bf)) {
+		img, err := Open(bf)
+		if err != nil {
+			_ = bf.Close()
+			return nil, 0, nil, fmt.Errorf("unable to open qcow2 backing file %s: %v", name, err)
+		}
+		return img, img.Size(), closers{img, bf}, nil
+	}
+	info, err := bf.Stat()
+	if err != nil {
+		_ = bf.Close()
+		return nil, 0, nil, fmt.Errorf("unable to get size of backing file %s: %v", name, err)
+	}
+	return bf, info.Size(), bf, nil
+}
+
+// Size returns the virtual size of the image in bytes
+func (i *Image) Size() int64 {
+	return int64(i.header.size)
+}
+
+// ClusterSize returns the size of a cluster in bytes
+func (i *Image) ClusterSize() int64 {
+	return i.clusterSize
+}
+
+// BackingFile returns the name of the backing file, as stored in the image, or "" if there is none
+func (i *Image) BackingFile() string {
+	return i.backingName
+}
+
+// BackingFormat returns the format of the backing file, "raw" or "qcow2", as stored in the image,
+// or "" if there is no backing file or the image does not record its format
+func (i *Image) BackingFormat() string {
+	return i.backingFormat
+}
+
+// Close releases the backing file, if any. It does not close the util.File holding the image itself.
+func (i *Image) Close() error {
+	if i.backingCloser == nil {
+		return nil
+	}
+	err := i.backingCloser.Close()
+	i.backing, i.backingCloser = nil, nil
+	return err
+}
+
+// ReadAt reads len(b) bytes from the virtual disk starting at byte offset off
+func (i *Image) ReadAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("invalid negative offset %d", off)
+	}
+	size := i.Size()
+	total := 0
+	for total < len(b) && off < size {
+		inCluster := off & (i.clusterSize - 1)
+		count := i.clusterSize - inCluster
+		if remaining := int64(len(b) - total); count > remaining {
+			count = remaining
+		}
+		if remaining := size - off; count > remaining {
+			count = remaining
+		}
+		if err := i.readCluster(b[total:total+int(count)], off); err != nil {
+			return total, err
+		}
+		total += int(count)
+		off += count
+	}
+	if total < len(b) {
+		return total, io.EOF
+	}
+	return total, nil
+}
+
+// WriteAt writes len(b) bytes to the virtual disk starting at byte offset off, allocating clusters as needed
+func (i *Image) WriteAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("invalid negative offset %d", off)
+	}
+	size := i.Size()
+	total := 0
+	for total < len(b) {
+		if off >= size {
+			return total, fmt.Errorf("cannot write beyond end of qcow2 image of size %d", size)
+		}
+		inCluster := off & (i.clusterSize - 1)
+		count := i.clusterSize - inCluster
+		if remaining := int64(len(b) - total); count > remaining {
+			count = remaining
+		}
+		if remaining := size - off; count > remaining {
+			count = remaining
+		}
+		host, err := i.clusterForWrite(off-inCluster, count == i.clusterSize)
+		if err != nil {
+			return total, err
+		}
+		if err := i.writeFull(b[total:total+int(count)], host+inCluster); err != nil {
+			return total, fmt.Errorf("error writing data cluster: %v", err)
+		}
+		total += int(count)
+		off += count
+	}
+	return total, nil
+}
+
+// Seek sets the offset for the next Read or Write. It exists to satisfy util.File.
+func (i *Image) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = i.pos + offset
+	case io.SeekEnd:
+		pos = i.Size() + offset
+	default:
+		return i.pos, fmt.Errorf("invalid whence %d", whence)
+	}
+	if pos < 0 {
+		return i.pos, fmt.Errorf("cannot seek to negative offset %d", pos)
+	}
+	i.pos = pos
+	return pos, nil
+}
+
+// readCluster fills b, which must not cross a cluster boundary, from virtual offset off
+func (i *Image) readCluster(b []byte, off int64) error {
+	entry, err := i.l2Entry(off)
+	if err != nil {
+		return err
+	}
+	inCluster := off & (i.clusterSize - 1)
+	switch {
+	case i.isZero(entry):
+		// a preallocated zero cluster has a host offset too, but its contents are stale
+		zero(b)
+	case entry&entryCompressed != 0:
+		data, err := i.decompressCluster(entry)
+		if err != nil {
+			return err
+		}
+		copy(b, data[inCluster:])
+	case entry&entryOffsetMask != 0:
+		if err := i.readFull(b, int64(entry&entryOffsetMask)+inCluster); err != nil {
+			return fmt.Errorf("error reading data cluster: %v", err)
+		}
+	default:
+		return i.readBacking(b, off)
+	}
+	return nil
+}
+
+// isZero reports whether an L2 entry marks its cluster as reading as all zeroes. The flag only exists in
+// version 3, and only for standard clusters, as bit 0 of a compressed entry is part of its host offset.
+func (i *Image) isZero(entry uint64) bool {
+	return i.header.version >= 3 && entry&entryCompressed == 0 && entry&entryZero != 0
+}
+
+// readBacking fills b from the backing file at virtual offset off, or with zeroes where there is none
+func (i *Image) readBacking(b []byte, off int64) error {
+	zero(b)
+	if i.backing == nil || off >= i.backingSize {
+		return nil
+	}
+	count := int64(len(b))
+	if off+count > i.backingSize {
+		count = i.backingSize - off
+	}
+	n, err := i.backing.ReadAt(b[:count], off)
+	if err != nil && !(errors.Is(err, io.EOF) && int64(n) == count) {
+		return fmt.Errorf("error reading backing file: %v", err)
+	}
+	return nil
+}
+
+// l2Entry returns the L2 entry for the cluster containing virtual offset off, or 0 if it is unallocated
+func (i *Image) l2Entry(off int64) (uint64, error) {
+	l1Index, l2Index := i.indexes(off)
+	if l1Index >= uint64(len(i.l1)) {
+		return 0, nil
+	}
+	l2Offset := i.l1[l1Index] & entryOffsetMask
+	if l2Offset == 0 {
+		return 0, nil
+	}
+	return i.readUint64(int64(l2Offset + l2Index*8))
+}
+
+// indexes returns the L1 and L2 indexes for a virtual offset
+func (i *Image) indexes(off int64) (l1Index, l2Index uint64) {
+	cluster := uint64(off) >> i.header.clusterBits
+	return cluster / i.l2Entries, cluster % i.l2Entries
+}
+
+// compressedRange returns the host offset and length of the data for a compressed L2 entry
+func (i *Image) compressedRange(entry uint64) (offset, length int64) {
+	x := 62 - (i.header.clusterBits - 8)
+	offset = int64(entry & (uint64(1)<<x - 1))
+	sectors := int64((entry>>x)&(uint64(1)<<(i.header.clusterBits-8)-1)) + 1
+	length = sectors*512 - offset&511
+	return offset, length
+}
+
+func (i *Image) decompressCluster(entry uint64) ([]byte, error) {
+	if i.compressedData != nil && i.compressedEntry == entry {
+		return i.compressedData, nil
+	}
+	offset, length := i.compressedRange(entry)
+	b := make([]byte, length)
+	// the compressed data may end before the last sector of the file does
+	n, err := i.file.ReadAt(b, offset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("error reading compressed cluster: %v", err)
+	}
+	data := make([]byte, i.clusterSize)
+	r := flate.NewReader(bytes.NewReader(b[:n]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("error decompressing cluster: %v", err)
+	}
+	i.compressedEntry, i.compressedData = entry, data
+	return data, nil
+}
+
+// clusterForWrite returns the host offset of a cluster, with a refcount of 1, that holds the virtual
+// cluster starting at off, allocating it or copying it on write as needed.
+// If full is true, the whole cluster is about to be overwritten, so previous contents are not copied.
+func (i *Image) clusterForWrite(off int64, full bool) (int64, error) {
+	l1Index, l2Index := i.indexes(off)
+	if l1Index >= uint64(len(i.l1)) {
+		return 0, fmt.Errorf("offset %d is beyond the L1 table", off)
+	}
+	l2Offset, err := i.l2TableForWrite(l1Index)
+	if err != nil {
+		return 0, err
+	}
+	entryOffset := l2Offset + int64(l2Index)*8
+	entry, err := i.readUint64(entryOffset)
+	if err != nil {
+		return 0, err
+	}
+	if entry&entryCopied != 0 && entry&entryCompressed == 0 && entry&entryOffsetMask != 0 {
+		host := int64(entry & entryOffsetMask)
+		if !i.isZero(entry) {
+			return host, nil
+		}
+		// a preallocated zero cluster is ours to write, but must be zeroed and lose its flag first
+		if !full {
+			if err := i.writeFull(make([]byte, i.clusterSize), host); err != nil {
+				return 0, fmt.Errorf("error zeroing cluster: %v", err)
+			}
+		}
+		if err := i.writeUint64(entryOffset, entry&^entryZero); err != nil {
+			return 0, fmt.Errorf("error updating L2 table: %v", err)
+		}
+		return host, nil
+	}
+
+	// we need a new cluster; fill it with the old contents first unless they are about to be replaced
+	var data []byte
+	if !full {
+		data = make([]byte, i.clusterSize)
+		if err := i.readCluster(data, off); err != nil {
+			return 0, err
+		}
+	}
+	host, err := i.allocCluster()
+	if err != nil {
+		return 0, err
+	}
+	if data != nil {
+		if err := i.writeFull(data, host); err != nil {
+			return 0, fmt.Errorf("error copying cluster: %v", err)
+		}
+	}
+	if err := i.writeUint64(entryOffset, uint64(host)|entryCopied); err != nil {
+		return 0, fmt.Errorf("error updating L2 table: %v", err)
+	}
+
+	// release our reference to the old cluster(s)
+	switch {
+	case entry&entryCompressed != 0:
+		start, length := i.compressedRange(entry)
+		for c := start &^ (i.clusterSize - 1); c < start+length; c += i.clusterSize {
+			if err := i.decref(c); err != nil {
+				return 0, err
+			}
+		}
+		i.compressedData = nil
+	case entry&entryOffsetMask != 0:
+		if err := i.decref(int64(entry & entryOffsetMask)); err != nil {
+			return 0, err
+		}
+	}
+	return host, nil
+}
+
+// l2TableForWrite returns the host offset of a writable L2 table for the given L1 index,
+// allocating it, or copying it if it is shared with a snapshot
+func (i *Image) l2TableForWrite(l1Index uint64) (int64, error) {
+	entry := i.l1[l1Index]
+	old := int64(entry & entryOffsetMask)
+	if old != 0 && entry&entryCopied != 0 {
+		return old, nil
+	}
+	host, err := i.allocCluster()
+	if err != nil {
+		return 0, err
+	}
+	if old != 0 {
+		b := make([]byte, i.clusterSize)
+		if err := i.readFull(b, old); err != nil {
+			return 0, fmt.Errorf("error reading L2 table: %v", err)
+		}
+		if err := i.writeFull(b, host); err != nil {
+			return 0, fmt.Errorf("error copying L2 table: %v", err)
+		}
+		if err := i.decref(old); err != nil {
+			return 0, err
+		}
+	}
+	i.l1[l1Index] = uint64(host) | entryCopied
+	if err := i.writeUint64(int64(i.header.l1TableOffset+l1Index*8), i.l1[l1Index]); err != nil {
+		return 0, fmt.Errorf("error updating L1 table: %v", err)
+	}
+	return host, nil
+}
+
+// allocCluster allocates a zeroed cluster at the end of the image and sets its refcount to 1
+func (i *Image) allocCluster() (int64, error) {
+	host := i.end
+	i.end += i.clusterSize
+	if err := i.writeFull(make([]byte, i.clusterSize), host); err != nil {
+		return 0, fmt.Errorf("error allocating cluster: %v", err)
+	}
+	if err := i.setRefcount(host, 1); err != nil {
+		return 0, err
+	}
+	return host, nil
+}
+
+// refcountLocation returns where the refcount for the cluster at host offset is stored, allocating
+// the refcount block if needed
+func (i *Image) refcountLocation(host int64, allocate bool) (int64, error) {
+	cluster := uint64(host) >> i.header.clusterBits
+	perBlock := uint64(i.clusterSize) * 8 / i.refcountBits
+	blockIndex := cluster / perBlock
+	if blockIndex >= uint64(len(i.refcountTable)) {
+		return 0, fmt.Errorf("refcount table is full, cannot track cluster at offset %d", host)
+	}
+	block := int64(i.refcountTable[blockIndex] & entryOffsetMask)
+	if block == 0 {
+		if !allocate {
+			return 0, nil
+		}
+		block = i.end
+		i.end += i.clusterSize
+		if err := i.writeFull(make([]byte, i.clusterSize), block); err != nil {
+			return 0, fmt.Errorf("error allocating refcount block: %v", err)
+		}
+		i.refcountTable[blockIndex] = uint64(block)
+		if err := i.writeUint64(int64(i.header.refcountTableOffset+blockIndex*8), uint64(block)); err != nil {
+			return 0, fmt.Errorf("error updating refcount table: %v", err)
+		}
+		// the new block needs a refcount of its own
+		if err := i.setRefcount(block, 1); err != nil {
+			return 0, err
+		}
+	}
+	return block + int64((cluster%perBlock)*i.refcountBits/8), nil
+}
+
+func (i *Image) getRefcount(host int64) (uint64, error) {
+	loc, err := i.refcountLocation(host, false)
+	if err != nil || loc == 0 {
+		return 0, err
+	}
+	b := make([]byte, i.refcountBits/8)
+	if err := i.readFull(b, loc); err != nil {
+		return 0, fmt.Errorf("error reading refcount: %v", err)
+	}
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+func (i *Image) setRefcount(host int64, v uint64) error {
+	loc, err := i.refcountLocation(host, true)
+	if err != nil {
+		return err
+	}
+	b := make([]byte, i.refcountBits/8)
+	for j := len(b) - 1; j >= 0; j-- {
+		b[j] = byte(v)
+		v >>= 8
+	}
+	if err := i.writeFull(b, loc); err != nil {
+		return fmt.Errorf("error writing refcount: %v", err)
+	}
+	return nil
+}
+
+func (i *Image) decref(host int64) error {
+	v, err := i.getRefcount(host)
+	if err != nil {
+		return err
+	}
+	if v == 0 {
+		return fmt.Errorf("refcount underflow for cluster at offset %d", host)
+	}
+	return i.setRefcount(host, v-1)
+}
+
+func (i *Image) readUint64(off int64) (uint64, error) {
+	b := make([]byte, 8)
+	if err := i.readFull(b, off); err != nil {
+		return 0, fmt.Errorf("error reading table entry at %d: %v", off, err)
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+func (i *Image) writeUint64(off int64, v uint64) error {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return i.writeFull(b, off)
+}
+
+func (i *Image) readFull(b []byte, off int64) error {
+	n, err := i.file.ReadAt(b, off)
+	if n == len(b) {
+		return nil
+	}
+	if err == nil {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (i *Image) writeFull(b []byte, off int64) error {
+	n, err := i.file.WriteAt(b, off)
+	if err != nil {
+		return err
+	}
+	if n != len(b) {
+		return fmt.Errorf("wrote %d bytes instead of %d", n, len(b))
+	}
+	return nil
+}
+
+// closers closes several io.Closer in order, returning the first error
+type closers []io.Closer
+
+func (c closers) Close() error {
+	var err error
+	for _, closer := range c {
+		if e := closer.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func zero(b []byte) {
+	for j := range b {
+		b[j] = 0
+	}
+}
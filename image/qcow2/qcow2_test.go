@@ -0,0 +1,195 @@
+package qcow2_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/diskfs/go-diskfs/image/qcow2"
+)
+
+const (
+	oneMB = 1024 * 1024
+)
+
+func TestCreateWriteRead(t *testing.T) {
+	dir := t.TempDir()
+	f, err := os.Create(filepath.Join(dir, "disk.qcow2"))
+	if err != nil {
+		t.Fatalf("unable to create image file: %v", err)
+	}
+	defer f.Close()
+
+	size := int64(100 * oneMB)
+	img, err := qcow2.Create(f, size, "")
+	if err != nil {
+		t.Fatalf("unexpected error creating image: %v", err)
+	}
+	if img.Size() != size {
+		t.Errorf("mismatched size, actual %d expected %d", img.Size(), size)
+	}
+
+	// unallocated space reads as zeroes
+	b := make([]byte, 4096)
+	if _, err := img.ReadAt(b, 10*oneMB); err != nil {
+		t.Fatalf("unexpected error reading unallocated cluster: %v", err)
+	}
+	if !bytes.Equal(b, make([]byte, len(b))) {
+		t.Errorf("unallocated cluster did not read as zeroes")
+	}
+
+	// write data crossing a cluster boundary, and at the end of the disk
+	writes := map[int64][]byte{
+		0:                       make([]byte, 512),
+		img.ClusterSize() - 100: make([]byte, 300),
+		size - 1000:             make([]byte, 1000),
+	}
+	for off, data := range writes {
+		_, _ = rand.Read(data)
+		n, err := img.WriteAt(data, off)
+		if err != nil {
+			t.Fatalf("unexpected error writing at %d: %v", off, err)
+		}
+		if n != len(data) {
+			t.Fatalf("wrote %d bytes at %d instead of %d", n, off, len(data))
+		}
+	}
+	if _, err := img.WriteAt([]byte{1, 2}, size); err == nil {
+		t.Errorf("writing beyond the end of the image did not return an error")
+	}
+
+	// reopen and compare
+	reopened, err := qcow2.Open(f)
+	if err != nil {
+		t.Fatalf("unexpected error reopening image: %v", err)
+	}
+	for off, data := range writes {
+		read := make([]byte, len(data))
+		if _, err := reopened.ReadAt(read, off); err != nil {
+			t.Fatalf("unexpected error reading at %d: %v", off, err)
+		}
+		if !bytes.Equal(read, data) {
+			t.Errorf("mismatched data at offset %d", off)
+		}
+	}
+	// the rest of the cluster that was partially written is still zero
+	read := make([]byte, 512)
+	if _, err := reopened.ReadAt(read, 512); err != nil {
+		t.Fatalf("unexpected error reading: %v", err)
+	}
+	if !bytes.Equal(read, make([]byte, len(read))) {
+		t.Errorf("partially written cluster was not zero outside of the written data")
+	}
+}
+
+func TestBackingFile(t *testing.T) {
+	dir := t.TempDir()
+	base := make([]byte, 4*oneMB)
+	_, _ = rand.Read(base)
+	basePath := filepath.Join(dir, "base.img")
+	if err := os.WriteFile(basePath, base, 0o600); err != nil {
+		t.Fatalf("unable to write backing file: %v", err)
+	}
+
+	f, err := os.Create(filepath.Join(dir, "overlay.qcow2"))
+	if err != nil {
+		t.Fatalf("unable to create image file: %v", err)
+	}
+	defer f.Close()
+	// use a relative name, which is resolved against the directory of the image
+	img, err := qcow2.Create(f, 8*oneMB, "base.img")
+	if err != nil {
+		t.Fatalf("unexpected error creating image: %v", err)
+	}
+	defer img.Close()
+	if img.BackingFile() != "base.img" {
+		t.Errorf("mismatched backing file, actual %s expected %s", img.BackingFile(), "base.img")
+	}
+
+	// write into the middle of a cluster; the rest of the cluster must come from the backing file
+	patch := []byte("copy-on-write")
+	off := int64(oneMB + 1000)
+	if _, err := img.WriteAt(patch, off); err != nil {
+		t.Fatalf("unexpected error writing: %v", err)
+	}
+
+	expected := make([]byte, 8*oneMB)
+	copy(expected, base)
+	copy(expected[off:], patch)
+	read := make([]byte, len(expected))
+	if _, err := img.ReadAt(read, 0); err != nil {
+		t.Fatalf("unexpected error reading: %v", err)
+	}
+	if !bytes.Equal(read, expected) {
+		t.Errorf("overlay contents do not match backing file plus written data")
+	}
+
+	// the backing file is untouched
+	after, err := os.ReadFile(basePath)
+	if err != nil {
+		t.Fatalf("unable to read backing file: %v", err)
+	}
+	if !bytes.Equal(after, base) {
+		t.Errorf("backing file was modified")
+	}
+
+	// a chain of qcow2 backing files works as well
+	f2, err := os.Create(filepath.Join(dir, "top.qcow2"))
+	if err != nil {
+		t.Fatalf("unable to create image file: %v", err)
+	}
+	defer f2.Close()
+	top, err := qcow2.Create(f2, 8*oneMB, filepath.Join(dir, "overlay.qcow2"))
+	if err != nil {
+		t.Fatalf("unexpected error creating image with qcow2 backing file: %v", err)
+	}
+	defer top.Close()
+	if _, err := top.ReadAt(read, 0); err != nil {
+		t.Fatalf("unexpected error reading: %v", err)
+	}
+	if !bytes.Equal(read, expected) {
+		t.Errorf("top image contents do not match its backing chain")
+	}
+	if top.BackingFormat() != "qcow2" || img.BackingFormat() != "raw" {
+		t.Errorf("mismatched backing formats, actual %q and %q expected qcow2 and raw", top.BackingFormat(), img.BackingFormat())
+	}
+
+	// the recorded backing format is used rather than guessed, so a raw backing file that starts
+	// with the qcow2 magic is still read as raw
+	magic := []byte{'Q', 'F', 'I', 0xfb}
+	copy(base, magic)
+	if err := os.WriteFile(basePath, base, 0o600); err != nil {
+		t.Fatalf("unable to write backing file: %v", err)
+	}
+	reopened, err := qcow2.Open(f)
+	if err != nil {
+		t.Fatalf("unexpected error opening image with raw backing file: %v", err)
+	}
+	defer reopened.Close()
+	start := make([]byte, len(magic))
+	if _, err := reopened.ReadAt(start, 0); err != nil {
+		t.Fatalf("unexpected error reading: %v", err)
+	}
+	if !bytes.Equal(start, magic) {
+		t.Errorf("raw backing file was not read as raw, start is %x", start)
+	}
+}
+
+func TestOpenInvalid(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "raw")
+	if err != nil {
+		t.Fatalf("unable to create file: %v", err)
+	}
+	defer f.Close()
+	if err := f.Truncate(oneMB); err != nil {
+		t.Fatalf("unable to size file: %v", err)
+	}
+	if qcow2.IsQcow2(f) {
+		t.Errorf("raw file detected as qcow2")
+	}
+	if _, err := qcow2.Open(f); err == nil {
+		t.Errorf("opening raw file as qcow2 did not return an error")
+	}
+}
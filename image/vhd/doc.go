@@ -0,0 +1,17 @@
+// Package vhd provides an implementation of the Microsoft Virtual Hard Disk (VHD) image format,
+// as used by Virtual PC, Hyper-V and Azure.
+//
+// Fixed VHD images are a raw disk followed by a 512-byte footer. Dynamic VHD images additionally have
+// a dynamic disk header and a Block Allocation Table (BAT), and allocate blocks as they are written.
+// Differencing images are not supported.
+//
+// vhd.Image implements util.File from github.com/diskfs/go-diskfs/util over the virtual disk, so that
+// it can be used anywhere a raw disk image can be used, e.g. for partition tables and filesystems.
+//
+// Azure only accepts fixed VHD images whose virtual size is a multiple of 1 MiB, so Create rejects any other
+// size for fixed images.
+//
+// references:
+//
+//	https://www.microsoft.com/en-us/download/details.aspx?id=23850
+package vhd
@@ -0,0 +1,232 @@
+package vhd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	uuid "github.com/google/uuid"
+)
+
+const (
+	footerSize        = 512
+	dynamicHeaderSize = 1024
+
+	fileFormatVersion uint32 = 0x00010000
+	headerVersion     uint32 = 0x00010000
+	featuresReserved  uint32 = 0x00000002
+	creatorVersion    uint32 = 0x00010000
+	creatorHostOS     uint32 = 0x5769326b // "Wi2k"
+
+	// noDataOffset is the data offset of a fixed disk, and of the next structure after a dynamic header
+	noDataOffset uint64 = 0xffffffffffffffff
+)
+
+// DiskType is the type of VHD image
+type DiskType uint32
+
+const (
+	// DiskTypeFixed is a fixed VHD, a raw disk followed by a footer
+	DiskTypeFixed DiskType = 2
+	// DiskTypeDynamic is a dynamically allocated VHD
+	DiskTypeDynamic DiskType = 3
+	// DiskTypeDifferencing is a dynamic VHD with a parent image; not supported
+	DiskTypeDifferencing DiskType = 4
+)
+
+func getFooterCookie() []byte {
+	return []byte("conectix")
+}
+
+func getDynamicHeaderCookie() []byte {
+	return []byte("cxsparse")
+}
+
+// vhdEpoch is the base for VHD timestamps
+var vhdEpoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// footer is the hard disk footer, stored big-endian at the end of every VHD, and for dynamic
+// disks also at the beginning
+type footer struct {
+	features        uint32
+	version         uint32
+	dataOffset      uint64
+	timestamp       uint32
+	creatorApp      [4]byte
+	creatorVersion  uint32
+	creatorHostOS   uint32
+	originalSize    uint64
+	currentSize     uint64
+	cylinders       uint16
+	heads           uint8
+	sectorsPerTrack uint8
+	diskType        DiskType
+	uniqueID        uuid.UUID
+	savedState      uint8
+}
+
+func newFooter(size int64, diskType DiskType, dataOffset uint64) *footer {
+	c, h, s := geometry(uint64(size) / 512)
+	id, _ := uuid.NewRandom()
+	return &footer{
+		features:        featuresReserved,
+		version:         fileFormatVersion,
+		dataOffset:      dataOffset,
+		timestamp:       uint32(time.Since(vhdEpoch) / time.Second),
+		creatorApp:      [4]byte{'d', 'f', 's', ' '},
+		creatorVersion:  creatorVersion,
+		creatorHostOS:   creatorHostOS,
+		originalSize:    uint64(size),
+		currentSize:     uint64(size),
+		cylinders:       c,
+		heads:           h,
+		sectorsPerTrack: s,
+		diskType:        diskType,
+		uniqueID:        id,
+	}
+}
+
+// geometry calculates the CHS geometry for a number of sectors, per the algorithm in the VHD specification
+func geometry(totalSectors uint64) (cylinders uint16, heads, sectorsPerTrack uint8) {
+	var cylinderTimesHeads uint64
+	if totalSectors > 65535*16*255 {
+		totalSectors = 65535 * 16 * 255
+	}
+	var spt, hds uint64
+	if totalSectors >= 65535*16*63 {
+		spt = 255
+		hds = 16
+		cylinderTimesHeads = totalSectors / spt
+	} else {
+		spt = 17
+		cylinderTimesHeads = totalSectors / spt
+		hds = (cylinderTimesHeads + 1023) / 1024
+		if hds < 4 {
+			hds = 4
+		}
+		if cylinderTimesHeads >= hds*1024 || hds > 16 {
+			spt = 31
+			hds = 16
+			cylinderTimesHeads = totalSectors / spt
+		}
+		if cylinderTimesHeads >= hds*1024 {
+			spt = 63
+			hds = 16
+			cylinderTimesHeads = totalSectors / spt
+		}
+	}
+	return uint16(cylinderTimesHeads / hds), uint8(hds), uint8(spt)
+}
+
+// checksum is the one's complement of the sum of all bytes, skipping the 4 checksum bytes at pos
+func checksum(b []byte, pos int) uint32 {
+	var sum uint32
+	for i, c := range b {
+		if i >= pos && i < pos+4 {
+			continue
+		}
+		sum += uint32(c)
+	}
+	return ^sum
+}
+
+func footerFromBytes(b []byte) (*footer, error) {
+	if len(b) != footerSize {
+		return nil, fmt.Errorf("footer was %d bytes instead of expected %d", len(b), footerSize)
+	}
+	if !bytes.Equal(b[0:8], getFooterCookie()) {
+		return nil, fmt.Errorf("invalid VHD footer cookie %v", b[0:8])
+	}
+	if expected, actual := checksum(b, 64), binary.BigEndian.Uint32(b[64:68]); expected != actual {
+		return nil, fmt.Errorf("invalid VHD footer checksum, expected %x, got %x", expected, actual)
+	}
+	f := &footer{
+		features:        binary.BigEndian.Uint32(b[8:12]),
+		version:         binary.BigEndian.Uint32(b[12:16]),
+		dataOffset:      binary.BigEndian.Uint64(b[16:24]),
+		timestamp:       binary.BigEndian.Uint32(b[24:28]),
+		creatorVersion:  binary.BigEndian.Uint32(b[32:36]),
+		creatorHostOS:   binary.BigEndian.Uint32(b[36:40]),
+		originalSize:    binary.BigEndian.Uint64(b[40:48]),
+		currentSize:     binary.BigEndian.Uint64(b[48:56]),
+		cylinders:       binary.BigEndian.Uint16(b[56:58]),
+		heads:           b[58],
+		sectorsPerTrack: b[59],
+		diskType:        DiskType(binary.BigEndian.Uint32(b[60:64])),
+		savedState:      b[84],
+	}
+	copy(f.creatorApp[:], b[28:32])
+	copy(f.uniqueID[:], b[68:84])
+	if f.version>>16 != fileFormatVersion>>16 {
+		return nil, fmt.Errorf("unsupported VHD file format version %x", f.version)
+	}
+	return f, nil
+}
+
+func (f *footer) toBytes() []byte {
+	b := make([]byte, footerSize)
+	copy(b[0:8], getFooterCookie())
+	binary.BigEndian.PutUint32(b[8:12], f.features)
+	binary.BigEndian.PutUint32(b[12:16], f.version)
+	binary.BigEndian.PutUint64(b[16:24], f.dataOffset)
+	binary.BigEndian.PutUint32(b[24:28], f.timestamp)
+	copy(b[28:32], f.creatorApp[:])
+	binary.BigEndian.PutUint32(b[32:36], f.creatorVersion)
+	binary.BigEndian.PutUint32(b[36:40], f.creatorHostOS)
+	binary.BigEndian.PutUint64(b[40:48], f.originalSize)
+	binary.BigEndian.PutUint64(b[48:56], f.currentSize)
+	binary.BigEndian.PutUint16(b[56:58], f.cylinders)
+	b[58] = f.heads
+	b[59] = f.sectorsPerTrack
+	binary.BigEndian.PutUint32(b[60:64], uint32(f.diskType))
+	copy(b[68:84], f.uniqueID[:])
+	b[84] = f.savedState
+	binary.BigEndian.PutUint32(b[64:68], checksum(b, 64))
+	return b
+}
+
+// dynamicHeader is the dynamic disk header, stored big-endian at the data offset given in the footer
+type dynamicHeader struct {
+	tableOffset     uint64
+	version         uint32
+	maxTableEntries uint32
+	blockSize       uint32
+}
+
+func dynamicHeaderFromBytes(b []byte) (*dynamicHeader, error) {
+	if len(b) != dynamicHeaderSize {
+		return nil, fmt.Errorf("dynamic disk header was %d bytes instead of expected %d", len(b), dynamicHeaderSize)
+	}
+	if !bytes.Equal(b[0:8], getDynamicHeaderCookie()) {
+		return nil, fmt.Errorf("invalid dynamic disk header cookie %v", b[0:8])
+	}
+	if expected, actual := checksum(b, 36), binary.BigEndian.Uint32(b[36:40]); expected != actual {
+		return nil, fmt.Errorf("invalid dynamic disk header checksum, expected %x, got %x", expected, actual)
+	}
+	h := &dynamicHeader{
+		tableOffset:     binary.BigEndian.Uint64(b[16:24]),
+		version:         binary.BigEndian.Uint32(b[24:28]),
+		maxTableEntries: binary.BigEndian.Uint32(b[28:32]),
+		blockSize:       binary.BigEndian.Uint32(b[32:36]),
+	}
+	if h.version>>16 != headerVersion>>16 {
+		return nil, fmt.Errorf("unsupported dynamic disk header version %x", h.version)
+	}
+	if h.blockSize == 0 || h.blockSize%512 != 0 {
+		return nil, fmt.Errorf("invalid block size %d", h.blockSize)
+	}
+	return h, nil
+}
+
+func (h *dynamicHeader) toBytes() []byte {
+	b := make([]byte, dynamicHeaderSize)
+	copy(b[0:8], getDynamicHeaderCookie())
+	binary.BigEndian.PutUint64(b[8:16], noDataOffset)
+	binary.BigEndian.PutUint64(b[16:24], h.tableOffset)
+	binary.BigEndian.PutUint32(b[24:28], h.version)
+	binary.BigEndian.PutUint32(b[28:32], h.maxTableEntries)
+	binary.BigEndian.PutUint32(b[32:36], h.blockSize)
+	binary.BigEndian.PutUint32(b[36:40], checksum(b, 36))
+	return b
+}
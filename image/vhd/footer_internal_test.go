@@ -0,0 +1,90 @@
+package vhd
+
+import (
+	"os"
+	"testing"
+)
+
+func TestGeometry(t *testing.T) {
+	tests := []struct {
+		sectors uint64
+		c       uint16
+		h, s    uint8
+	}{
+		{20480, 301, 4, 17},                    // 10 MiB
+		{2097152, 2080, 16, 63},                // 1 GiB
+		{65535 * 16 * 255 * 2, 65535, 16, 255}, // saturates
+	}
+	for _, tt := range tests {
+		c, h, s := geometry(tt.sectors)
+		if c != tt.c || h != tt.h || s != tt.s {
+			t.Errorf("%d sectors: geometry %d/%d/%d instead of %d/%d/%d", tt.sectors, c, h, s, tt.c, tt.h, tt.s)
+		}
+	}
+}
+
+func TestFooterToFromBytes(t *testing.T) {
+	ft := newFooter(10*1024*1024, DiskTypeDynamic, footerSize)
+	b := ft.toBytes()
+	ft2, err := footerFromBytes(b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *ft2 != *ft {
+		t.Errorf("mismatched footer, actual %#v expected %#v", ft2, ft)
+	}
+	b[100] = 1
+	if _, err := footerFromBytes(b); err == nil {
+		t.Errorf("bad checksum did not return an error")
+	}
+}
+
+func TestDynamicHeaderToFromBytes(t *testing.T) {
+	h := &dynamicHeader{tableOffset: 1536, version: headerVersion, maxTableEntries: 5, blockSize: DefaultBlockSize}
+	b := h.toBytes()
+	h2, err := dynamicHeaderFromBytes(b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *h2 != *h {
+		t.Errorf("mismatched header, actual %#v expected %#v", h2, h)
+	}
+	b[36]++
+	if _, err := dynamicHeaderFromBytes(b); err == nil {
+		t.Errorf("bad checksum did not return an error")
+	}
+}
+
+func TestDamagedFooter(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "vhd")
+	if err != nil {
+		t.Fatalf("unable to create file: %v", err)
+	}
+	defer f.Close()
+	if _, err := Create(f, 4*1024*1024, DiskTypeDynamic); err != nil {
+		t.Fatalf("unexpected error creating image: %v", err)
+	}
+	info, _ := f.Stat()
+	if _, err := f.WriteAt([]byte("garbage!"), info.Size()-footerSize); err != nil {
+		t.Fatalf("unable to damage footer: %v", err)
+	}
+	img, err := Open(f)
+	if err != nil {
+		t.Fatalf("unexpected error opening image with damaged footer: %v", err)
+	}
+	if _, err := img.WriteAt([]byte("data"), 0); err != nil {
+		t.Fatalf("unexpected error writing: %v", err)
+	}
+	// a valid footer was written at the new end
+	if _, err := Open(f); err != nil {
+		t.Fatalf("unexpected error reopening image: %v", err)
+	}
+	info, _ = f.Stat()
+	b := make([]byte, footerSize)
+	if _, err := f.ReadAt(b, info.Size()-footerSize); err != nil {
+		t.Fatalf("unable to read footer: %v", err)
+	}
+	if _, err := footerFromBytes(b); err != nil {
+		t.Errorf("footer at end of image is invalid: %v", err)
+	}
+}
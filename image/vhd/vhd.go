@@ -0,0 +1,345 @@
+package vhd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/diskfs/go-diskfs/util"
+)
+
+const (
+	// DefaultBlockSize is the block size of newly created dynamic images
+	DefaultBlockSize = 2 * 1024 * 1024
+	// MaxSize is the largest virtual size supported by the VHD format
+	MaxSize = 2040 * 1024 * 1024 * 1024
+
+	// batUnused marks a BAT entry whose block is not allocated
+	batUnused  uint32 = 0xffffffff
+	sectorSize        = 512
+	// fixedSizeAlignment is the multiple of which Azure requires the virtual size of fixed images to be
+	fixedSizeAlignment = 1024 * 1024
+)
+
+// Image is a VHD image. It implements util.File, reading and writing the virtual disk.
+type Image struct {
+	file       util.File
+	footer     *footer
+	header     *dynamicHeader // nil for fixed images
+	bat        []uint32
+	bitmapSize int64 // size of the sector bitmap preceding each block, rounded up to a sector
+	footerPos  int64 // offset in the host file of the footer, and of the next allocated block
+	pos        int64 // position for Seek
+}
+
+// IsVHD reports whether the given util.File ends with a VHD footer, or starts with a copy of one
+func IsVHD(f util.File) bool {
+	end, err := f.Seek(0, io.SeekEnd)
+	if err != nil || end < footerSize {
+		return false
+	}
+	b := make([]byte, len(getFooterCookie()))
+	for _, off := range []int64{end - footerSize, 0} {
+		if n, err := f.ReadAt(b, off); err == nil && n == len(b) && bytes.Equal(b, getFooterCookie()) {
+			return true
+		}
+	}
+	return false
+}
+
+// Create creates a new VHD image of the given virtual size in bytes and type, writing it to f, which should be empty.
+// size must be a multiple of 512 bytes, and for DiskTypeFixed a multiple of 1 MiB, so that the image
+// is accepted by Azure. Only DiskTypeFixed and DiskTypeDynamic are supported.
+func Create(f util.File, size int64, diskType DiskType) (*Image, error) {
+	if size <= 0 || size%sectorSize != 0 {
+		return nil, fmt.Errorf("invalid virtual size %d, must be a positive multiple of %d", size, sectorSize)
+	}
+	if diskType == DiskTypeFixed && size%fixedSizeAlignment != 0 {
+		return nil, fmt.Errorf("invalid virtual size %d for a fixed image, must be a multiple of 1 MiB", size)
+	}
+	if size > MaxSize {
+		return nil, fmt.Errorf("virtual size %d is larger than the VHD maximum of %d", size, int64(MaxSize))
+	}
+	switch diskType {
+	case DiskTypeFixed:
+		ft := newFooter(size, diskType, noDataOffset)
+		if err := writeFull(f, ft.toBytes(), size); err != nil {
+			return nil, fmt.Errorf("error writing VHD footer: %v", err)
+		}
+	case DiskTypeDynamic:
+		entries := (size + DefaultBlockSize - 1) / DefaultBlockSize
+		batOffset := int64(footerSize + dynamicHeaderSize)
+		batSize := (entries*4 + sectorSize - 1) / sectorSize * sectorSize
+		h := &dynamicHeader{
+			tableOffset:     uint64(batOffset),
+			version:         headerVersion,
+			maxTableEntries: uint32(entries),
+			blockSize:       DefaultBlockSize,
+		}
+		ft := newFooter(size, diskType, footerSize)
+		fb := ft.toBytes()
+
+		b := make([]byte, batOffset+batSize+footerSize)
+		copy(b, fb)
+		copy(b[footerSize:], h.toBytes())
+		for i := batOffset; i < batOffset+batSize; i++ {
+			b[i] = 0xff
+		}
+		copy(b[batOffset+batSize:], fb)
+		if err := writeFull(f, b, 0); err != nil {
+			return nil, fmt.Errorf("error writing VHD metadata: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported VHD disk type %d", diskType)
+	}
+	return Open(f)
+}
+
+// Open opens an existing fixed or dynamic VHD image stored in f.
+//
+// If the footer at the end of a dynamic image is damaged, the copy at the start of the image is used,
+// and a new footer is written at the end on the next block allocation.
+func Open(f util.File) (*Image, error) {
+	end, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find end of VHD image: %v", err)
+	}
+	if end < footerSize {
+		return nil, fmt.Errorf("file of %d bytes is too small to be a VHD image", end)
+	}
+	img := &Image{file: f, footerPos: end - footerSize}
+
+	b := make([]byte, footerSize)
+	if err := readFull(f, b, end-footerSize); err != nil {
+		return nil, fmt.Errorf("error reading VHD footer: %v", err)
+	}
+	ft, err := footerFromBytes(b)
+	if err != nil {
+		// try the copy at the start of dynamic images
+		if e := readFull(f, b, 0); e != nil {
+			return nil, fmt.Errorf("error reading VHD footer: %v", err)
+		}
+		ftCopy, e := footerFromBytes(b)
+		if e != nil || ftCopy.diskType != DiskTypeDynamic {
+			return nil, fmt.Errorf("error reading VHD footer: %v", err)
+		}
+		ft = ftCopy
+		img.footerPos = (end + sectorSize - 1) / sectorSize * sectorSize
+	}
+	img.footer = ft
+
+	switch ft.diskType {
+	case DiskTypeFixed:
+		if int64(ft.currentSize) > end-footerSize {
+			return nil, fmt.Errorf("fixed VHD of virtual size %d is truncated to %d bytes", ft.currentSize, end-footerSize)
+		}
+		return img, nil
+	case DiskTypeDynamic:
+	case DiskTypeDifferencing:
+		return nil, errors.New("differencing VHD images are not supported")
+	default:
+		return nil, fmt.Errorf("unknown VHD disk type %d", ft.diskType)
+	}
+
+	hb := make([]byte, dynamicHeaderSize)
+	if err := readFull(f, hb, int64(ft.dataOffset)); err != nil {
+		return nil, fmt.Errorf("error reading dynamic disk header: %v", err)
+	}
+	h, err := dynamicHeaderFromBytes(hb)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(h.maxTableEntries)*uint64(h.blockSize) < ft.currentSize {
+		return nil, fmt.Errorf("BAT of %d entries of %d bytes does not cover virtual size %d", h.maxTableEntries, h.blockSize, ft.currentSize)
+	}
+	img.header = h
+	bitmapBytes := int64(h.blockSize) / sectorSize / 8
+	img.bitmapSize = (bitmapBytes + sectorSize - 1) / sectorSize * sectorSize
+
+	bb := make([]byte, int64(h.maxTableEntries)*4)
+	if err := readFull(f, bb, int64(h.tableOffset)); err != nil {
+		return nil, fmt.Errorf("error reading BAT: %v", err)
+	}
+	img.bat = make([]uint32, h.maxTableEntries)
+	for i := range img.bat {
+		img.bat[i] = binary.BigEndian.Uint32(bb[i*4:])
+	}
+	return img, nil
+}
+
+// Size returns the virtual size of the image in bytes
+func (i *Image) Size() int64 {
+	return int64(i.footer.currentSize)
+}
+
+// Type returns the type of the image
+func (i *Image) Type() DiskType {
+	return i.footer.diskType
+}
+
+// ReadAt reads len(b) bytes from the virtual disk starting at byte offset off
+func (i *Image) ReadAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("invalid negative offset %d", off)
+	}
+	size := i.Size()
+	total := 0
+	for total < len(b) && off < size {
+		count := i.chunk(off, len(b)-total)
+		host, err := i.hostOffset(off, false)
+		if err != nil {
+			return total, err
+		}
+		chunk := b[total : total+int(count)]
+		if host < 0 {
+			zero(chunk)
+		} else if err := readFull(i.file, chunk, host); err != nil {
+			return total, fmt.Errorf("error reading VHD data: %v", err)
+		}
+		total += int(count)
+		off += count
+	}
+	if total < len(b) {
+		return total, io.EOF
+	}
+	return total, nil
+}
+
+// WriteAt writes len(b) bytes to the virtual disk starting at byte offset off, allocating blocks as needed
+func (i *Image) WriteAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("invalid negative offset %d", off)
+	}
+	size := i.Size()
+	total := 0
+	for total < len(b) {
+		if off >= size {
+			return total, fmt.Errorf("cannot write beyond end of VHD image of size %d", size)
+		}
+		count := i.chunk(off, len(b)-total)
+		host, err := i.hostOffset(off, true)
+		if err != nil {
+			return total, err
+		}
+		if err := writeFull(i.file, b[total:total+int(count)], host); err != nil {
+			return total, fmt.Errorf("error writing VHD data: %v", err)
+		}
+		total += int(count)
+		off += count
+	}
+	return total, nil
+}
+
+// Seek sets the offset for the next Read or Write. It exists to satisfy util.File.
+func (i *Image) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = i.pos + offset
+	case io.SeekEnd:
+		pos = i.Size() + offset
+	default:
+		return i.pos, fmt.Errorf("invalid whence %d", whence)
+	}
+	if pos < 0 {
+		return i.pos, fmt.Errorf("cannot seek to negative offset %d", pos)
+	}
+	i.pos = pos
+	return pos, nil
+}
+
+// chunk returns how many of the remaining bytes at virtual offset off can be handled at once,
+// without crossing a block boundary or the end of the disk
+func (i *Image) chunk(off int64, remaining int) int64 {
+	count := i.Size() - off
+	if int64(remaining) < count {
+		count = int64(remaining)
+	}
+	if i.header != nil {
+		blockSize := int64(i.header.blockSize)
+		if inBlock := blockSize - off%blockSize; inBlock < count {
+			count = inBlock
+		}
+	}
+	return count
+}
+
+// hostOffset returns the offset in the host file of virtual offset off, or -1 if it is in an
+// unallocated block. If allocate is true, unallocated blocks are allocated.
+func (i *Image) hostOffset(off int64, allocate bool) (int64, error) {
+	if i.header == nil {
+		return off, nil
+	}
+	blockSize := int64(i.header.blockSize)
+	index := off / blockSize
+	entry := i.bat[index]
+	if entry == batUnused {
+		if !allocate {
+			return -1, nil
+		}
+		var err error
+		if entry, err = i.allocBlock(index); err != nil {
+			return 0, err
+		}
+	}
+	return int64(entry)*sectorSize + i.bitmapSize + off%blockSize, nil
+}
+
+// allocBlock allocates a block where the footer is now, moves the footer after it, and records it in the BAT
+func (i *Image) allocBlock(index int64) (uint32, error) {
+	start := i.footerPos
+	// every sector of the block is marked present; the block data is the newly extended, zero, part of the file
+	bitmap := make([]byte, i.bitmapSize)
+	for j := range bitmap {
+		bitmap[j] = 0xff
+	}
+	if err := writeFull(i.file, bitmap, start); err != nil {
+		return 0, fmt.Errorf("error writing sector bitmap: %v", err)
+	}
+	footerPos := start + i.bitmapSize + int64(i.header.blockSize)
+	if err := writeFull(i.file, i.footer.toBytes(), footerPos); err != nil {
+		return 0, fmt.Errorf("error writing VHD footer: %v", err)
+	}
+	i.footerPos = footerPos
+
+	entry := uint32(start / sectorSize)
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, entry)
+	if err := writeFull(i.file, b, int64(i.header.tableOffset)+index*4); err != nil {
+		return 0, fmt.Errorf("error updating BAT: %v", err)
+	}
+	i.bat[index] = entry
+	return entry, nil
+}
+
+func readFull(f util.File, b []byte, off int64) error {
+	n, err := f.ReadAt(b, off)
+	if n == len(b) {
+		return nil
+	}
+	if err == nil {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func writeFull(f util.File, b []byte, off int64) error {
+	n, err := f.WriteAt(b, off)
+	if err != nil {
+		return err
+	}
+	if n != len(b) {
+		return fmt.Errorf("wrote %d bytes instead of %d", n, len(b))
+	}
+	return nil
+}
+
+func zero(b []byte) {
+	for j := range b {
+		b[j] = 0
+	}
+}
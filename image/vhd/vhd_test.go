@@ -0,0 +1,148 @@
+package vhd_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/diskfs/go-diskfs/image/vhd"
+)
+
+const (
+	oneMB = 1024 * 1024
+)
+
+func TestCreateWriteRead(t *testing.T) {
+	tests := []struct {
+		name     string
+		diskType vhd.DiskType
+	}{
+		{"fixed", vhd.DiskTypeFixed},
+		{"dynamic", vhd.DiskTypeDynamic},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := os.Create(filepath.Join(t.TempDir(), "disk.vhd"))
+			if err != nil {
+				t.Fatalf("unable to create image file: %v", err)
+			}
+			defer f.Close()
+
+			size := int64(10 * oneMB)
+			img, err := vhd.Create(f, size, tt.diskType)
+			if err != nil {
+				t.Fatalf("unexpected error creating image: %v", err)
+			}
+			if img.Size() != size {
+				t.Errorf("mismatched size, actual %d expected %d", img.Size(), size)
+			}
+			if img.Type() != tt.diskType {
+				t.Errorf("mismatched type, actual %d expected %d", img.Type(), tt.diskType)
+			}
+			if !vhd.IsVHD(f) {
+				t.Errorf("created image not detected as VHD")
+			}
+
+			b := make([]byte, 4096)
+			if _, err := img.ReadAt(b, 5*oneMB); err != nil {
+				t.Fatalf("unexpected error reading: %v", err)
+			}
+			if !bytes.Equal(b, make([]byte, len(b))) {
+				t.Errorf("new image did not read as zeroes")
+			}
+
+			// write data crossing a block boundary, and at the end of the disk
+			writes := map[int64][]byte{
+				0:                          make([]byte, 512),
+				vhd.DefaultBlockSize - 100: make([]byte, 300),
+				size - 1000:                make([]byte, 1000),
+			}
+			for off, data := range writes {
+				_, _ = rand.Read(data)
+				if _, err := img.WriteAt(data, off); err != nil {
+					t.Fatalf("unexpected error writing at %d: %v", off, err)
+				}
+			}
+			if _, err := img.WriteAt([]byte{1, 2}, size); err == nil {
+				t.Errorf("writing beyond the end of the image did not return an error")
+			}
+
+			reopened, err := vhd.Open(f)
+			if err != nil {
+				t.Fatalf("unexpected error reopening image: %v", err)
+			}
+			for off, data := range writes {
+				read := make([]byte, len(data))
+				if _, err := reopened.ReadAt(read, off); err != nil {
+					t.Fatalf("unexpected error reading at %d: %v", off, err)
+				}
+				if !bytes.Equal(read, data) {
+					t.Errorf("mismatched data at offset %d", off)
+				}
+			}
+			read := make([]byte, 512)
+			if _, err := reopened.ReadAt(read, 512); err != nil {
+				t.Fatalf("unexpected error reading: %v", err)
+			}
+			if !bytes.Equal(read, make([]byte, len(read))) {
+				t.Errorf("partially written block was not zero outside of the written data")
+			}
+
+			info, err := f.Stat()
+			if err != nil {
+				t.Fatalf("unable to stat image: %v", err)
+			}
+			switch tt.diskType {
+			case vhd.DiskTypeFixed:
+				if info.Size() != size+512 {
+					t.Errorf("fixed image file is %d bytes instead of %d", info.Size(), size+512)
+				}
+			case vhd.DiskTypeDynamic:
+				// 3 of 5 blocks are allocated
+				if info.Size() >= size {
+					t.Errorf("dynamic image file is %d bytes, not smaller than its virtual size", info.Size())
+				}
+				if info.Size()%512 != 0 {
+					t.Errorf("dynamic image file of %d bytes does not end on a sector boundary", info.Size())
+				}
+			}
+		})
+	}
+}
+
+func TestCreateInvalid(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "disk.vhd"))
+	if err != nil {
+		t.Fatalf("unable to create image file: %v", err)
+	}
+	defer f.Close()
+	if _, err := vhd.Create(f, oneMB+1, vhd.DiskTypeFixed); err == nil {
+		t.Errorf("size that is not a multiple of 512 did not return an error")
+	}
+	if _, err := vhd.Create(f, oneMB+512, vhd.DiskTypeFixed); err == nil || !strings.Contains(err.Error(), "multiple of 1 MiB") {
+		t.Errorf("fixed image size that is not a multiple of 1 MiB returned %v", err)
+	}
+	if _, err := vhd.Create(f, oneMB, vhd.DiskTypeDifferencing); err == nil {
+		t.Errorf("differencing disk type did not return an error")
+	}
+}
+
+func TestOpenInvalid(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "raw")
+	if err != nil {
+		t.Fatalf("unable to create file: %v", err)
+	}
+	defer f.Close()
+	if err := f.Truncate(oneMB); err != nil {
+		t.Fatalf("unable to size file: %v", err)
+	}
+	if vhd.IsVHD(f) {
+		t.Errorf("raw file detected as VHD")
+	}
+	if _, err := vhd.Open(f); err == nil {
+		t.Errorf("opening raw file as VHD did not return an error")
+	}
+}
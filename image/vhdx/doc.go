@@ -0,0 +1,13 @@
+// Package vhdx provides an implementation of the Microsoft VHDX image format, as used by Hyper-V.
+//
+// Fixed and dynamic images are supported; differencing images are not. Images with a log that needs
+// to be replayed are refused. Metadata changes made by this package are written in place without
+// using the log, which is fine for offline image building, but is not crash-safe.
+//
+// vhdx.Image implements util.File from github.com/diskfs/go-diskfs/util over the virtual disk, so that
+// it can be used anywhere a raw disk image can be used, e.g. for partition tables and filesystems.
+//
+// references:
+//
+//	https://learn.microsoft.com/en-us/openspecs/windows_protocols/ms-vhdx/83e061f8-f6e2-4de1-91bd-5d518a43d477
+package vhdx
@@ -0,0 +1,187 @@
+package vhdx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"unicode/utf16"
+
+	uuid "github.com/google/uuid"
+)
+
+const (
+	kb = 1024
+	mb = 1024 * kb
+
+	fileIdentifierSize = 64 * kb
+	headerOffset1      = 64 * kb
+	headerOffset2      = 128 * kb
+	headerSize         = 4 * kb
+	regionTableOffset1 = 192 * kb
+	regionTableOffset2 = 256 * kb
+	regionTableSize    = 64 * kb
+	maxRegionEntries   = (regionTableSize - 16) / 32
+
+	headerVersion uint16 = 1
+)
+
+var (
+	batRegionGUID      = uuid.MustParse("2DC27766-F623-4200-9D64-115E9BFD4A08")
+	metadataRegionGUID = uuid.MustParse("8B7CA206-4790-4B9A-B8FE-575F050F886E")
+	crcTable           = crc32.MakeTable(crc32.Castagnoli)
+)
+
+func getFileIdentifierSignature() []byte {
+	return []byte("vhdxfile")
+}
+
+func getHeaderSignature() []byte {
+	return []byte("head")
+}
+
+func getRegionTableSignature() []byte {
+	return []byte("regi")
+}
+
+// checksum calculates the CRC-32C of b with the 4 bytes at pos treated as zero
+func checksum(b []byte, pos int) uint32 {
+	c := crc32.Update(0, crcTable, b[:pos])
+	c = crc32.Update(c, crcTable, make([]byte, 4))
+	return crc32.Update(c, crcTable, b[pos+4:])
+}
+
+// guidToBytes converts a uuid.UUID to the mixed-endian on-disk GUID format
+func guidToBytes(u uuid.UUID) []byte {
+	b := make([]byte, 16)
+	copy(b, u[:])
+	b[0], b[1], b[2], b[3] = u[3], u[2], u[1], u[0]
+	b[4], b[5] = u[5], u[4]
+	b[6], b[7] = u[7], u[6]
+	return b
+}
+
+// guidFromBytes converts a mixed-endian on-disk GUID to a uuid.UUID
+func guidFromBytes(b []byte) uuid.UUID {
+	var raw, u uuid.UUID
+	copy(raw[:], b[:16])
+	copy(u[:], guidToBytes(raw))
+	return u
+}
+
+func fileIdentifierToBytes(creator string) []byte {
+	b := make([]byte, fileIdentifierSize)
+	copy(b, getFileIdentifierSignature())
+	for i, c := range utf16.Encode([]rune(creator)) {
+		if 8+i*2+2 > 8+512 {
+			break
+		}
+		binary.LittleEndian.PutUint16(b[8+i*2:], c)
+	}
+	return b
+}
+
+// header is one of the two VHDX headers; the valid one with the highest sequence number is current
+type header struct {
+	sequenceNumber uint64
+	fileWriteGUID  uuid.UUID
+	dataWriteGUID  uuid.UUID
+	logGUID        uuid.UUID
+	logVersion     uint16
+	version        uint16
+	logLength      uint32
+	logOffset      uint64
+}
+
+func headerFromBytes(b []byte) (*header, error) {
+	if len(b) != headerSize {
+		return nil, fmt.Errorf("header was %d bytes instead of expected %d", len(b), headerSize)
+	}
+	if !bytes.Equal(b[0:4], getHeaderSignature()) {
+		return nil, fmt.Errorf("invalid header signature %v", b[0:4])
+	}
+	if expected, actual := checksum(b, 4), binary.LittleEndian.Uint32(b[4:8]); expected != actual {
+		return nil, fmt.Errorf("invalid header checksum, expected %x, got %x", expected, actual)
+	}
+	h := &header{
+		sequenceNumber: binary.LittleEndian.Uint64(b[8:16]),
+		fileWriteGUID:  guidFromBytes(b[16:32]),
+		dataWriteGUID:  guidFromBytes(b[32:48]),
+		logGUID:        guidFromBytes(b[48:64]),
+		logVersion:     binary.LittleEndian.Uint16(b[64:66]),
+		version:        binary.LittleEndian.Uint16(b[66:68]),
+		logLength:      binary.LittleEndian.Uint32(b[68:72]),
+		logOffset:      binary.LittleEndian.Uint64(b[72:80]),
+	}
+	if h.version != headerVersion {
+		return nil, fmt.Errorf("unsupported VHDX version %d", h.version)
+	}
+	return h, nil
+}
+
+func (h *header) toBytes() []byte {
+	b := make([]byte, headerSize)
+	copy(b[0:4], getHeaderSignature())
+	binary.LittleEndian.PutUint64(b[8:16], h.sequenceNumber)
+	copy(b[16:32], guidToBytes(h.fileWriteGUID))
+	copy(b[32:48], guidToBytes(h.dataWriteGUID))
+	copy(b[48:64], guidToBytes(h.logGUID))
+	binary.LittleEndian.PutUint16(b[64:66], h.logVersion)
+	binary.LittleEndian.PutUint16(b[66:68], h.version)
+	binary.LittleEndian.PutUint32(b[68:72], h.logLength)
+	binary.LittleEndian.PutUint64(b[72:80], h.logOffset)
+	binary.LittleEndian.PutUint32(b[4:8], checksum(b, 4))
+	return b
+}
+
+// region is an entry in the region table
+type region struct {
+	guid     uuid.UUID
+	offset   uint64
+	length   uint32
+	required bool
+}
+
+func regionTableFromBytes(b []byte) ([]region, error) {
+	if len(b) != regionTableSize {
+		return nil, fmt.Errorf("region table was %d bytes instead of expected %d", len(b), regionTableSize)
+	}
+	if !bytes.Equal(b[0:4], getRegionTableSignature()) {
+		return nil, fmt.Errorf("invalid region table signature %v", b[0:4])
+	}
+	if expected, actual := checksum(b, 4), binary.LittleEndian.Uint32(b[4:8]); expected != actual {
+		return nil, fmt.Errorf("invalid region table checksum, expected %x, got %x", expected, actual)
+	}
+	count := binary.LittleEndian.Uint32(b[8:12])
+	if count > maxRegionEntries {
+		return nil, fmt.Errorf("region table has %d entries, more than the maximum %d", count, maxRegionEntries)
+	}
+	regions := make([]region, 0, count)
+	for i := uint32(0); i < count; i++ {
+		e := b[16+i*32 : 16+i*32+32]
+		regions = append(regions, region{
+			guid:     guidFromBytes(e[0:16]),
+			offset:   binary.LittleEndian.Uint64(e[16:24]),
+			length:   binary.LittleEndian.Uint32(e[24:28]),
+			required: binary.LittleEndian.Uint32(e[28:32])&1 == 1,
+		})
+	}
+	return regions, nil
+}
+
+func regionTableToBytes(regions []region) []byte {
+	b := make([]byte, regionTableSize)
+	copy(b[0:4], getRegionTableSignature())
+	binary.LittleEndian.PutUint32(b[8:12], uint32(len(regions)))
+	for i, r := range regions {
+		e := b[16+i*32 : 16+i*32+32]
+		copy(e[0:16], guidToBytes(r.guid))
+		binary.LittleEndian.PutUint64(e[16:24], r.offset)
+		binary.LittleEndian.PutUint32(e[24:28], r.length)
+		if r.required {
+			binary.LittleEndian.PutUint32(e[28:32], 1)
+		}
+	}
+	binary.LittleEndian.PutUint32(b[4:8], checksum(b, 4))
+	return b
+}
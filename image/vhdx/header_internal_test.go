@@ -0,0 +1,136 @@
+package vhdx
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	uuid "github.com/google/uuid"
+)
+
+func TestGUIDBytes(t *testing.T) {
+	// the BAT region GUID as stored on disk
+	expected := []byte{0x66, 0x77, 0xc2, 0x2d, 0x23, 0xf6, 0x00, 0x42, 0x9d, 0x64, 0x11, 0x5e, 0x9b, 0xfd, 0x4a, 0x08}
+	b := guidToBytes(batRegionGUID)
+	if !bytes.Equal(b, expected) {
+		t.Errorf("mismatched GUID bytes, actual %x expected %x", b, expected)
+	}
+	if u := guidFromBytes(b); u != batRegionGUID {
+		t.Errorf("mismatched GUID, actual %s expected %s", u, batRegionGUID)
+	}
+}
+
+func TestHeaderToFromBytes(t *testing.T) {
+	h := &header{
+		sequenceNumber: 7,
+		fileWriteGUID:  uuid.New(),
+		dataWriteGUID:  uuid.New(),
+		version:        headerVersion,
+		logLength:      logLength,
+		logOffset:      logOffset,
+	}
+	b := h.toBytes()
+	h2, err := headerFromBytes(b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *h2 != *h {
+		t.Errorf("mismatched header, actual %#v expected %#v", h2, h)
+	}
+	b[100] = 1
+	if _, err := headerFromBytes(b); err == nil {
+		t.Errorf("bad checksum did not return an error")
+	}
+}
+
+func TestRegionTableToFromBytes(t *testing.T) {
+	regions := []region{
+		{guid: batRegionGUID, offset: batOffset, length: 1024 * 1024, required: true},
+		{guid: metadataRegionGUID, offset: metadataOffset, length: metadataLength, required: true},
+	}
+	b := regionTableToBytes(regions)
+	r, err := regionTableFromBytes(b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(r) != len(regions) || r[0] != regions[0] || r[1] != regions[1] {
+		t.Errorf("mismatched regions, actual %v expected %v", r, regions)
+	}
+	b[20]++
+	if _, err := regionTableFromBytes(b); err == nil {
+		t.Errorf("bad checksum did not return an error")
+	}
+}
+
+func TestMetadataToFromBytes(t *testing.T) {
+	m := &metadata{
+		blockSize:          DefaultBlockSize,
+		virtualDiskSize:    10 * 1024 * 1024,
+		page83Data:         uuid.New(),
+		logicalSectorSize:  512,
+		physicalSectorSize: 4096,
+	}
+	region := make([]byte, metadataLength)
+	copy(region, m.toBytes())
+	m2, err := metadataFromBytes(region)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *m2 != *m {
+		t.Errorf("mismatched metadata, actual %#v expected %#v", m2, m)
+	}
+	m.fileFlags = fileParametersHasParent
+	copy(region, m.toBytes())
+	if _, err := metadataFromBytes(region); err == nil {
+		t.Errorf("differencing image did not return an error")
+	}
+}
+
+func TestHeaderSelection(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "vhdx")
+	if err != nil {
+		t.Fatalf("unable to create file: %v", err)
+	}
+	defer f.Close()
+	img, err := Create(f, 10*1024*1024, false, 0)
+	if err != nil {
+		t.Fatalf("unexpected error creating image: %v", err)
+	}
+	if img.headerSlot != 1 || img.header.sequenceNumber != 1 {
+		t.Errorf("new image has current header %d with sequence %d", img.headerSlot, img.header.sequenceNumber)
+	}
+	// the first write moves the current header to the other slot
+	if _, err := img.WriteAt([]byte("data"), 0); err != nil {
+		t.Fatalf("unexpected error writing: %v", err)
+	}
+	img, err = Open(f)
+	if err != nil {
+		t.Fatalf("unexpected error reopening image: %v", err)
+	}
+	if img.headerSlot != 0 || img.header.sequenceNumber != 2 {
+		t.Errorf("written image has current header %d with sequence %d", img.headerSlot, img.header.sequenceNumber)
+	}
+
+	// a damaged current header falls back to the other one
+	if _, err := f.WriteAt([]byte("junk"), headerOffset1+100); err != nil {
+		t.Fatalf("unable to damage header: %v", err)
+	}
+	img, err = Open(f)
+	if err != nil {
+		t.Fatalf("unexpected error opening image with a damaged header: %v", err)
+	}
+	if img.headerSlot != 1 {
+		t.Errorf("current header is %d instead of the undamaged 1", img.headerSlot)
+	}
+
+	// a pending log is refused
+	h := *img.header
+	h.sequenceNumber = 10
+	h.logGUID = uuid.New()
+	if _, err := f.WriteAt(h.toBytes(), headerOffset1); err != nil {
+		t.Fatalf("unable to write header: %v", err)
+	}
+	if _, err := Open(f); err == nil {
+		t.Errorf("image with a pending log did not return an error")
+	}
+}
@@ -0,0 +1,170 @@
+package vhdx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	uuid "github.com/google/uuid"
+)
+
+const (
+	metadataTableSize = 64 * kb
+	maxMetadataItems  = 2047
+
+	metadataFlagUser        uint32 = 1 << 0
+	metadataFlagVirtualDisk uint32 = 1 << 1
+	metadataFlagRequired    uint32 = 1 << 2
+
+	fileParametersLeaveBlocksAllocated uint32 = 1 << 0
+	fileParametersHasParent            uint32 = 1 << 1
+)
+
+var (
+	fileParametersGUID     = uuid.MustParse("CAA16737-FA36-4D43-B3B6-33F0AA44E76B")
+	virtualDiskSizeGUID    = uuid.MustParse("2FA54224-CD1B-4876-B211-5DBED83BF4B8")
+	page83DataGUID         = uuid.MustParse("BECA12AB-B2E6-4523-93EF-C309E000C746")
+	logicalSectorSizeGUID  = uuid.MustParse("8141BF1D-A96F-4709-BA47-F233A8FAAB5F")
+	physicalSectorSizeGUID = uuid.MustParse("CDA348C7-445D-4471-9CC9-E9885251C556")
+	parentLocatorGUID      = uuid.MustParse("A8D35F2D-B30B-454D-ABF7-D3D84834AB0C")
+)
+
+func getMetadataSignature() []byte {
+	return []byte("metadata")
+}
+
+// metadata holds the known metadata items of a VHDX image
+type metadata struct {
+	blockSize          uint32
+	fileFlags          uint32
+	virtualDiskSize    uint64
+	page83Data         uuid.UUID
+	logicalSectorSize  uint32
+	physicalSectorSize uint32
+}
+
+// metadataFromBytes parses the metadata region, which starts with the metadata table
+func metadataFromBytes(b []byte) (*metadata, error) {
+	if len(b) < metadataTableSize {
+		return nil, fmt.Errorf("metadata region of %d bytes is smaller than the metadata table", len(b))
+	}
+	if !bytes.Equal(b[0:8], getMetadataSignature()) {
+		return nil, fmt.Errorf("invalid metadata table signature %v", b[0:8])
+	}
+	count := int(binary.LittleEndian.Uint16(b[10:12]))
+	if count > maxMetadataItems {
+		return nil, fmt.Errorf("metadata table has %d entries, more than the maximum %d", count, maxMetadataItems)
+	}
+	m := &metadata{}
+	found := map[uuid.UUID]bool{}
+	for i := 0; i < count; i++ {
+		e := b[32+i*32 : 32+i*32+32]
+		id := guidFromBytes(e[0:16])
+		offset := binary.LittleEndian.Uint32(e[16:20])
+		length := binary.LittleEndian.Uint32(e[20:24])
+		flags := binary.LittleEndian.Uint32(e[24:28])
+		if uint64(offset)+uint64(length) > uint64(len(b)) {
+			return nil, fmt.Errorf("metadata item %s at %d of %d bytes is outside of the metadata region", id, offset, length)
+		}
+		data := b[offset : offset+length]
+		var expected uint32
+		switch id {
+		case fileParametersGUID:
+			expected = 8
+		case virtualDiskSizeGUID:
+			expected = 8
+		case page83DataGUID:
+			expected = 16
+		case logicalSectorSizeGUID, physicalSectorSizeGUID:
+			expected = 4
+		case parentLocatorGUID:
+			return nil, fmt.Errorf("differencing VHDX images are not supported")
+		default:
+			if flags&metadataFlagRequired != 0 {
+				return nil, fmt.Errorf("unsupported required metadata item %s", id)
+			}
+			continue
+		}
+		if length != expected {
+			return nil, fmt.Errorf("metadata item %s is %d bytes instead of %d", id, length, expected)
+		}
+		found[id] = true
+		switch id {
+		case fileParametersGUID:
+			m.blockSize = binary.LittleEndian.Uint32(data[0:4])
+			m.fileFlags = binary.LittleEndian.Uint32(data[4:8])
+		case virtualDiskSizeGUID:
+			m.virtualDiskSize = binary.LittleEndian.Uint64(data)
+		case page83DataGUID:
+			m.page83Data = guidFromBytes(data)
+		case logicalSectorSizeGUID:
+			m.logicalSectorSize = binary.LittleEndian.Uint32(data)
+		case physicalSectorSizeGUID:
+			m.physicalSectorSize = binary.LittleEndian.Uint32(data)
+		}
+	}
+	for _, id := range []uuid.UUID{fileParametersGUID, virtualDiskSizeGUID, logicalSectorSizeGUID, physicalSectorSizeGUID} {
+		if !found[id] {
+			return nil, fmt.Errorf("missing required metadata item %s", id)
+		}
+	}
+	if m.fileFlags&fileParametersHasParent != 0 {
+		return nil, fmt.Errorf("differencing VHDX images are not supported")
+	}
+	if m.blockSize < mb || m.blockSize > 256*mb || m.blockSize&(m.blockSize-1) != 0 {
+		return nil, fmt.Errorf("invalid block size %d", m.blockSize)
+	}
+	if m.logicalSectorSize != 512 && m.logicalSectorSize != 4096 {
+		return nil, fmt.Errorf("invalid logical sector size %d", m.logicalSectorSize)
+	}
+	if m.physicalSectorSize != 512 && m.physicalSectorSize != 4096 {
+		return nil, fmt.Errorf("invalid physical sector size %d", m.physicalSectorSize)
+	}
+	if m.virtualDiskSize == 0 || m.virtualDiskSize%uint64(m.logicalSectorSize) != 0 {
+		return nil, fmt.Errorf("invalid virtual disk size %d", m.virtualDiskSize)
+	}
+	return m, nil
+}
+
+// toBytes returns the metadata region: the table, followed by the items, which start at 64KiB
+func (m *metadata) toBytes() []byte {
+	type item struct {
+		id    uuid.UUID
+		flags uint32
+		data  []byte
+	}
+	fp := make([]byte, 8)
+	binary.LittleEndian.PutUint32(fp[0:4], m.blockSize)
+	binary.LittleEndian.PutUint32(fp[4:8], m.fileFlags)
+	vds := make([]byte, 8)
+	binary.LittleEndian.PutUint64(vds, m.virtualDiskSize)
+	lss := make([]byte, 4)
+	binary.LittleEndian.PutUint32(lss, m.logicalSectorSize)
+	pss := make([]byte, 4)
+	binary.LittleEndian.PutUint32(pss, m.physicalSectorSize)
+	items := []item{
+		{fileParametersGUID, metadataFlagRequired, fp},
+		{virtualDiskSizeGUID, metadataFlagVirtualDisk | metadataFlagRequired, vds},
+		{page83DataGUID, metadataFlagVirtualDisk | metadataFlagRequired, guidToBytes(m.page83Data)},
+		{logicalSectorSizeGUID, metadataFlagVirtualDisk | metadataFlagRequired, lss},
+		{physicalSectorSizeGUID, metadataFlagVirtualDisk | metadataFlagRequired, pss},
+	}
+
+	size := metadataTableSize
+	for _, it := range items {
+		size += len(it.data)
+	}
+	b := make([]byte, size)
+	copy(b[0:8], getMetadataSignature())
+	binary.LittleEndian.PutUint16(b[10:12], uint16(len(items)))
+	offset := metadataTableSize
+	for i, it := range items {
+		e := b[32+i*32 : 32+i*32+32]
+		copy(e[0:16], guidToBytes(it.id))
+		binary.LittleEndian.PutUint32(e[16:20], uint32(offset))
+		binary.LittleEndian.PutUint32(e[20:24], uint32(len(it.data)))
+		binary.LittleEndian.PutUint32(e[24:28], it.flags)
+		offset += copy(b[offset:], it.data)
+	}
+	return b
+}
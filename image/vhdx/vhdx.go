@@ -0,0 +1,474 @@
+package vhdx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/diskfs/go-diskfs/util"
+	uuid "github.com/google/uuid"
+)
+
+const (
+	// DefaultBlockSize is the block size of newly created images
+	DefaultBlockSize = 32 * mb
+	// MaxSize is the largest virtual size supported by the VHDX format
+	MaxSize = 64 * 1024 * 1024 * mb
+
+	logOffset      = 1 * mb
+	logLength      = 1 * mb
+	metadataOffset = 2 * mb
+	metadataLength = 1 * mb
+	batOffset      = 3 * mb
+
+	// payload block states, in the low 3 bits of a BAT entry
+	blockNotPresent       uint64 = 0
+	blockUndefined        uint64 = 1
+	blockZero             uint64 = 2
+	blockUnmapped         uint64 = 3
+	blockFullyPresent     uint64 = 6
+	blockPartiallyPresent uint64 = 7
+	blockStateMask        uint64 = 7
+	// the file offset in MiB is in the upper 44 bits of a BAT entry
+	batOffsetShift = 20
+
+	creator = "go-diskfs"
+)
+
+// Image is a VHDX image. It implements util.File, reading and writing the virtual disk.
+type Image struct {
+	file          util.File
+	header        *header
+	headerSlot    int // which of the two headers is current
+	metadata      *metadata
+	batOffset     int64
+	bat           []uint64
+	chunkRatio    uint64 // number of payload blocks per sector bitmap block
+	end           int64  // offset in the host file at which the next block is allocated
+	pos           int64  // position for Seek
+	headerUpdated bool
+}
+
+// IsVHDX reports whether the given util.File starts with the VHDX file identifier
+func IsVHDX(f util.File) bool {
+	b := make([]byte, len(getFileIdentifierSignature()))
+	if n, err := f.ReadAt(b, 0); err != nil || n != len(b) {
+		return false
+	}
+	return bytes.Equal(b, getFileIdentifierSignature())
+}
+
+// Create creates a new VHDX image of the given virtual size in bytes, writing it to f, which should be empty.
+//
+// If fixed is true, all blocks are allocated up front, otherwise they are allocated as they are written.
+// logicalSectorSize is the sector size presented by the virtual disk, 512 or 4096; 0 means 512.
+// size must be a multiple of logicalSectorSize.
+func Create(f util.File, size int64, fixed bool, logicalSectorSize int64) (*Image, error) {
+	if logicalSectorSize == 0 {
+		logicalSectorSize = 512
+	}
+	if logicalSectorSize != 512 && logicalSectorSize != 4096 {
+		return nil, fmt.Errorf("invalid logical sector size %d, must be 512 or 4096", logicalSectorSize)
+	}
+	if size <= 0 || size%logicalSectorSize != 0 {
+		return nil, fmt.Errorf("invalid virtual size %d, must be a positive multiple of %d", size, logicalSectorSize)
+	}
+	if size > MaxSize {
+		return nil, fmt.Errorf("virtual size %d is larger than the VHDX maximum of %d", size, int64(MaxSize))
+	}
+	page83, err := uuid.NewRandom()
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate page 83 identifier: %v", err)
+	}
+	m := &metadata{
+		blockSize:          DefaultBlockSize,
+		virtualDiskSize:    uint64(size),
+		page83Data:         page83,
+		logicalSectorSize:  uint32(logicalSectorSize),
+		physicalSectorSize: 4096,
+	}
+	if fixed {
+		m.fileFlags = fileParametersLeaveBlocksAllocated
+	}
+	blocks, chunkRatio := m.blockCounts()
+	entries := batEntries(blocks, chunkRatio)
+	batLength := (entries*8 + mb - 1) / mb * mb
+
+	// BAT, with every block allocated contiguously after it for fixed images
+	bat := make([]byte, entries*8)
+	dataStart := uint64(batOffset + batLength)
+	if fixed {
+		for b := uint64(0); b < blocks; b++ {
+			entry := (dataStart+b*DefaultBlockSize)/mb<<batOffsetShift | blockFullyPresent
+			binary.LittleEndian.PutUint64(bat[batIndex(b, chunkRatio)*8:], entry)
+		}
+	}
+
+	regions := regionTableToBytes([]region{
+		{guid: batRegionGUID, offset: batOffset, length: uint32(batLength), required: true},
+		{guid: metadataRegionGUID, offset: metadataOffset, length: metadataLength, required: true},
+	})
+	h := &header{
+		version:   headerVersion,
+		logLength: logLength,
+		logOffset: logOffset,
+	}
+	if h.fileWriteGUID, err = uuid.NewRandom(); err != nil {
+		return nil, fmt.Errorf("unable to generate file write GUID: %v", err)
+	}
+	h.dataWriteGUID = h.fileWriteGUID
+
+	writes := []struct {
+		offset int64
+		data   []byte
+	}{
+		{0, fileIdentifierToBytes(creator)},
+		{regionTableOffset1, regions},
+		{regionTableOffset2, regions},
+		{logOffset, make([]byte, logLength)},
+		{metadataOffset, m.toBytes()},
+		{batOffset, bat},
+	}
+	for _, w := range writes {
+		if err := writeFull(f, w.data, w.offset); err != nil {
+			return nil, fmt.Errorf("error writing VHDX metadata at %d: %v", w.offset, err)
+		}
+	}
+	// both headers, the second one current
+	for i, offset := range []int64{headerOffset1, headerOffset2} {
+		h.sequenceNumber = uint64(i)
+		if err := writeFull(f, h.toBytes(), offset); err != nil {
+			return nil, fmt.Errorf("error writing VHDX header: %v", err)
+		}
+	}
+	end := int64(batOffset + batLength)
+	if fixed {
+		end += int64(blocks * DefaultBlockSize)
+	}
+	// extend the file to its full size; the unwritten parts of it read as zeroes
+	if err := writeFull(f, []byte{0}, end-1); err != nil {
+		return nil, fmt.Errorf("error extending VHDX image: %v", err)
+	}
+	return Open(f)
+}
+
+// Open opens an existing fixed or dynamic VHDX image stored in f
+func Open(f util.File) (*Image, error) {
+	if !IsVHDX(f) {
+		return nil, errors.New("missing VHDX file identifier")
+	}
+
+	// the current header is the valid one with the highest sequence number
+	img := &Image{file: f, headerSlot: -1}
+	var headerErr error
+	for i, offset := range []int64{headerOffset1, headerOffset2} {
+		b := make([]byte, headerSize)
+		if err := readFull(f, b, offset); err != nil {
+			headerErr = fmt.Errorf("error reading VHDX header %d: %v", i+1, err)
+			continue
+		}
+		h, err := headerFromBytes(b)
+		if err != nil {
+			headerErr = fmt.Errorf("error reading VHDX header %d: %v", i+1, err)
+			continue
+		}
+		if img.header == nil || h.sequenceNumber > img.header.sequenceNumber {
+			img.header, img.headerSlot = h, i
+		}
+	}
+	if img.header == nil {
+		return nil, fmt.Errorf("no valid VHDX header: %v", headerErr)
+	}
+	if img.header.logGUID != uuid.Nil {
+		return nil, errors.New("VHDX image has a log that must be replayed, which is not supported")
+	}
+
+	var (
+		regions []region
+		err     error
+	)
+	for _, offset := range []int64{regionTableOffset1, regionTableOffset2} {
+		b := make([]byte, regionTableSize)
+		if err = readFull(f, b, offset); err != nil {
+			continue
+		}
+		if regions, err = regionTableFromBytes(b); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("no valid VHDX region table: %v", err)
+	}
+	var batRegion, metadataRegion *region
+	for i := range regions {
+		switch regions[i].guid {
+		case batRegionGUID:
+			batRegion = &regions[i]
+		case metadataRegionGUID:
+			metadataRegion = &regions[i]
+		default:
+			if regions[i].required {
+				return nil, fmt.Errorf("unsupported required region %s", regions[i].guid)
+			}
+		}
+	}
+	if batRegion == nil || metadataRegion == nil {
+		return nil, errors.New("VHDX region table is missing the BAT or metadata region")
+	}
+
+	mdb := make([]byte, metadataRegion.length)
+	if err := readFull(f, mdb, int64(metadataRegion.offset)); err != nil {
+		return nil, fmt.Errorf("error reading VHDX metadata: %v", err)
+	}
+	if img.metadata, err = metadataFromBytes(mdb); err != nil {
+		return nil, fmt.Errorf("error reading VHDX metadata: %v", err)
+	}
+
+	blocks, chunkRatio := img.metadata.blockCounts()
+	entries := batEntries(blocks, chunkRatio)
+	if entries*8 > uint64(batRegion.length) {
+		return nil, fmt.Errorf("BAT region of %d bytes is too small for %d entries", batRegion.length, entries)
+	}
+	bb := make([]byte, entries*8)
+	if err := readFull(f, bb, int64(batRegion.offset)); err != nil {
+		return nil, fmt.Errorf("error reading BAT: %v", err)
+	}
+	img.batOffset = int64(batRegion.offset)
+	img.chunkRatio = chunkRatio
+	img.bat = make([]uint64, entries)
+	for i := range img.bat {
+		img.bat[i] = binary.LittleEndian.Uint64(bb[i*8:])
+	}
+
+	end, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find end of VHDX image: %v", err)
+	}
+	img.end = (end + mb - 1) / mb * mb
+	return img, nil
+}
+
+// blockCounts returns the number of payload blocks, and the number of payload blocks per sector bitmap block
+func (m *metadata) blockCounts() (blocks, chunkRatio uint64) {
+	chunkRatio = (uint64(1) << 23) * uint64(m.logicalSectorSize) / uint64(m.blockSize)
+	blocks = (m.virtualDiskSize + uint64(m.blockSize) - 1) / uint64(m.blockSize)
+	return blocks, chunkRatio
+}
+
+// batEntries returns the number of BAT entries, payload and sector bitmap, for an image without a parent
+func batEntries(blocks, chunkRatio uint64) uint64 {
+	return blocks + (blocks-1)/chunkRatio
+}
+
+// batIndex returns the BAT index of a payload block, skipping the interleaved sector bitmap entries
+func batIndex(block, chunkRatio uint64) uint64 {
+	return block + block/chunkRatio
+}
+
+// Size returns the virtual size of the image in bytes
+func (i *Image) Size() int64 {
+	return int64(i.metadata.virtualDiskSize)
+}
+
+// BlockSize returns the size of a payload block in bytes
+func (i *Image) BlockSize() int64 {
+	return int64(i.metadata.blockSize)
+}
+
+// LogicalSectorSize returns the logical sector size of the virtual disk
+func (i *Image) LogicalSectorSize() int64 {
+	return int64(i.metadata.logicalSectorSize)
+}
+
+// PhysicalSectorSize returns the physical sector size of the virtual disk
+func (i *Image) PhysicalSectorSize() int64 {
+	return int64(i.metadata.physicalSectorSize)
+}
+
+// ReadAt reads len(b) bytes from the virtual disk starting at byte offset off
+func (i *Image) ReadAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("invalid negative offset %d", off)
+	}
+	size := i.Size()
+	total := 0
+	for total < len(b) && off < size {
+		count := i.chunk(off, len(b)-total)
+		host, err := i.hostOffset(off, false)
+		if err != nil {
+			return total, err
+		}
+		chunk := b[total : total+int(count)]
+		if host < 0 {
+			zero(chunk)
+		} else if err := readFull(i.file, chunk, host); err != nil {
+			return total, fmt.Errorf("error reading VHDX data: %v", err)
+		}
+		total += int(count)
+		off += count
+	}
+	if total < len(b) {
+		return total, io.EOF
+	}
+	return total, nil
+}
+
+// WriteAt writes len(b) bytes to the virtual disk starting at byte offset off, allocating blocks as needed
+func (i *Image) WriteAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("invalid negative offset %d", off)
+	}
+	if err := i.updateHeader(); err != nil {
+		return 0, err
+	}
+	size := i.Size()
+	total := 0
+	for total < len(b) {
+		if off >= size {
+			return total, fmt.Errorf("cannot write beyond end of VHDX image of size %d", size)
+		}
+		count := i.chunk(off, len(b)-total)
+		host, err := i.hostOffset(off, true)
+		if err != nil {
+			return total, err
+		}
+		if err := writeFull(i.file, b[total:total+int(count)], host); err != nil {
+			return total, fmt.Errorf("error writing VHDX data: %v", err)
+		}
+		total += int(count)
+		off += count
+	}
+	return total, nil
+}
+
+// Seek sets the offset for the next Read or Write. It exists to satisfy util.File.
+func (i *Image) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = i.pos + offset
+	case io.SeekEnd:
+		pos = i.Size() + offset
+	default:
+		return i.pos, fmt.Errorf("invalid whence %d", whence)
+	}
+	if pos < 0 {
+		return i.pos, fmt.Errorf("cannot seek to negative offset %d", pos)
+	}
+	i.pos = pos
+	return pos, nil
+}
+
+// chunk returns how many of the remaining bytes at virtual offset off can be handled at once,
+// without crossing a block boundary or the end of the disk
+func (i *Image) chunk(off int64, remaining int) int64 {
+	count := i.Size() - off
+	if int64(remaining) < count {
+		count = int64(remaining)
+	}
+	blockSize := i.BlockSize()
+	if inBlock := blockSize - off%blockSize; inBlock < count {
+		count = inBlock
+	}
+	return count
+}
+
+// hostOffset returns the offset in the host file of virtual offset off, or -1 if it is in a block that
+// reads as zeroes. If allocate is true, such blocks are allocated.
+func (i *Image) hostOffset(off int64, allocate bool) (int64, error) {
+	blockSize := i.BlockSize()
+	index := batIndex(uint64(off/blockSize), i.chunkRatio)
+	entry := i.bat[index]
+	switch entry & blockStateMask {
+	case blockFullyPresent:
+	case blockNotPresent, blockUndefined, blockZero, blockUnmapped:
+		if !allocate {
+			return -1, nil
+		}
+		var err error
+		if entry, err = i.allocBlock(index); err != nil {
+			return 0, err
+		}
+	case blockPartiallyPresent:
+		return 0, errors.New("partially present blocks are only valid in differencing VHDX images")
+	default:
+		return 0, fmt.Errorf("invalid BAT entry state %d", entry&blockStateMask)
+	}
+	return int64(entry>>batOffsetShift)*mb + off%blockSize, nil
+}
+
+// allocBlock allocates a zeroed block at the end of the image and records it in the BAT
+func (i *Image) allocBlock(index uint64) (uint64, error) {
+	start := i.end
+	blockSize := i.BlockSize()
+	// extend the file to cover the block; the new space reads as zeroes
+	if err := writeFull(i.file, []byte{0}, start+blockSize-1); err != nil {
+		return 0, fmt.Errorf("error allocating block: %v", err)
+	}
+	i.end += blockSize
+	entry := uint64(start/mb)<<batOffsetShift | blockFullyPresent
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, entry)
+	if err := writeFull(i.file, b, i.batOffset+int64(index)*8); err != nil {
+		return 0, fmt.Errorf("error updating BAT: %v", err)
+	}
+	i.bat[index] = entry
+	return entry, nil
+}
+
+// updateHeader writes a new header with new write GUIDs before the first write to the image, as the
+// specification requires
+func (i *Image) updateHeader() error {
+	if i.headerUpdated {
+		return nil
+	}
+	h := *i.header
+	h.sequenceNumber++
+	var err error
+	if h.fileWriteGUID, err = uuid.NewRandom(); err != nil {
+		return fmt.Errorf("unable to generate file write GUID: %v", err)
+	}
+	h.dataWriteGUID = h.fileWriteGUID
+	slot := 1 - i.headerSlot
+	offset := int64(headerOffset1)
+	if slot == 1 {
+		offset = headerOffset2
+	}
+	if err := writeFull(i.file, h.toBytes(), offset); err != nil {
+		return fmt.Errorf("error updating VHDX header: %v", err)
+	}
+	i.header, i.headerSlot, i.headerUpdated = &h, slot, true
+	return nil
+}
+
+func readFull(f util.File, b []byte, off int64) error {
+	n, err := f.ReadAt(b, off)
+	if n == len(b) {
+		return nil
+	}
+	if err == nil {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func writeFull(f util.File, b []byte, off int64) error {
+	n, err := f.WriteAt(b, off)
+	if err != nil {
+		return err
+	}
+	if n != len(b) {
+		return fmt.Errorf("wrote %d bytes instead of %d", n, len(b))
+	}
+	return nil
+}
+
+func zero(b []byte) {
+	for j := range b {
+		b[j] = 0
+	}
+}
@@ -0,0 +1,142 @@
+package vhdx_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/diskfs/go-diskfs/image/vhdx"
+)
+
+const (
+	oneMB = 1024 * 1024
+)
+
+func TestCreateWriteRead(t *testing.T) {
+	tests := []struct {
+		name  string
+		fixed bool
+	}{
+		{"fixed", true},
+		{"dynamic", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := os.Create(filepath.Join(t.TempDir(), "disk.vhdx"))
+			if err != nil {
+				t.Fatalf("unable to create image file: %v", err)
+			}
+			defer f.Close()
+
+			// more than one block, with a partial last block
+			size := int64(vhdx.DefaultBlockSize + 10*oneMB)
+			img, err := vhdx.Create(f, size, tt.fixed, 0)
+			if err != nil {
+				t.Fatalf("unexpected error creating image: %v", err)
+			}
+			if img.Size() != size {
+				t.Errorf("mismatched size, actual %d expected %d", img.Size(), size)
+			}
+			if img.LogicalSectorSize() != 512 {
+				t.Errorf("mismatched logical sector size %d", img.LogicalSectorSize())
+			}
+			if !vhdx.IsVHDX(f) {
+				t.Errorf("created image not detected as VHDX")
+			}
+
+			b := make([]byte, 4096)
+			if _, err := img.ReadAt(b, 5*oneMB); err != nil {
+				t.Fatalf("unexpected error reading: %v", err)
+			}
+			if !bytes.Equal(b, make([]byte, len(b))) {
+				t.Errorf("new image did not read as zeroes")
+			}
+
+			writes := map[int64][]byte{
+				0:                           make([]byte, 512),
+				vhdx.DefaultBlockSize - 100: make([]byte, 300),
+				size - 1000:                 make([]byte, 1000),
+			}
+			for off, data := range writes {
+				_, _ = rand.Read(data)
+				if _, err := img.WriteAt(data, off); err != nil {
+					t.Fatalf("unexpected error writing at %d: %v", off, err)
+				}
+			}
+			if _, err := img.WriteAt([]byte{1, 2}, size); err == nil {
+				t.Errorf("writing beyond the end of the image did not return an error")
+			}
+
+			reopened, err := vhdx.Open(f)
+			if err != nil {
+				t.Fatalf("unexpected error reopening image: %v", err)
+			}
+			for off, data := range writes {
+				read := make([]byte, len(data))
+				if _, err := reopened.ReadAt(read, off); err != nil {
+					t.Fatalf("unexpected error reading at %d: %v", off, err)
+				}
+				if !bytes.Equal(read, data) {
+					t.Errorf("mismatched data at offset %d", off)
+				}
+			}
+			read := make([]byte, 512)
+			if _, err := reopened.ReadAt(read, 512); err != nil {
+				t.Fatalf("unexpected error reading: %v", err)
+			}
+			if !bytes.Equal(read, make([]byte, len(read))) {
+				t.Errorf("partially written block was not zero outside of the written data")
+			}
+
+			info, err := f.Stat()
+			if err != nil {
+				t.Fatalf("unable to stat image: %v", err)
+			}
+			// metadata takes 4MB; fixed images have both blocks, dynamic ones allocated both on write
+			expected := int64(4*oneMB + 2*vhdx.DefaultBlockSize)
+			if info.Size() != expected {
+				t.Errorf("image file is %d bytes instead of %d", info.Size(), expected)
+			}
+		})
+	}
+}
+
+func TestCreateSectorSize(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "disk.vhdx"))
+	if err != nil {
+		t.Fatalf("unable to create image file: %v", err)
+	}
+	defer f.Close()
+	if _, err := vhdx.Create(f, 10*oneMB, false, 1024); err == nil {
+		t.Errorf("invalid sector size did not return an error")
+	}
+	if _, err := vhdx.Create(f, 10*oneMB+512, false, 4096); err == nil {
+		t.Errorf("size that is not a multiple of the sector size did not return an error")
+	}
+	img, err := vhdx.Create(f, 10*oneMB, false, 4096)
+	if err != nil {
+		t.Fatalf("unexpected error creating image: %v", err)
+	}
+	if img.LogicalSectorSize() != 4096 {
+		t.Errorf("mismatched logical sector size %d", img.LogicalSectorSize())
+	}
+}
+
+func TestOpenInvalid(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "raw")
+	if err != nil {
+		t.Fatalf("unable to create file: %v", err)
+	}
+	defer f.Close()
+	if err := f.Truncate(oneMB); err != nil {
+		t.Fatalf("unable to size file: %v", err)
+	}
+	if vhdx.IsVHDX(f) {
+		t.Errorf("raw file detected as VHDX")
+	}
+	if _, err := vhdx.Open(f); err == nil {
+		t.Errorf("opening raw file as VHDX did not return an error")
+	}
+}
@@ -0,0 +1,17 @@
+// Package vmdk provides an implementation of the VMware Virtual Disk (VMDK) hosted sparse extent format.
+//
+// Two subformats are supported, both a single file with an embedded descriptor:
+//
+//   - monolithicSparse, which can be created, read and written
+//   - streamOptimized, with compressed grains, as used in OVA/OVF packages. These are write-once:
+//     ExportStreamOptimized writes one sequentially from a raw disk, and Open can read one, but not write to it
+//
+// Multi-extent disks, flat extents and parent (delta) disks are not supported.
+//
+// vmdk.Image implements util.File from github.com/diskfs/go-diskfs/util over the virtual disk, so that
+// it can be used anywhere a raw disk image can be used, e.g. for partition tables and filesystems.
+//
+// references:
+//
+//	https://www.vmware.com/app/vmdk/?src=vmdk
+package vmdk
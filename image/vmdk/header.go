@@ -0,0 +1,228 @@
+package vmdk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	vmdkMagic  uint32 = 0x564d444b // "KDMV" on disk
+	sectorSize        = 512
+	headerSize        = sectorSize
+
+	// gdAtEnd is the grain directory offset of a streamOptimized header, meaning it is in the footer
+	gdAtEnd uint64 = 0xffffffffffffffff
+
+	flagValidNewlineTest uint32 = 1 << 0
+	flagRedundantGT      uint32 = 1 << 1
+	flagCompressed       uint32 = 1 << 16
+	flagMarkers          uint32 = 1 << 17
+
+	compressionDeflate uint16 = 1
+
+	defaultGrainSize  = 128 // sectors, i.e. 64KiB
+	gtesPerGT         = 512
+	descriptorSectors = 20
+
+	createTypeMonolithicSparse = "monolithicSparse"
+	createTypeStreamOptimized  = "streamOptimized"
+)
+
+// marker types in streamOptimized images
+const (
+	markerEOS    uint32 = 0
+	markerGT     uint32 = 1
+	markerGD     uint32 = 2
+	markerFooter uint32 = 3
+)
+
+// header is the sparse extent header, at the start of the file, and for streamOptimized images
+// also as a footer near the end
+type header struct {
+	version           uint32
+	flags             uint32
+	capacity          uint64 // sectors
+	grainSize         uint64 // sectors
+	descriptorOffset  uint64 // sectors
+	descriptorSize    uint64 // sectors
+	numGTEsPerGT      uint32
+	rgdOffset         uint64 // sectors
+	gdOffset          uint64 // sectors
+	overHead          uint64 // sectors
+	uncleanShutdown   bool
+	compressAlgorithm uint16
+}
+
+func headerFromBytes(b []byte) (*header, error) {
+	if len(b) < headerSize {
+		return nil, fmt.Errorf("header was %d bytes instead of expected %d", len(b), headerSize)
+	}
+	if magic := binary.LittleEndian.Uint32(b[0:4]); magic != vmdkMagic {
+		return nil, fmt.Errorf("invalid VMDK magic %x", magic)
+	}
+	h := &header{
+		version:           binary.LittleEndian.Uint32(b[4:8]),
+		flags:             binary.LittleEndian.Uint32(b[8:12]),
+		capacity:          binary.LittleEndian.Uint64(b[12:20]),
+		grainSize:         binary.LittleEndian.Uint64(b[20:28]),
+		descriptorOffset:  binary.LittleEndian.Uint64(b[28:36]),
+		descriptorSize:    binary.LittleEndian.Uint64(b[36:44]),
+		numGTEsPerGT:      binary.LittleEndian.Uint32(b[44:48]),
+		rgdOffset:         binary.LittleEndian.Uint64(b[48:56]),
+		gdOffset:          binary.LittleEndian.Uint64(b[56:64]),
+		overHead:          binary.LittleEndian.Uint64(b[64:72]),
+		uncleanShutdown:   b[72] != 0,
+		compressAlgorithm: binary.LittleEndian.Uint16(b[77:79]),
+	}
+	switch {
+	case h.version < 1 || h.version > 3:
+		return nil, fmt.Errorf("unsupported VMDK version %d", h.version)
+	case h.flags&flagValidNewlineTest != 0 && (b[73] != '\n' || b[74] != ' ' || b[75] != '\r' || b[76] != '\n'):
+		return nil, fmt.Errorf("VMDK header end of line characters are corrupted, the file was probably transferred in text mode")
+	case h.grainSize < 8 || h.grainSize&(h.grainSize-1) != 0:
+		return nil, fmt.Errorf("invalid grain size of %d sectors", h.grainSize)
+	case h.numGTEsPerGT != gtesPerGT:
+		return nil, fmt.Errorf("unsupported number of grain table entries %d", h.numGTEsPerGT)
+	case h.flags&flagCompressed != 0 && h.compressAlgorithm != compressionDeflate:
+		return nil, fmt.Errorf("unsupported compression algorithm %d", h.compressAlgorithm)
+	}
+	return h, nil
+}
+
+func (h *header) toBytes() []byte {
+	b := make([]byte, headerSize)
+	binary.LittleEndian.PutUint32(b[0:4], vmdkMagic)
+	binary.LittleEndian.PutUint32(b[4:8], h.version)
+	binary.LittleEndian.PutUint32(b[8:12], h.flags)
+	binary.LittleEndian.PutUint64(b[12:20], h.capacity)
+	binary.LittleEndian.PutUint64(b[20:28], h.grainSize)
+	binary.LittleEndian.PutUint64(b[28:36], h.descriptorOffset)
+	binary.LittleEndian.PutUint64(b[36:44], h.descriptorSize)
+	binary.LittleEndian.PutUint32(b[44:48], h.numGTEsPerGT)
+	binary.LittleEndian.PutUint64(b[48:56], h.rgdOffset)
+	binary.LittleEndian.PutUint64(b[56:64], h.gdOffset)
+	binary.LittleEndian.PutUint64(b[64:72], h.overHead)
+	if h.uncleanShutdown {
+		b[72] = 1
+	}
+	b[73], b[74], b[75], b[76] = '\n', ' ', '\r', '\n'
+	binary.LittleEndian.PutUint16(b[77:79], h.compressAlgorithm)
+	return b
+}
+
+// numGTs returns the number of grain tables, i.e. grain directory entries, needed to cover the capacity
+func (h *header) numGTs() uint64 {
+	perGT := h.grainSize * uint64(h.numGTEsPerGT)
+	return (h.capacity + perGT - 1) / perGT
+}
+
+// descriptor is the embedded text descriptor
+type descriptor struct {
+	cid        uint32
+	createType string
+	extents    []extent
+	ddb        map[string]string
+}
+
+// extent is an extent line of a descriptor, e.g. RW 20480 SPARSE "disk.vmdk"
+type extent struct {
+	access     string
+	sectors    uint64
+	extentType string
+	filename   string
+}
+
+func newDescriptor(cid uint32, createType string, capacity uint64, filename string) *descriptor {
+	// lsilogic geometry, the default for vSphere
+	cylinders := capacity / (255 * 63)
+	if cylinders > 65535 {
+		cylinders = 65535
+	}
+	return &descriptor{
+		cid:        cid,
+		createType: createType,
+		extents:    []extent{{access: "RW", sectors: capacity, extentType: "SPARSE", filename: filename}},
+		ddb: map[string]string{
+			"ddb.virtualHWVersion":   "4",
+			"ddb.geometry.cylinders": strconv.FormatUint(cylinders, 10),
+			"ddb.geometry.heads":     "255",
+			"ddb.geometry.sectors":   "63",
+			"ddb.adapterType":        "lsilogic",
+		},
+	}
+}
+
+func descriptorFromBytes(b []byte) (*descriptor, error) {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	d := &descriptor{ddb: map[string]string{}}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok {
+			key = strings.TrimSpace(key)
+			value = strings.Trim(strings.TrimSpace(value), `"`)
+			switch {
+			case key == "CID":
+				cid, err := strconv.ParseUint(value, 16, 32)
+				if err != nil {
+					return nil, fmt.Errorf("invalid descriptor CID %q", value)
+				}
+				d.cid = uint32(cid)
+			case key == "createType":
+				d.createType = value
+			case strings.HasPrefix(key, "ddb."):
+				d.ddb[key] = value
+			}
+			continue
+		}
+		// extent lines: access size type "filename" [offset]
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("invalid descriptor line %q", line)
+		}
+		sectors, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid extent size in descriptor line %q", line)
+		}
+		_, quoted, _ := strings.Cut(line, `"`)
+		filename, _, _ := strings.Cut(quoted, `"`)
+		d.extents = append(d.extents, extent{access: fields[0], sectors: sectors, extentType: fields[2], filename: filename})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading descriptor: %v", err)
+	}
+	return d, nil
+}
+
+func (d *descriptor) toBytes() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# Disk DescriptorFile\nversion=1\nCID=%08x\nparentCID=ffffffff\ncreateType=%q\n\n", d.cid, d.createType)
+	buf.WriteString("# Extent description\n")
+	for _, e := range d.extents {
+		fmt.Fprintf(&buf, "%s %d %s %q\n", e.access, e.sectors, e.extentType, e.filename)
+	}
+	buf.WriteString("\n# The Disk Data Base\n#DDB\n\n")
+	for _, key := range []string{"ddb.virtualHWVersion", "ddb.geometry.cylinders", "ddb.geometry.heads", "ddb.geometry.sectors", "ddb.adapterType"} {
+		if value, ok := d.ddb[key]; ok {
+			fmt.Fprintf(&buf, "%s = %q\n", key, value)
+		}
+	}
+	return buf.Bytes()
+}
+
+// markerToBytes returns a metadata marker sector for a streamOptimized image
+func markerToBytes(sectors uint64, markerType uint32) []byte {
+	b := make([]byte, sectorSize)
+	binary.LittleEndian.PutUint64(b[0:8], sectors)
+	binary.LittleEndian.PutUint32(b[12:16], markerType)
+	return b
+}
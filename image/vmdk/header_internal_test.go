@@ -0,0 +1,86 @@
+package vmdk
+
+import (
+	"os"
+	"testing"
+)
+
+func TestHeaderToFromBytes(t *testing.T) {
+	h := &header{
+		version:           3,
+		flags:             flagValidNewlineTest | flagCompressed | flagMarkers,
+		capacity:          20480,
+		grainSize:         defaultGrainSize,
+		descriptorOffset:  1,
+		descriptorSize:    descriptorSectors,
+		numGTEsPerGT:      gtesPerGT,
+		gdOffset:          gdAtEnd,
+		overHead:          128,
+		compressAlgorithm: compressionDeflate,
+	}
+	b := h.toBytes()
+	h2, err := headerFromBytes(b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *h2 != *h {
+		t.Errorf("mismatched header, actual %#v expected %#v", h2, h)
+	}
+	if string(b[0:4]) != "KDMV" {
+		t.Errorf("header starts with %q instead of KDMV", b[0:4])
+	}
+
+	// a file transferred in text mode has its \r\n turned into \n
+	b[75] = '\n'
+	if _, err := headerFromBytes(b); err == nil {
+		t.Errorf("corrupted end of line characters did not return an error")
+	}
+}
+
+func TestDescriptorToFromBytes(t *testing.T) {
+	d := newDescriptor(0x1234abcd, createTypeMonolithicSparse, 20480, "disk.vmdk")
+	b := d.toBytes()
+	d2, err := descriptorFromBytes(append(b, 0, 0, 0))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d2.cid != d.cid || d2.createType != d.createType {
+		t.Errorf("mismatched descriptor, actual %#v expected %#v", d2, d)
+	}
+	if len(d2.extents) != 1 || d2.extents[0] != d.extents[0] {
+		t.Errorf("mismatched extents, actual %v expected %v", d2.extents, d.extents)
+	}
+	if d2.ddb["ddb.adapterType"] != "lsilogic" {
+		t.Errorf("mismatched adapter type %q", d2.ddb["ddb.adapterType"])
+	}
+}
+
+func TestRedundantGrainTable(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "vmdk")
+	if err != nil {
+		t.Fatalf("unable to create file: %v", err)
+	}
+	defer f.Close()
+	img, err := Create(f, 10*1024*1024)
+	if err != nil {
+		t.Fatalf("unexpected error creating image: %v", err)
+	}
+	if img.rgd == nil {
+		t.Fatalf("new image has no redundant grain directory")
+	}
+	off := int64(3 * 1024 * 1024)
+	if _, err := img.WriteAt([]byte("data"), off); err != nil {
+		t.Fatalf("unexpected error writing: %v", err)
+	}
+	entry, err := img.readUint32(img.gteLocation(img.gd, off))
+	if err != nil {
+		t.Fatalf("unexpected error reading grain table: %v", err)
+	}
+	redundant, err := img.readUint32(img.gteLocation(img.rgd, off))
+	if err != nil {
+		t.Fatalf("unexpected error reading redundant grain table: %v", err)
+	}
+	if entry == 0 || entry != redundant {
+		t.Errorf("grain table entry %d does not match redundant entry %d", entry, redundant)
+	}
+}
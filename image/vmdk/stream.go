@@ -0,0 +1,139 @@
+package vmdk
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ExportStreamOptimized writes the first size bytes of src, a raw disk, to dst as a streamOptimized
+// VMDK image, suitable for an OVA/OVF package. size is rounded up to a multiple of 512 bytes.
+//
+// dst is written strictly sequentially, so it can be a pipe or an archive entry. Grains that are all
+// zeroes are not stored. src can be a disk.Disk's File, or anything else that implements io.ReaderAt.
+func ExportStreamOptimized(dst io.Writer, src io.ReaderAt, size int64) error {
+	if size <= 0 {
+		return fmt.Errorf("invalid virtual size %d", size)
+	}
+	h := &header{
+		version:           3,
+		flags:             flagValidNewlineTest | flagCompressed | flagMarkers,
+		capacity:          (uint64(size) + sectorSize - 1) / sectorSize,
+		grainSize:         defaultGrainSize,
+		descriptorOffset:  1,
+		descriptorSize:    descriptorSectors,
+		numGTEsPerGT:      gtesPerGT,
+		gdOffset:          gdAtEnd,
+		compressAlgorithm: compressionDeflate,
+	}
+	h.overHead = (h.descriptorOffset + h.descriptorSize + h.grainSize - 1) / h.grainSize * h.grainSize
+	w := &sectorWriter{w: dst}
+
+	desc := newDescriptor(newCID(), createTypeStreamOptimized, h.capacity, extentName(dst))
+	db := desc.toBytes()
+	if uint64(len(db)) > h.descriptorSize*sectorSize {
+		return fmt.Errorf("descriptor of %d bytes does not fit in %d sectors", len(db), h.descriptorSize)
+	}
+	meta := make([]byte, h.overHead*sectorSize)
+	copy(meta, h.toBytes())
+	copy(meta[h.descriptorOffset*sectorSize:], db)
+	if err := w.write(meta); err != nil {
+		return err
+	}
+
+	grainSize := int64(h.grainSize) * sectorSize
+	numGTs := h.numGTs()
+	gd := make([]byte, numGTs*4)
+	grain := make([]byte, grainSize)
+	empty := make([]byte, grainSize)
+	var compressed bytes.Buffer
+	for g := uint64(0); g < numGTs; g++ {
+		gt := make([]byte, gtesPerGT*4)
+		used := false
+		for e := uint64(0); e < gtesPerGT; e++ {
+			off := int64(g*gtesPerGT+e) * grainSize
+			if off >= size {
+				break
+			}
+			count := grainSize
+			if off+count > size {
+				count = size - off
+			}
+			n, err := src.ReadAt(grain[:count], off)
+			if err != nil && !(errors.Is(err, io.EOF) && int64(n) == count) {
+				return fmt.Errorf("error reading source at %d: %v", off, err)
+			}
+			if bytes.Equal(grain[:count], empty[:count]) {
+				continue
+			}
+
+			compressed.Reset()
+			zw := zlib.NewWriter(&compressed)
+			if _, err := zw.Write(grain[:count]); err != nil {
+				return fmt.Errorf("error compressing grain: %v", err)
+			}
+			if err := zw.Close(); err != nil {
+				return fmt.Errorf("error compressing grain: %v", err)
+			}
+			marker := make([]byte, 12, 12+compressed.Len())
+			binary.LittleEndian.PutUint64(marker[0:8], uint64(off/sectorSize))
+			binary.LittleEndian.PutUint32(marker[8:12], uint32(compressed.Len()))
+			binary.LittleEndian.PutUint32(gt[e*4:], uint32(w.sector()))
+			if err := w.write(append(marker, compressed.Bytes()...)); err != nil {
+				return err
+			}
+			used = true
+		}
+		if !used {
+			continue
+		}
+		if err := w.write(markerToBytes(uint64(len(gt)/sectorSize), markerGT)); err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint32(gd[g*4:], uint32(w.sector()))
+		if err := w.write(gt); err != nil {
+			return err
+		}
+	}
+
+	if err := w.write(markerToBytes((uint64(len(gd))+sectorSize-1)/sectorSize, markerGD)); err != nil {
+		return err
+	}
+	h.gdOffset = w.sector()
+	if err := w.write(gd); err != nil {
+		return err
+	}
+	if err := w.write(markerToBytes(1, markerFooter)); err != nil {
+		return err
+	}
+	if err := w.write(h.toBytes()); err != nil {
+		return err
+	}
+	return w.write(markerToBytes(0, markerEOS))
+}
+
+// sectorWriter writes sequentially, padding every write to a sector boundary
+type sectorWriter struct {
+	w       io.Writer
+	written uint64
+}
+
+// sector returns the sector at which the next write starts
+func (s *sectorWriter) sector() uint64 {
+	return s.written / sectorSize
+}
+
+func (s *sectorWriter) write(b []byte) error {
+	if pad := len(b) % sectorSize; pad != 0 {
+		b = append(b, make([]byte, sectorSize-pad)...)
+	}
+	n, err := s.w.Write(b)
+	s.written += uint64(n)
+	if err != nil {
+		return fmt.Errorf("error writing streamOptimized VMDK: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,449 @@
+package vmdk
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/diskfs/go-diskfs/util"
+)
+
+const (
+	// gteZero is a grain table entry for a grain that reads as zeroes without being allocated
+	gteZero uint32 = 1
+)
+
+// Image is a VMDK image. It implements util.File, reading and writing the virtual disk.
+type Image struct {
+	file       util.File
+	header     *header
+	descriptor *descriptor
+	grainSize  int64 // bytes
+	gd         []uint32
+	rgd        []uint32 // redundant grain directory, nil if there is none
+	end        int64    // offset in the host file at which the next grain is allocated
+	pos        int64    // position for Seek
+	// the most recently decompressed grain, by grain table entry
+	compressedEntry uint32
+	compressedData  []byte
+}
+
+// IsVMDK reports whether the given util.File starts with the VMDK sparse extent magic number
+func IsVMDK(f util.File) bool {
+	b := make([]byte, 4)
+	if n, err := f.ReadAt(b, 0); err != nil || n != len(b) {
+		return false
+	}
+	return binary.LittleEndian.Uint32(b) == vmdkMagic
+}
+
+// Create creates a new, empty monolithicSparse VMDK image of the given virtual size in bytes,
+// writing it to f, which should be empty. size must be a multiple of 512 bytes.
+func Create(f util.File, size int64) (*Image, error) {
+	if size <= 0 || size%sectorSize != 0 {
+		return nil, fmt.Errorf("invalid virtual size %d, must be a positive multiple of %d", size, sectorSize)
+	}
+	h := &header{
+		version:          1,
+		flags:            flagValidNewlineTest | flagRedundantGT,
+		capacity:         uint64(size) / sectorSize,
+		grainSize:        defaultGrainSize,
+		descriptorOffset: 1,
+		descriptorSize:   descriptorSectors,
+		numGTEsPerGT:     gtesPerGT,
+	}
+	numGTs := h.numGTs()
+	gdSectors := (numGTs*4 + sectorSize - 1) / sectorSize
+	gtSectors := uint64(gtesPerGT * 4 / sectorSize)
+
+	// layout: header, descriptor, redundant grain directory and its grain tables, then the same for
+	// the grain directory, and grains after that
+	h.rgdOffset = h.descriptorOffset + h.descriptorSize
+	h.gdOffset = h.rgdOffset + gdSectors + numGTs*gtSectors
+	metadataEnd := h.gdOffset + gdSectors + numGTs*gtSectors
+	h.overHead = (metadataEnd + h.grainSize - 1) / h.grainSize * h.grainSize
+
+	desc := newDescriptor(newCID(), createTypeMonolithicSparse, h.capacity, extentName(f))
+	db := desc.toBytes()
+	if uint64(len(db)) > h.descriptorSize*sectorSize {
+		return nil, fmt.Errorf("descriptor of %d bytes does not fit in %d sectors", len(db), h.descriptorSize)
+	}
+
+	// the grain tables start out as zeroes, and take up most of the metadata, so they are not built in memory
+	if err := zeroFill(f, 0, int64(h.overHead*sectorSize)); err != nil {
+		return nil, fmt.Errorf("error writing VMDK grain tables: %v", err)
+	}
+	if err := writeFull(f, h.toBytes(), 0); err != nil {
+		return nil, fmt.Errorf("error writing VMDK header: %v", err)
+	}
+	if err := writeFull(f, db, int64(h.descriptorOffset*sectorSize)); err != nil {
+		return nil, fmt.Errorf("error writing VMDK descriptor: %v", err)
+	}
+	gd := make([]byte, numGTs*4)
+	for _, gdOffset := range []uint64{h.rgdOffset, h.gdOffset} {
+		gtOffset := gdOffset + gdSectors
+		for i := uint64(0); i < numGTs; i++ {
+			binary.LittleEndian.PutUint32(gd[i*4:], uint32(gtOffset+i*gtSectors))
+		}
+		if err := writeFull(f, gd, int64(gdOffset*sectorSize)); err != nil {
+			return nil, fmt.Errorf("error writing VMDK grain directory: %v", err)
+		}
+	}
+	return Open(f)
+}
+
+// zeroChunkSize is the most zeroes zeroFill writes at once
+const zeroChunkSize = 1024 * 1024
+
+// zeroFill makes the bytes from start to end of an empty f read as zeroes. If f can be truncated, it is
+// extended, which leaves a sparse hole on most filesystems; otherwise zeroes are written in chunks.
+func zeroFill(f util.File, start, end int64) error {
+	if truncater, ok := f.(interface{ Truncate(int64) error }); ok {
+		return truncater.Truncate(end)
+	}
+	b := make([]byte, zeroChunkSize)
+	for off := start; off < end; off += int64(len(b)) {
+		if end-off < int64(len(b)) {
+			b = b[:end-off]
+		}
+		if err := writeFull(f, b, off); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Open opens an existing monolithicSparse or streamOptimized VMDK image stored in f.
+// streamOptimized images can only be read.
+func Open(f util.File) (*Image, error) {
+	b := make([]byte, headerSize)
+	if err := readFull(f, b, 0); err != nil {
+		return nil, fmt.Errorf("error reading VMDK header: %v", err)
+	}
+	h, err := headerFromBytes(b)
+	if err != nil {
+		return nil, fmt.Errorf("error reading VMDK header: %v", err)
+	}
+	end, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find end of VMDK image: %v", err)
+	}
+	// the header of a streamOptimized image does not know where the grain directory is, the footer does
+	if h.gdOffset == gdAtEnd {
+		if end < 3*sectorSize {
+			return nil, errors.New("VMDK image is too small to have a footer")
+		}
+		if err := readFull(f, b, end-2*sectorSize); err != nil {
+			return nil, fmt.Errorf("error reading VMDK footer: %v", err)
+		}
+		if h, err = headerFromBytes(b); err != nil {
+			return nil, fmt.Errorf("error reading VMDK footer: %v", err)
+		}
+		if h.gdOffset == gdAtEnd {
+			return nil, errors.New("VMDK footer does not have the grain directory offset")
+		}
+	}
+	if h.descriptorOffset == 0 {
+		return nil, errors.New("VMDK image without an embedded descriptor is an extent of a multi-file disk, which is not supported")
+	}
+
+	db := make([]byte, h.descriptorSize*sectorSize)
+	if err := readFull(f, db, int64(h.descriptorOffset*sectorSize)); err != nil {
+		return nil, fmt.Errorf("error reading VMDK descriptor: %v", err)
+	}
+	desc, err := descriptorFromBytes(db)
+	if err != nil {
+		return nil, err
+	}
+	switch desc.createType {
+	case createTypeMonolithicSparse, createTypeStreamOptimized:
+	default:
+		return nil, fmt.Errorf("unsupported VMDK create type %q", desc.createType)
+	}
+	if len(desc.extents) != 1 || desc.extents[0].extentType != "SPARSE" {
+		return nil, errors.New("VMDK descriptor must have exactly one sparse extent")
+	}
+
+	img := &Image{
+		file:       f,
+		header:     h,
+		descriptor: desc,
+		grainSize:  int64(h.grainSize) * sectorSize,
+		end:        (end + sectorSize - 1) / sectorSize * sectorSize,
+	}
+	if img.gd, err = img.readGD(h.gdOffset); err != nil {
+		return nil, err
+	}
+	if h.flags&flagRedundantGT != 0 && h.rgdOffset != 0 {
+		if img.rgd, err = img.readGD(h.rgdOffset); err != nil {
+			return nil, err
+		}
+	}
+	return img, nil
+}
+
+func (i *Image) readGD(offset uint64) ([]uint32, error) {
+	b := make([]byte, i.header.numGTs()*4)
+	if err := readFull(i.file, b, int64(offset*sectorSize)); err != nil {
+		return nil, fmt.Errorf("error reading grain directory: %v", err)
+	}
+	gd := make([]uint32, len(b)/4)
+	for j := range gd {
+		gd[j] = binary.LittleEndian.Uint32(b[j*4:])
+	}
+	return gd, nil
+}
+
+// newCID returns a random content ID for a descriptor
+func newCID() uint32 {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return binary.LittleEndian.Uint32(b)
+}
+
+// extentName returns the file name to use in the extent line of the descriptor
+func extentName(f interface{}) string {
+	if named, ok := f.(interface{ Name() string }); ok {
+		return filepath.Base(named.Name())
+	}
+	return "disk.vmdk"
+}
+
+// Size returns the virtual size of the image in bytes
+func (i *Image) Size() int64 {
+	return int64(i.header.capacity) * sectorSize
+}
+
+// StreamOptimized reports whether the image is a read-only streamOptimized image
+func (i *Image) StreamOptimized() bool {
+	return i.header.flags&flagCompressed != 0
+}
+
+// ReadAt reads len(b) bytes from the virtual disk starting at byte offset off
+func (i *Image) ReadAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("invalid negative offset %d", off)
+	}
+	size := i.Size()
+	total := 0
+	for total < len(b) && off < size {
+		count := i.chunk(off, len(b)-total)
+		if err := i.readGrain(b[total:total+int(count)], off); err != nil {
+			return total, err
+		}
+		total += int(count)
+		off += count
+	}
+	if total < len(b) {
+		return total, io.EOF
+	}
+	return total, nil
+}
+
+// WriteAt writes len(b) bytes to the virtual disk starting at byte offset off, allocating grains as needed
+func (i *Image) WriteAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("invalid negative offset %d", off)
+	}
+	if i.StreamOptimized() {
+		return 0, errors.New("streamOptimized VMDK images are read-only")
+	}
+	size := i.Size()
+	total := 0
+	for total < len(b) {
+		if off >= size {
+			return total, fmt.Errorf("cannot write beyond end of VMDK image of size %d", size)
+		}
+		count := i.chunk(off, len(b)-total)
+		host, err := i.grainForWrite(off)
+		if err != nil {
+			return total, err
+		}
+		if err := writeFull(i.file, b[total:total+int(count)], host+off%i.grainSize); err != nil {
+			return total, fmt.Errorf("error writing VMDK data: %v", err)
+		}
+		total += int(count)
+		off += count
+	}
+	return total, nil
+}
+
+// Seek sets the offset for the next Read or Write. It exists to satisfy util.File.
+func (i *Image) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = i.pos + offset
+	case io.SeekEnd:
+		pos = i.Size() + offset
+	default:
+		return i.pos, fmt.Errorf("invalid whence %d", whence)
+	}
+	if pos < 0 {
+		return i.pos, fmt.Errorf("cannot seek to negative offset %d", pos)
+	}
+	i.pos = pos
+	return pos, nil
+}
+
+// chunk returns how many of the remaining bytes at virtual offset off can be handled at once,
+// without crossing a grain boundary or the end of the disk
+func (i *Image) chunk(off int64, remaining int) int64 {
+	count := i.Size() - off
+	if int64(remaining) < count {
+		count = int64(remaining)
+	}
+	if inGrain := i.grainSize - off%i.grainSize; inGrain < count {
+		count = inGrain
+	}
+	return count
+}
+
+// gteLocation returns the offset in the host file of the grain table entry for virtual offset off in
+// the given grain directory, or 0 if the grain table is not allocated
+func (i *Image) gteLocation(gd []uint32, off int64) int64 {
+	grain := uint64(off / i.grainSize)
+	gt := gd[grain/gtesPerGT]
+	if gt == 0 {
+		return 0
+	}
+	return int64(gt)*sectorSize + int64(grain%gtesPerGT)*4
+}
+
+func (i *Image) readGrain(b []byte, off int64) error {
+	loc := i.gteLocation(i.gd, off)
+	if loc == 0 {
+		zero(b)
+		return nil
+	}
+	entry, err := i.readUint32(loc)
+	if err != nil {
+		return err
+	}
+	inGrain := off % i.grainSize
+	switch {
+	case entry == 0 || entry == gteZero:
+		zero(b)
+	case i.header.flags&flagCompressed != 0:
+		data, err := i.decompressGrain(entry)
+		if err != nil {
+			return err
+		}
+		copy(b, data[inGrain:])
+	default:
+		if err := readFull(i.file, b, int64(entry)*sectorSize+inGrain); err != nil {
+			return fmt.Errorf("error reading grain: %v", err)
+		}
+	}
+	return nil
+}
+
+// decompressGrain reads the compressed grain whose grain marker is at the given sector
+func (i *Image) decompressGrain(entry uint32) ([]byte, error) {
+	if i.compressedData != nil && i.compressedEntry == entry {
+		return i.compressedData, nil
+	}
+	offset := int64(entry) * sectorSize
+	marker := make([]byte, 12)
+	if err := readFull(i.file, marker, offset); err != nil {
+		return nil, fmt.Errorf("error reading grain marker: %v", err)
+	}
+	length := binary.LittleEndian.Uint32(marker[8:12])
+	compressed := make([]byte, length)
+	if err := readFull(i.file, compressed, offset+12); err != nil {
+		return nil, fmt.Errorf("error reading compressed grain: %v", err)
+	}
+	r, err := zlib.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing grain: %v", err)
+	}
+	data := make([]byte, i.grainSize)
+	// the last grain of the disk may be short
+	if _, err := io.ReadFull(r, data); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, fmt.Errorf("error decompressing grain: %v", err)
+	}
+	i.compressedEntry, i.compressedData = entry, data
+	return data, nil
+}
+
+// grainForWrite returns the host offset of the grain holding virtual offset off, allocating it if needed
+func (i *Image) grainForWrite(off int64) (int64, error) {
+	loc := i.gteLocation(i.gd, off)
+	if loc == 0 {
+		return 0, fmt.Errorf("grain table for offset %d is not allocated", off)
+	}
+	entry, err := i.readUint32(loc)
+	if err != nil {
+		return 0, err
+	}
+	if entry != 0 && entry != gteZero {
+		return int64(entry) * sectorSize, nil
+	}
+
+	host := i.end
+	if err := writeFull(i.file, make([]byte, i.grainSize), host); err != nil {
+		return 0, fmt.Errorf("error allocating grain: %v", err)
+	}
+	i.end += i.grainSize
+	entry = uint32(host / sectorSize)
+	if i.rgd != nil {
+		if rloc := i.gteLocation(i.rgd, off); rloc != 0 {
+			if err := i.writeUint32(rloc, entry); err != nil {
+				return 0, fmt.Errorf("error updating redundant grain table: %v", err)
+			}
+		}
+	}
+	if err := i.writeUint32(loc, entry); err != nil {
+		return 0, fmt.Errorf("error updating grain table: %v", err)
+	}
+	return host, nil
+}
+
+func (i *Image) readUint32(off int64) (uint32, error) {
+	b := make([]byte, 4)
+	if err := readFull(i.file, b, off); err != nil {
+		return 0, fmt.Errorf("error reading grain table entry at %d: %v", off, err)
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+func (i *Image) writeUint32(off int64, v uint32) error {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	return writeFull(i.file, b, off)
+}
+
+func readFull(f util.File, b []byte, off int64) error {
+	n, err := f.ReadAt(b, off)
+	if n == len(b) {
+		return nil
+	}
+	if err == nil {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func writeFull(f util.File, b []byte, off int64) error {
+	n, err := f.WriteAt(b, off)
+	if err != nil {
+		return err
+	}
+	if n != len(b) {
+		return fmt.Errorf("wrote %d bytes instead of %d", n, len(b))
+	}
+	return nil
+}
+
+func zero(b []byte) {
+	for j := range b {
+		b[j] = 0
+	}
+}
@@ -0,0 +1,213 @@
+package vmdk_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/diskfs/go-diskfs/image/vmdk"
+	"github.com/diskfs/go-diskfs/util"
+)
+
+const (
+	oneMB = 1024 * 1024
+)
+
+func TestCreateWriteRead(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "disk.vmdk"))
+	if err != nil {
+		t.Fatalf("unable to create image file: %v", err)
+	}
+	defer f.Close()
+
+	size := int64(100 * oneMB)
+	img, err := vmdk.Create(f, size)
+	if err != nil {
+		t.Fatalf("unexpected error creating image: %v", err)
+	}
+	if img.Size() != size {
+		t.Errorf("mismatched size, actual %d expected %d", img.Size(), size)
+	}
+	if img.StreamOptimized() {
+		t.Errorf("new image is streamOptimized")
+	}
+	if !vmdk.IsVMDK(f) {
+		t.Errorf("created image not detected as VMDK")
+	}
+
+	b := make([]byte, 4096)
+	if _, err := img.ReadAt(b, 10*oneMB); err != nil {
+		t.Fatalf("unexpected error reading unallocated grain: %v", err)
+	}
+	if !bytes.Equal(b, make([]byte, len(b))) {
+		t.Errorf("unallocated grain did not read as zeroes")
+	}
+
+	// write data crossing a grain boundary, and at the end of the disk
+	writes := map[int64][]byte{
+		0:           make([]byte, 512),
+		65536 - 100: make([]byte, 300),
+		size - 1000: make([]byte, 1000),
+	}
+	for off, data := range writes {
+		_, _ = rand.Read(data)
+		if _, err := img.WriteAt(data, off); err != nil {
+			t.Fatalf("unexpected error writing at %d: %v", off, err)
+		}
+	}
+	if _, err := img.WriteAt([]byte{1, 2}, size); err == nil {
+		t.Errorf("writing beyond the end of the image did not return an error")
+	}
+
+	reopened, err := vmdk.Open(f)
+	if err != nil {
+		t.Fatalf("unexpected error reopening image: %v", err)
+	}
+	for off, data := range writes {
+		read := make([]byte, len(data))
+		if _, err := reopened.ReadAt(read, off); err != nil {
+			t.Fatalf("unexpected error reading at %d: %v", off, err)
+		}
+		if !bytes.Equal(read, data) {
+			t.Errorf("mismatched data at offset %d", off)
+		}
+	}
+	read := make([]byte, 512)
+	if _, err := reopened.ReadAt(read, 512); err != nil {
+		t.Fatalf("unexpected error reading: %v", err)
+	}
+	if !bytes.Equal(read, make([]byte, len(read))) {
+		t.Errorf("partially written grain was not zero outside of the written data")
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatalf("unable to stat image: %v", err)
+	}
+	if info.Size() >= size {
+		t.Errorf("image file is %d bytes, not smaller than its virtual size %d", info.Size(), size)
+	}
+}
+
+// noTruncateFile hides the Truncate method of an *os.File, so that Create has to write its metadata out
+type noTruncateFile struct {
+	util.File
+}
+
+func TestCreateMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int64
+		truncate bool
+	}{
+		// the grain tables of a 2 TB disk take 256 MB, which is left as a sparse hole
+		{"large sparse", 2 * 1024 * 1024 * oneMB, true},
+		{"written out", 100 * oneMB, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := os.Create(filepath.Join(t.TempDir(), "disk.vmdk"))
+			if err != nil {
+				t.Fatalf("unable to create image file: %v", err)
+			}
+			defer f.Close()
+			var file util.File = f
+			if !tt.truncate {
+				file = noTruncateFile{f}
+			}
+			img, err := vmdk.Create(file, tt.size)
+			if err != nil {
+				t.Fatalf("unexpected error creating image: %v", err)
+			}
+			if img.Size() != tt.size {
+				t.Errorf("mismatched size, actual %d expected %d", img.Size(), tt.size)
+			}
+			data := []byte("written at the end")
+			off := tt.size - int64(len(data))
+			if _, err := img.WriteAt(data, off); err != nil {
+				t.Fatalf("unexpected error writing: %v", err)
+			}
+			reopened, err := vmdk.Open(f)
+			if err != nil {
+				t.Fatalf("unexpected error opening image: %v", err)
+			}
+			read := make([]byte, 2*len(data))
+			if _, err := reopened.ReadAt(read, off-int64(len(data))); err != nil {
+				t.Fatalf("unexpected error reading: %v", err)
+			}
+			if !bytes.Equal(read, append(make([]byte, len(data)), data...)) {
+				t.Errorf("mismatched data at the end of the disk %q", read)
+			}
+		})
+	}
+}
+
+func TestExportStreamOptimized(t *testing.T) {
+	// a source that is not a multiple of the grain size, with data in a few places
+	size := int64(40*oneMB + 1000)
+	src := make([]byte, size)
+	for _, off := range []int64{0, 5 * oneMB, 33*oneMB - 10, size - 500} {
+		_, _ = rand.Read(src[off : off+300])
+	}
+	copy(src[20*oneMB:], bytes.Repeat([]byte("compressible"), 10000))
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "disk-stream.vmdk"))
+	if err != nil {
+		t.Fatalf("unable to create image file: %v", err)
+	}
+	defer f.Close()
+	if err := vmdk.ExportStreamOptimized(f, bytes.NewReader(src), size); err != nil {
+		t.Fatalf("unexpected error exporting: %v", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatalf("unable to stat image: %v", err)
+	}
+	if info.Size() > 2*oneMB {
+		t.Errorf("streamOptimized image is %d bytes, zero grains were not skipped", info.Size())
+	}
+
+	img, err := vmdk.Open(f)
+	if err != nil {
+		t.Fatalf("unexpected error opening streamOptimized image: %v", err)
+	}
+	if !img.StreamOptimized() {
+		t.Errorf("image is not streamOptimized")
+	}
+	expectedSize := (size + 511) / 512 * 512
+	if img.Size() != expectedSize {
+		t.Errorf("mismatched size, actual %d expected %d", img.Size(), expectedSize)
+	}
+	read := make([]byte, expectedSize)
+	if _, err := img.ReadAt(read, 0); err != nil {
+		t.Fatalf("unexpected error reading: %v", err)
+	}
+	if !bytes.Equal(read[:size], src) {
+		t.Errorf("streamOptimized image contents do not match the source")
+	}
+	if !bytes.Equal(read[size:], make([]byte, expectedSize-size)) {
+		t.Errorf("padding at the end of the streamOptimized image is not zero")
+	}
+	if _, err := img.WriteAt([]byte{1}, 0); err == nil {
+		t.Errorf("writing to a streamOptimized image did not return an error")
+	}
+}
+
+func TestOpenInvalid(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "raw")
+	if err != nil {
+		t.Fatalf("unable to create file: %v", err)
+	}
+	defer f.Close()
+	if err := f.Truncate(oneMB); err != nil {
+		t.Fatalf("unable to size file: %v", err)
+	}
+	if vmdk.IsVMDK(f) {
+		t.Errorf("raw file detected as VMDK")
+	}
+	if _, err := vmdk.Open(f); err == nil {
+		t.Errorf("opening raw file as VMDK did not return an error")
+	}
+}
@@ -0,0 +1,21 @@
+// Package apm provides an interface to Apple Partition Map (APM) partitioned disks, as used by classic
+// Mac OS, PowerPC Macs, and boot media for older Intel Macs.
+//
+// You can use this package to manipulate existing APM disks, read existing disks, or create entirely
+// new partition maps on disks or disk files.
+//
+// apm.Table implements the Table interface in github.com/diskfs/go-diskfs/partition
+//
+// The partition map describes itself in one of its entries, normally the first one, which must start at
+// block 1 and have room for all of the entries. Here is a simple example of a map with a single HFS+
+// partition on a 10MB disk:
+//
+//	table := &apm.Table{
+//	  BlockSize: 512,
+//	  Partitions: []*apm.Partition{
+//	    {Start: 1, Size: 63, Name: "Apple", Type: apm.PartitionMap, Status: apm.StatusValid | apm.StatusAllocated},
+//	    {Start: 64, Size: 20416, Name: "Macintosh HD", Type: apm.HFS, Status: apm.StatusValid | apm.StatusAllocated |
+//	      apm.StatusReadable | apm.StatusWritable},
+//	  },
+//	}
+package apm
@@ -0,0 +1,198 @@
+package apm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/diskfs/go-diskfs/util"
+)
+
+const (
+	partitionSignature = "PM"
+	nameSize           = 32
+	processorSize      = 16
+)
+
+// Partition represents a single entry in an Apple Partition Map. Start and Size are in blocks of the
+// BlockSize of the Table.
+type Partition struct {
+	Start        uint32 // first block of the partition
+	Size         uint32 // number of blocks in the partition
+	Name         string // name of the partition, at most 32 bytes
+	Type         Type   // type of the partition, at most 32 bytes
+	DataStart    uint32 // first block of the data area, relative to the start of the partition
+	DataSize     uint32 // number of blocks in the data area, 0 for all of the partition after DataStart
+	Status       uint32 // Status flags, e.g. StatusValid|StatusAllocated
+	BootStart    uint32 // first block of the boot code, relative to the start of the partition
+	BootSize     uint32 // size of the boot code in bytes
+	BootAddress  uint32 // address in memory to load the boot code to
+	BootEntry    uint32 // address in memory to jump to in the boot code
+	BootChecksum uint32 // checksum of the boot code
+	Processor    string // processor type of the boot code, e.g. "powerpc", at most 16 bytes
+	blockSize    int
+}
+
+// Equal compares if another partition is equal to this one
+func (p *Partition) Equal(p2 *Partition) bool {
+	if p2 == nil {
+		return false
+	}
+	return p.Start == p2.Start &&
+		p.Size == p2.Size &&
+		p.Name == p2.Name &&
+		p.Type == p2.Type &&
+		p.DataStart == p2.DataStart &&
+		p.dataSize() == p2.dataSize() &&
+		p.Status == p2.Status &&
+		p.BootStart == p2.BootStart &&
+		p.BootSize == p2.BootSize &&
+		p.BootAddress == p2.BootAddress &&
+		p.BootEntry == p2.BootEntry &&
+		p.BootChecksum == p2.BootChecksum &&
+		p.Processor == p2.Processor
+}
+
+// GetSize the size of the partition in bytes
+func (p *Partition) GetSize() int64 {
+	return int64(p.Size) * int64(p.getBlockSize())
+}
+
+// GetStart the start of the partition in bytes
+func (p *Partition) GetStart() int64 {
+	return int64(p.Start) * int64(p.getBlockSize())
+}
+
+// dataSize the size of the data area, all of the partition after DataStart if not set
+func (p *Partition) dataSize() uint32 {
+	if p.DataSize == 0 && p.Size > p.DataStart {
+		return p.Size - p.DataStart
+	}
+	return p.DataSize
+}
+
+func (p *Partition) getBlockSize() int {
+	if p.blockSize == 0 {
+		return defaultBlockSize
+	}
+	return p.blockSize
+}
+
+// toBytes the bytes of the partition map entry, for a map with count entries, in a block of blockSize bytes
+func (p *Partition) toBytes(count uint32, blockSize int) ([]byte, error) {
+	if len(p.Name) > nameSize {
+		return nil, fmt.Errorf("name %q is longer than %d bytes", p.Name, nameSize)
+	}
+	if len(p.Type) > nameSize {
+		return nil, fmt.Errorf("type %q is longer than %d bytes", p.Type, nameSize)
+	}
+	if len(p.Processor) > processorSize {
+		return nil, fmt.Errorf("processor %q is longer than %d bytes", p.Processor, processorSize)
+	}
+	b := make([]byte, blockSize)
+	copy(b[0:2], partitionSignature)
+	binary.BigEndian.PutUint32(b[4:8], count)
+	binary.BigEndian.PutUint32(b[8:12], p.Start)
+	binary.BigEndian.PutUint32(b[12:16], p.Size)
+	copy(b[16:48], p.Name)
+	copy(b[48:80], p.Type)
+	binary.BigEndian.PutUint32(b[80:84], p.DataStart)
+	binary.BigEndian.PutUint32(b[84:88], p.dataSize())
+	binary.BigEndian.PutUint32(b[88:92], p.Status)
+	binary.BigEndian.PutUint32(b[92:96], p.BootStart)
+	binary.BigEndian.PutUint32(b[96:100], p.BootSize)
+	binary.BigEndian.PutUint32(b[100:104], p.BootAddress)
+	binary.BigEndian.PutUint32(b[108:112], p.BootEntry)
+	binary.BigEndian.PutUint32(b[116:120], p.BootChecksum)
+	copy(b[120:136], p.Processor)
+	return b, nil
+}
+
+// partitionFromBytes create a partition from a partition map entry, returning also the number of
+// entries in the map
+func partitionFromBytes(b []byte, blockSize int) (*Partition, uint32, error) {
+	if len(b) < 136 {
+		return nil, 0, fmt.Errorf("data for partition was %d bytes instead of expected minimum %d", len(b), 136)
+	}
+	if string(b[0:2]) != partitionSignature {
+		return nil, 0, fmt.Errorf("invalid partition map entry signature %v", b[0:2])
+	}
+	return &Partition{
+		Start:        binary.BigEndian.Uint32(b[8:12]),
+		Size:         binary.BigEndian.Uint32(b[12:16]),
+		Name:         cString(b[16:48]),
+		Type:         Type(cString(b[48:80])),
+		DataStart:    binary.BigEndian.Uint32(b[80:84]),
+		DataSize:     binary.BigEndian.Uint32(b[84:88]),
+		Status:       binary.BigEndian.Uint32(b[88:92]),
+		BootStart:    binary.BigEndian.Uint32(b[92:96]),
+		BootSize:     binary.BigEndian.Uint32(b[96:100]),
+		BootAddress:  binary.BigEndian.Uint32(b[100:104]),
+		BootEntry:    binary.BigEndian.Uint32(b[108:112]),
+		BootChecksum: binary.BigEndian.Uint32(b[116:120]),
+		Processor:    cString(b[120:136]),
+		blockSize:    blockSize,
+	}, binary.BigEndian.Uint32(b[4:8]), nil
+}
+
+// cString a string from a NUL-terminated, or NUL-padded, byte slice
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// WriteContents fills the partition with the contents provided
+// reads from beginning of reader to exactly size of partition in bytes
+func (p *Partition) WriteContents(f util.File, contents io.Reader) (uint64, error) {
+	start, size := p.GetStart(), uint64(p.GetSize())
+	total := uint64(0)
+	b := make([]byte, p.getBlockSize())
+	for {
+		read, err := contents.Read(b)
+		if err != nil && err != io.EOF {
+			return total, fmt.Errorf("could not read contents to pass to partition: %v", err)
+		}
+		if total+uint64(read) > size {
+			return total, fmt.Errorf("requested to write at least %d bytes to partition but maximum size is %d", total+uint64(read), size)
+		}
+		if read > 0 {
+			written, err := f.WriteAt(b[:read], start+int64(total))
+			if err != nil {
+				return total, fmt.Errorf("error writing to file: %v", err)
+			}
+			total += uint64(written)
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if total != size {
+		return total, fmt.Errorf("write %d bytes to partition but actual size is %d", total, size)
+	}
+	return total, nil
+}
+
+// ReadContents reads the contents of the partition into a writer
+// streams the entire partition to the writer
+func (p *Partition) ReadContents(f util.File, out io.Writer) (int64, error) {
+	start, size := p.GetStart(), p.GetSize()
+	total := int64(0)
+	b := make([]byte, p.getBlockSize())
+	for total < size {
+		read, err := f.ReadAt(b, start+total)
+		if err != nil && err != io.EOF {
+			return total, fmt.Errorf("error reading from file: %v", err)
+		}
+		if read > 0 {
+			_, _ = out.Write(b[:read])
+		}
+		total += int64(read)
+		if err == io.EOF {
+			break
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,242 @@
+package apm
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/diskfs/go-diskfs/partition/part"
+	"github.com/diskfs/go-diskfs/util"
+)
+
+const (
+	defaultBlockSize  = 512
+	ddrSignature      = "ER"
+	ddrHeaderSize     = 18
+	driverEntrySize   = 8
+	maxMapEntries     = 1024
+	maxDriverEntries  = (defaultBlockSize - ddrHeaderSize) / driverEntrySize
+	maxBlockSizeShift = 15
+)
+
+// Table represents an Apple Partition Map (APM) to be applied to a disk or read from a disk, along with
+// the driver descriptor record in the first block of the disk.
+//
+// The Partitions are all of the entries of the map, in order, including the entry for the partition map
+// itself, of type PartitionMap. That entry must start at block 1, right after the driver descriptor record,
+// and be large enough to hold all of the entries.
+//
+// Only the driver descriptor record itself is written to the first block, leaving the rest of it, e.g. an
+// MBR partition table for a hybrid disk, in place.
+type Table struct {
+	Partitions []*Partition
+	BlockSize  int                // size of a block, to which Start and Size of partitions refer, normally 512, or 2048 for a CD
+	DeviceType uint16             // device type from the driver descriptor record, normally 0
+	DeviceID   uint16             // device id from the driver descriptor record, normally 0
+	Drivers    []DriverDescriptor // device drivers for classic Mac OS
+}
+
+// DriverDescriptor describes a device driver for classic Mac OS, in the driver descriptor record
+type DriverDescriptor struct {
+	Block uint32 // first block of the driver
+	Size  uint16 // size of the driver in blocks of 512 bytes
+	Type  uint16 // operating system or processor the driver is for
+}
+
+// Type report the type of table, always the string "apm"
+func (t *Table) Type() string {
+	return "apm"
+}
+
+// ensure that a blank table is initialized
+func (t *Table) initTable() {
+	if t.BlockSize == 0 {
+		t.BlockSize = defaultBlockSize
+	}
+}
+
+// Equal check if another table is equal to this one
+func (t *Table) Equal(t2 *Table) bool {
+	if t2 == nil || t.BlockSize != t2.BlockSize || t.DeviceType != t2.DeviceType || t.DeviceID != t2.DeviceID ||
+		len(t.Drivers) != len(t2.Drivers) || len(t.Partitions) != len(t2.Partitions) {
+		return false
+	}
+	for i, d := range t.Drivers {
+		if d != t2.Drivers[i] {
+			return false
+		}
+	}
+	for i, p := range t.Partitions {
+		if p == nil || !p.Equal(t2.Partitions[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// validBlockSize check that a block size is a power of 2 of at least 512 bytes
+func validBlockSize(blockSize int) bool {
+	return blockSize >= defaultBlockSize && blockSize <= 1<<maxBlockSizeShift && blockSize&(blockSize-1) == 0
+}
+
+// ddrBytes the bytes of the driver descriptor record, without the padding up to the end of the block
+func (t *Table) ddrBytes(blocks uint32) []byte {
+	b := make([]byte, ddrHeaderSize+driverEntrySize*len(t.Drivers))
+	copy(b[0:2], ddrSignature)
+	binary.BigEndian.PutUint16(b[2:4], uint16(t.BlockSize))
+	binary.BigEndian.PutUint32(b[4:8], blocks)
+	binary.BigEndian.PutUint16(b[8:10], t.DeviceType)
+	binary.BigEndian.PutUint16(b[10:12], t.DeviceID)
+	binary.BigEndian.PutUint16(b[16:18], uint16(len(t.Drivers)))
+	for i, d := range t.Drivers {
+		entry := b[ddrHeaderSize+i*driverEntrySize:]
+		binary.BigEndian.PutUint32(entry[0:4], d.Block)
+		binary.BigEndian.PutUint16(entry[4:6], d.Size)
+		binary.BigEndian.PutUint16(entry[6:8], d.Type)
+	}
+	return b
+}
+
+// validate check that the table can be written to a disk with the given number of blocks
+func (t *Table) validate(blocks uint32) error {
+	if !validBlockSize(t.BlockSize) {
+		return fmt.Errorf("invalid block size %d, must be a power of 2 of at least %d", t.BlockSize, defaultBlockSize)
+	}
+	if len(t.Drivers) > maxDriverEntries {
+		return fmt.Errorf("%d drivers, more than the maximum %d", len(t.Drivers), maxDriverEntries)
+	}
+	var mapEntry *Partition
+	for i, p := range t.Partitions {
+		if p == nil {
+			return fmt.Errorf("partition %d is nil", i+1)
+		}
+		if uint64(p.Start)+uint64(p.Size) > uint64(blocks) {
+			return fmt.Errorf("partition %d ends at block %d, beyond the end of the disk at block %d", i+1, uint64(p.Start)+uint64(p.Size)-1, blocks-1)
+		}
+		if p.Type == PartitionMap && mapEntry == nil {
+			mapEntry = p
+		}
+	}
+	switch {
+	case mapEntry == nil:
+		return fmt.Errorf("no partition of type %s for the partition map itself", PartitionMap)
+	case mapEntry.Start != 1:
+		return fmt.Errorf("partition map starts at block %d instead of 1", mapEntry.Start)
+	case int(mapEntry.Size) < len(t.Partitions):
+		return fmt.Errorf("partition map of %d blocks is too small for %d entries", mapEntry.Size, len(t.Partitions))
+	}
+	return nil
+}
+
+// Write writes the driver descriptor record and the partition map to disk.
+// Must be passed the util.File to write to and the size of the disk
+func (t *Table) Write(f util.File, size int64) error {
+	t.initTable()
+	if size <= 0 || size/int64(t.BlockSize) > 1<<32-1 {
+		return fmt.Errorf("invalid disk size %d for a partition map with blocks of %d bytes", size, t.BlockSize)
+	}
+	blocks := uint32(size / int64(t.BlockSize))
+	if err := t.validate(blocks); err != nil {
+		return fmt.Errorf("invalid partition map: %v", err)
+	}
+	entries := make([][]byte, 0, len(t.Partitions))
+	for i, p := range t.Partitions {
+		b, err := p.toBytes(uint32(len(t.Partitions)), t.BlockSize)
+		if err != nil {
+			return fmt.Errorf("invalid partition %d: %v", i+1, err)
+		}
+		entries = append(entries, b)
+	}
+
+	ddr := t.ddrBytes(blocks)
+	written, err := f.WriteAt(ddr, 0)
+	if err != nil {
+		return fmt.Errorf("error writing driver descriptor record to disk: %v", err)
+	}
+	if written != len(ddr) {
+		return fmt.Errorf("driver descriptor record wrote %d bytes to disk instead of the expected %d", written, len(ddr))
+	}
+	for i, b := range entries {
+		written, err := f.WriteAt(b, int64(i+1)*int64(t.BlockSize))
+		if err != nil {
+			return fmt.Errorf("error writing partition map entry %d to disk: %v", i+1, err)
+		}
+		if written != len(b) {
+			return fmt.Errorf("partition map entry %d wrote %d bytes to disk instead of the expected %d", i+1, written, len(b))
+		}
+	}
+	for _, p := range t.Partitions {
+		p.blockSize = t.BlockSize
+	}
+	return nil
+}
+
+// Read read an Apple Partition Map from a disk. The block size comes from the driver descriptor record,
+// so logicalBlockSize and physicalBlockSize are ignored; they exist to match the other partition tables.
+func Read(f util.File, logicalBlockSize, physicalBlockSize int) (*Table, error) {
+	b := make([]byte, defaultBlockSize)
+	read, err := f.ReadAt(b, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error reading driver descriptor record from file: %v", err)
+	}
+	if read != len(b) {
+		return nil, fmt.Errorf("read only %d bytes of driver descriptor record from file instead of expected %d", read, len(b))
+	}
+	if string(b[0:2]) != ddrSignature {
+		return nil, fmt.Errorf("invalid driver descriptor record signature %v", b[0:2])
+	}
+	table := &Table{
+		BlockSize:  int(binary.BigEndian.Uint16(b[2:4])),
+		DeviceType: binary.BigEndian.Uint16(b[8:10]),
+		DeviceID:   binary.BigEndian.Uint16(b[10:12]),
+	}
+	if !validBlockSize(table.BlockSize) {
+		return nil, fmt.Errorf("invalid block size %d in driver descriptor record", table.BlockSize)
+	}
+	drivers := int(binary.BigEndian.Uint16(b[16:18]))
+	if drivers > maxDriverEntries {
+		return nil, fmt.Errorf("driver descriptor record has %d drivers, more than the maximum %d", drivers, maxDriverEntries)
+	}
+	for i := 0; i < drivers; i++ {
+		entry := b[ddrHeaderSize+i*driverEntrySize:]
+		table.Drivers = append(table.Drivers, DriverDescriptor{
+			Block: binary.BigEndian.Uint32(entry[0:4]),
+			Size:  binary.BigEndian.Uint16(entry[4:6]),
+			Type:  binary.BigEndian.Uint16(entry[6:8]),
+		})
+	}
+
+	// the first entry tells how many entries the map has
+	count := uint32(1)
+	entry := make([]byte, table.BlockSize)
+	for i := uint32(0); i < count; i++ {
+		read, err := f.ReadAt(entry, int64(i+1)*int64(table.BlockSize))
+		if err != nil {
+			return nil, fmt.Errorf("error reading partition map entry %d from file: %v", i+1, err)
+		}
+		if read != len(entry) {
+			return nil, fmt.Errorf("read only %d bytes of partition map entry %d instead of expected %d", read, i+1, len(entry))
+		}
+		p, n, err := partitionFromBytes(entry, table.BlockSize)
+		if err != nil {
+			return nil, fmt.Errorf("error reading partition map entry %d: %v", i+1, err)
+		}
+		if i == 0 {
+			if n == 0 || n > maxMapEntries {
+				return nil, fmt.Errorf("invalid number of partition map entries %d", n)
+			}
+			count = n
+		}
+		table.Partitions = append(table.Partitions, p)
+	}
+	return table, nil
+}
+
+// GetPartitions the partitions of the table, including the entry for the partition map itself
+func (t *Table) GetPartitions() []part.Partition {
+	// each Partition matches the part.Partition interface, but golang does not accept passing them in a slice
+	parts := make([]part.Partition, len(t.Partitions))
+	for i, p := range t.Partitions {
+		parts[i] = p
+	}
+	return parts
+}
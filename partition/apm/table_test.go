@@ -0,0 +1,169 @@
+package apm_test
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/diskfs/go-diskfs/partition/apm"
+	"github.com/diskfs/go-diskfs/testhelper"
+)
+
+const tenMB = 10 * 1024 * 1024
+
+func tmpDisk(size int64) (*os.File, error) {
+	f, err := os.CreateTemp("", "apm_test")
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Truncate(size); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func newTable() *apm.Table {
+	return &apm.Table{
+		BlockSize: 512,
+		Drivers: []apm.DriverDescriptor{
+			{Block: 64, Size: 32, Type: 0x0701},
+		},
+		Partitions: []*apm.Partition{
+			{Start: 1, Size: 63, Name: "Apple", Type: apm.PartitionMap, Status: apm.StatusValid | apm.StatusAllocated},
+			{Start: 64, Size: 32, Name: "Macintosh", Type: apm.Driver43, Status: 0x37f, BootSize: 16384, BootAddress: 0x8000, BootEntry: 0x8000, BootChecksum: 0x1234, Processor: "68000"},
+			{Start: 96, Size: 20000, Name: "Macintosh HD", Type: apm.HFS, Status: apm.StatusValid | apm.StatusAllocated | apm.StatusReadable | apm.StatusWritable},
+			{Start: 20096, Size: 384, Type: apm.Free},
+		},
+	}
+}
+
+func TestTableWriteRead(t *testing.T) {
+	f, err := tmpDisk(tenMB)
+	if err != nil {
+		t.Fatalf("error creating new temporary disk: %v", err)
+	}
+	defer f.Close()
+	defer os.Remove(f.Name())
+
+	// an MBR partition table in the first block is left in place
+	mbrEntries := bytes.Repeat([]byte{0x5a}, 66)
+	if _, err := f.WriteAt(mbrEntries, 446); err != nil {
+		t.Fatalf("error writing MBR: %v", err)
+	}
+
+	table := newTable()
+	if err := table.Write(f, tenMB); err != nil {
+		t.Fatalf("unexpected error writing table: %v", err)
+	}
+	b := make([]byte, 4*512)
+	if _, err := f.ReadAt(b, 0); err != nil {
+		t.Fatalf("error reading disk: %v", err)
+	}
+	if !bytes.Equal(b[0:8], []byte{'E', 'R', 0x02, 0x00, 0x00, 0x00, 0x50, 0x00}) {
+		t.Errorf("driver descriptor record starts with % x", b[0:8])
+	}
+	if !bytes.Equal(b[446:512], mbrEntries) {
+		t.Errorf("MBR partition table was overwritten")
+	}
+	// the second entry, for the HFS partition, with 4 entries in the map
+	if !bytes.Equal(b[1024:1040], []byte{'P', 'M', 0, 0, 0, 0, 0, 4, 0, 0, 0, 0x40, 0, 0, 0, 0x20}) {
+		t.Errorf("second partition map entry starts with % x", b[1024:1040])
+	}
+
+	read, err := apm.Read(f, 512, 512)
+	if err != nil {
+		t.Fatalf("unexpected error reading table: %v", err)
+	}
+	if !read.Equal(table) {
+		t.Errorf("actual table was %v instead of expected %v", read, table)
+	}
+	if read.Type() != "apm" {
+		t.Errorf("table type %s instead of apm", read.Type())
+	}
+	if start := read.GetPartitions()[2].GetStart(); start != 96*512 {
+		t.Errorf("partition 3 starts at %d instead of %d", start, 96*512)
+	}
+
+	contents := bytes.Repeat([]byte{0x12, 0x34}, 32*512/2)
+	p := read.Partitions[1]
+	if _, err := p.WriteContents(f, bytes.NewReader(contents)); err != nil {
+		t.Fatalf("unexpected error writing partition contents: %v", err)
+	}
+	var out bytes.Buffer
+	if _, err := p.ReadContents(f, &out); err != nil {
+		t.Fatalf("unexpected error reading partition contents: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), contents) {
+		t.Errorf("mismatched partition contents")
+	}
+}
+
+func TestTableWriteInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*apm.Table)
+		err    string
+	}{
+		{"block size", func(t *apm.Table) { t.BlockSize = 1000 }, "invalid block size"},
+		{"no partition map", func(t *apm.Table) { t.Partitions[0].Type = apm.Free }, "no partition of type Apple_partition_map"},
+		{"partition map start", func(t *apm.Table) { t.Partitions[0].Start = 2 }, "starts at block 2"},
+		{"partition map size", func(t *apm.Table) { t.Partitions[0].Size = 3 }, "too small for 4 entries"},
+		{"beyond disk", func(t *apm.Table) { t.Partitions[3].Size = 400 }, "partition 4 ends at block 20495"},
+		{"long name", func(t *apm.Table) { t.Partitions[2].Name = strings.Repeat("a", 33) }, "longer than 32 bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := newTable()
+			tt.modify(table)
+			f := &testhelper.FileImpl{
+				Writer: func(b []byte, offset int64) (int, error) {
+					t.Fatalf("wrote to disk at %d despite invalid table", offset)
+					return 0, nil
+				},
+			}
+			err := table.Write(f, tenMB)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("returned error %v instead of expected %s", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(b []byte)
+		err     string
+	}{
+		{"no driver descriptor record", func(b []byte) { b[0] = 0 }, "invalid driver descriptor record signature"},
+		{"block size", func(b []byte) { b[2] = 0x03 }, "invalid block size 768"},
+		{"entry signature", func(b []byte) { b[3*512] = 'X' }, "error reading partition map entry 3"},
+		{"entry count", func(b []byte) { b[512+4] = 0x10 }, "invalid number of partition map entries"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := tmpDisk(tenMB)
+			if err != nil {
+				t.Fatalf("error creating new temporary disk: %v", err)
+			}
+			defer f.Close()
+			defer os.Remove(f.Name())
+			if err := newTable().Write(f, tenMB); err != nil {
+				t.Fatalf("unexpected error writing table: %v", err)
+			}
+			b := make([]byte, 5*512)
+			if _, err := f.ReadAt(b, 0); err != nil {
+				t.Fatalf("error reading disk: %v", err)
+			}
+			tt.corrupt(b)
+			if _, err := f.WriteAt(b, 0); err != nil {
+				t.Fatalf("error writing disk: %v", err)
+			}
+			_, err = apm.Read(f, 512, 512)
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+				t.Errorf("returned error %v instead of expected %s", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package apm
+
+// Type the type of an Apple Partition Map partition, a string of at most 32 characters
+type Type string
+
+// List of common partition types
+const (
+	PartitionMap Type = "Apple_partition_map"
+	Driver       Type = "Apple_Driver"
+	Driver43     Type = "Apple_Driver43"
+	DriverATA    Type = "Apple_Driver_ATA"
+	Patches      Type = "Apple_Patches"
+	HFS          Type = "Apple_HFS"
+	HFSX         Type = "Apple_HFSX"
+	MFS          Type = "Apple_MFS"
+	UnixSVR2     Type = "Apple_UNIX_SVR2"
+	ProDOS       Type = "Apple_PRODOS"
+	Boot         Type = "Apple_Boot"
+	Bootstrap    Type = "Apple_Bootstrap"
+	Free         Type = "Apple_Free"
+	Scratch      Type = "Apple_Scratch"
+	Void         Type = "Apple_Void"
+)
+
+// Status flags of a partition
+const (
+	StatusValid     uint32 = 0x00000001 // entry is valid
+	StatusAllocated uint32 = 0x00000002 // entry is allocated
+	StatusInUse     uint32 = 0x00000004 // entry in use
+	StatusBootable  uint32 = 0x00000008 // partition contains valid boot information
+	StatusReadable  uint32 = 0x00000010 // partition allows reading
+	StatusWritable  uint32 = 0x00000020 // partition allows writing
+	StatusPICCode   uint32 = 0x00000040 // boot code is position independent
+	StatusAutoMount uint32 = 0x40000000 // partition is mounted automatically by macOS
+)
@@ -0,0 +1,24 @@
+// Package bsd provides an interface to BSD disklabels, as used by FreeBSD, OpenBSD and NetBSD.
+//
+// A disklabel is either on a whole disk, or nested inside an MBR partition, which BSD calls a slice,
+// of type mbr.FreeBSD, mbr.OpenBSD or mbr.NetBSD. Use Read for the former and ReadFromMBR for the latter.
+// FreeBSD also nests a disklabel inside a GPT partition of type gpt.FreeBSDData; use ReadFromGPT for that.
+// Either way, the partitions of the label have absolute offsets on the disk, so they can be used like
+// the partitions of any other table.
+//
+// bsd.Table implements the Table interface in github.com/diskfs/go-diskfs/partition
+//
+// Here is an example of a FreeBSD label with a root and a swap partition, inside an MBR slice starting
+// at sector 2048 of 1048576 sectors:
+//
+//	table := &bsd.Table{
+//	  Start:           2048,
+//	  Size:            1048576,
+//	  RelativeOffsets: true,
+//	  Partitions: []*bsd.Partition{
+//	    {Start: 2048 + 16, Size: 917488, Type: bsd.FFS}, // a
+//	    {Start: 2048 + 917504, Size: 131072, Type: bsd.Swap}, // b
+//	    {Start: 2048, Size: 1048576, Type: bsd.Unused},       // c, the whole slice
+//	  },
+//	}
+package bsd
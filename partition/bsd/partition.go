@@ -0,0 +1,131 @@
+package bsd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/diskfs/go-diskfs/util"
+)
+
+// partitionEntrySize size of a partition in the disklabel
+const partitionEntrySize = 16
+
+// Partition represents a single partition in a BSD disklabel, e.g. partition a.
+type Partition struct {
+	Start             uint32 // first sector of the partition, absolute on the disk even for a label inside an MBR slice
+	Size              uint32 // number of sectors in the partition, 0 for an unused partition
+	Type              FSType // type of filesystem
+	FragmentSize      uint32 // filesystem fragment size in bytes
+	FragmentsPerBlock uint8  // filesystem fragments per block
+	CylindersPerGroup uint16 // filesystem cylinders per group
+	sectorSize        int
+}
+
+// Equal compares if another partition is equal to this one
+func (p *Partition) Equal(p2 *Partition) bool {
+	if p2 == nil {
+		return false
+	}
+	return p.Start == p2.Start &&
+		p.Size == p2.Size &&
+		p.Type == p2.Type &&
+		p.FragmentSize == p2.FragmentSize &&
+		p.FragmentsPerBlock == p2.FragmentsPerBlock &&
+		p.CylindersPerGroup == p2.CylindersPerGroup
+}
+
+// GetSize the size of the partition in bytes
+func (p *Partition) GetSize() int64 {
+	return int64(p.Size) * int64(p.getSectorSize())
+}
+
+// GetStart the start of the partition on the disk in bytes
+func (p *Partition) GetStart() int64 {
+	return int64(p.Start) * int64(p.getSectorSize())
+}
+
+func (p *Partition) getSectorSize() int {
+	if p.sectorSize == 0 {
+		return logicalSectorSize
+	}
+	return p.sectorSize
+}
+
+// toBytes the bytes of the partition entry, with its offset as stored in the label
+func (p *Partition) toBytes(offset uint32) []byte {
+	b := make([]byte, partitionEntrySize)
+	binary.LittleEndian.PutUint32(b[0:4], p.Size)
+	binary.LittleEndian.PutUint32(b[4:8], offset)
+	binary.LittleEndian.PutUint32(b[8:12], p.FragmentSize)
+	b[12] = byte(p.Type)
+	b[13] = p.FragmentsPerBlock
+	binary.LittleEndian.PutUint16(b[14:16], p.CylindersPerGroup)
+	return b
+}
+
+// partitionFromBytes create a partition from its entry in the label, with the offset as stored
+func partitionFromBytes(b []byte, sectorSize int) *Partition {
+	return &Partition{
+		Size:              binary.LittleEndian.Uint32(b[0:4]),
+		Start:             binary.LittleEndian.Uint32(b[4:8]),
+		FragmentSize:      binary.LittleEndian.Uint32(b[8:12]),
+		Type:              FSType(b[12]),
+		FragmentsPerBlock: b[13],
+		CylindersPerGroup: binary.LittleEndian.Uint16(b[14:16]),
+		sectorSize:        sectorSize,
+	}
+}
+
+// WriteContents fills the partition with the contents provided
+// reads from beginning of reader to exactly size of partition in bytes
+func (p *Partition) WriteContents(f util.File, contents io.Reader) (uint64, error) {
+	start, size := p.GetStart(), uint64(p.GetSize())
+	total := uint64(0)
+	b := make([]byte, p.getSectorSize())
+	for {
+		read, err := contents.Read(b)
+		if err != nil && err != io.EOF {
+			return total, fmt.Errorf("could not read contents to pass to partition: %v", err)
+		}
+		if total+uint64(read) > size {
+			return total, fmt.Errorf("requested to write at least %d bytes to partition but maximum size is %d", total+uint64(read), size)
+		}
+		if read > 0 {
+			written, err := f.WriteAt(b[:read], start+int64(total))
+			if err != nil {
+				return total, fmt.Errorf("error writing to file: %v", err)
+			}
+			total += uint64(written)
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if total != size {
+		return total, fmt.Errorf("write %d bytes to partition but actual size is %d", total, size)
+	}
+	return total, nil
+}
+
+// ReadContents reads the contents of the partition into a writer
+// streams the entire partition to the writer
+func (p *Partition) ReadContents(f util.File, out io.Writer) (int64, error) {
+	start, size := p.GetStart(), p.GetSize()
+	total := int64(0)
+	b := make([]byte, p.getSectorSize())
+	for total < size {
+		read, err := f.ReadAt(b, start+total)
+		if err != nil && err != io.EOF {
+			return total, fmt.Errorf("error reading from file: %v", err)
+		}
+		if read > 0 {
+			_, _ = out.Write(b[:read])
+		}
+		total += int64(read)
+		if err == io.EOF {
+			break
+		}
+	}
+	return total, nil
+}
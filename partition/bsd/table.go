@@ -0,0 +1,349 @@
+package bsd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/diskfs/go-diskfs/partition/gpt"
+	"github.com/diskfs/go-diskfs/partition/mbr"
+	"github.com/diskfs/go-diskfs/partition/part"
+	"github.com/diskfs/go-diskfs/util"
+)
+
+const (
+	logicalSectorSize = 512
+	// the label is in the second sector of the disk or MBR slice
+	labelSector       = 1
+	diskMagic         = 0x82564557
+	headerSize        = 148
+	maxPartitions     = (logicalSectorSize - headerSize) / partitionEntrySize
+	minPartitions     = 8
+	rawPartition      = 2 // partition c, which covers the whole slice or disk
+	defaultBootSize   = 8192
+	defaultHeads      = 255
+	defaultSectors    = 63
+	typeNameSize      = 16
+	checksumStart     = 136
+	partitionsStart   = headerSize
+	numPartitionsAddr = 138
+)
+
+// Table represents a BSD disklabel, either on a whole disk or nested inside an MBR slice of type
+// mbr.FreeBSD, mbr.OpenBSD or mbr.NetBSD.
+//
+// The Partitions are partitions a, b, c and so on, with partition c by convention covering the whole
+// slice or disk. Their Start is always the absolute sector on the disk, even though FreeBSD stores
+// offsets relative to the slice, see RelativeOffsets.
+type Table struct {
+	Partitions        []*Partition
+	LogicalSectorSize int    // size of a sector, normally 512
+	Start             uint32 // first sector of the MBR slice holding the label, 0 for a label on the whole disk
+	Size              uint32 // number of sectors in the MBR slice, 0 for a label on the whole disk
+	// RelativeOffsets whether partition offsets are stored relative to the start of the MBR slice, as
+	// FreeBSD does, rather than absolute on the disk, as OpenBSD and NetBSD do
+	RelativeOffsets    bool
+	DiskType           uint16 // type of the drive, e.g. 4 for SCSI
+	DiskSubtype        uint16 // controller-specific subtype
+	TypeName           string // type name of the drive, at most 16 bytes
+	PackName           string // label of the disk, at most 16 bytes
+	SectorsPerTrack    uint32 // geometry, defaults to 63
+	TracksPerCylinder  uint32 // geometry, defaults to 255
+	Cylinders          uint32 // geometry, calculated from SectorsPerUnit if left blank
+	SectorsPerCylinder uint32 // geometry, calculated if left blank
+	SectorsPerUnit     uint32 // number of sectors in the slice or disk, calculated if left blank
+	Flags              uint32
+	BootBlockSize      uint32 // size of the boot area at the start of the slice or disk, defaults to 8192
+	SuperBlockSize     uint32 // maximum size of a filesystem superblock, normally 0
+	raw                []byte // label as read from disk, keeping the fields not in the Table when written back
+}
+
+// Type report the type of table, always the string "bsd"
+func (t *Table) Type() string {
+	return "bsd"
+}
+
+// ensure that a blank table is initialized, for a disk of the given size in bytes
+func (t *Table) initTable(size int64) {
+	if t.LogicalSectorSize == 0 {
+		t.LogicalSectorSize = logicalSectorSize
+	}
+	if t.SectorsPerUnit == 0 {
+		if t.Size != 0 {
+			t.SectorsPerUnit = t.Size
+		} else if sectors := size / int64(t.LogicalSectorSize); sectors < 1<<32 {
+			t.SectorsPerUnit = uint32(sectors)
+		} else {
+			t.SectorsPerUnit = 1<<32 - 1
+		}
+	}
+	if t.SectorsPerTrack == 0 {
+		t.SectorsPerTrack = defaultSectors
+	}
+	if t.TracksPerCylinder == 0 {
+		t.TracksPerCylinder = defaultHeads
+	}
+	if t.SectorsPerCylinder == 0 {
+		t.SectorsPerCylinder = t.SectorsPerTrack * t.TracksPerCylinder
+	}
+	if t.Cylinders == 0 {
+		t.Cylinders = t.SectorsPerUnit / t.SectorsPerCylinder
+	}
+	if t.BootBlockSize == 0 {
+		t.BootBlockSize = defaultBootSize
+	}
+}
+
+// Equal check if another table is equal to this one, ignoring unused partitions at the end
+func (t *Table) Equal(t2 *Table) bool {
+	if t2 == nil {
+		return false
+	}
+	basicMatch := t.LogicalSectorSize == t2.LogicalSectorSize &&
+		t.Start == t2.Start &&
+		t.Size == t2.Size &&
+		t.RelativeOffsets == t2.RelativeOffsets &&
+		t.DiskType == t2.DiskType &&
+		t.DiskSubtype == t2.DiskSubtype &&
+		t.TypeName == t2.TypeName &&
+		t.PackName == t2.PackName &&
+		t.SectorsPerTrack == t2.SectorsPerTrack &&
+		t.TracksPerCylinder == t2.TracksPerCylinder &&
+		t.Cylinders == t2.Cylinders &&
+		t.SectorsPerCylinder == t2.SectorsPerCylinder &&
+		t.SectorsPerUnit == t2.SectorsPerUnit &&
+		t.Flags == t2.Flags &&
+		t.BootBlockSize == t2.BootBlockSize &&
+		t.SuperBlockSize == t2.SuperBlockSize
+	p1, p2 := usedPartitions(t.Partitions), usedPartitions(t2.Partitions)
+	if !basicMatch || len(p1) != len(p2) {
+		return false
+	}
+	for i, p := range p1 {
+		if p == nil || !p.Equal(p2[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// usedPartitions the partitions up to the last one that is used
+func usedPartitions(parts []*Partition) []*Partition {
+	n := len(parts)
+	for n > 0 && (parts[n-1] == nil || (parts[n-1].Size == 0 && parts[n-1].Type == Unused)) {
+		n--
+	}
+	return parts[:n]
+}
+
+// checksum the checksum of a label, the XOR of all of its 16-bit words, with the checksum itself as zero
+func checksum(b []byte) uint16 {
+	var sum uint16
+	for i := 0; i+1 < len(b); i += 2 {
+		if i == checksumStart {
+			continue
+		}
+		sum ^= binary.LittleEndian.Uint16(b[i : i+2])
+	}
+	return sum
+}
+
+// toBytes the bytes of the label, with room for count partitions
+func (t *Table) toBytes(count int) ([]byte, error) {
+	if len(t.TypeName) > typeNameSize || len(t.PackName) > typeNameSize {
+		return nil, fmt.Errorf("type name %q or pack name %q is longer than %d bytes", t.TypeName, t.PackName, typeNameSize)
+	}
+	b := make([]byte, headerSize+count*partitionEntrySize)
+	// keep the spare sectors, timing and drive data fields of a label read from disk
+	if len(t.raw) >= headerSize {
+		copy(b[64:132], t.raw[64:132])
+	}
+	binary.LittleEndian.PutUint32(b[0:4], diskMagic)
+	binary.LittleEndian.PutUint16(b[4:6], t.DiskType)
+	binary.LittleEndian.PutUint16(b[6:8], t.DiskSubtype)
+	copy(b[8:24], t.TypeName)
+	copy(b[24:40], t.PackName)
+	binary.LittleEndian.PutUint32(b[40:44], uint32(t.LogicalSectorSize))
+	binary.LittleEndian.PutUint32(b[44:48], t.SectorsPerTrack)
+	binary.LittleEndian.PutUint32(b[48:52], t.TracksPerCylinder)
+	binary.LittleEndian.PutUint32(b[52:56], t.Cylinders)
+	binary.LittleEndian.PutUint32(b[56:60], t.SectorsPerCylinder)
+	binary.LittleEndian.PutUint32(b[60:64], t.SectorsPerUnit)
+	binary.LittleEndian.PutUint32(b[88:92], t.Flags)
+	binary.LittleEndian.PutUint32(b[132:136], diskMagic)
+	binary.LittleEndian.PutUint16(b[numPartitionsAddr:numPartitionsAddr+2], uint16(count))
+	binary.LittleEndian.PutUint32(b[140:144], t.BootBlockSize)
+	binary.LittleEndian.PutUint32(b[144:148], t.SuperBlockSize)
+	for i, p := range t.Partitions {
+		if p == nil {
+			continue
+		}
+		offset := p.Start
+		if t.RelativeOffsets && p.Size > 0 {
+			if p.Start < t.Start {
+				return nil, fmt.Errorf("partition %c starts at sector %d, before the slice at sector %d", 'a'+i, p.Start, t.Start)
+			}
+			offset -= t.Start
+		}
+		copy(b[partitionsStart+i*partitionEntrySize:], p.toBytes(offset))
+	}
+	binary.LittleEndian.PutUint16(b[checksumStart:checksumStart+2], checksum(b))
+	return b, nil
+}
+
+// Write writes the disklabel to the second sector of its MBR slice, or of the disk, leaving the boot code
+// around it in place.
+// Must be passed the util.File to write to and the size of the disk
+func (t *Table) Write(f util.File, size int64) error {
+	t.initTable(size)
+	if len(t.Partitions) > maxPartitions {
+		return fmt.Errorf("disklabel can have at most %d partitions, not %d", maxPartitions, len(t.Partitions))
+	}
+	diskSectors := size / int64(t.LogicalSectorSize)
+	for i, p := range t.Partitions {
+		if p != nil && p.Size > 0 && int64(p.Start)+int64(p.Size) > diskSectors {
+			return fmt.Errorf("partition %c ends at sector %d, beyond the end of the disk at sector %d", 'a'+i, int64(p.Start)+int64(p.Size)-1, diskSectors-1)
+		}
+	}
+	count := len(t.Partitions)
+	if count < minPartitions {
+		count = minPartitions
+	}
+	b, err := t.toBytes(count)
+	if err != nil {
+		return fmt.Errorf("invalid disklabel: %v", err)
+	}
+	offset := (int64(t.Start) + labelSector) * logicalSectorSize
+	written, err := f.WriteAt(b, offset)
+	if err != nil {
+		return fmt.Errorf("error writing disklabel to disk: %v", err)
+	}
+	if written != len(b) {
+		return fmt.Errorf("disklabel wrote %d bytes to disk instead of the expected %d", written, len(b))
+	}
+	for _, p := range t.Partitions {
+		if p != nil {
+			p.sectorSize = t.LogicalSectorSize
+		}
+	}
+	return nil
+}
+
+// Read read a BSD disklabel from a whole disk, without an MBR. The sector size comes from the label, so
+// logicalBlockSize and physicalBlockSize are ignored; they exist to match the other partition tables.
+func Read(f util.File, logicalBlockSize, physicalBlockSize int) (*Table, error) {
+	return readLabel(f, 0, 0, false)
+}
+
+// ReadFromMBR read the BSD disklabel nested inside an MBR partition, or slice, of type mbr.FreeBSD,
+// mbr.OpenBSD or mbr.NetBSD
+func ReadFromMBR(f util.File, slice *mbr.Partition) (*Table, error) {
+	if slice == nil {
+		return nil, fmt.Errorf("no MBR partition to read disklabel from")
+	}
+	switch slice.Type {
+	case mbr.FreeBSD, mbr.OpenBSD, mbr.NetBSD:
+	default:
+		return nil, fmt.Errorf("MBR partition of type 0x%02x does not hold a BSD disklabel", byte(slice.Type))
+	}
+	return readLabel(f, slice.Start, slice.Size, slice.Type == mbr.FreeBSD)
+}
+
+// ReadFromGPT read the BSD disklabel nested inside a GPT partition of type gpt.FreeBSDData, which FreeBSD
+// uses as a slice, as gpart does for its "freebsd" partition type
+func ReadFromGPT(f util.File, slice *gpt.Partition) (*Table, error) {
+	if slice == nil {
+		return nil, fmt.Errorf("no GPT partition to read disklabel from")
+	}
+	if !strings.EqualFold(string(slice.Type), string(gpt.FreeBSDData)) {
+		return nil, fmt.Errorf("GPT partition of type %s does not hold a BSD disklabel", slice.Type)
+	}
+	if slice.End < slice.Start || slice.End > math.MaxUint32 {
+		return nil, fmt.Errorf("GPT partition from sector %d to %d is beyond the reach of a disklabel", slice.Start, slice.End)
+	}
+	return readLabel(f, uint32(slice.Start), uint32(slice.End-slice.Start+1), true)
+}
+
+// readLabel read the disklabel in the slice at the given start and size. FreeBSD stores offsets relative
+// to the slice, unless its raw partition c starts at the slice, as in labels written before FreeBSD 8.
+func readLabel(f util.File, start, size uint32, freeBSD bool) (*Table, error) {
+	b := make([]byte, logicalSectorSize)
+	read, err := f.ReadAt(b, (int64(start)+labelSector)*logicalSectorSize)
+	if err != nil {
+		return nil, fmt.Errorf("error reading disklabel from file: %v", err)
+	}
+	if read != len(b) {
+		return nil, fmt.Errorf("read only %d bytes of disklabel from file instead of expected %d", read, len(b))
+	}
+	if magic := binary.LittleEndian.Uint32(b[0:4]); magic != diskMagic || binary.LittleEndian.Uint32(b[132:136]) != diskMagic {
+		return nil, fmt.Errorf("invalid disklabel magic 0x%08x", magic)
+	}
+	count := int(binary.LittleEndian.Uint16(b[numPartitionsAddr : numPartitionsAddr+2]))
+	if count > maxPartitions {
+		return nil, fmt.Errorf("disklabel has %d partitions, more than the maximum %d", count, maxPartitions)
+	}
+	b = b[:headerSize+count*partitionEntrySize]
+	if sum, expected := binary.LittleEndian.Uint16(b[checksumStart:checksumStart+2]), checksum(b); sum != expected {
+		return nil, fmt.Errorf("invalid disklabel checksum 0x%04x, expected 0x%04x", sum, expected)
+	}
+	sectorSize := int(binary.LittleEndian.Uint32(b[40:44]))
+	if sectorSize < logicalSectorSize || sectorSize&(sectorSize-1) != 0 {
+		return nil, fmt.Errorf("invalid disklabel sector size %d", sectorSize)
+	}
+
+	table := &Table{
+		LogicalSectorSize:  sectorSize,
+		Start:              start,
+		Size:               size,
+		DiskType:           binary.LittleEndian.Uint16(b[4:6]),
+		DiskSubtype:        binary.LittleEndian.Uint16(b[6:8]),
+		TypeName:           cString(b[8:24]),
+		PackName:           cString(b[24:40]),
+		SectorsPerTrack:    binary.LittleEndian.Uint32(b[44:48]),
+		TracksPerCylinder:  binary.LittleEndian.Uint32(b[48:52]),
+		Cylinders:          binary.LittleEndian.Uint32(b[52:56]),
+		SectorsPerCylinder: binary.LittleEndian.Uint32(b[56:60]),
+		SectorsPerUnit:     binary.LittleEndian.Uint32(b[60:64]),
+		Flags:              binary.LittleEndian.Uint32(b[88:92]),
+		BootBlockSize:      binary.LittleEndian.Uint32(b[140:144]),
+		SuperBlockSize:     binary.LittleEndian.Uint32(b[144:148]),
+		raw:                b,
+	}
+	for i := 0; i < count; i++ {
+		table.Partitions = append(table.Partitions, partitionFromBytes(b[partitionsStart+i*partitionEntrySize:], sectorSize))
+	}
+	if freeBSD && start != 0 && (count <= rawPartition || table.Partitions[rawPartition].Start != start) {
+		table.RelativeOffsets = true
+		for _, p := range table.Partitions {
+			if p.Size > 0 {
+				p.Start += start
+			}
+		}
+	}
+	return table, nil
+}
+
+// cString a string from a NUL-padded byte slice
+func cString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
+
+// GetPartitions the partitions of the disklabel, starting with partition a. A nil entry in Partitions is
+// returned as an unused partition, as it is written, so the others keep their letters.
+func (t *Table) GetPartitions() []part.Partition {
+	// each Partition matches the part.Partition interface, but golang does not accept passing them in a slice
+	parts := make([]part.Partition, len(t.Partitions))
+	for i, p := range t.Partitions {
+		if p == nil {
+			p = &Partition{Type: Unused, sectorSize: t.LogicalSectorSize}
+		}
+		parts[i] = p
+	}
+	return parts
+}
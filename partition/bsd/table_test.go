@@ -0,0 +1,204 @@
+package bsd_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/diskfs/go-diskfs/partition"
+	"github.com/diskfs/go-diskfs/partition/bsd"
+	"github.com/diskfs/go-diskfs/partition/gpt"
+	"github.com/diskfs/go-diskfs/partition/mbr"
+)
+
+const tenMB = 10 * 1024 * 1024
+
+func tmpDisk(size int64) (*os.File, error) {
+	f, err := os.CreateTemp("", "bsd_test")
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Truncate(size); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// sliceTable a disklabel inside an MBR slice from sector 2048 to the end of a 10MB disk
+func sliceTable(relative bool) *bsd.Table {
+	return &bsd.Table{
+		Start:           2048,
+		Size:            18432,
+		RelativeOffsets: relative,
+		PackName:        "lab",
+		Partitions: []*bsd.Partition{
+			{Start: 2048 + 16, Size: 12272, Type: bsd.FFS, FragmentSize: 4096, FragmentsPerBlock: 8},
+			{Start: 2048 + 12288, Size: 6144, Type: bsd.Swap},
+			{Start: 2048, Size: 18432, Type: bsd.Unused},
+		},
+	}
+}
+
+func TestWholeDisk(t *testing.T) {
+	f, err := tmpDisk(tenMB)
+	if err != nil {
+		t.Fatalf("error creating new temporary disk: %v", err)
+	}
+	defer f.Close()
+	defer os.Remove(f.Name())
+
+	table := &bsd.Table{
+		TypeName: "SCSI disk",
+		Partitions: []*bsd.Partition{
+			{Start: 16, Size: 16368, Type: bsd.FFS},
+			{Start: 16384, Size: 4096, Type: bsd.Swap},
+			{Start: 0, Size: 20480, Type: bsd.Unused},
+		},
+	}
+	if err := table.Write(f, tenMB); err != nil {
+		t.Fatalf("unexpected error writing table: %v", err)
+	}
+	b := make([]byte, 512)
+	if _, err := f.ReadAt(b, 512); err != nil {
+		t.Fatalf("error reading disklabel: %v", err)
+	}
+	if !bytes.Equal(b[0:4], []byte{0x57, 0x45, 0x56, 0x82}) {
+		t.Errorf("disklabel starts with % x instead of the magic number", b[0:4])
+	}
+	if n := binary.LittleEndian.Uint16(b[138:140]); n != 8 {
+		t.Errorf("disklabel has %d partitions instead of %d", n, 8)
+	}
+	var sum uint16
+	for i := 0; i < 148+8*16; i += 2 {
+		sum ^= binary.LittleEndian.Uint16(b[i:])
+	}
+	if sum != 0 {
+		t.Errorf("disklabel checksum does not match, XOR of all words is 0x%04x", sum)
+	}
+
+	read, err := bsd.Read(f, 512, 512)
+	if err != nil {
+		t.Fatalf("unexpected error reading table: %v", err)
+	}
+	if !read.Equal(table) {
+		t.Errorf("actual table was %+v instead of expected %+v", read, table)
+	}
+	if read.SectorsPerUnit != 20480 || read.SectorsPerCylinder != 255*63 {
+		t.Errorf("disklabel has %d sectors and %d sectors per cylinder", read.SectorsPerUnit, read.SectorsPerCylinder)
+	}
+
+	detected, err := partition.Read(f, 512, 512)
+	if err != nil {
+		t.Fatalf("unexpected error detecting table: %v", err)
+	}
+	if detected.Type() != "bsd" {
+		t.Errorf("detected table of type %s instead of bsd", detected.Type())
+	}
+
+	// a nil entry is an unused partition, and the partitions after it keep their letters
+	table.Partitions[1] = nil
+	parts := table.GetPartitions()
+	if len(parts) != 3 || parts[1].GetStart() != 0 || parts[1].GetSize() != 0 || parts[2].GetSize() != 20480*512 {
+		t.Errorf("partitions with a nil entry returned as %v", parts)
+	}
+}
+
+func TestSlice(t *testing.T) {
+	tests := []struct {
+		name     string
+		sliceTyp mbr.Type
+		table    *bsd.Table
+		offset   uint32 // offset of partition a as stored on disk
+	}{
+		{"FreeBSD", mbr.FreeBSD, sliceTable(true), 16},
+		{"FreeBSD absolute", mbr.FreeBSD, sliceTable(false), 2048 + 16},
+		{"OpenBSD", mbr.OpenBSD, sliceTable(false), 2048 + 16},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := tmpDisk(tenMB)
+			if err != nil {
+				t.Fatalf("error creating new temporary disk: %v", err)
+			}
+			defer f.Close()
+			defer os.Remove(f.Name())
+
+			mbrTable := &mbr.Table{
+				Partitions: []*mbr.Partition{
+					{Type: tt.sliceTyp, Start: 2048, Size: 18432, Bootable: true},
+				},
+			}
+			if err := mbrTable.Write(f, tenMB); err != nil {
+				t.Fatalf("unexpected error writing MBR: %v", err)
+			}
+			if err := tt.table.Write(f, tenMB); err != nil {
+				t.Fatalf("unexpected error writing disklabel: %v", err)
+			}
+			b := make([]byte, 4)
+			if _, err := f.ReadAt(b, 2049*512+148+4); err != nil {
+				t.Fatalf("error reading disklabel: %v", err)
+			}
+			if offset := binary.LittleEndian.Uint32(b); offset != tt.offset {
+				t.Errorf("partition a stored with offset %d instead of %d", offset, tt.offset)
+			}
+
+			read, err := bsd.ReadFromMBR(f, mbrTable.Partitions[0])
+			if err != nil {
+				t.Fatalf("unexpected error reading disklabel: %v", err)
+			}
+			if !read.Equal(tt.table) {
+				t.Errorf("actual table was %+v instead of expected %+v", read, tt.table)
+			}
+			if start := read.GetPartitions()[0].GetStart(); start != (2048+16)*512 {
+				t.Errorf("partition a starts at %d instead of %d", start, (2048+16)*512)
+			}
+		})
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	f, err := tmpDisk(tenMB)
+	if err != nil {
+		t.Fatalf("error creating new temporary disk: %v", err)
+	}
+	defer f.Close()
+	defer os.Remove(f.Name())
+
+	if _, err := bsd.ReadFromMBR(f, &mbr.Partition{Type: mbr.Linux, Start: 2048, Size: 2048}); err == nil {
+		t.Errorf("reading a disklabel from a Linux partition did not return an error")
+	}
+	if _, err := bsd.ReadFromGPT(f, &gpt.Partition{Type: gpt.LinuxFilesystem, Start: 2048, End: 4095}); err == nil {
+		t.Errorf("reading a disklabel from a Linux GPT partition did not return an error")
+	}
+	if _, err := bsd.ReadFromGPT(f, &gpt.Partition{Type: gpt.FreeBSDData, Start: 2048, End: 4095}); err == nil || !strings.HasPrefix(err.Error(), "invalid disklabel magic") {
+		t.Errorf("returned error %v for a GPT partition without a disklabel", err)
+	}
+	if _, err := bsd.Read(f, 512, 512); err == nil || !strings.HasPrefix(err.Error(), "invalid disklabel magic") {
+		t.Errorf("returned error %v for a disk without a disklabel", err)
+	}
+
+	table := sliceTable(true)
+	if err := table.Write(f, tenMB); err != nil {
+		t.Fatalf("unexpected error writing disklabel: %v", err)
+	}
+	// change the pack name
+	if _, err := f.WriteAt([]byte{'x'}, 2049*512+24); err != nil {
+		t.Fatalf("error changing disklabel: %v", err)
+	}
+	if _, err := bsd.ReadFromMBR(f, &mbr.Partition{Type: mbr.FreeBSD, Start: 2048, Size: 18432}); err == nil || !strings.HasPrefix(err.Error(), "invalid disklabel checksum") {
+		t.Errorf("returned error %v for a disklabel with an invalid checksum", err)
+	}
+
+	table = sliceTable(true)
+	table.Partitions[0].Start = 100
+	if err := table.Write(f, tenMB); err == nil || !strings.Contains(err.Error(), "before the slice") {
+		t.Errorf("returned error %v for a partition before the slice", err)
+	}
+	table = sliceTable(true)
+	table.Partitions[1].Size = 8192
+	if err := table.Write(f, tenMB); err == nil || !strings.Contains(err.Error(), "beyond the end of the disk") {
+		t.Errorf("returned error %v for a partition beyond the end of the disk", err)
+	}
+}
@@ -0,0 +1,23 @@
+package bsd
+
+// FSType the type of filesystem in a disklabel partition. Types above Boot differ between the BSDs,
+// e.g. 14 is Vinum on FreeBSD and ADOS on OpenBSD and NetBSD.
+type FSType byte
+
+// List of filesystem types shared by FreeBSD, OpenBSD and NetBSD
+const (
+	Unused  FSType = 0
+	Swap    FSType = 1
+	V6      FSType = 2
+	V7      FSType = 3
+	SysV    FSType = 4
+	V71K    FSType = 5
+	V8      FSType = 6
+	FFS     FSType = 7 // 4.2BSD fast filesystem, i.e. UFS
+	MSDOS   FSType = 8
+	LFS     FSType = 9
+	Other   FSType = 10
+	HPFS    FSType = 11
+	ISO9660 FSType = 12
+	Boot    FSType = 13
+)
@@ -0,0 +1,147 @@
+package partition
+
+import (
+	"fmt"
+
+	"github.com/diskfs/go-diskfs/partition/gpt"
+	"github.com/diskfs/go-diskfs/partition/mbr"
+)
+
+// mbrToGPTTypes the GPT type for each MBR type that has an equivalent
+var mbrToGPTTypes = map[mbr.Type]gpt.Type{
+	mbr.Fat12:        gpt.MicrosoftBasicData,
+	mbr.Fat16:        gpt.MicrosoftBasicData,
+	mbr.Fat16b:       gpt.MicrosoftBasicData,
+	mbr.Fat16bLBA:    gpt.MicrosoftBasicData,
+	mbr.Fat32CHS:     gpt.MicrosoftBasicData,
+	mbr.Fat32LBA:     gpt.MicrosoftBasicData,
+	mbr.NTFS:         gpt.MicrosoftBasicData,
+	mbr.Linux:        gpt.LinuxFilesystem,
+	mbr.LinuxSwap:    gpt.LinuxSwap,
+	mbr.LinuxLVM:     gpt.LinuxLVM,
+	mbr.EFISystem:    gpt.EFISystemPartition,
+	mbr.MacOSXUFS:    gpt.AppleUFS,
+	mbr.MacOSXBoot:   gpt.AppleBoot,
+	mbr.HFS:          gpt.AppleHFS,
+	mbr.Solaris8Boot: gpt.SolarisBoot,
+	mbr.VMWareFS:     gpt.VMwareVMFS,
+}
+
+// gptToMBRTypes the MBR type for each GPT type that has an equivalent. Microsoft basic data can hold
+// FAT or NTFS; like gdisk, it maps to NTFS, which is also used for exFAT.
+var gptToMBRTypes = map[gpt.Type]mbr.Type{
+	gpt.MicrosoftBasicData: mbr.NTFS,
+	gpt.LinuxFilesystem:    mbr.Linux,
+	gpt.LinuxRootX86:       mbr.Linux,
+	gpt.LinuxRootX86_64:    mbr.Linux,
+	gpt.LinuxRootArm:       mbr.Linux,
+	gpt.LinuxRootArm64:     mbr.Linux,
+	gpt.LinuxRootIA64:      mbr.Linux,
+	gpt.LinuxHome:          mbr.Linux,
+	gpt.LinuxServerData:    mbr.Linux,
+	gpt.LinuxSwap:          mbr.LinuxSwap,
+	gpt.LinuxLVM:           mbr.LinuxLVM,
+	gpt.EFISystemPartition: mbr.EFISystem,
+	gpt.AppleUFS:           mbr.MacOSXUFS,
+	gpt.AppleBoot:          mbr.MacOSXBoot,
+	gpt.AppleHFS:           mbr.HFS,
+	gpt.SolarisBoot:        mbr.Solaris8Boot,
+	gpt.VMwareVMFS:         mbr.VMWareFS,
+}
+
+// MBRToGPT converts an MBR partition table to a GPT for a disk of diskSize bytes. Every partition keeps its
+// start and end, so the data in it is untouched; the primary partitions come first, in order, followed by
+// the logical ones, and the extended partition that held them is dropped. The active flag becomes the legacy
+// BIOS bootable attribute.
+//
+// Returns an error if a partition type has no GPT equivalent, or if a partition overlaps the space the GPT
+// needs at the start or the end of the disk.
+func MBRToGPT(t *mbr.Table, diskSize int64) (*gpt.Table, error) {
+	sectorSize := t.LogicalSectorSize
+	if sectorSize == 0 {
+		sectorSize = 512
+	}
+	ss := uint64(sectorSize)
+	arraySectors := (gptArraySize + ss - 1) / ss
+	sectors := uint64(diskSize) / ss
+	if diskSize <= 0 || sectors < 2*arraySectors+4 {
+		return nil, fmt.Errorf("disk of %d bytes is too small for a GPT", diskSize)
+	}
+	first := 2 + arraySectors
+	last := sectors - 2 - arraySectors
+
+	table := &gpt.Table{
+		LogicalSectorSize:  sectorSize,
+		PhysicalSectorSize: t.PhysicalSectorSize,
+		ProtectiveMBR:      true,
+	}
+	for i, p := range t.Partitions {
+		if p == nil || p.Type == mbr.Empty || p.Size == 0 || p.Type == mbr.ExtendedCHS || p.Type == mbr.ExtendedLBA || p.Type == mbr.LinuxExtended {
+			continue
+		}
+		if p.Type == mbr.GPTProtective {
+			return nil, fmt.Errorf("partition %d is a protective MBR entry, the disk already has a GPT", i+1)
+		}
+		gptType, ok := mbrToGPTTypes[p.Type]
+		if !ok {
+			return nil, fmt.Errorf("partition %d has MBR type 0x%02x with no GPT equivalent", i+1, byte(p.Type))
+		}
+		start := uint64(p.Start)
+		end := start + uint64(p.Size) - 1
+		if start < first {
+			return nil, fmt.Errorf("partition %d starts at sector %d, inside the space for the primary GPT, which ends at sector %d", i+1, start, first-1)
+		}
+		if end > last {
+			return nil, fmt.Errorf("partition %d ends at sector %d, inside the space for the secondary GPT, which starts at sector %d", i+1, end, last+1)
+		}
+		part := &gpt.Partition{
+			Start: start,
+			End:   end,
+			Size:  uint64(p.Size) * ss,
+			Type:  gptType,
+		}
+		// the legacy BIOS bootable attribute is the equivalent of the MBR active flag
+		part.SetLegacyBIOSBootable(p.Bootable)
+		table.Partitions = append(table.Partitions, part)
+	}
+	return table, nil
+}
+
+// GPTToMBR converts a GPT to an MBR partition table. Every partition keeps its start and end, so the data in
+// it is untouched, and the legacy BIOS bootable attribute becomes the active flag. Partition names and GUIDs
+// have no place in an MBR, and are dropped.
+//
+// Returns an error if there are more than four partitions, a partition type has no MBR equivalent, or a
+// partition lies beyond what an MBR can address.
+func GPTToMBR(t *gpt.Table) (*mbr.Table, error) {
+	sectorSize := t.LogicalSectorSize
+	if sectorSize == 0 {
+		sectorSize = 512
+	}
+	table := &mbr.Table{
+		LogicalSectorSize:  sectorSize,
+		PhysicalSectorSize: t.PhysicalSectorSize,
+	}
+	for i, p := range t.Partitions {
+		if p == nil || p.Type == gpt.Unused {
+			continue
+		}
+		if len(table.Partitions) == 4 {
+			return nil, fmt.Errorf("partition %d does not fit, an MBR holds at most 4 primary partitions", i+1)
+		}
+		mbrType, ok := gptToMBRTypes[p.Type]
+		if !ok {
+			return nil, fmt.Errorf("partition %d has GPT type %s with no MBR equivalent", i+1, p.Type)
+		}
+		if p.End < p.Start || p.End > maxMBRSectors {
+			return nil, fmt.Errorf("partition %d from sector %d to %d is beyond what an MBR can address", i+1, p.Start, p.End)
+		}
+		table.Partitions = append(table.Partitions, &mbr.Partition{
+			Bootable: p.LegacyBIOSBootable(),
+			Type:     mbrType,
+			Start:    uint32(p.Start),
+			Size:     uint32(p.End - p.Start + 1),
+		})
+	}
+	return table, nil
+}
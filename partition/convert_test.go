@@ -0,0 +1,89 @@
+package partition_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/diskfs/go-diskfs/partition"
+	"github.com/diskfs/go-diskfs/partition/gpt"
+	"github.com/diskfs/go-diskfs/partition/mbr"
+)
+
+func TestMBRToGPT(t *testing.T) {
+	size := int64(100 * oneMiB)
+	table := &mbr.Table{
+		LogicalSectorSize:  512,
+		PhysicalSectorSize: 512,
+		Partitions: []*mbr.Partition{
+			{Bootable: true, Type: mbr.Fat32LBA, Start: 2048, Size: 20480},
+			{Type: mbr.ExtendedLBA, Start: 22528, Size: 100000},
+			{Type: mbr.Empty},
+			{Type: mbr.Empty},
+			{Type: mbr.Linux, Start: 24576, Size: 40960},
+			{Type: mbr.LinuxSwap, Start: 67584, Size: 20480},
+		},
+	}
+	converted, err := partition.MBRToGPT(table, size)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []gpt.Partition{
+		{Start: 2048, End: 22527, Type: gpt.MicrosoftBasicData, Attributes: 4},
+		{Start: 24576, End: 65535, Type: gpt.LinuxFilesystem},
+		{Start: 67584, End: 88063, Type: gpt.LinuxSwap},
+	}
+	if len(converted.Partitions) != len(expected) {
+		t.Fatalf("converted %d partitions instead of %d", len(converted.Partitions), len(expected))
+	}
+	for i, p := range converted.Partitions {
+		e := expected[i]
+		if p.Start != e.Start || p.End != e.End || p.Type != e.Type || p.Attributes != e.Attributes {
+			t.Errorf("partition %d is %#v instead of %#v", i+1, p, e)
+		}
+	}
+
+	back, err := partition.GPTToMBR(converted)
+	if err != nil {
+		t.Fatalf("unexpected error converting back: %v", err)
+	}
+	if len(back.Partitions) != 3 || !back.Partitions[0].Bootable || back.Partitions[0].Start != 2048 || back.Partitions[0].Size != 20480 {
+		t.Errorf("unexpected partitions converting back %v", back.Partitions)
+	}
+	if back.Partitions[1].Type != mbr.Linux || back.Partitions[2].Type != mbr.LinuxSwap {
+		t.Errorf("unexpected partition types converting back %v %v", back.Partitions[1].Type, back.Partitions[2].Type)
+	}
+}
+
+func TestConvertInvalid(t *testing.T) {
+	size := int64(100 * oneMiB)
+	mbrTests := []struct {
+		name string
+		p    *mbr.Partition
+		err  string
+	}{
+		{"primary GPT", &mbr.Partition{Type: mbr.Linux, Start: 2, Size: 2048}, "inside the space for the primary GPT"},
+		{"secondary GPT", &mbr.Partition{Type: mbr.Linux, Start: 2048, Size: 204800 - 2048}, "inside the space for the secondary GPT"},
+		{"unknown type", &mbr.Partition{Type: mbr.XenixRoot, Start: 2048, Size: 2048}, "no GPT equivalent"},
+		{"protective", &mbr.Partition{Type: mbr.GPTProtective, Start: 1, Size: 204799}, "already has a GPT"},
+	}
+	for _, tt := range mbrTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := partition.MBRToGPT(&mbr.Table{Partitions: []*mbr.Partition{tt.p}}, size)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("returned error %v instead of expected %s", err, tt.err)
+			}
+		})
+	}
+
+	tooMany := &gpt.Table{}
+	for i := uint64(0); i < 5; i++ {
+		tooMany.Partitions = append(tooMany.Partitions, &gpt.Partition{Start: 2048 * (i + 1), End: 2048*(i+2) - 1, Type: gpt.LinuxFilesystem})
+	}
+	if _, err := partition.GPTToMBR(tooMany); err == nil || !strings.Contains(err.Error(), "at most 4") {
+		t.Errorf("returned error %v for 5 partitions", err)
+	}
+	bios := &gpt.Table{Partitions: []*gpt.Partition{{Start: 2048, End: 4095, Type: gpt.BIOSBoot}}}
+	if _, err := partition.GPTToMBR(bios); err == nil || !strings.Contains(err.Error(), "no MBR equivalent") {
+		t.Errorf("returned error %v for a BIOS boot partition", err)
+	}
+}
@@ -0,0 +1,229 @@
+package gpt
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Attribute bits of a partition, in Partition.Attributes. Bits 0 to 2 apply to every partition, bits 48
+// to 63 have a meaning that depends on the partition type.
+const (
+	// AttributeRequired the partition is required for the platform to function, and must not be removed
+	AttributeRequired uint64 = 1 << 0
+	// AttributeNoBlockIOProtocol EFI firmware must not provide a block IO protocol for the partition
+	AttributeNoBlockIOProtocol uint64 = 1 << 1
+	// AttributeLegacyBIOSBootable the partition is bootable by legacy BIOS, e.g. through a hybrid or protective MBR
+	AttributeLegacyBIOSBootable uint64 = 1 << 2
+
+	// AttributeGrowFS systemd grows the filesystem to the size of the partition when it is mounted
+	AttributeGrowFS uint64 = 1 << 59
+	// AttributeReadOnly systemd, and Windows for basic data partitions, mounts the partition read-only
+	AttributeReadOnly uint64 = 1 << 60
+	// AttributeNoAuto systemd does not mount the partition automatically, Windows does not give it a drive letter
+	AttributeNoAuto uint64 = 1 << 63
+
+	// AttributeChromeOSSuccessful a ChromeOS kernel partition has booted successfully
+	AttributeChromeOSSuccessful uint64 = 1 << 56
+)
+
+// ChromeOS kernel partitions keep their boot priority and tries left, for A/B updates, in 4 bits each
+const (
+	chromeOSPriorityShift        = 48
+	chromeOSTriesShift           = 52
+	chromeOSFieldMask     uint64 = 0xf
+)
+
+// names of the attributes in the format of sfdisk
+var attributeNames = []struct {
+	bit  uint64
+	name string
+}{
+	{AttributeRequired, "RequiredPartition"},
+	{AttributeNoBlockIOProtocol, "NoBlockIOProtocol"},
+	{AttributeLegacyBIOSBootable, "LegacyBIOSBootable"},
+}
+
+func (p *Partition) attribute(bit uint64) bool {
+	return p.Attributes&bit != 0
+}
+
+func (p *Partition) setAttribute(bit uint64, set bool) {
+	if set {
+		p.Attributes |= bit
+	} else {
+		p.Attributes &^= bit
+	}
+}
+
+// Required whether the partition is required for the platform to function
+func (p *Partition) Required() bool { return p.attribute(AttributeRequired) }
+
+// SetRequired set whether the partition is required for the platform to function
+func (p *Partition) SetRequired(set bool) { p.setAttribute(AttributeRequired, set) }
+
+// NoBlockIOProtocol whether EFI firmware must not provide a block IO protocol for the partition
+func (p *Partition) NoBlockIOProtocol() bool { return p.attribute(AttributeNoBlockIOProtocol) }
+
+// SetNoBlockIOProtocol set whether EFI firmware must not provide a block IO protocol for the partition
+func (p *Partition) SetNoBlockIOProtocol(set bool) { p.setAttribute(AttributeNoBlockIOProtocol, set) }
+
+// LegacyBIOSBootable whether the partition is bootable by legacy BIOS
+func (p *Partition) LegacyBIOSBootable() bool { return p.attribute(AttributeLegacyBIOSBootable) }
+
+// SetLegacyBIOSBootable set whether the partition is bootable by legacy BIOS
+func (p *Partition) SetLegacyBIOSBootable(set bool) { p.setAttribute(AttributeLegacyBIOSBootable, set) }
+
+// GrowFS whether systemd grows the filesystem in the partition to the size of the partition
+func (p *Partition) GrowFS() bool { return p.attribute(AttributeGrowFS) }
+
+// SetGrowFS set whether systemd grows the filesystem in the partition to the size of the partition
+func (p *Partition) SetGrowFS(set bool) { p.setAttribute(AttributeGrowFS, set) }
+
+// ReadOnly whether the partition is mounted read-only
+func (p *Partition) ReadOnly() bool { return p.attribute(AttributeReadOnly) }
+
+// SetReadOnly set whether the partition is mounted read-only
+func (p *Partition) SetReadOnly(set bool) { p.setAttribute(AttributeReadOnly, set) }
+
+// NoAuto whether the partition is left out of automatic mounting
+func (p *Partition) NoAuto() bool { return p.attribute(AttributeNoAuto) }
+
+// SetNoAuto set whether the partition is left out of automatic mounting
+func (p *Partition) SetNoAuto(set bool) { p.setAttribute(AttributeNoAuto, set) }
+
+// ChromeOSPriority the boot priority of a ChromeOS kernel partition, from 0, not bootable, to 15, the highest
+func (p *Partition) ChromeOSPriority() uint8 {
+	return uint8(p.Attributes >> chromeOSPriorityShift & chromeOSFieldMask)
+}
+
+// SetChromeOSPriority set the boot priority of a ChromeOS kernel partition, at most 15
+func (p *Partition) SetChromeOSPriority(priority uint8) error {
+	return p.setChromeOSField(chromeOSPriorityShift, priority, "priority")
+}
+
+// ChromeOSTries the number of boot attempts left for a ChromeOS kernel partition, from 0 to 15
+func (p *Partition) ChromeOSTries() uint8 {
+	return uint8(p.Attributes >> chromeOSTriesShift & chromeOSFieldMask)
+}
+
+// SetChromeOSTries set the number of boot attempts left for a ChromeOS kernel partition, at most 15
+func (p *Partition) SetChromeOSTries(tries uint8) error {
+	return p.setChromeOSField(chromeOSTriesShift, tries, "tries")
+}
+
+// ChromeOSSuccessful whether a ChromeOS kernel partition has booted successfully
+func (p *Partition) ChromeOSSuccessful() bool { return p.attribute(AttributeChromeOSSuccessful) }
+
+// SetChromeOSSuccessful set whether a ChromeOS kernel partition has booted successfully
+func (p *Partition) SetChromeOSSuccessful(set bool) { p.setAttribute(AttributeChromeOSSuccessful, set) }
+
+func (p *Partition) setChromeOSField(shift uint, value uint8, name string) error {
+	if uint64(value) > chromeOSFieldMask {
+		return fmt.Errorf("ChromeOS %s %d is more than the maximum %d", name, value, chromeOSFieldMask)
+	}
+	p.Attributes = p.Attributes&^(chromeOSFieldMask<<shift) | uint64(value)<<shift
+	return nil
+}
+
+// FormatAttributes the attributes in the format sfdisk uses, e.g. "RequiredPartition GUID:48,56", with the
+// three common attributes by name, and the type-specific bits 48 to 63 by number. Other bits are reserved
+// and are listed by number as well, which sfdisk does not accept.
+func FormatAttributes(attributes uint64) string {
+	var words, bits []string
+	for _, a := range attributeNames {
+		if attributes&a.bit != 0 {
+			words = append(words, a.name)
+		}
+	}
+	for bit := 3; bit < 64; bit++ {
+		if attributes&(1<<uint(bit)) != 0 {
+			bits = append(bits, strconv.Itoa(bit))
+		}
+	}
+	if len(bits) > 0 {
+		words = append(words, "GUID:"+strings.Join(bits, ","))
+	}
+	return strings.Join(words, " ")
+}
+
+// ParseAttributes parse attributes in the format of FormatAttributes, and of sfdisk. Names and bit numbers
+// may be separated by spaces or commas.
+func ParseAttributes(s string) (uint64, error) {
+	var attributes uint64
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ',' })
+	for _, field := range fields {
+		field = strings.TrimPrefix(field, "GUID:")
+		found := false
+		for _, a := range attributeNames {
+			if field == a.name {
+				attributes |= a.bit
+				found = true
+			}
+		}
+		if found {
+			continue
+		}
+		bit, err := strconv.Atoi(field)
+		if err != nil || bit < 0 || bit > 63 {
+			return 0, fmt.Errorf("invalid attribute %q", field)
+		}
+		attributes |= 1 << uint(bit)
+	}
+	return attributes, nil
+}
+
+// describeAttributes readable descriptions of the attributes of the partition, decoding the type-specific
+// bits for ChromeOS kernel partitions and for systemd
+func (p *Partition) describeAttributes() []string {
+	var desc []string
+	for _, a := range []struct {
+		set  bool
+		name string
+	}{
+		{p.Required(), "required"},
+		{p.NoBlockIOProtocol(), "no-block-io"},
+		{p.LegacyBIOSBootable(), "legacy-bios-bootable"},
+	} {
+		if a.set {
+			desc = append(desc, a.name)
+		}
+	}
+	rest := p.Attributes &^ (AttributeRequired | AttributeNoBlockIOProtocol | AttributeLegacyBIOSBootable)
+	if p.Type == ChromeOSKernel {
+		desc = append(desc, fmt.Sprintf("priority=%d", p.ChromeOSPriority()), fmt.Sprintf("tries=%d", p.ChromeOSTries()))
+		if p.ChromeOSSuccessful() {
+			desc = append(desc, "successful")
+		}
+		rest &^= chromeOSFieldMask<<chromeOSPriorityShift | chromeOSFieldMask<<chromeOSTriesShift | AttributeChromeOSSuccessful
+	} else {
+		for _, a := range []struct {
+			bit  uint64
+			name string
+		}{
+			{AttributeGrowFS, "grow-fs"},
+			{AttributeReadOnly, "read-only"},
+			{AttributeNoAuto, "no-auto"},
+		} {
+			if p.attribute(a.bit) {
+				desc = append(desc, a.name)
+				rest &^= a.bit
+			}
+		}
+	}
+	for bit := 0; bit < 64; bit++ {
+		if rest&(1<<uint(bit)) != 0 {
+			desc = append(desc, fmt.Sprintf("bit-%d", bit))
+		}
+	}
+	return desc
+}
+
+// String a readable description of the partition, with its attributes decoded
+func (p *Partition) String() string {
+	s := fmt.Sprintf("start=%d end=%d type=%s guid=%s name=%q", p.Start, p.End, p.Type, p.GUID, p.Name)
+	if desc := p.describeAttributes(); len(desc) > 0 {
+		s += " attributes=" + strings.Join(desc, ",")
+	}
+	return s
+}
@@ -0,0 +1,92 @@
+package gpt_test
+
+import (
+	"testing"
+
+	. "github.com/diskfs/go-diskfs/partition/gpt"
+)
+
+func TestAttributes(t *testing.T) {
+	p := &Partition{Type: LinuxFilesystem}
+	p.SetRequired(true)
+	p.SetLegacyBIOSBootable(true)
+	p.SetReadOnly(true)
+	p.SetGrowFS(true)
+	p.SetNoAuto(true)
+	expected := uint64(1<<0 | 1<<2 | 1<<59 | 1<<60 | 1<<63)
+	if p.Attributes != expected {
+		t.Fatalf("attributes %#x instead of %#x", p.Attributes, expected)
+	}
+	if !p.Required() || p.NoBlockIOProtocol() || !p.LegacyBIOSBootable() || !p.ReadOnly() || !p.GrowFS() || !p.NoAuto() {
+		t.Errorf("attributes %#x read back wrong", p.Attributes)
+	}
+	p.SetReadOnly(false)
+	p.SetRequired(false)
+	if p.ReadOnly() || p.Required() || p.Attributes != 1<<2|1<<59|1<<63 {
+		t.Errorf("clearing attributes left %#x", p.Attributes)
+	}
+	if s := p.String(); s != `start=0 end=0 type=0FC63DAF-8483-4772-8E79-3D69D8477DE4 guid= name="" attributes=legacy-bios-bootable,grow-fs,no-auto` {
+		t.Errorf("printed as %s", s)
+	}
+}
+
+func TestChromeOSAttributes(t *testing.T) {
+	p := &Partition{Type: ChromeOSKernel, Attributes: AttributeNoAuto}
+	if err := p.SetChromeOSPriority(15); err != nil {
+		t.Fatalf("unexpected error setting priority: %v", err)
+	}
+	if err := p.SetChromeOSTries(6); err != nil {
+		t.Fatalf("unexpected error setting tries: %v", err)
+	}
+	p.SetChromeOSSuccessful(true)
+	if p.Attributes != 1<<63|1<<56|6<<52|15<<48 {
+		t.Errorf("attributes %#x", p.Attributes)
+	}
+	if err := p.SetChromeOSPriority(1); err != nil {
+		t.Fatalf("unexpected error setting priority: %v", err)
+	}
+	if p.ChromeOSPriority() != 1 || p.ChromeOSTries() != 6 || !p.ChromeOSSuccessful() {
+		t.Errorf("read back priority %d tries %d successful %v", p.ChromeOSPriority(), p.ChromeOSTries(), p.ChromeOSSuccessful())
+	}
+	if err := p.SetChromeOSTries(16); err == nil {
+		t.Errorf("no error for tries 16")
+	}
+	if p.ChromeOSTries() != 6 {
+		t.Errorf("invalid tries changed the attributes to %#x", p.Attributes)
+	}
+	// bit 63 has no meaning for ChromeOS
+	if s := p.String(); s != `start=0 end=0 type=FE3A2A5D-4F32-41A7-B725-ACCC3285A309 guid= name="" attributes=priority=1,tries=6,successful,bit-63` {
+		t.Errorf("printed as %s", s)
+	}
+}
+
+func TestFormatParseAttributes(t *testing.T) {
+	tests := []struct {
+		attributes uint64
+		formatted  string
+	}{
+		{0, ""},
+		{AttributeRequired | AttributeNoBlockIOProtocol | AttributeLegacyBIOSBootable, "RequiredPartition NoBlockIOProtocol LegacyBIOSBootable"},
+		{AttributeLegacyBIOSBootable | 1<<48 | AttributeChromeOSSuccessful | AttributeReadOnly, "LegacyBIOSBootable GUID:48,56,60"},
+	}
+	for _, tt := range tests {
+		if s := FormatAttributes(tt.attributes); s != tt.formatted {
+			t.Errorf("%#x formatted as %q instead of %q", tt.attributes, s, tt.formatted)
+		}
+		a, err := ParseAttributes(tt.formatted)
+		if err != nil {
+			t.Errorf("unexpected error parsing %q: %v", tt.formatted, err)
+		}
+		if a != tt.attributes {
+			t.Errorf("%q parsed as %#x instead of %#x", tt.formatted, a, tt.attributes)
+		}
+	}
+	if a, err := ParseAttributes("RequiredPartition,GUID:63 2"); err != nil || a != 1|1<<63|1<<2 {
+		t.Errorf("parsed mixed separators as %#x, error %v", a, err)
+	}
+	for _, s := range []string{"Bootable", "GUID:64", "GUID:-1"} {
+		if _, err := ParseAttributes(s); err == nil {
+			t.Errorf("no error parsing %q", s)
+		}
+	}
+}
@@ -23,4 +23,26 @@
 //	    },
 //	  },
 //	}
+//
+// Read falls back to the secondary GPT at the end of the disk when the primary one is damaged.
+// To check for, and fix, a damaged copy:
+//
+//	table, err := gpt.Read(f, 512, 512)
+//	if err == nil && !table.Health().OK() {
+//	  err = table.Repair(f)
+//	}
+//
+// For firmware that only understands MBR, up to three GPT partitions can also be listed in a hybrid MBR.
+// Partition numbers count from 1:
+//
+//	table.HybridMBR = []gpt.HybridMBREntry{
+//	  {Partition: 2, Type: mbr.Fat32LBA, Bootable: true},
+//	}
+//
+// Partition attributes have typed accessors, so that, for example, A/B update tooling for ChromeOS can
+// mark the other kernel partition to boot next:
+//
+//	p.SetChromeOSSuccessful(false)
+//	err := p.SetChromeOSTries(1)
+//	err = p.SetChromeOSPriority(2)
 package gpt
@@ -0,0 +1,139 @@
+package gpt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/diskfs/go-diskfs/partition/mbr"
+)
+
+// maxHybridMBREntries how many GPT partitions a hybrid MBR can mirror, next to its protective entry
+const maxHybridMBREntries = 3
+
+// HybridMBREntry a GPT partition mirrored as a real partition in a hybrid MBR, so that firmware or an
+// operating system that only understands MBR can use it
+type HybridMBREntry struct {
+	Partition int      // number of the GPT partition to mirror, starting at 1
+	Type      mbr.Type // MBR partition type of the entry
+	Bootable  bool     // whether the entry is marked active
+}
+
+// generateHybridMBR create a hybrid MBR, like gdisk does: the first entry is the protective 0xEE partition,
+// from sector 1 to just before the first mirrored partition, followed by the mirrored partitions in order
+func (t *Table) generateHybridMBR() ([]byte, error) {
+	if len(t.HybridMBR) > maxHybridMBREntries {
+		return nil, fmt.Errorf("hybrid MBR can mirror at most %d partitions, not %d", maxHybridMBREntries, len(t.HybridMBR))
+	}
+	b := make([]byte, 512)
+	copy(b[mbrSignatureStart:], getMbrSignature())
+	entries := b[mbrPartitionEntriesStart : mbrPartitionEntriesStart+mbrpartitionEntrySize*mbrPartitionEntriesCount]
+
+	firstStart := uint64(0)
+	mirrored := map[int]bool{}
+	for i, h := range t.HybridMBR {
+		if h.Partition < 1 || h.Partition > len(t.Partitions) || t.Partitions[h.Partition-1].Type == Unused {
+			return nil, fmt.Errorf("hybrid MBR entry %d mirrors partition %d, which does not exist", i+1, h.Partition)
+		}
+		if mirrored[h.Partition] {
+			return nil, fmt.Errorf("hybrid MBR entry %d mirrors partition %d, which is already mirrored", i+1, h.Partition)
+		}
+		mirrored[h.Partition] = true
+		if h.Type == mbr.Empty || h.Type == mbr.GPTProtective {
+			return nil, fmt.Errorf("hybrid MBR entry %d has invalid type 0x%02x", i+1, byte(h.Type))
+		}
+		p := t.Partitions[h.Partition-1]
+		if p.End < p.Start || p.End > 1<<32-2 {
+			return nil, fmt.Errorf("partition %d mirrored in the hybrid MBR is beyond what an MBR can address", h.Partition)
+		}
+		if p.Start < t.firstDataSector {
+			return nil, fmt.Errorf("partition %d mirrored in the hybrid MBR starts inside the GPT", h.Partition)
+		}
+		if firstStart == 0 || p.Start < firstStart {
+			firstStart = p.Start
+		}
+		entry := entries[(i+1)*mbrpartitionEntrySize : (i+2)*mbrpartitionEntrySize]
+		if h.Bootable {
+			entry[0] = 0x80
+		}
+		entry[4] = byte(h.Type)
+		setEntryCHS(entry, uint32(p.Start), uint32(p.End))
+		binary.LittleEndian.PutUint32(entry[8:12], uint32(p.Start))
+		binary.LittleEndian.PutUint32(entry[12:16], uint32(p.End-p.Start+1))
+	}
+
+	// the protective entry covers the GPT header and partition array, up to the first mirrored partition
+	protective := entries[0:mbrpartitionEntrySize]
+	protective[4] = byte(mbr.GPTProtective)
+	setEntryCHS(protective, 1, uint32(firstStart-1))
+	binary.LittleEndian.PutUint32(protective[8:12], 1)
+	binary.LittleEndian.PutUint32(protective[12:16], uint32(firstStart-1))
+	return b, nil
+}
+
+// setEntryCHS fill the CHS start and end addresses of an MBR partition entry from its first and last sector,
+// as the firmware that needs a hybrid MBR may read them rather than the LBA fields
+func setEntryCHS(entry []byte, first, last uint32) {
+	entry[1], entry[2], entry[3] = mbr.DefaultGeometry.CHSBytes(first)
+	entry[5], entry[6], entry[7] = mbr.DefaultGeometry.CHSBytes(last)
+}
+
+// readHybridMBR find the GPT partitions mirrored in the MBR in a byte slice, if it is a hybrid MBR: a
+// protective 0xEE entry starting at sector 1, and other entries that each match a GPT partition exactly
+func (t *Table) readHybridMBR(b []byte) {
+	t.HybridMBR = nil
+	if len(b) < 512 || !bytes.Equal(b[mbrSignatureStart:mbrSignatureStart+2], getMbrSignature()) {
+		return
+	}
+	entries := b[mbrPartitionEntriesStart : mbrPartitionEntriesStart+mbrpartitionEntrySize*mbrPartitionEntriesCount]
+	protective := false
+	var hybrid []HybridMBREntry
+	for i := 0; i < mbrPartitionEntriesCount; i++ {
+		entry := entries[i*mbrpartitionEntrySize : (i+1)*mbrpartitionEntrySize]
+		typ := mbr.Type(entry[4])
+		start := uint64(binary.LittleEndian.Uint32(entry[8:12]))
+		size := uint64(binary.LittleEndian.Uint32(entry[12:16]))
+		switch {
+		case typ == mbr.Empty:
+		case typ == mbr.GPTProtective:
+			if start != 1 || protective {
+				return
+			}
+			protective = true
+		default:
+			n := t.partitionNumber(start, size)
+			if n == 0 {
+				return
+			}
+			hybrid = append(hybrid, HybridMBREntry{Partition: n, Type: typ, Bootable: entry[0] == 0x80})
+		}
+	}
+	if protective && len(hybrid) > 0 {
+		t.HybridMBR = hybrid
+		t.ProtectiveMBR = true
+	}
+}
+
+// partitionNumber the number, starting at 1, of the partition with exactly the given start and size in
+// sectors, or 0 if there is none
+func (t *Table) partitionNumber(start, size uint64) int {
+	for i, p := range t.Partitions {
+		if p.Type != Unused && size > 0 && p.Start == start && p.End == start+size-1 {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// compareHybridMBR compare the mirrored partitions of two hybrid MBRs
+func compareHybridMBR(h1, h2 []HybridMBREntry) bool {
+	if len(h1) != len(h2) {
+		return false
+	}
+	for i := range h1 {
+		if h1[i] != h2[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,90 @@
+package gpt
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/diskfs/go-diskfs/util"
+)
+
+// Health describes the state of the primary and secondary (backup) copies of a GPT, as found by Read.
+// A GPT keeps a primary header and partition array at the start of the disk, and a secondary copy at
+// the end of the disk, so that a table damaged in one place can be recovered from the other.
+type Health struct {
+	PrimaryErr    error // why the primary header or partition array is unusable, nil if it is valid
+	SecondaryErr  error // why the secondary header or partition array is unusable, nil if it is valid
+	UsedSecondary bool  // the table was read from the secondary copy, because the primary is unusable
+	Mismatch      bool  // both copies are valid, but they describe different tables
+}
+
+// OK whether both copies were valid and identical
+func (h Health) OK() bool {
+	return h.PrimaryErr == nil && h.SecondaryErr == nil && !h.Mismatch
+}
+
+// Health report the state of the primary and secondary copies of the table when it was read from disk.
+// For a table that was not read from disk, or after a successful Write or Repair, both copies are healthy.
+func (t *Table) Health() Health {
+	return t.health
+}
+
+// Repair rewrites the damaged copy of the table on disk from the good one, like the recovery options of
+// gdisk. If the primary copy was unusable, it is rebuilt from the secondary copy that Read used, and
+// vice versa. If both copies were valid but disagree, the secondary copy is rebuilt from the primary.
+// It does nothing if both copies were valid and identical.
+func (t *Table) Repair(f util.File) error {
+	h := t.health
+	if h.OK() {
+		return nil
+	}
+	if h.UsedSecondary {
+		if err := t.writeCopy(f, true); err != nil {
+			return fmt.Errorf("error rebuilding primary GPT from secondary: %v", err)
+		}
+		// whatever destroyed the primary GPT may have taken the MBR with it; restore a protective one,
+		// but never overwrite an MBR that is still there, as it may be a hybrid
+		if !t.ProtectiveMBR {
+			b := make([]byte, 2)
+			if _, err := f.ReadAt(b, mbrSignatureStart); err != nil {
+				return fmt.Errorf("error reading MBR signature: %v", err)
+			}
+			if !bytes.Equal(b, getMbrSignature()) {
+				if err := t.writeProtectiveMBR(f); err != nil {
+					return err
+				}
+				t.ProtectiveMBR = true
+			}
+		}
+	} else {
+		if err := t.writeCopy(f, false); err != nil {
+			return fmt.Errorf("error rebuilding secondary GPT from primary: %v", err)
+		}
+	}
+	t.health = Health{}
+	return nil
+}
+
+// Erase overwrites the primary and secondary GPT headers on disk with zeroes, so that the disk is no
+// longer recognized as having a GPT, e.g. after writing an MBR partition table in its place. The protective
+// MBR, the partition arrays and the partitions themselves are left untouched.
+func (t *Table) Erase(f util.File) error {
+	sectorSize := t.LogicalSectorSize
+	if sectorSize == 0 {
+		sectorSize = logicalSectorSize
+	}
+	// the primary header is always at sector 1, even for a table that was never written
+	empty := make([]byte, sectorSize)
+	for _, lba := range []uint64{1, t.secondaryHeader} {
+		if lba == 0 {
+			continue
+		}
+		written, err := f.WriteAt(empty, int64(lba)*int64(sectorSize))
+		if err != nil {
+			return fmt.Errorf("error erasing GPT header at sector %d: %v", lba, err)
+		}
+		if written != len(empty) {
+			return fmt.Errorf("wrote %d bytes erasing GPT header at sector %d instead of %d", written, lba, len(empty))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package gpt
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/diskfs/go-diskfs/partition/part"
+	uuid "github.com/google/uuid"
+)
+
+// scriptLabel the label of a GPT in an sfdisk script
+const scriptLabel = "gpt"
+
+// Dump write the table as an sfdisk script, as sfdisk --dump does, so it can be kept as text, and restored
+// with ParseScript or with sfdisk. Partition lines are named after the partition number, as the device
+// is not known; unused entries are left out.
+func (t *Table) Dump(w io.Writer) error {
+	return t.script().Write(w)
+}
+
+// script the sfdisk script for the table
+func (t *Table) script() *part.Script {
+	sectorSize := t.LogicalSectorSize
+	if sectorSize == 0 {
+		sectorSize = logicalSectorSize
+	}
+	arraySize := t.partitionArraySize
+	if arraySize == 0 {
+		arraySize = defaultPartitionArraySize
+	}
+	firstLBA := t.firstDataSector
+	if firstLBA == 0 {
+		firstLBA = 2 + uint64(arraySize)*PartitionEntrySize/uint64(sectorSize)
+	}
+
+	s := &part.Script{Header: []part.ScriptField{{Name: "label", Value: scriptLabel}}}
+	if t.GUID != "" {
+		s.Header = append(s.Header, part.ScriptField{Name: "label-id", Value: strings.ToUpper(t.GUID)})
+	}
+	s.Header = append(s.Header,
+		part.ScriptField{Name: "unit", Value: "sectors"},
+		part.ScriptField{Name: "first-lba", Value: strconv.FormatUint(firstLBA, 10)},
+	)
+	// the last usable sector depends on the size of the disk, so is only known for a table read from one
+	if t.lastDataSector != 0 {
+		s.Header = append(s.Header, part.ScriptField{Name: "last-lba", Value: strconv.FormatUint(t.lastDataSector, 10)})
+	}
+	if arraySize != defaultPartitionArraySize {
+		s.Header = append(s.Header, part.ScriptField{Name: "table-length", Value: strconv.Itoa(arraySize)})
+	}
+	s.Header = append(s.Header, part.ScriptField{Name: "sector-size", Value: strconv.Itoa(sectorSize)})
+
+	for i, p := range t.Partitions {
+		if p == nil || p.Type == Unused {
+			continue
+		}
+		var fields []part.ScriptField
+		// a partition with no start or size yet is placed by sfdisk, as it is by Write
+		if p.Start != 0 {
+			fields = append(fields, part.ScriptField{Name: "start", Value: fmt.Sprintf("%12d", p.Start)})
+		}
+		var size uint64
+		switch {
+		case p.End >= p.Start && p.End != 0:
+			size = p.End - p.Start + 1
+		case p.Size != 0:
+			size = p.Size / uint64(sectorSize)
+		}
+		if size != 0 {
+			fields = append(fields, part.ScriptField{Name: "size", Value: fmt.Sprintf("%12d", size)})
+		}
+		fields = append(fields, part.ScriptField{Name: "type", Value: strings.ToUpper(string(p.Type))})
+		if p.GUID != "" {
+			fields = append(fields, part.ScriptField{Name: "uuid", Value: strings.ToUpper(p.GUID)})
+		}
+		if p.Name != "" {
+			fields = append(fields, part.ScriptField{Name: "name", Value: p.Name})
+		}
+		if p.Attributes != 0 {
+			fields = append(fields, part.ScriptField{Name: "attrs", Value: FormatAttributes(p.Attributes)})
+		}
+		s.Partitions = append(s.Partitions, part.ScriptPartition{Number: i + 1, Fields: fields})
+	}
+	return s
+}
+
+// ParseScript read a table from an sfdisk script, as written by Dump or by sfdisk --dump. Partitions are
+// placed at the number of their device name, if they have one, and otherwise after the previous partition.
+// The device, grain and last-lba headers are ignored, as the last usable sector follows from the size of
+// the disk the table is written to.
+func ParseScript(r io.Reader) (*Table, error) {
+	s, err := part.ParseScript(r)
+	if err != nil {
+		return nil, err
+	}
+	return TableFromScript(s)
+}
+
+// TableFromScript create a table from a parsed sfdisk script, see ParseScript
+func TableFromScript(s *part.Script) (*Table, error) {
+	table := &Table{
+		LogicalSectorSize:  logicalSectorSize,
+		PhysicalSectorSize: physicalSectorSize,
+		ProtectiveMBR:      true,
+	}
+	if label, _ := s.Get("label"); label != scriptLabel {
+		return nil, fmt.Errorf("script has label %q instead of %q", label, scriptLabel)
+	}
+	var firstLBA uint64
+	for _, h := range s.Header {
+		var err error
+		switch h.Name {
+		case "label", "device", "grain", "last-lba":
+		case "unit":
+			if h.Value != "sectors" {
+				err = fmt.Errorf("unsupported unit %q", h.Value)
+			}
+		case "label-id":
+			var guid uuid.UUID
+			if guid, err = uuid.Parse(h.Value); err == nil {
+				table.GUID = strings.ToUpper(guid.String())
+			}
+		case "first-lba":
+			firstLBA, err = strconv.ParseUint(h.Value, 10, 64)
+		case "table-length":
+			table.partitionArraySize, err = strconv.Atoi(h.Value)
+			if err == nil && table.partitionArraySize < 1 {
+				err = fmt.Errorf("must be at least 1")
+			}
+		case "sector-size":
+			table.LogicalSectorSize, err = strconv.Atoi(h.Value)
+			if err == nil && table.LogicalSectorSize != 512 && table.LogicalSectorSize != 4096 {
+				err = fmt.Errorf("must be 512 or 4096")
+			}
+		default:
+			err = fmt.Errorf("unknown header")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid header %s: %s: %v", h.Name, h.Value, err)
+		}
+	}
+	if table.LogicalSectorSize > table.PhysicalSectorSize {
+		table.PhysicalSectorSize = table.LogicalSectorSize
+	}
+	table.firstDataSector = firstLBA
+
+	for i, sp := range s.Partitions {
+		number := sp.Number
+		if number == 0 {
+			number = len(table.Partitions) + 1
+		}
+		if number <= len(table.Partitions) {
+			return nil, fmt.Errorf("partition %d is out of order or given twice", number)
+		}
+		p, err := partitionFromScript(sp, table.LogicalSectorSize)
+		if err != nil {
+			return nil, fmt.Errorf("partition %d: %v", i+1, err)
+		}
+		for len(table.Partitions) < number-1 {
+			table.Partitions = append(table.Partitions, &Partition{Type: Unused})
+		}
+		table.Partitions = append(table.Partitions, p)
+	}
+	return table, nil
+}
+
+// partitionFromScript create a partition from the fields of an sfdisk script line
+func partitionFromScript(sp part.ScriptPartition, logicalSectorSize int) (*Partition, error) {
+	p := &Partition{}
+	var size uint64
+	for _, f := range sp.Fields {
+		var err error
+		switch f.Name {
+		case "start":
+			p.Start, err = strconv.ParseUint(f.Value, 10, 64)
+		case "size":
+			size, err = strconv.ParseUint(f.Value, 10, 64)
+		case "type":
+			var guid uuid.UUID
+			if guid, err = uuid.Parse(f.Value); err == nil {
+				p.Type = Type(strings.ToUpper(guid.String()))
+			}
+		case "uuid":
+			var guid uuid.UUID
+			if guid, err = uuid.Parse(f.Value); err == nil {
+				p.GUID = strings.ToUpper(guid.String())
+			}
+		case "name":
+			p.Name = f.Value
+		case "attrs":
+			p.Attributes, err = ParseAttributes(f.Value)
+		default:
+			err = fmt.Errorf("unsupported field")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s=%s: %v", f.Name, f.Value, err)
+		}
+	}
+	// sfdisk defaults to a Linux filesystem too
+	if p.Type == "" {
+		p.Type = LinuxFilesystem
+	}
+	if size > 0 {
+		p.Size = size * uint64(logicalSectorSize)
+		if p.Start != 0 {
+			p.End = p.Start + size - 1
+		}
+	}
+	return p, nil
+}
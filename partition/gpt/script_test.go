@@ -0,0 +1,135 @@
+package gpt_test
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/diskfs/go-diskfs/partition/gpt"
+)
+
+const gptScript = `label: gpt
+label-id: 43E51892-3273-42F7-BCDA-B43B80CDFC48
+unit: sectors
+first-lba: 34
+sector-size: 512
+
+1 : start=        2048, size=        2048, type=C12A7328-F81F-11D2-BA4B-00A0C93EC93B, uuid=5CA3360B-5DE6-4FCF-B4CE-419CEE433B51, name="EFI \x22System\x22", attrs="LegacyBIOSBootable"
+3 : start=        4096, size=        2048, type=0FC63DAF-8483-4772-8E79-3D69D8477DE4, uuid=74335E03-835D-4E1A-9542-B4D8D23AC001
+`
+
+func TestDump(t *testing.T) {
+	table := &Table{
+		LogicalSectorSize: 512,
+		GUID:              "43e51892-3273-42f7-bcda-b43b80cdfc48",
+		Partitions: []*Partition{
+			{Start: 2048, End: 4095, Type: EFISystemPartition, GUID: "5CA3360B-5DE6-4FCF-B4CE-419CEE433B51", Name: `EFI "System"`, Attributes: AttributeLegacyBIOSBootable},
+			{Type: Unused},
+			{Start: 4096, Size: 1024 * 1024, Type: LinuxFilesystem, GUID: "74335e03-835d-4e1a-9542-b4d8d23ac001"},
+		},
+	}
+	var b bytes.Buffer
+	if err := table.Dump(&b); err != nil {
+		t.Fatalf("unexpected error dumping table: %v", err)
+	}
+	if b.String() != gptScript {
+		t.Errorf("dumped\n%s\ninstead of\n%s", b.String(), gptScript)
+	}
+}
+
+func TestParseScript(t *testing.T) {
+	t.Run("sfdisk", func(t *testing.T) {
+		// as written by sfdisk --dump
+		script := `label: gpt
+label-id: 43E51892-3273-42F7-BCDA-B43B80CDFC48
+device: /dev/sda
+unit: sectors
+first-lba: 34
+last-lba: 20446
+sector-size: 512
+
+/dev/sda1 : start=        2048, size=        2048, type=C12A7328-F81F-11D2-BA4B-00A0C93EC93B, uuid=5CA3360B-5DE6-4FCF-B4CE-419CEE433B51, name="EFI System", attrs="RequiredPartition GUID:63"
+/dev/sda3 : start=        4096, size=       16351, type=0FC63DAF-8483-4772-8E79-3D69D8477DE4, name="root"
+`
+		table, err := ParseScript(strings.NewReader(script))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if table.GUID != "43E51892-3273-42F7-BCDA-B43B80CDFC48" || table.LogicalSectorSize != 512 || !table.ProtectiveMBR {
+			t.Errorf("parsed table %+v", table)
+		}
+		if len(table.Partitions) != 3 || table.Partitions[1].Type != Unused {
+			t.Fatalf("parsed %d partitions, instead of 2 around an unused entry", len(table.Partitions))
+		}
+		p := table.Partitions[0]
+		if p.Start != 2048 || p.End != 4095 || p.Size != 2048*512 || p.Type != EFISystemPartition || p.Name != "EFI System" ||
+			p.GUID != "5CA3360B-5DE6-4FCF-B4CE-419CEE433B51" || !p.Required() || !p.NoAuto() {
+			t.Errorf("parsed partition 1 as %s", p)
+		}
+		if p := table.Partitions[2]; p.Start != 4096 || p.End != 20446 || p.Name != "root" || p.GUID != "" {
+			t.Errorf("parsed partition 3 as %s", p)
+		}
+	})
+	t.Run("round trip", func(t *testing.T) {
+		table, err := ParseScript(strings.NewReader(gptScript))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		f, err := tmpDisk("", tenMB)
+		if err != nil {
+			t.Fatalf("error creating new temporary disk: %v", err)
+		}
+		defer os.Remove(f.Name())
+		defer f.Close()
+		if err := table.Write(f, tenMB); err != nil {
+			t.Fatalf("unexpected error writing table: %v", err)
+		}
+		read, err := Read(f, 512, 512)
+		if err != nil {
+			t.Fatalf("unexpected error reading table: %v", err)
+		}
+		var b bytes.Buffer
+		if err := read.Dump(&b); err != nil {
+			t.Fatalf("unexpected error dumping table: %v", err)
+		}
+		// the disk adds the last usable sector
+		expected := strings.Replace(gptScript, "first-lba: 34\n", "first-lba: 34\nlast-lba: 20446\n", 1)
+		if b.String() != expected {
+			t.Errorf("dumped\n%s\ninstead of\n%s", b.String(), expected)
+		}
+	})
+	t.Run("new partitions", func(t *testing.T) {
+		table, err := ParseScript(strings.NewReader("label: gpt\nsize=2048\nsize=4096, type=EBD0A0A2-B9E5-4433-87C0-68B6B72699C7\n"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(table.Partitions) != 2 || table.Partitions[0].Type != LinuxFilesystem || table.Partitions[0].Size != 2048*512 ||
+			table.Partitions[1].Type != MicrosoftBasicData || table.Partitions[1].Start != 0 {
+			t.Errorf("parsed partitions %s and %s", table.Partitions[0], table.Partitions[1])
+		}
+	})
+	t.Run("invalid", func(t *testing.T) {
+		tests := []struct {
+			script string
+			err    string
+		}{
+			{"label: dos\n", `script has label "dos" instead of "gpt"`},
+			{"label: gpt\nunit: cylinders\n", `invalid header unit: cylinders: unsupported unit "cylinders"`},
+			{"label: gpt\nsector-size: 1024\n", "invalid header sector-size: 1024: must be 512 or 4096"},
+			{"label: gpt\nfoo: bar\n", "invalid header foo: bar: unknown header"},
+			{"label: gpt\n2 : start=2048\n1 : start=4096\n", "partition 1 is out of order or given twice"},
+			{"label: gpt\nstart=2048, type=83\n", "partition 1: invalid type=83"},
+			{"label: gpt\nstart=2048, bootable\n", "partition 1: invalid bootable=: unsupported field"},
+			{"label: gpt\nstart=2048, name=\"EFI\n", "line 2: field name: missing closing quote"},
+			{"label: gpt\nsda : start=2048\n", `line 2: device "sda" does not end in a partition number`},
+			{"label: gpt\nstart=2048\nunit: sectors\n", `line 3: header "unit: sectors" after the partitions`},
+		}
+		for _, tt := range tests {
+			_, err := ParseScript(strings.NewReader(tt.script))
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+				t.Errorf("%q returned error %v instead of %s", tt.script, err, tt.err)
+			}
+		}
+	})
+}
@@ -3,8 +3,10 @@ package gpt
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"hash/crc32"
+	"io"
 	"strings"
 
 	"github.com/diskfs/go-diskfs/partition/part"
@@ -17,6 +19,10 @@ const (
 	mbrPartitionEntriesStart = 446
 	mbrPartitionEntriesCount = 4
 	mbrpartitionEntrySize    = 16
+	mbrSignatureStart        = 510
+	mbrBootCodeSize          = 440
+	// defaultPartitionArraySize number of entries in the partition array, unless set otherwise
+	defaultPartitionArraySize = 128
 	// just defaults
 	physicalSectorSize = 512
 	logicalSectorSize  = 512
@@ -24,20 +30,28 @@ const (
 
 // Table represents a partition table to be applied to a disk or read from a disk
 type Table struct {
-	Partitions             []*Partition // slice of Partition
-	LogicalSectorSize      int          // logical size of a sector
-	PhysicalSectorSize     int          // physical size of the sector
-	GUID                   string       // disk GUID, can be left blank to auto-generate
-	ProtectiveMBR          bool         // whether or not a protective MBR is in place
-	partitionArraySize     int          // how many entries are in the partition array size
-	partitionEntrySize     uint32       // size of the partition entry in the table, usually 128 bytes
-	partitionFirstLBA      uint64       // first LBA of the partition array
-	partitionEntryChecksum uint32       // checksum of the partition array
-	primaryHeader          uint64       // LBA of primary header, always 1
-	secondaryHeader        uint64       // LBA of secondary header, always last sectors on disk
-	firstDataSector        uint64       // LBA of first data sector
-	lastDataSector         uint64       // LBA of last data sector
+	Partitions         []*Partition // slice of Partition
+	LogicalSectorSize  int          // logical size of a sector
+	PhysicalSectorSize int          // physical size of the sector
+	GUID               string       // disk GUID, can be left blank to auto-generate
+	ProtectiveMBR      bool         // whether or not a protective MBR is in place
+	// HybridMBR GPT partitions to mirror as real MBR entries next to the protective one, at most three, for
+	// firmware that needs a hybrid MBR. When set, a hybrid MBR is written instead of the protective MBR.
+	HybridMBR []HybridMBREntry
+	// BootCode bootstrap code for the start of the protective or hybrid MBR, at most 440 bytes, e.g. GRUB
+	// boot.img for BIOS boot from a GPT disk. If nil, any boot code already on the disk is kept; an empty,
+	// non-nil slice zeroes it.
+	BootCode               []byte
+	partitionArraySize     int    // how many entries are in the partition array size
+	partitionEntrySize     uint32 // size of the partition entry in the table, usually 128 bytes
+	partitionFirstLBA      uint64 // first LBA of the partition array
+	partitionEntryChecksum uint32 // checksum of the partition array
+	primaryHeader          uint64 // LBA of primary header, always 1
+	secondaryHeader        uint64 // LBA of secondary header, always last sectors on disk
+	firstDataSector        uint64 // LBA of first data sector
+	lastDataSector         uint64 // LBA of last data sector
 	initialized            bool
+	health                 Health // state of the primary and secondary copies when read from disk
 }
 
 func getEfiSignature() []byte {
@@ -87,7 +101,7 @@ func (t *Table) initTable(size int64) {
 		t.GUID = guid.String()
 	}
 	if t.partitionArraySize == 0 {
-		t.partitionArraySize = 128
+		t.partitionArraySize = defaultPartitionArraySize
 	}
 	if t.partitionEntrySize == 0 {
 		t.partitionEntrySize = 128
@@ -105,13 +119,42 @@ func (t *Table) initTable(size int64) {
 	if t.secondaryHeader == 0 {
 		t.secondaryHeader = diskSectors - 1
 	}
+	// the last usable sector is just before the secondary partition array
 	if t.lastDataSector == 0 {
-		t.lastDataSector = diskSectors - 1 - partSectors
+		t.lastDataSector = diskSectors - 2 - partSectors
 	}
 
 	t.initialized = true
 }
 
+// Resize updates the table for a disk that has grown or shrunk to size bytes, e.g. after enlarging a
+// disk image: the secondary GPT header and partition array move to the new end of the disk, and the
+// last usable sector follows them. Partitions are not changed. Returns an error, without changing
+// anything, if a partition would end beyond the new last usable sector.
+//
+// Only the Table is changed; Write it to the disk to move the secondary GPT.
+func (t *Table) Resize(size int64) error {
+	// a new table gets its layout from the size of the disk when it is written
+	if !t.initialized {
+		return nil
+	}
+	diskSectors := uint64(size) / uint64(t.LogicalSectorSize)
+	partSectors := uint64(t.partitionArraySize) * uint64(t.partitionEntrySize) / uint64(t.LogicalSectorSize)
+	if size <= 0 || diskSectors < t.firstDataSector+partSectors+2 {
+		return fmt.Errorf("disk of %d bytes is too small for a GPT with first usable sector %d", size, t.firstDataSector)
+	}
+	// the last usable sector is just before the secondary partition array
+	lastDataSector := diskSectors - 2 - partSectors
+	for i, p := range t.Partitions {
+		if p.Type != Unused && p.End > lastDataSector {
+			return fmt.Errorf("partition %d ends at sector %d, beyond the last usable sector %d", i+1, p.End, lastDataSector)
+		}
+	}
+	t.secondaryHeader = diskSectors - 1
+	t.lastDataSector = lastDataSector
+	return nil
+}
+
 // Equal check if another table is functionally equal to this one
 func (t *Table) Equal(t2 *Table) bool {
 	if t2 == nil {
@@ -127,6 +170,7 @@ func (t *Table) Equal(t2 *Table) bool {
 		t.lastDataSector == t2.lastDataSector &&
 		t.partitionArraySize == t2.partitionArraySize &&
 		t.ProtectiveMBR == t2.ProtectiveMBR &&
+		compareHybridMBR(t.HybridMBR, t2.HybridMBR) &&
 		t.GUID == t2.GUID
 	partMatch := comparePartitionArray(t.Partitions, t2.Partitions)
 	return basicMatch && partMatch
@@ -193,6 +237,14 @@ func readProtectiveMBR(b []byte, sectors uint32) bool {
 	return true
 }
 
+// readBootCode get the boot code from the MBR in a byte slice, or nil if there is none
+func readBootCode(b []byte) []byte {
+	if len(b) < mbrBootCodeSize || zeroMatch(b[:mbrBootCodeSize]) {
+		return nil
+	}
+	return append([]byte{}, b[:mbrBootCodeSize]...)
+}
+
 // partitionArraySector get the sector that holds the primary or secondary partition array
 func (t *Table) partitionArraySector(primary bool) uint64 {
 	if primary {
@@ -204,7 +256,7 @@ func (t *Table) partitionArraySector(primary bool) uint64 {
 func (t *Table) generateProtectiveMBR() []byte {
 	b := make([]byte, 512)
 	// we don't do anything to the first 446 bytes
-	copy(b[510:], getMbrSignature())
+	copy(b[mbrSignatureStart:], getMbrSignature())
 	// create the single all disk partition
 	parts := b[mbrPartitionEntriesStart : mbrPartitionEntriesStart+mbrpartitionEntrySize]
 	// non-bootable
@@ -352,7 +404,18 @@ func tableFromBytes(b []byte, logicalBlockSize, physicalBlockSize int) (*Table,
 	}
 
 	// GPT starts at LBA1
-	gpt := b[logicalBlockSize:]
+	table, err := headerFromBytes(b[logicalBlockSize:], logicalBlockSize, physicalBlockSize)
+	if err != nil {
+		return nil, err
+	}
+	// potential protective MBR is at LBA0
+	table.ProtectiveMBR = readProtectiveMBR(b[:logicalBlockSize], uint32(table.secondaryHeader))
+	return table, nil
+}
+
+// headerFromBytes read a GPT header, primary or secondary, from a byte slice. The primaryHeader of
+// the returned table is the LBA of the header itself, and secondaryHeader the LBA of the other copy.
+func headerFromBytes(gpt []byte, logicalBlockSize, physicalBlockSize int) (*Table, error) {
 	// start with fixed headers
 	efiSignature := gpt[0:8]
 	efiRevision := gpt[8:12]
@@ -393,9 +456,6 @@ func tableFromBytes(b []byte, logicalBlockSize, physicalBlockSize int) (*Table,
 		return nil, fmt.Errorf("invalid EFI Header Checksum, expected %v, got %v", checksum, efiHeaderCrc)
 	}
 
-	// potential protective MBR is at LBA0
-	hasProtectiveMBR := readProtectiveMBR(b[:logicalBlockSize], uint32(secondaryHeader))
-
 	table := Table{
 		LogicalSectorSize:      logicalBlockSize,
 		PhysicalSectorSize:     physicalBlockSize,
@@ -406,7 +466,6 @@ func tableFromBytes(b []byte, logicalBlockSize, physicalBlockSize int) (*Table,
 		lastDataSector:         lastDataSector,
 		partitionArraySize:     int(partitionEntryCount),
 		partitionFirstLBA:      partitionEntryFirstLBA,
-		ProtectiveMBR:          hasProtectiveMBR,
 		GUID:                   strings.ToUpper(diskGUID.String()),
 		partitionEntryChecksum: partitionEntryChecksum,
 		initialized:            true,
@@ -433,70 +492,98 @@ func (t *Table) Write(f util.File, size int64) error {
 	// write the primary partition array
 	// write the secondary partition array
 	// write the secondary GPT header
-	var written int
-	var err error
-	if t.ProtectiveMBR {
-		fullMBR := t.generateProtectiveMBR()
-		protectiveMBR := fullMBR[mbrPartitionEntriesStart:]
-		written, err = f.WriteAt(protectiveMBR, mbrPartitionEntriesStart)
+	if t.ProtectiveMBR || len(t.HybridMBR) > 0 {
+		if err := t.writeProtectiveMBR(f); err != nil {
+			return err
+		}
+	}
+
+	if err := t.writeCopy(f, true); err != nil {
+		return err
+	}
+	if err := t.writeCopy(f, false); err != nil {
+		return err
+	}
+	t.health = Health{}
+	return nil
+}
+
+// writeProtectiveMBR writes the partition entries and signature of the protective or hybrid MBR, and the boot code
+// if there is any, otherwise leaving the boot code on disk in place
+func (t *Table) writeProtectiveMBR(f util.File) error {
+	fullMBR := t.generateProtectiveMBR()
+	if len(t.HybridMBR) > 0 {
+		var err error
+		fullMBR, err = t.generateHybridMBR()
 		if err != nil {
-			return fmt.Errorf("error writing protective MBR to disk: %v", err)
+			return fmt.Errorf("invalid hybrid MBR: %v", err)
 		}
-		if written != len(protectiveMBR) {
-			return fmt.Errorf("wrote %d bytes of protective MBR instead of %d", written, len(protectiveMBR))
+	}
+	if len(t.BootCode) > mbrBootCodeSize {
+		return fmt.Errorf("boot code is %d bytes, more than the maximum %d", len(t.BootCode), mbrBootCodeSize)
+	}
+	if t.BootCode != nil {
+		bootCode := make([]byte, mbrBootCodeSize)
+		copy(bootCode, t.BootCode)
+		written, err := f.WriteAt(bootCode, 0)
+		if err != nil {
+			return fmt.Errorf("error writing boot code to disk: %v", err)
+		}
+		if written != len(bootCode) {
+			return fmt.Errorf("wrote %d bytes of boot code instead of %d", written, len(bootCode))
 		}
 	}
-
-	primaryHeader, err := t.toGPTBytes(true)
+	protectiveMBR := fullMBR[mbrPartitionEntriesStart:]
+	written, err := f.WriteAt(protectiveMBR, mbrPartitionEntriesStart)
 	if err != nil {
-		return fmt.Errorf("error converting primary GPT header to byte array: %v", err)
+		return fmt.Errorf("error writing protective MBR to disk: %v", err)
 	}
-	written, err = f.WriteAt(primaryHeader, int64(t.LogicalSectorSize))
-	if err != nil {
-		return fmt.Errorf("error writing primary GPT to disk: %v", err)
+	if written != len(protectiveMBR) {
+		return fmt.Errorf("wrote %d bytes of protective MBR instead of %d", written, len(protectiveMBR))
 	}
-	if written != len(primaryHeader) {
-		return fmt.Errorf("wrote %d bytes of primary GPT header instead of %d", written, len(primaryHeader))
+	return nil
+}
+
+// writeCopy writes the primary or the secondary GPT header and its partition array to disk.
+// The partition array is written first, so the header never points to an array not yet written.
+func (t *Table) writeCopy(f util.File, primary bool) error {
+	which, headerSector := "primary", t.primaryHeader
+	if !primary {
+		which, headerSector = "secondary", t.secondaryHeader
 	}
 
 	partitionArray, err := t.toPartitionArrayBytes()
 	if err != nil {
-		return fmt.Errorf("error converting primary GPT partitions to byte array: %v", err)
-	}
-	written, err = f.WriteAt(partitionArray, int64(t.LogicalSectorSize*int(t.partitionArraySector(true))))
-	if err != nil {
-		return fmt.Errorf("error writing primary partition arrayto disk: %v", err)
-	}
-	if written != len(partitionArray) {
-		return fmt.Errorf("wrote %d bytes of primary partition array instead of %d", written, len(primaryHeader))
+		return fmt.Errorf("error converting %s GPT partitions to byte array: %v", which, err)
 	}
-
-	written, err = f.WriteAt(partitionArray, int64(t.LogicalSectorSize)*int64(t.partitionArraySector(false)))
+	written, err := f.WriteAt(partitionArray, int64(t.LogicalSectorSize)*int64(t.partitionArraySector(primary)))
 	if err != nil {
-		return fmt.Errorf("error writing secondary partition array to disk: %v", err)
+		return fmt.Errorf("error writing %s partition array to disk: %v", which, err)
 	}
 	if written != len(partitionArray) {
-		return fmt.Errorf("wrote %d bytes of secondary partition array instead of %d", written, len(primaryHeader))
+		return fmt.Errorf("wrote %d bytes of %s partition array instead of %d", written, which, len(partitionArray))
 	}
 
-	secondaryHeader, err := t.toGPTBytes(false)
+	header, err := t.toGPTBytes(primary)
 	if err != nil {
-		return fmt.Errorf("error converting secondary GPT header to byte array: %v", err)
+		return fmt.Errorf("error converting %s GPT header to byte array: %v", which, err)
 	}
-	written, err = f.WriteAt(secondaryHeader, int64(t.secondaryHeader)*int64(t.LogicalSectorSize))
+	written, err = f.WriteAt(header, int64(headerSector)*int64(t.LogicalSectorSize))
 	if err != nil {
-		return fmt.Errorf("error writing secondary GPT to disk: %v", err)
+		return fmt.Errorf("error writing %s GPT to disk: %v", which, err)
 	}
-	if written != len(secondaryHeader) {
-		return fmt.Errorf("wrote %d bytes of secondary GPT header instead of %d", written, len(secondaryHeader))
+	if written != len(header) {
+		return fmt.Errorf("wrote %d bytes of %s GPT header instead of %d", written, which, len(header))
 	}
-
 	return nil
 }
 
 // Read read a partition table from a disk
 // must be passed the util.File from which to read, and the logical and physical block sizes
 //
+// If the primary GPT header or its partition array is damaged, the secondary copy at the end of the disk
+// is used instead. Health reports which copy was used, and whether the two copies disagree.
+//
 // if successful, returns a gpt.Table struct
 // returns errors if fails at any stage reading the disk or processing the bytes on disk as a GPT
 func Read(f util.File, logicalBlockSize, physicalBlockSize int) (*Table, error) {
@@ -509,33 +596,93 @@ func Read(f util.File, logicalBlockSize, physicalBlockSize int) (*Table, error)
 	if read != len(b) {
 		return nil, fmt.Errorf("read only %d bytes of GPT from file instead of expected %d", read, len(b))
 	}
-	// get the gpt table
-	gptTable, err := tableFromBytes(b, logicalBlockSize, physicalBlockSize)
+	// get the primary gpt table, and the secondary one from the end of the disk
+	primary, primaryErr := tableFromBytes(b, logicalBlockSize, physicalBlockSize)
+	if primaryErr != nil {
+		primaryErr = fmt.Errorf("error reading GPT table: %w", primaryErr)
+	} else if primaryErr = primary.readPartitionArray(f); primaryErr == nil {
+		primary.readHybridMBR(b[:logicalBlockSize])
+	}
+	var secondaryHeader uint64
+	if primary != nil {
+		secondaryHeader = primary.secondaryHeader
+	} else if size, err := f.Seek(0, io.SeekEnd); err == nil && size >= int64(logicalBlockSize)*2 {
+		secondaryHeader = uint64(size/int64(logicalBlockSize)) - 1
+	}
+	backup, backupErr := readSecondary(f, secondaryHeader, logicalBlockSize, physicalBlockSize)
+	if backupErr == nil {
+		backup.ProtectiveMBR = readProtectiveMBR(b[:logicalBlockSize], uint32(backup.secondaryHeader))
+		backup.readHybridMBR(b[:logicalBlockSize])
+	}
+
+	switch {
+	case primaryErr == nil:
+		primary.BootCode = readBootCode(b[:logicalBlockSize])
+		primary.health = Health{
+			SecondaryErr: backupErr,
+			Mismatch:     backupErr == nil && !primary.Equal(backup),
+		}
+		return primary, nil
+	case backupErr == nil:
+		backup.BootCode = readBootCode(b[:logicalBlockSize])
+		backup.health = Health{PrimaryErr: primaryErr, UsedSecondary: true}
+		return backup, nil
+	default:
+		return nil, primaryErr
+	}
+}
+
+// readSecondary read the secondary GPT header at the given LBA, and its partition array
+func readSecondary(f util.File, lba uint64, logicalBlockSize, physicalBlockSize int) (*Table, error) {
+	if lba == 0 {
+		return nil, errors.New("unable to find secondary GPT header, the size of the disk is unknown")
+	}
+	b := make([]byte, logicalBlockSize)
+	read, err := f.ReadAt(b, int64(lba)*int64(logicalBlockSize))
 	if err != nil {
-		return nil, fmt.Errorf("error reading GPT table: %w", err)
+		return nil, fmt.Errorf("error reading secondary GPT from file: %w", err)
 	}
-	start, size := gptTable.calculatePartitionArrayLocations()
-	b = make([]byte, size)
-	read, err = f.ReadAt(b, int64(start))
 	if read != len(b) {
-		return nil, fmt.Errorf("read only %d bytes of GPT from file instead of expected %d", read, len(b))
+		return nil, fmt.Errorf("read only %d bytes of secondary GPT from file instead of expected %d", read, len(b))
 	}
+	table, err := headerFromBytes(b, logicalBlockSize, physicalBlockSize)
 	if err != nil {
-		return nil, fmt.Errorf("error reading partitions from file: %w", err)
+		return nil, fmt.Errorf("error reading secondary GPT table: %w", err)
+	}
+	// the secondary header describes itself first, and then the primary
+	table.primaryHeader, table.secondaryHeader = table.secondaryHeader, table.primaryHeader
+	if table.secondaryHeader != lba {
+		return nil, fmt.Errorf("secondary GPT header at sector %d claims to be at sector %d", lba, table.secondaryHeader)
+	}
+	if err := table.readPartitionArray(f); err != nil {
+		return nil, err
+	}
+	return table, nil
+}
+
+// readPartitionArray read the partition array that the header points to, and validate its checksum
+func (t *Table) readPartitionArray(f util.File) error {
+	start, size := t.calculatePartitionArrayLocations()
+	b := make([]byte, size)
+	read, err := f.ReadAt(b, int64(start))
+	if read != len(b) {
+		return fmt.Errorf("read only %d bytes of GPT from file instead of expected %d", read, len(b))
+	}
+	if err != nil {
+		return fmt.Errorf("error reading partitions from file: %w", err)
 	}
 	// we need a CRC/zlib of the partition entries, so we do those first, then append the bytes
 	checksum := crc32.ChecksumIEEE(b)
-	if gptTable.partitionEntryChecksum != checksum {
-		return nil, fmt.Errorf("invalid EFI Partition Entry Checksum, expected %v, got %v", checksum, gptTable.partitionEntryChecksum)
+	if t.partitionEntryChecksum != checksum {
+		return fmt.Errorf("invalid EFI Partition Entry Checksum, expected %v, got %v", checksum, t.partitionEntryChecksum)
 	}
 
-	parts, err := readPartitionArrayBytes(b, int(gptTable.partitionEntrySize), logicalBlockSize, physicalBlockSize)
+	parts, err := readPartitionArrayBytes(b, int(t.partitionEntrySize), t.LogicalSectorSize, t.PhysicalSectorSize)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing partition data: %w", err)
+		return fmt.Errorf("error parsing partition data: %w", err)
 	}
-	gptTable.Partitions = parts
-	// get the partition table
-	return gptTable, nil
+	t.Partitions = parts
+	return nil
 }
 
 // GetPartitions get the partitions
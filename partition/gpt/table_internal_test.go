@@ -207,8 +207,9 @@ func TestRead(t *testing.T) {
 		if err != nil {
 			t.Fatalf("unable to read test fixture file %s: %v", gptFile, err)
 		}
-		// change a single byte in a partition entry
+		// change a single byte in a partition entry, in both the primary and the secondary array
 		b[512+512+400]++
+		b[20447*512+400]++
 		buf := &byteBufferReader{b: b}
 		table, err := Read(buf, 512, 512)
 		if table != nil {
@@ -241,3 +242,123 @@ func TestRead(t *testing.T) {
 		}
 	})
 }
+
+func TestReadRecovery(t *testing.T) {
+	const (
+		size           = 20480 * 512
+		secondaryArray = 20447 * 512
+	)
+	newDisk := func(t *testing.T) *byteBufferReader {
+		buf := &byteBufferReader{b: make([]byte, size)}
+		if err := GetValidTable().Write(buf, size); err != nil {
+			t.Fatalf("error writing table: %v", err)
+		}
+		return buf
+	}
+	tests := []struct {
+		name          string
+		corrupt       func(b []byte)
+		usedSecondary bool
+		mismatch      bool
+		noMBR         bool
+	}{
+		{"healthy", func(b []byte) {}, false, false, false},
+		{"primary header", func(b []byte) { b[512+40]++ }, true, false, false},
+		{"primary array", func(b []byte) { b[1024+400]++ }, true, false, false},
+		{"primary zeroed", func(b []byte) { copy(b[:34*512], make([]byte, 34*512)) }, true, false, true},
+		{"secondary header", func(b []byte) { b[size-512+40]++ }, false, false, false},
+		{"secondary array", func(b []byte) { b[secondaryArray+400]++ }, false, false, false},
+		{"mismatch", func(b []byte) {
+			table := GetValidTable()
+			table.Partitions[0].Name = "Other"
+			table.initTable(size)
+			if err := table.writeCopy(&byteBufferReader{b: b}, false); err != nil {
+				t.Fatalf("error writing secondary copy: %v", err)
+			}
+		}, false, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := newDisk(t)
+			tt.corrupt(buf.b)
+			table, err := Read(buf, 512, 512)
+			if err != nil {
+				t.Fatalf("unexpected error reading table: %v", err)
+			}
+			expected := GetValidTable()
+			expected.ProtectiveMBR = !tt.noMBR
+			if !table.Equal(expected) {
+				t.Errorf("mismatched\nactual: %#v\nexpected %#v", table, expected)
+			}
+			h := table.Health()
+			if h.UsedSecondary != tt.usedSecondary || (h.PrimaryErr != nil) != tt.usedSecondary {
+				t.Errorf("unexpected primary health %+v", h)
+			}
+			if h.Mismatch != tt.mismatch {
+				t.Errorf("mismatch %v instead of %v", h.Mismatch, tt.mismatch)
+			}
+			if err := table.Repair(buf); err != nil {
+				t.Fatalf("unexpected error repairing table: %v", err)
+			}
+			repaired, err := Read(buf, 512, 512)
+			if err != nil {
+				t.Fatalf("unexpected error reading repaired table: %v", err)
+			}
+			if !repaired.Health().OK() {
+				t.Errorf("repaired table is not healthy: %+v", repaired.Health())
+			}
+			// a protective MBR is restored along with the primary GPT
+			expected.ProtectiveMBR = true
+			if !repaired.Equal(expected) {
+				t.Errorf("mismatched repaired\nactual: %#v\nexpected %#v", repaired, expected)
+			}
+		})
+	}
+	t.Run("both copies damaged", func(t *testing.T) {
+		buf := newDisk(t)
+		buf.b[1024+400]++
+		buf.b[secondaryArray+400]++
+		if _, err := Read(buf, 512, 512); err == nil {
+			t.Errorf("returned nil error for a table with both copies damaged")
+		}
+	})
+}
+
+func TestTableResize(t *testing.T) {
+	const size = 20480 * 512
+	buf := &byteBufferReader{b: make([]byte, size)}
+	if err := GetValidTable().Write(buf, size); err != nil {
+		t.Fatalf("error writing table: %v", err)
+	}
+	table, err := Read(buf, 512, 512)
+	if err != nil {
+		t.Fatalf("error reading table: %v", err)
+	}
+
+	// the only partition ends at sector 3048
+	if err := table.Resize(3080 * 512); err == nil {
+		t.Errorf("resizing into the last partition did not return an error")
+	}
+	if table.secondaryHeader != 20479 || table.lastDataSector != 20446 {
+		t.Errorf("failed resize changed the table, secondary header %d last data sector %d", table.secondaryHeader, table.lastDataSector)
+	}
+
+	if err := table.Resize(2 * size); err != nil {
+		t.Fatalf("unexpected error resizing table: %v", err)
+	}
+	if table.secondaryHeader != 40959 || table.lastDataSector != 40926 {
+		t.Errorf("resized table has secondary header %d last data sector %d instead of %d and %d", table.secondaryHeader, table.lastDataSector, 40959, 40926)
+	}
+	grown := &byteBufferReader{b: make([]byte, 2*size)}
+	copy(grown.b, buf.b)
+	if err := table.Write(grown, 2*size); err != nil {
+		t.Fatalf("error writing resized table: %v", err)
+	}
+	read, err := Read(grown, 512, 512)
+	if err != nil {
+		t.Fatalf("error reading resized table: %v", err)
+	}
+	if !read.Health().OK() || !read.Equal(table) {
+		t.Errorf("mismatched resized table, health %+v\nactual: %#v\nexpected %#v", read.Health(), read, table)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"crypto/rand"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
@@ -14,6 +15,7 @@ import (
 	"testing"
 
 	. "github.com/diskfs/go-diskfs/partition/gpt"
+	"github.com/diskfs/go-diskfs/partition/mbr"
 	"github.com/diskfs/go-diskfs/testhelper"
 )
 
@@ -356,6 +358,169 @@ func TestTableWrite(t *testing.T) {
 		}
 	})
 }
+func TestHybridMBR(t *testing.T) {
+	newTable := func() *Table {
+		return &Table{
+			LogicalSectorSize:  512,
+			PhysicalSectorSize: 512,
+			ProtectiveMBR:      true,
+			Partitions: []*Partition{
+				{Start: 2048, End: 4095, Type: EFISystemPartition, Name: "EFI"},
+				{Start: 4096, End: 8191, Type: MicrosoftBasicData, Name: "data"},
+				{Start: 8192, End: 16383, Type: LinuxFilesystem, Name: "root"},
+			},
+			HybridMBR: []HybridMBREntry{
+				{Partition: 2, Type: mbr.Fat32LBA, Bootable: true},
+				{Partition: 3, Type: mbr.Linux},
+			},
+		}
+	}
+	t.Run("write and read", func(t *testing.T) {
+		f, err := tmpDisk("", tenMB)
+		if err != nil {
+			t.Fatalf("error creating new temporary disk: %v", err)
+		}
+		defer f.Close()
+		defer os.Remove(f.Name())
+
+		table := newTable()
+		if err := table.Write(f, tenMB); err != nil {
+			t.Fatalf("unexpected error writing table: %v", err)
+		}
+		b := make([]byte, 512)
+		if _, err := f.ReadAt(b, 0); err != nil {
+			t.Fatalf("error reading MBR: %v", err)
+		}
+		expected := [][4]uint32{
+			// type, active, start, size
+			{0xee, 0, 1, 4095},
+			{0x0c, 0x80, 4096, 4096},
+			{0x83, 0, 8192, 8192},
+			{0, 0, 0, 0},
+		}
+		for i, e := range expected {
+			entry := b[446+i*16 : 446+(i+1)*16]
+			actual := [4]uint32{uint32(entry[4]), uint32(entry[0]), binary.LittleEndian.Uint32(entry[8:12]), binary.LittleEndian.Uint32(entry[12:16])}
+			if actual != e {
+				t.Errorf("MBR entry %d is %v instead of %v", i+1, actual, e)
+			}
+		}
+		// CHS start and end, as head, sector and cylinder bytes, with 255 heads and 63 sectors per track
+		expectedCHS := [][6]byte{
+			{0, 2, 0, 65, 1, 0},
+			{65, 2, 0, 130, 2, 0},
+			{130, 3, 0, 5, 4, 1},
+		}
+		for i, e := range expectedCHS {
+			entry := b[446+i*16 : 446+(i+1)*16]
+			actual := [6]byte{entry[1], entry[2], entry[3], entry[5], entry[6], entry[7]}
+			if actual != e {
+				t.Errorf("MBR entry %d has CHS %v instead of %v", i+1, actual, e)
+			}
+		}
+
+		read, err := Read(f, 512, 512)
+		if err != nil {
+			t.Fatalf("unexpected error reading table: %v", err)
+		}
+		if !read.ProtectiveMBR || len(read.HybridMBR) != 2 || read.HybridMBR[0] != table.HybridMBR[0] || read.HybridMBR[1] != table.HybridMBR[1] {
+			t.Errorf("read hybrid MBR %v instead of %v", read.HybridMBR, table.HybridMBR)
+		}
+		if !read.Health().OK() {
+			t.Errorf("table with hybrid MBR is not healthy: %+v", read.Health())
+		}
+
+		// back to a plain protective MBR
+		read.HybridMBR = nil
+		if err := read.Write(f, tenMB); err != nil {
+			t.Fatalf("unexpected error writing table: %v", err)
+		}
+		read, err = Read(f, 512, 512)
+		if err != nil {
+			t.Fatalf("unexpected error reading table: %v", err)
+		}
+		if !read.ProtectiveMBR || read.HybridMBR != nil {
+			t.Errorf("protective MBR read as hybrid %v", read.HybridMBR)
+		}
+	})
+	t.Run("invalid", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			hybrid []HybridMBREntry
+			err    string
+		}{
+			{"too many", []HybridMBREntry{{1, mbr.EFISystem, false}, {2, mbr.Fat32LBA, false}, {3, mbr.Linux, false}, {3, mbr.Linux, false}}, "at most 3"},
+			{"no such partition", []HybridMBREntry{{4, mbr.Linux, false}}, "does not exist"},
+			{"protective type", []HybridMBREntry{{1, mbr.GPTProtective, false}}, "invalid type"},
+			{"mirrored twice", []HybridMBREntry{{2, mbr.Fat32LBA, false}, {2, mbr.Linux, false}}, "already mirrored"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				table := newTable()
+				table.HybridMBR = tt.hybrid
+				f := &testhelper.FileImpl{
+					Writer: func(b []byte, offset int64) (int, error) {
+						t.Fatalf("wrote to disk at %d despite invalid hybrid MBR", offset)
+						return 0, nil
+					},
+				}
+				err := table.Write(f, tenMB)
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("returned error %v instead of expected %s", err, tt.err)
+				}
+			})
+		}
+	})
+}
+
+func TestBootCode(t *testing.T) {
+	f, err := tmpDisk("", tenMB)
+	if err != nil {
+		t.Fatalf("error creating new temporary disk: %v", err)
+	}
+	defer f.Close()
+	defer os.Remove(f.Name())
+
+	bootCode := bytes.Repeat([]byte{0xeb, 0x63, 0x90}, 100)
+	table := &Table{
+		LogicalSectorSize:  512,
+		PhysicalSectorSize: 512,
+		ProtectiveMBR:      true,
+		BootCode:           bootCode,
+		Partitions: []*Partition{
+			{Start: 2048, End: 4095, Type: BIOSBoot, Name: "BIOS boot"},
+		},
+	}
+	if err := table.Write(f, tenMB); err != nil {
+		t.Fatalf("unexpected error writing table: %v", err)
+	}
+	read, err := Read(f, 512, 512)
+	if err != nil {
+		t.Fatalf("unexpected error reading table: %v", err)
+	}
+	if len(read.BootCode) != 440 || !bytes.Equal(read.BootCode[:len(bootCode)], bootCode) {
+		t.Errorf("read boot code % x instead of % x", read.BootCode, bootCode)
+	}
+
+	// a table without boot code leaves the boot code on disk alone
+	read.BootCode = nil
+	if err := read.Write(f, tenMB); err != nil {
+		t.Fatalf("unexpected error writing table: %v", err)
+	}
+	read, err = Read(f, 512, 512)
+	if err != nil {
+		t.Fatalf("unexpected error reading table: %v", err)
+	}
+	if len(read.BootCode) != 440 || !bytes.Equal(read.BootCode[:len(bootCode)], bootCode) {
+		t.Errorf("boot code was not preserved, read % x", read.BootCode)
+	}
+
+	read.BootCode = make([]byte, 446)
+	if err := read.Write(f, tenMB); err == nil {
+		t.Errorf("writing 446 bytes of boot code did not return an error")
+	}
+}
+
 func TestGetPartitionSize(t *testing.T) {
 	table := GetValidTable()
 	request := 1
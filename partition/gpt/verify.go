@@ -0,0 +1,99 @@
+package gpt
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/diskfs/go-diskfs/partition/part"
+)
+
+// Verify check the table for problems that would make it invalid when written to a disk of diskSize bytes:
+// partitions that end before they start, lie inside the primary or secondary GPT or beyond the end of the
+// disk, overlap each other or share a GUID. It returns nothing if the table is valid.
+//
+// Partitions are checked as they would be written, i.e. an End or Start left blank is calculated first.
+// The table itself is not changed.
+func (t *Table) Verify(diskSize int64) []part.Problem {
+	var problems []part.Problem
+	addProblem := func(partition int, format string, a ...interface{}) {
+		problems = append(problems, part.Problem{Partition: partition, Description: fmt.Sprintf(format, a...)})
+	}
+
+	if diskSize <= 0 {
+		addProblem(0, "invalid disk size %d", diskSize)
+		return problems
+	}
+	// work on a copy, so that a new table keeps its layout from the size of the disk when it is written
+	c := *t
+	if !c.initialized {
+		c.initTable(diskSize)
+	}
+	diskSectors := uint64(diskSize) / uint64(c.LogicalSectorSize)
+	if c.secondaryHeader != diskSectors-1 {
+		addProblem(0, "secondary header at sector %d instead of the last sector %d of the disk", c.secondaryHeader, diskSectors-1)
+	}
+	if c.lastDataSector < c.firstDataSector || c.lastDataSector >= c.partitionArraySector(false) {
+		addProblem(0, "disk of %d bytes has no usable sectors, from %d to %d, outside of the GPT", diskSize, c.firstDataSector, c.lastDataSector)
+	}
+	if len(c.Partitions) > c.partitionArraySize {
+		addProblem(0, "%d partitions do not fit in a partition array of %d entries", len(c.Partitions), c.partitionArraySize)
+	}
+
+	type extent struct {
+		number     int
+		start, end uint64
+	}
+	var extents []extent
+	guids := map[string]int{}
+	if t.GUID != "" {
+		guids[strings.ToUpper(t.GUID)] = 0
+	}
+	nextstart := uint64(c.LogicalSectorSize)
+	for i, p := range c.Partitions {
+		number := i + 1
+		if p == nil {
+			addProblem(number, "partition is nil")
+			continue
+		}
+		if p.Type != Unused && p.End != 0 && p.End < p.Start {
+			addProblem(number, "ends at sector %d, before its start at sector %d", p.End, p.Start)
+			continue
+		}
+		// calculate blank values the same way as when writing the partition array
+		entry := *p
+		if err := entry.initEntry(uint64(c.LogicalSectorSize), nextstart); err != nil {
+			addProblem(number, "%v", err)
+			continue
+		}
+		nextstart = entry.End + 1
+		if entry.Type == Unused {
+			continue
+		}
+		if p.GUID != "" {
+			if other, ok := guids[entry.GUID]; ok {
+				if other == 0 {
+					addProblem(number, "has the same GUID %s as the disk", entry.GUID)
+				} else {
+					addProblem(number, "has the same GUID %s as partition %d", entry.GUID, other)
+				}
+			} else {
+				guids[entry.GUID] = number
+			}
+		}
+		switch {
+		case entry.Start < c.firstDataSector:
+			addProblem(number, "starts at sector %d, inside the primary GPT before the first usable sector %d", entry.Start, c.firstDataSector)
+		case entry.End >= diskSectors:
+			addProblem(number, "ends at sector %d, beyond the end of the disk at sector %d", entry.End, diskSectors-1)
+		case entry.End > c.lastDataSector:
+			addProblem(number, "ends at sector %d, inside the secondary GPT after the last usable sector %d", entry.End, c.lastDataSector)
+		}
+		for _, e := range extents {
+			if entry.Start <= e.end && e.start <= entry.End {
+				addProblem(number, "overlaps partition %d", e.number)
+			}
+		}
+		extents = append(extents, extent{number: number, start: entry.Start, end: entry.End})
+	}
+	return problems
+}
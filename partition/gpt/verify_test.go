@@ -0,0 +1,79 @@
+package gpt_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/diskfs/go-diskfs/partition/gpt"
+)
+
+func TestVerify(t *testing.T) {
+	newTable := func() *Table {
+		return &Table{
+			LogicalSectorSize:  512,
+			PhysicalSectorSize: 512,
+			ProtectiveMBR:      true,
+			Partitions: []*Partition{
+				{Start: 2048, End: 4095, Type: EFISystemPartition, GUID: "5CA3360B-5DE6-4FCF-B4CE-419CEE433B51"},
+				{Start: 4096, Size: 2048 * 512, Type: LinuxFilesystem},
+				{Type: Unused},
+				{Start: 8192, End: 20446, Type: LinuxFilesystem},
+			},
+		}
+	}
+	tests := []struct {
+		name     string
+		modify   func(*Table)
+		problems []string
+	}{
+		{"valid", func(*Table) {}, nil},
+		{"end before start", func(t *Table) { t.Partitions[0].End = 2000 }, []string{"partition 1: ends at sector 2000, before its start"}},
+		{"inside primary GPT", func(t *Table) { t.Partitions[0].Start = 20 }, []string{"partition 1: starts at sector 20, inside the primary GPT"}},
+		{"inside secondary GPT", func(t *Table) { t.Partitions[3].End = 20447 }, []string{"partition 4: ends at sector 20447, inside the secondary GPT"}},
+		{"beyond end of disk", func(t *Table) { t.Partitions[3].End = 30000 }, []string{"partition 4: ends at sector 30000, beyond the end of the disk"}},
+		{"overlapping", func(t *Table) { t.Partitions[3].Start = 5000 }, []string{"partition 4: overlaps partition 2"}},
+		{"duplicate GUID", func(t *Table) { t.Partitions[3].GUID = strings.ToLower(t.Partitions[0].GUID) }, []string{"partition 4: has the same GUID 5CA3360B-5DE6-4FCF-B4CE-419CEE433B51 as partition 1"}},
+		{"GUID of disk", func(t *Table) { t.GUID = t.Partitions[0].GUID }, []string{"partition 1: has the same GUID"}},
+		{"invalid size", func(t *Table) { t.Partitions[1].Size = 1000 }, []string{"partition 2: invalid partition entry"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := newTable()
+			tt.modify(table)
+			problems := table.Verify(tenMB)
+			if len(problems) != len(tt.problems) {
+				t.Fatalf("returned problems %v instead of %v", problems, tt.problems)
+			}
+			for i, p := range problems {
+				if !strings.HasPrefix(p.String(), tt.problems[i]) {
+					t.Errorf("returned problem %q instead of %q", p, tt.problems[i])
+				}
+			}
+		})
+	}
+	t.Run("table is not changed", func(t *testing.T) {
+		table := newTable()
+		table.Verify(tenMB)
+		if !table.Equal(newTable()) {
+			t.Errorf("verifying changed the table")
+		}
+	})
+	t.Run("resized disk", func(t *testing.T) {
+		f, err := tmpDisk("", tenMB)
+		if err != nil {
+			t.Fatalf("error creating new temporary disk: %v", err)
+		}
+		defer f.Close()
+		defer os.Remove(f.Name())
+
+		table := newTable()
+		if err := table.Write(f, tenMB); err != nil {
+			t.Fatalf("unexpected error writing table: %v", err)
+		}
+		problems := table.Verify(2 * tenMB)
+		if len(problems) != 1 || !strings.HasPrefix(problems[0].String(), "secondary header at sector 20479 instead of the last sector 40959") {
+			t.Errorf("returned problems %v for a disk that grew", problems)
+		}
+	})
+}
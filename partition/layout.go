@@ -0,0 +1,213 @@
+package partition
+
+import (
+	"fmt"
+
+	"github.com/diskfs/go-diskfs/partition/gpt"
+	"github.com/diskfs/go-diskfs/partition/mbr"
+)
+
+const (
+	// DefaultAlignment the default alignment of the start of each partition, 1MiB, as used by most partitioning tools
+	DefaultAlignment int64 = 1024 * 1024
+	// gptArraySize the size in bytes of the GPT partition array, 128 entries of 128 bytes, reserved at both ends of the disk
+	gptArraySize = 128 * gpt.PartitionEntrySize
+	// maxMBRSectors the largest disk an MBR can address
+	maxMBRSectors = 1<<32 - 1
+)
+
+// Spec describes one partition for LayoutGPT or LayoutMBR to place on a disk.
+//
+// The size is given in one of three ways: Size in bytes, Percent of the usable space on the disk, or,
+// if both are 0, the rest of the disk left over by the other partitions. Only one partition may take
+// the rest of the disk, but it does not need to be the last one.
+type Spec struct {
+	Size      int64    // size in bytes, rounded up to whole sectors
+	Percent   float64  // size as a percentage of the usable space from the start of the first partition, rounded down to the alignment
+	Alignment int64    // alignment of the start of the partition in bytes, 0 for DefaultAlignment
+	Name      string   // partition name, GPT only
+	GPTType   gpt.Type // partition type for LayoutGPT
+	MBRType   mbr.Type // partition type for LayoutMBR
+	Bootable  bool     // whether the partition is marked active, MBR only
+}
+
+// extent the first and last sectors of a partition
+type extent struct {
+	start, end uint64
+}
+
+// LayoutGPT plans a GPT for a disk of diskSize bytes with the given logical sector size, 0 for 512, placing the
+// partitions in the order given, each one aligned and after the previous one. Space is kept free for the primary
+// and secondary GPT headers and partition arrays at both ends of the disk.
+//
+// The returned Table can be adjusted further, and is applied to the disk with disk.Partition().
+func LayoutGPT(diskSize int64, sectorSize int, specs []Spec) (*gpt.Table, error) {
+	if sectorSize == 0 {
+		sectorSize = 512
+	}
+	ss := uint64(sectorSize)
+	if diskSize <= 0 || uint64(diskSize) < ss*4 {
+		return nil, fmt.Errorf("invalid disk size %d", diskSize)
+	}
+	sectors := uint64(diskSize) / ss
+	arraySectors := (gptArraySize + ss - 1) / ss
+	// protective MBR, primary header and array at the start, secondary array and header at the end
+	first := 2 + arraySectors
+	last := sectors - 2 - arraySectors
+	extents, err := layout(first, last, int64(sectorSize), specs)
+	if err != nil {
+		return nil, err
+	}
+
+	table := &gpt.Table{
+		LogicalSectorSize:  sectorSize,
+		PhysicalSectorSize: sectorSize,
+		ProtectiveMBR:      true,
+	}
+	for i, e := range extents {
+		table.Partitions = append(table.Partitions, &gpt.Partition{
+			Start: e.start,
+			End:   e.end,
+			Size:  (e.end - e.start + 1) * ss,
+			Type:  specs[i].GPTType,
+			Name:  specs[i].Name,
+		})
+	}
+	return table, nil
+}
+
+// LayoutMBR plans an MBR partition table for a disk of diskSize bytes with the given logical sector size,
+// 0 for 512, placing the partitions in the order given, each one aligned and after the previous one.
+// At most four partitions, all primary, can be planned.
+//
+// The returned Table can be adjusted further, and is applied to the disk with disk.Partition().
+func LayoutMBR(diskSize int64, sectorSize int, specs []Spec) (*mbr.Table, error) {
+	if sectorSize == 0 {
+		sectorSize = 512
+	}
+	if len(specs) > 4 {
+		return nil, fmt.Errorf("cannot lay out %d partitions in an MBR, the maximum is 4", len(specs))
+	}
+	ss := uint64(sectorSize)
+	if diskSize <= 0 || uint64(diskSize) < ss*2 {
+		return nil, fmt.Errorf("invalid disk size %d", diskSize)
+	}
+	sectors := uint64(diskSize) / ss
+	if sectors > maxMBRSectors {
+		sectors = maxMBRSectors
+	}
+	// sector 0 is the MBR itself
+	extents, err := layout(1, sectors-1, int64(sectorSize), specs)
+	if err != nil {
+		return nil, err
+	}
+
+	table := &mbr.Table{
+		LogicalSectorSize:  sectorSize,
+		PhysicalSectorSize: sectorSize,
+	}
+	for i, e := range extents {
+		table.Partitions = append(table.Partitions, &mbr.Partition{
+			Bootable: specs[i].Bootable,
+			Type:     specs[i].MBRType,
+			Start:    uint32(e.start),
+			Size:     uint32(e.end - e.start + 1),
+		})
+	}
+	return table, nil
+}
+
+// layout places the partitions between the first and last usable sectors, inclusive
+func layout(first, last uint64, sectorSize int64, specs []Spec) ([]extent, error) {
+	if last < first {
+		return nil, fmt.Errorf("disk has no usable space")
+	}
+	ss := uint64(sectorSize)
+
+	// the alignment of each partition in sectors
+	aligns := make([]uint64, len(specs))
+	for i, s := range specs {
+		align := s.Alignment
+		if align == 0 {
+			align = DefaultAlignment
+		}
+		if align < 0 || align%sectorSize != 0 {
+			return nil, fmt.Errorf("partition %d alignment %d is not a multiple of the sector size %d", i+1, align, sectorSize)
+		}
+		aligns[i] = uint64(align) / ss
+	}
+	// percentages are of the space from the start of the first partition, so that 100 percent fits
+	usable := last - first + 1
+	if len(specs) > 0 {
+		if start := (first + aligns[0] - 1) / aligns[0] * aligns[0]; start <= last {
+			usable = last - start + 1
+		}
+	}
+
+	// the size of each partition in sectors, with the rest of the disk as size 0 for now
+	sizes := make([]uint64, len(specs))
+	rest := -1
+	for i, s := range specs {
+		switch {
+		case s.Size < 0 || s.Percent < 0 || s.Percent > 100:
+			return nil, fmt.Errorf("partition %d has invalid size %d bytes or %v percent", i+1, s.Size, s.Percent)
+		case s.Size > 0 && s.Percent > 0:
+			return nil, fmt.Errorf("partition %d has both a size and a percentage", i+1)
+		case s.Size > 0:
+			sizes[i] = (uint64(s.Size) + ss - 1) / ss
+		case s.Percent > 0:
+			sizes[i] = uint64(float64(usable)*s.Percent/100) / aligns[i] * aligns[i]
+			if sizes[i] == 0 {
+				return nil, fmt.Errorf("partition %d of %v percent is smaller than its alignment", i+1, s.Percent)
+			}
+		case rest >= 0:
+			return nil, fmt.Errorf("partitions %d and %d both take the rest of the disk", rest+1, i+1)
+		default:
+			rest = i
+		}
+	}
+
+	extents, end := place(first, sizes, aligns)
+	if end > last+1 {
+		return nil, fmt.Errorf("partitions need %d sectors, but the disk has only %d usable", end-first, last-first+1)
+	}
+	if rest < 0 {
+		return extents, nil
+	}
+
+	// give the free space to the rest of the disk, in steps that keep the partitions after it aligned
+	step := uint64(1)
+	for _, a := range aligns[rest+1:] {
+		step = lcm(step, a)
+	}
+	sizes[rest] = (last + 1 - end) / step * step
+	if sizes[rest] == 0 {
+		return nil, fmt.Errorf("no space left on the disk for partition %d", rest+1)
+	}
+	extents, _ = place(first, sizes, aligns)
+	return extents, nil
+}
+
+// place lays the partitions out one after the other from the first sector, returning them and the
+// sector after the end of the last one
+func place(first uint64, sizes, aligns []uint64) ([]extent, uint64) {
+	extents := make([]extent, len(sizes))
+	next := first
+	for i, size := range sizes {
+		start := (next + aligns[i] - 1) / aligns[i] * aligns[i]
+		extents[i] = extent{start: start, end: start + size - 1}
+		next = start + size
+	}
+	return extents, next
+}
+
+func gcd(a, b uint64) uint64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+func lcm(a, b uint64) uint64 {
+	return a / gcd(a, b) * b
+}
@@ -0,0 +1,128 @@
+package partition_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/diskfs/go-diskfs/partition"
+	"github.com/diskfs/go-diskfs/partition/gpt"
+	"github.com/diskfs/go-diskfs/partition/mbr"
+)
+
+const oneMiB = 1024 * 1024
+
+func TestLayoutGPT(t *testing.T) {
+	tests := []struct {
+		name       string
+		sectorSize int
+		specs      []partition.Spec
+		expected   [][2]uint64
+	}{
+		{"efi and rest", 512, []partition.Spec{
+			{Size: 50 * oneMiB, GPTType: gpt.EFISystemPartition, Name: "EFI"},
+			{GPTType: gpt.LinuxFilesystem, Name: "root"},
+		}, [][2]uint64{{2048, 104447}, {104448, 204766}}},
+		{"rest in the middle", 512, []partition.Spec{
+			{Size: 10*oneMiB + 1, GPTType: gpt.EFISystemPartition},
+			{GPTType: gpt.LinuxFilesystem},
+			{Size: 10 * oneMiB, GPTType: gpt.LinuxSwap},
+		}, [][2]uint64{{2048, 22528}, {24576, 182271}, {182272, 202751}}},
+		{"percent and alignment", 512, []partition.Spec{
+			{Percent: 25, GPTType: gpt.LinuxFilesystem},
+			{Size: 4096, Alignment: 4096, GPTType: gpt.LinuxFilesystem},
+		}, [][2]uint64{{2048, 51199}, {51200, 51207}}},
+		{"4k sectors", 4096, []partition.Spec{
+			{GPTType: gpt.LinuxFilesystem},
+		}, [][2]uint64{{256, 25594}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			size := int64(100 * oneMiB)
+			table, err := partition.LayoutGPT(size, tt.sectorSize, tt.specs)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(table.Partitions) != len(tt.expected) {
+				t.Fatalf("planned %d partitions instead of %d", len(table.Partitions), len(tt.expected))
+			}
+			for i, p := range table.Partitions {
+				if p.Start != tt.expected[i][0] || p.End != tt.expected[i][1] {
+					t.Errorf("partition %d from %d to %d instead of %d to %d", i+1, p.Start, p.End, tt.expected[i][0], tt.expected[i][1])
+				}
+				if p.Type != tt.specs[i].GPTType || p.Name != tt.specs[i].Name {
+					t.Errorf("partition %d has type %s name %s", i+1, p.Type, p.Name)
+				}
+			}
+
+			// the plan is a valid table
+			f, err := os.CreateTemp(t.TempDir(), "layout")
+			if err != nil {
+				t.Fatalf("unable to create file: %v", err)
+			}
+			defer f.Close()
+			if err := f.Truncate(size); err != nil {
+				t.Fatalf("unable to size file: %v", err)
+			}
+			if err := table.Write(f, size); err != nil {
+				t.Fatalf("unexpected error writing table: %v", err)
+			}
+			read, err := gpt.Read(f, tt.sectorSize, tt.sectorSize)
+			if err != nil {
+				t.Fatalf("unexpected error reading table: %v", err)
+			}
+			if !read.Health().OK() {
+				t.Errorf("table read back is not healthy: %+v", read.Health())
+			}
+		})
+	}
+}
+
+func TestLayoutMBR(t *testing.T) {
+	table, err := partition.LayoutMBR(100*oneMiB, 0, []partition.Spec{
+		{Size: 20 * oneMiB, MBRType: mbr.Fat32LBA, Bootable: true},
+		{MBRType: mbr.Linux},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []*mbr.Partition{
+		{Bootable: true, Type: mbr.Fat32LBA, Start: 2048, Size: 40960},
+		{Type: mbr.Linux, Start: 43008, Size: 204800 - 43008},
+	}
+	if len(table.Partitions) != len(expected) {
+		t.Fatalf("planned %d partitions instead of %d", len(table.Partitions), len(expected))
+	}
+	for i, p := range table.Partitions {
+		if !p.Equal(expected[i]) {
+			t.Errorf("partition %d is %#v instead of %#v", i+1, p, expected[i])
+		}
+	}
+}
+
+func TestLayoutInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		specs []partition.Spec
+		err   string
+	}{
+		{"too large", []partition.Spec{{Size: 100 * oneMiB}}, "but the disk has only"},
+		{"two rest", []partition.Spec{{}, {Size: oneMiB}, {}}, "both take the rest"},
+		{"no rest left", []partition.Spec{{}, {Percent: 100}}, "no space left"},
+		{"percent too large", []partition.Spec{{Percent: 100}, {Size: 2 * oneMiB}}, "but the disk has only"},
+		{"size and percent", []partition.Spec{{Size: oneMiB, Percent: 10}}, "both a size and a percentage"},
+		{"bad percent", []partition.Spec{{Percent: 120}}, "invalid size"},
+		{"bad alignment", []partition.Spec{{Size: oneMiB, Alignment: 1000}}, "not a multiple of the sector size"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := partition.LayoutGPT(100*oneMiB, 512, tt.specs)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("returned error %v instead of expected %s", err, tt.err)
+			}
+		})
+	}
+	if _, err := partition.LayoutMBR(100*oneMiB, 512, make([]partition.Spec, 5)); err == nil {
+		t.Errorf("laying out 5 MBR partitions did not return an error")
+	}
+}
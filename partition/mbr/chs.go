@@ -0,0 +1,124 @@
+package mbr
+
+import "fmt"
+
+const (
+	// maximum values of a cylinder-head-sector (CHS) address in a partition entry. Sectors beyond what
+	// CHS can address are marked with all three at their maximum, as other tools do.
+	maxCylinder = 1023
+	maxHead     = 254
+	maxSector   = 63
+)
+
+// Geometry the disk geometry used to translate between logical block addresses (LBA) and the
+// cylinder-head-sector (CHS) addresses in partition entries
+type Geometry struct {
+	Heads           int // heads per cylinder, at most 255
+	SectorsPerTrack int // sectors per track, at most 63
+}
+
+// DefaultGeometry the geometry used by nearly every modern tool and BIOS, when a Table has none set
+var DefaultGeometry = Geometry{Heads: 255, SectorsPerTrack: 63}
+
+// chs a cylinder-head-sector address
+type chs struct {
+	cylinder uint16
+	head     byte
+	sector   byte
+}
+
+func (c chs) String() string {
+	return fmt.Sprintf("%d/%d/%d", c.cylinder, c.head, c.sector)
+}
+
+// valid check if the geometry can be used for CHS addresses
+func (g Geometry) valid() error {
+	if g.Heads < 1 || g.Heads > 255 {
+		return fmt.Errorf("geometry has %d heads, must be between 1 and 255", g.Heads)
+	}
+	if g.SectorsPerTrack < 1 || g.SectorsPerTrack > maxSector {
+		return fmt.Errorf("geometry has %d sectors per track, must be between 1 and %d", g.SectorsPerTrack, maxSector)
+	}
+	return nil
+}
+
+// chs translate a logical block address to a CHS address, saturating at 1023/254/63
+func (g Geometry) chs(lba uint32) chs {
+	spc := uint64(g.Heads) * uint64(g.SectorsPerTrack)
+	cylinder := uint64(lba) / spc
+	if cylinder > maxCylinder {
+		return chs{cylinder: maxCylinder, head: maxHead, sector: maxSector}
+	}
+	rest := uint64(lba) % spc
+	return chs{
+		cylinder: uint16(cylinder),
+		head:     byte(rest / uint64(g.SectorsPerTrack)),
+		sector:   byte(rest%uint64(g.SectorsPerTrack)) + 1,
+	}
+}
+
+// CHSBytes the head, sector and cylinder bytes of a partition entry for the CHS address of a logical block
+// address, saturating at 1023/254/63, for writing partition entries outside of a Table, e.g. a hybrid MBR
+func (g Geometry) CHSBytes(lba uint32) (head, sector, cylinder byte) {
+	return g.chs(lba).bytes()
+}
+
+// chsFromBytes decode the 3 bytes of a CHS address in a partition entry: head, then the sector in the
+// low 6 bits and the high 2 bits of the cylinder, then the low 8 bits of the cylinder
+func chsFromBytes(head, sector, cylinder byte) chs {
+	return chs{
+		cylinder: uint16(sector&0xc0)<<2 | uint16(cylinder),
+		head:     head,
+		sector:   sector & 0x3f,
+	}
+}
+
+// bytes encode a CHS address as the head, sector and cylinder bytes of a partition entry
+func (c chs) bytes() (head, sector, cylinder byte) {
+	return c.head, c.sector | byte(c.cylinder>>8)<<6, byte(c.cylinder)
+}
+
+// hasCHS check if any of the CHS addresses of the partition are set
+func (p *Partition) hasCHS() bool {
+	return p.StartCylinder != 0 || p.StartHead != 0 || p.StartSector != 0 ||
+		p.EndCylinder != 0 || p.EndHead != 0 || p.EndSector != 0
+}
+
+// withCHS a copy of the partition with its CHS addresses calculated from its LBA start and size,
+// unless they already are set explicitly
+func (p *Partition) withCHS(g Geometry) *Partition {
+	c := *p
+	if g == (Geometry{}) {
+		g = DefaultGeometry
+	}
+	if p.hasCHS() || p.Type == Empty || p.Size == 0 {
+		return &c
+	}
+	c.StartHead, c.StartSector, c.StartCylinder = g.chs(p.Start).bytes()
+	c.EndHead, c.EndSector, c.EndCylinder = g.chs(p.Start + p.Size - 1).bytes()
+	return &c
+}
+
+// checkCHS check that the CHS addresses of the partition match its LBA start and size
+func (p *Partition) checkCHS(g Geometry) error {
+	if p.Type == Empty || p.Size == 0 {
+		return nil
+	}
+	checks := []struct {
+		name     string
+		lba      uint32
+		actual   chs
+		expected chs
+	}{
+		{"start", p.Start, chsFromBytes(p.StartHead, p.StartSector, p.StartCylinder), g.chs(p.Start)},
+		{"end", p.Start + p.Size - 1, chsFromBytes(p.EndHead, p.EndSector, p.EndCylinder), g.chs(p.Start + p.Size - 1)},
+	}
+	for _, c := range checks {
+		// beyond what CHS can address, any maximum cylinder marks the address as unusable
+		if c.actual == c.expected || (c.expected.cylinder == maxCylinder && c.actual.cylinder == maxCylinder) {
+			continue
+		}
+		return fmt.Errorf("%s CHS %s does not match LBA %d, expected %s", c.name, c.actual, c.lba, c.expected)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package mbr
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGeometryCHS(t *testing.T) {
+	tests := []struct {
+		geometry Geometry
+		lba      uint32
+		expected chs
+	}{
+		{DefaultGeometry, 0, chs{0, 0, 1}},
+		{DefaultGeometry, 62, chs{0, 0, 63}},
+		{DefaultGeometry, 63, chs{0, 1, 1}},
+		{DefaultGeometry, 2048, chs{0, 32, 33}},
+		{DefaultGeometry, 16064, chs{0, 254, 63}},
+		{DefaultGeometry, 16065, chs{1, 0, 1}},
+		{DefaultGeometry, 1024*16065 - 1, chs{1023, 254, 63}},
+		{DefaultGeometry, 1024 * 16065, chs{1023, 254, 63}},
+		{DefaultGeometry, 1<<32 - 1, chs{1023, 254, 63}},
+		{Geometry{Heads: 16, SectorsPerTrack: 63}, 2048, chs{2, 0, 33}},
+	}
+	for _, tt := range tests {
+		actual := tt.geometry.chs(tt.lba)
+		if actual != tt.expected {
+			t.Errorf("LBA %d with geometry %+v is CHS %s instead of %s", tt.lba, tt.geometry, actual, tt.expected)
+		}
+		head, sector, cylinder := actual.bytes()
+		if decoded := chsFromBytes(head, sector, cylinder); decoded != actual {
+			t.Errorf("CHS %s decoded as %s", actual, decoded)
+		}
+	}
+}
+
+func TestPartitionCHS(t *testing.T) {
+	p := &Partition{Type: Linux, Start: 2048, Size: 20480}
+	c := p.withCHS(DefaultGeometry)
+	// 2048 is 0/32/33, 22527 is 1/102/37
+	if c.StartCylinder != 0 || c.StartHead != 32 || c.StartSector != 33 || c.EndCylinder != 1 || c.EndHead != 102 || c.EndSector != 37 {
+		t.Errorf("calculated CHS %d/%d/%d - %d/%d/%d", c.StartCylinder, c.StartHead, c.StartSector, c.EndCylinder, c.EndHead, c.EndSector)
+	}
+	if p.hasCHS() {
+		t.Errorf("calculating CHS changed the original partition")
+	}
+	if err := c.checkCHS(DefaultGeometry); err != nil {
+		t.Errorf("calculated CHS is inconsistent: %v", err)
+	}
+
+	explicit := &Partition{Type: Linux, Start: 2048, Size: 20480, StartHead: 1, StartSector: 1}
+	c = explicit.withCHS(DefaultGeometry)
+	if c.StartHead != 1 || c.StartSector != 1 || c.StartCylinder != 0 || c.EndSector != 0 {
+		t.Errorf("explicit CHS was replaced")
+	}
+	if err := c.checkCHS(DefaultGeometry); err == nil || !strings.HasPrefix(err.Error(), "start CHS 0/1/1 does not match LBA 2048") {
+		t.Errorf("returned error %v for inconsistent CHS", err)
+	}
+
+	// beyond what CHS can address, 1023/254/63 and 1023/255/63 are both accepted
+	large := &Partition{Type: Linux, Start: 1 << 30, Size: 2048, StartCylinder: 0xff, StartHead: 255, StartSector: 0xff, EndCylinder: 0xff, EndHead: 254, EndSector: 0xff}
+	if err := large.checkCHS(DefaultGeometry); err != nil {
+		t.Errorf("saturated CHS is inconsistent: %v", err)
+	}
+	if err := (&Partition{Type: Empty}).checkCHS(DefaultGeometry); err != nil {
+		t.Errorf("empty partition is inconsistent: %v", err)
+	}
+}
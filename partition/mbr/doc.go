@@ -23,4 +23,19 @@
 //	    },
 //	  },
 //	}
+//
+// To have more than four partitions, make one of the primary partitions an extended partition, e.g. of
+// type ExtendedLBA, and add logical partitions after the fourth entry. Each logical partition must leave
+// at least one free sector before it, inside the extended partition, for its extended boot record:
+//
+//	table := &mbr.Table{
+//	  Partitions: []*mbr.Partition{
+//	    {Type: mbr.Linux, Start: 2048, Size: 20480},
+//	    {Type: mbr.ExtendedLBA, Start: 22528, Size: 43008},
+//	    {Type: mbr.Empty},
+//	    {Type: mbr.Empty},
+//	    {Type: mbr.Linux, Start: 24576, Size: 20480},    // partition 5
+//	    {Type: mbr.LinuxSwap, Start: 47104, Size: 18432}, // partition 6
+//	  },
+//	}
 package mbr
@@ -0,0 +1,197 @@
+package mbr
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/diskfs/go-diskfs/util"
+)
+
+// maxLogicalPartitions limits how far the chain of extended boot records is followed, in case of a corrupt table
+const maxLogicalPartitions = 1024
+
+// ebr an extended boot record, describing one logical partition and linking to the next record
+type ebr struct {
+	sector uint32 // absolute LBA sector of the record
+	b      []byte
+}
+
+// isExtended whether a partition of this type holds a chain of extended boot records
+func (t Type) isExtended() bool {
+	return t == ExtendedCHS || t == ExtendedLBA || t == LinuxExtended
+}
+
+// primaryCount the number of entries in Partitions that are primary partitions
+func (t *Table) primaryCount() int {
+	if len(t.Partitions) < partitionEntriesCount {
+		return len(t.Partitions)
+	}
+	return partitionEntriesCount
+}
+
+// extendedPartition get the primary partition holding the logical partitions, or nil if there is none.
+// Returns an error if there is more than one.
+func (t *Table) extendedPartition() (*Partition, error) {
+	var ext *Partition
+	for i, p := range t.Partitions[:t.primaryCount()] {
+		if p == nil || !p.Type.isExtended() {
+			continue
+		}
+		if ext != nil {
+			return nil, fmt.Errorf("partition %d is a second extended partition, only one is allowed", i+1)
+		}
+		ext = p
+	}
+	return ext, nil
+}
+
+// LogicalPartitions get the logical partitions inside the extended partition, i.e. all of the Partitions
+// after the first four
+func (t *Table) LogicalPartitions() []*Partition {
+	if len(t.Partitions) <= partitionEntriesCount {
+		return nil
+	}
+	return t.Partitions[partitionEntriesCount:]
+}
+
+// readLogicalPartitions follow the chain of extended boot records in the extended partition, if any,
+// and add the logical partitions found to the table, with absolute starts
+func (t *Table) readLogicalPartitions(f util.File) error {
+	ext, err := t.extendedPartition()
+	if err != nil {
+		return err
+	}
+	if ext == nil || ext.Size == 0 {
+		return nil
+	}
+	sectorSize := int64(t.LogicalSectorSize)
+	extEnd := uint64(ext.Start) + uint64(ext.Size)
+	current := ext.Start
+	visited := map[uint32]bool{}
+	for {
+		if visited[current] {
+			return fmt.Errorf("extended boot record at sector %d is linked more than once", current)
+		}
+		if len(visited) >= maxLogicalPartitions {
+			return fmt.Errorf("more than %d extended boot records", maxLogicalPartitions)
+		}
+		visited[current] = true
+
+		b := make([]byte, mbrSize)
+		read, err := f.ReadAt(b, int64(current)*sectorSize)
+		if err != nil {
+			return fmt.Errorf("error reading extended boot record at sector %d: %v", current, err)
+		}
+		if read != len(b) {
+			return fmt.Errorf("read only %d bytes of extended boot record at sector %d instead of expected %d", read, current, len(b))
+		}
+		if !bytes.Equal(b[signatureStart:], getMbrSignature()) {
+			// an extended partition that was never filled in has no logical partitions
+			if current == ext.Start {
+				return nil
+			}
+			return fmt.Errorf("invalid signature %v for extended boot record at sector %d", b[signatureStart:], current)
+		}
+
+		entries := b[partitionEntriesStart:]
+		logical, err := partitionFromBytes(entries[0:partitionEntrySize], t.LogicalSectorSize, t.PhysicalSectorSize)
+		if err != nil {
+			return fmt.Errorf("error reading logical partition at sector %d: %v", current, err)
+		}
+		next, err := partitionFromBytes(entries[partitionEntrySize:2*partitionEntrySize], t.LogicalSectorSize, t.PhysicalSectorSize)
+		if err != nil {
+			return fmt.Errorf("error reading link to next extended boot record at sector %d: %v", current, err)
+		}
+
+		// the logical partition start is relative to its own extended boot record
+		if logical.Type != Empty && logical.Size > 0 {
+			logical.Start += current
+			if uint64(logical.Start)+uint64(logical.Size) > extEnd {
+				return fmt.Errorf("logical partition at sector %d extends beyond the end of the extended partition", logical.Start)
+			}
+			t.Partitions = append(t.Partitions, logical)
+		}
+
+		// the link to the next record is relative to the start of the extended partition
+		if !next.Type.isExtended() || next.Size == 0 {
+			return nil
+		}
+		if uint64(next.Start)+uint64(ext.Start) >= extEnd {
+			return fmt.Errorf("extended boot record at sector %d links outside of the extended partition", current)
+		}
+		current = ext.Start + next.Start
+	}
+}
+
+// extendedBootRecords build the chain of extended boot records for the logical partitions.
+// Each record is placed in the first sector of the free space before its logical partition, i.e. the
+// first one at the start of the extended partition, and each following one right after the end of
+// the previous logical partition.
+func (t *Table) extendedBootRecords() ([]ebr, error) {
+	ext, err := t.extendedPartition()
+	if err != nil {
+		return nil, err
+	}
+	logical := t.LogicalPartitions()
+	if ext == nil {
+		if len(logical) > 0 {
+			return nil, fmt.Errorf("table has %d logical partitions but no extended partition", len(logical))
+		}
+		return nil, nil
+	}
+	// an extended partition without logical partitions still needs a valid, empty, first record
+	if len(logical) == 0 {
+		return []ebr{{sector: ext.Start, b: newEBRBytes(nil, nil)}}, nil
+	}
+
+	extEnd := uint64(ext.Start) + uint64(ext.Size)
+	sectors := make([]uint32, len(logical))
+	for i, p := range logical {
+		if p == nil {
+			return nil, fmt.Errorf("logical partition %d is empty", i+partitionEntriesCount+1)
+		}
+		sectors[i] = ext.Start
+		if i > 0 {
+			sectors[i] = logical[i-1].Start + logical[i-1].Size
+		}
+		if p.Start <= sectors[i] {
+			return nil, fmt.Errorf("logical partition %d starts at sector %d, leaving no room for its extended boot record at sector %d", i+partitionEntriesCount+1, p.Start, sectors[i])
+		}
+		if uint64(p.Start)+uint64(p.Size) > extEnd {
+			return nil, fmt.Errorf("logical partition %d extends beyond the end of the extended partition at sector %d", i+partitionEntriesCount+1, extEnd)
+		}
+	}
+
+	records := make([]ebr, 0, len(logical))
+	for i, p := range logical {
+		// CHS addresses are always absolute, so calculate them before making the start relative
+		entry := p.withCHS(t.Geometry)
+		entry.Start -= sectors[i]
+		var link *Partition
+		if i+1 < len(logical) {
+			next := logical[i+1]
+			link = (&Partition{
+				Type:  ExtendedCHS,
+				Start: sectors[i+1],
+				Size:  next.Start + next.Size - sectors[i+1],
+			}).withCHS(t.Geometry)
+			link.Start -= ext.Start
+		}
+		records = append(records, ebr{sector: sectors[i], b: newEBRBytes(entry, link)})
+	}
+	return records, nil
+}
+
+// newEBRBytes the full sector for an extended boot record with the given logical partition and
+// link to the next record, either of which may be nil
+func newEBRBytes(logical, link *Partition) []byte {
+	b := make([]byte, mbrSize)
+	if logical != nil {
+		copy(b[partitionEntriesStart:], logical.toBytes())
+	}
+	if link != nil {
+		copy(b[partitionEntriesStart+partitionEntrySize:], link.toBytes())
+	}
+	copy(b[signatureStart:], getMbrSignature())
+	return b
+}
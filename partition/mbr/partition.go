@@ -11,7 +11,8 @@ import (
 )
 
 // Partition represents the structure of a single partition on the disk
-// note that start and end cylinder, head, sector (CHS) are ignored, for the most part.
+// note that start and end cylinder, head, sector (CHS) are ignored, for the most part. If they are left blank,
+// they are calculated from Start and Size when the table is written; see Table.Geometry.
 // godiskfs works with disks that support [Logical Block Addressing (LBA)](https://en.wikipedia.org/wiki/Logical_block_addressing)
 type Partition struct {
 	Bootable      bool
@@ -0,0 +1,167 @@
+package mbr
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/diskfs/go-diskfs/partition/part"
+)
+
+// scriptLabel the label of an MBR in an sfdisk script
+const scriptLabel = "dos"
+
+// Dump write the table as an sfdisk script, as sfdisk --dump does, so it can be kept as text, and restored
+// with ParseScript or with sfdisk. Partition lines are named after the partition number, as the device
+// is not known, so logical partitions are numbered from 5; empty entries are left out.
+func (t *Table) Dump(w io.Writer) error {
+	return t.script().Write(w)
+}
+
+// script the sfdisk script for the table
+func (t *Table) script() *part.Script {
+	sectorSize := t.LogicalSectorSize
+	if sectorSize == 0 {
+		sectorSize = logicalSectorSize
+	}
+	s := &part.Script{Header: []part.ScriptField{{Name: "label", Value: scriptLabel}}}
+	if t.DiskSignature != 0 {
+		s.Header = append(s.Header, part.ScriptField{Name: "label-id", Value: fmt.Sprintf("0x%08x", t.DiskSignature)})
+	}
+	s.Header = append(s.Header,
+		part.ScriptField{Name: "unit", Value: "sectors"},
+		part.ScriptField{Name: "sector-size", Value: strconv.Itoa(sectorSize)},
+	)
+	for i, p := range t.Partitions {
+		if p == nil || p.Type == Empty {
+			continue
+		}
+		fields := []part.ScriptField{
+			{Name: "start", Value: fmt.Sprintf("%12d", p.Start)},
+			{Name: "size", Value: fmt.Sprintf("%12d", p.Size)},
+			{Name: "type", Value: fmt.Sprintf("%x", byte(p.Type))},
+		}
+		if p.Bootable {
+			fields = append(fields, part.ScriptField{Name: "bootable"})
+		}
+		s.Partitions = append(s.Partitions, part.ScriptPartition{Number: i + 1, Fields: fields})
+	}
+	return s
+}
+
+// ParseScript read a table from an sfdisk script, as written by Dump or by sfdisk --dump. Partitions are
+// placed at the number of their device name, if they have one. Otherwise they follow the previous
+// partition, as a logical partition if they start inside the extended partition.
+func ParseScript(r io.Reader) (*Table, error) {
+	s, err := part.ParseScript(r)
+	if err != nil {
+		return nil, err
+	}
+	return TableFromScript(s)
+}
+
+// TableFromScript create a table from a parsed sfdisk script, see ParseScript
+func TableFromScript(s *part.Script) (*Table, error) {
+	table := &Table{
+		LogicalSectorSize:  logicalSectorSize,
+		PhysicalSectorSize: physicalSectorSize,
+	}
+	// sfdisk assumes an MBR when there is no label
+	if label, ok := s.Get("label"); ok && label != scriptLabel {
+		return nil, fmt.Errorf("script has label %q instead of %q", label, scriptLabel)
+	}
+	for _, h := range s.Header {
+		var err error
+		switch h.Name {
+		case "label", "device", "grain":
+		case "unit":
+			if h.Value != "sectors" {
+				err = fmt.Errorf("unsupported unit %q", h.Value)
+			}
+		case "label-id":
+			var signature uint64
+			signature, err = strconv.ParseUint(strings.TrimPrefix(strings.ToLower(h.Value), "0x"), 16, 32)
+			table.DiskSignature = uint32(signature)
+		case "sector-size":
+			table.LogicalSectorSize, err = strconv.Atoi(h.Value)
+			if err == nil && table.LogicalSectorSize != 512 && table.LogicalSectorSize != 4096 {
+				err = fmt.Errorf("must be 512 or 4096")
+			}
+		default:
+			err = fmt.Errorf("unknown header")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid header %s: %s: %v", h.Name, h.Value, err)
+		}
+	}
+	if table.LogicalSectorSize > table.PhysicalSectorSize {
+		table.PhysicalSectorSize = table.LogicalSectorSize
+	}
+
+	for i, sp := range s.Partitions {
+		p, err := partitionFromScript(sp)
+		if err != nil {
+			return nil, fmt.Errorf("partition %d: %v", i+1, err)
+		}
+		number := sp.Number
+		if number == 0 {
+			number = len(table.Partitions) + 1
+			if ext, _ := table.extendedPartition(); ext != nil && p.Start >= ext.Start && p.Start < ext.Start+ext.Size && number <= partitionEntriesCount {
+				number = partitionEntriesCount + 1
+			}
+		}
+		switch {
+		case number <= len(table.Partitions):
+			return nil, fmt.Errorf("partition %d is out of order or given twice", number)
+		case number > partitionEntriesCount+1 && number != len(table.Partitions)+1:
+			return nil, fmt.Errorf("logical partition %d follows partition %d, logical partitions are numbered without gaps", number, len(table.Partitions))
+		case number <= partitionEntriesCount && p.Type.isExtended():
+			if ext, _ := table.extendedPartition(); ext != nil {
+				return nil, fmt.Errorf("partition %d is a second extended partition, only one is allowed", number)
+			}
+		}
+		for len(table.Partitions) < number-1 {
+			table.Partitions = append(table.Partitions, &Partition{Type: Empty})
+		}
+		table.Partitions = append(table.Partitions, p)
+	}
+	// the partitions need the sector sizes for the byte offsets of their start and size
+	for _, p := range table.Partitions {
+		p.logicalSectorSize = table.LogicalSectorSize
+		p.physicalSectorSize = table.PhysicalSectorSize
+	}
+	return table, nil
+}
+
+// partitionFromScript create a partition from the fields of an sfdisk script line
+func partitionFromScript(sp part.ScriptPartition) (*Partition, error) {
+	// sfdisk defaults to a Linux partition too
+	p := &Partition{Type: Linux}
+	for _, f := range sp.Fields {
+		var err error
+		var v uint64
+		switch f.Name {
+		case "start":
+			v, err = strconv.ParseUint(f.Value, 10, 32)
+			p.Start = uint32(v)
+		case "size":
+			v, err = strconv.ParseUint(f.Value, 10, 32)
+			p.Size = uint32(v)
+		case "type":
+			v, err = strconv.ParseUint(strings.TrimPrefix(strings.ToLower(f.Value), "0x"), 16, 8)
+			p.Type = Type(v)
+		case "bootable":
+			p.Bootable = true
+		default:
+			err = fmt.Errorf("unsupported field")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s=%s: %v", f.Name, f.Value, err)
+		}
+	}
+	if p.Start == 0 || p.Size == 0 {
+		return nil, fmt.Errorf("start and size are required")
+	}
+	return p, nil
+}
@@ -0,0 +1,134 @@
+package mbr_test
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/diskfs/go-diskfs/partition/mbr"
+)
+
+const mbrScript = `label: dos
+label-id: 0x1a2b3c4d
+unit: sectors
+sector-size: 512
+
+1 : start=        2048, size=        4096, type=c, bootable
+3 : start=        6144, size=       12288, type=5
+5 : start=        8192, size=        2048, type=83
+6 : start=       12288, size=        4096, type=82
+`
+
+func TestDump(t *testing.T) {
+	table := &mbr.Table{
+		LogicalSectorSize: 512,
+		DiskSignature:     0x1a2b3c4d,
+		Partitions: []*mbr.Partition{
+			{Start: 2048, Size: 4096, Type: mbr.Fat32LBA, Bootable: true},
+			{Type: mbr.Empty},
+			{Start: 6144, Size: 12288, Type: mbr.ExtendedCHS},
+			{Type: mbr.Empty},
+			{Start: 8192, Size: 2048, Type: mbr.Linux},
+			{Start: 12288, Size: 4096, Type: mbr.LinuxSwap},
+		},
+	}
+	var b bytes.Buffer
+	if err := table.Dump(&b); err != nil {
+		t.Fatalf("unexpected error dumping table: %v", err)
+	}
+	if b.String() != mbrScript {
+		t.Errorf("dumped\n%s\ninstead of\n%s", b.String(), mbrScript)
+	}
+}
+
+func TestParseScript(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		table, err := mbr.ParseScript(strings.NewReader(mbrScript))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		f, err := tmpDisk("", tenMB)
+		if err != nil {
+			t.Fatalf("error creating new temporary disk: %v", err)
+		}
+		defer os.Remove(f.Name())
+		defer f.Close()
+		if err := table.Write(f, tenMB); err != nil {
+			t.Fatalf("unexpected error writing table: %v", err)
+		}
+		read, err := mbr.Read(f, 512, 512)
+		if err != nil {
+			t.Fatalf("unexpected error reading table: %v", err)
+		}
+		var b bytes.Buffer
+		if err := read.Dump(&b); err != nil {
+			t.Fatalf("unexpected error dumping table: %v", err)
+		}
+		if b.String() != mbrScript {
+			t.Errorf("dumped\n%s\ninstead of\n%s", b.String(), mbrScript)
+		}
+	})
+	t.Run("4096 byte sectors", func(t *testing.T) {
+		script := strings.Replace(mbrScript, "sector-size: 512", "sector-size: 4096", 1)
+		table, err := mbr.ParseScript(strings.NewReader(script))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if table.LogicalSectorSize != 4096 {
+			t.Errorf("parsed sector size %d instead of 4096", table.LogicalSectorSize)
+		}
+		p := table.Partitions[0]
+		if p.GetStart() != 2048*4096 || p.GetSize() != 4096*4096 {
+			t.Errorf("partition 1 starts at byte %d with size %d instead of %d and %d", p.GetStart(), p.GetSize(), 2048*4096, 4096*4096)
+		}
+		var b bytes.Buffer
+		if err := table.Dump(&b); err != nil {
+			t.Fatalf("unexpected error dumping table: %v", err)
+		}
+		if b.String() != script {
+			t.Errorf("dumped\n%s\ninstead of\n%s", b.String(), script)
+		}
+	})
+	t.Run("unnamed", func(t *testing.T) {
+		// without device names, partitions inside the extended partition are logical
+		script := "start=2048, size=4096, type=83\nstart=6144, size=12288, type=0x05\nstart=8192, size=2048\nstart=12288 size=4096 type=82\n"
+		table, err := mbr.ParseScript(strings.NewReader(script))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		types := []mbr.Type{mbr.Linux, mbr.ExtendedCHS, mbr.Empty, mbr.Empty, mbr.Linux, mbr.LinuxSwap}
+		if len(table.Partitions) != len(types) {
+			t.Fatalf("parsed %d partitions instead of %d", len(table.Partitions), len(types))
+		}
+		for i, p := range table.Partitions {
+			if p.Type != types[i] {
+				t.Errorf("partition %d has type %x instead of %x", i+1, p.Type, types[i])
+			}
+		}
+		if table.LogicalSectorSize != 512 || table.DiskSignature != 0 {
+			t.Errorf("parsed table %+v", table)
+		}
+	})
+	t.Run("invalid", func(t *testing.T) {
+		tests := []struct {
+			script string
+			err    string
+		}{
+			{"label: gpt\n", `script has label "gpt" instead of "dos"`},
+			{"label-id: 0x123456789\n", "invalid header label-id: 0x123456789"},
+			{"first-lba: 34\n", "invalid header first-lba: 34: unknown header"},
+			{"start=2048\n", "partition 1: start and size are required"},
+			{"start=2048, size=2048, type=1ff\n", "partition 1: invalid type=1ff"},
+			{"start=2048, size=2048, uuid=5CA3360B-5DE6-4FCF-B4CE-419CEE433B51\n", "partition 1: invalid uuid=5CA3360B-5DE6-4FCF-B4CE-419CEE433B51: unsupported field"},
+			{"1 : start=2048, size=2048, type=5\n2 : start=8192, size=2048, type=f\n", "partition 2 is a second extended partition"},
+			{"1 : start=2048, size=8192, type=5\n6 : start=4096, size=2048\n", "logical partition 6 follows partition 1"},
+		}
+		for _, tt := range tests {
+			_, err := mbr.ParseScript(strings.NewReader(tt.script))
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+				t.Errorf("%q returned error %v instead of %s", tt.script, err, tt.err)
+			}
+		}
+	})
+}
@@ -2,6 +2,7 @@ package mbr
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 
 	"github.com/diskfs/go-diskfs/partition/part"
@@ -9,15 +10,33 @@ import (
 )
 
 // Table represents an MBR partition table to be applied to a disk or read from a disk
+//
+// The first four Partitions are the primary partitions in the MBR itself. Any further Partitions are
+// logical partitions inside the single extended partition, numbered from 5 as Linux does. Their Start
+// is the absolute sector on the disk, just like for primary partitions.
+//
+// The cylinder-head-sector (CHS) addresses of partitions are calculated from their LBA Start and Size
+// using the Geometry when writing, unless they are set explicitly.
+//
+// BootCode and DiskSignature are only written when set, so a table written without them leaves whatever
+// boot code and disk signature are already on the disk in place. To clear them, set BootCode to an empty,
+// non-nil slice, which zeroes the boot code, and set ClearDiskSignature.
 type Table struct {
 	Partitions         []*Partition
-	LogicalSectorSize  int // logical size of a sector
-	PhysicalSectorSize int // physical size of the sector
+	LogicalSectorSize  int      // logical size of a sector
+	PhysicalSectorSize int      // physical size of the sector
+	BootCode           []byte   // bootstrap code at the start of the MBR, at most 440 bytes, e.g. syslinux mbr.bin
+	DiskSignature      uint32   // disk signature, used by Windows and Linux PARTUUID to identify the disk
+	ClearDiskSignature bool     // write a DiskSignature of 0, rather than keeping the one on the disk
+	Geometry           Geometry // geometry for CHS addresses, DefaultGeometry if left blank
 	initialized        bool
+	chsErrors          []error // partitions whose CHS addresses did not match their LBA when read from disk
 }
 
 const (
 	mbrSize               = 512
+	bootCodeSize          = 440
+	diskSignatureStart    = 440
 	logicalSectorSize     = 512
 	physicalSectorSize    = 512
 	partitionEntriesStart = 446
@@ -63,11 +82,15 @@ func (t *Table) initTable() {
 	if t.PhysicalSectorSize == 0 {
 		t.PhysicalSectorSize = 512
 	}
+	if t.Geometry == (Geometry{}) {
+		t.Geometry = DefaultGeometry
+	}
 
 	t.initialized = true
 }
 
-// Equal check if another table is equal to this one, ignoring CHS start and end for the partitions
+// Equal check if another table is equal to this one, ignoring CHS start and end for the partitions,
+// the boot code, the disk signature and the geometry
 func (t *Table) Equal(t2 *Table) bool {
 	if t2 == nil {
 		return false
@@ -109,6 +132,10 @@ func tableFromBytes(b []byte) (*Table, error) {
 		Partitions:         parts,
 		LogicalSectorSize:  logicalSectorSize,
 		PhysicalSectorSize: 512,
+		DiskSignature:      binary.LittleEndian.Uint32(b[diskSignatureStart : diskSignatureStart+4]),
+	}
+	if !bytes.Equal(b[:bootCodeSize], make([]byte, bootCodeSize)) {
+		table.BootCode = append([]byte{}, b[:bootCodeSize]...)
 	}
 
 	return table, nil
@@ -119,7 +146,9 @@ func (t *Table) Type() string {
 	return "mbr"
 }
 
-// Read read a partition table from a disk, given the logical block size and physical block size
+// Read read a partition table from a disk, given the logical block size and physical block size.
+// If there is an extended partition, its chain of extended boot records is followed and the
+// logical partitions are added after the four primary partitions.
 func Read(f util.File, logicalBlockSize, physicalBlockSize int) (*Table, error) {
 	// read the data off of the disk
 	b := make([]byte, mbrSize)
@@ -130,7 +159,26 @@ func Read(f util.File, logicalBlockSize, physicalBlockSize int) (*Table, error)
 	if read != len(b) {
 		return nil, fmt.Errorf("read only %d bytes of MBR from file instead of expected %d", read, len(b))
 	}
-	return tableFromBytes(b)
+	table, err := tableFromBytes(b)
+	if err != nil {
+		return nil, err
+	}
+	if err := table.readLogicalPartitions(f); err != nil {
+		return nil, fmt.Errorf("error reading logical partitions: %v", err)
+	}
+	for i, p := range table.Partitions {
+		if err := p.checkCHS(DefaultGeometry); err != nil {
+			table.chsErrors = append(table.chsErrors, fmt.Errorf("partition %d: %v", i+1, err))
+		}
+	}
+	return table, nil
+}
+
+// CHSErrors report the partitions whose CHS addresses did not match their LBA start and size, using
+// DefaultGeometry, when the table was read from disk. Most systems only use the LBA values, but some old
+// BIOSes do not boot from a disk with inconsistent CHS addresses.
+func (t *Table) CHSErrors() []error {
+	return t.chsErrors
 }
 
 // ToBytes convert Table to byte slice suitable to be flashed to a disk
@@ -141,7 +189,7 @@ func (t *Table) toBytes() []byte {
 	// write the partitions
 	for i := 0; i < partitionEntriesCount; i++ {
 		if i < len(t.Partitions) {
-			btmp := t.Partitions[i].toBytes()
+			btmp := t.Partitions[i].withCHS(t.Geometry).toBytes()
 			b = append(b, btmp...)
 		} else {
 			b = append(b, []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}...)
@@ -153,11 +201,46 @@ func (t *Table) toBytes() []byte {
 	return b
 }
 
-// Write writes a given MBR Table to disk.
+// Write writes a given MBR Table to disk, along with the extended boot records for any logical partitions.
 // Must be passed the util.File to write to and the size of the disk
 func (t *Table) Write(f util.File, size int64) error {
+	t.initTable()
+	if err := t.Geometry.valid(); err != nil {
+		return fmt.Errorf("invalid geometry: %v", err)
+	}
+	if len(t.BootCode) > bootCodeSize {
+		return fmt.Errorf("boot code is %d bytes, more than the maximum %d", len(t.BootCode), bootCodeSize)
+	}
+	records, err := t.extendedBootRecords()
+	if err != nil {
+		return fmt.Errorf("invalid logical partitions: %v", err)
+	}
 	b := t.toBytes()
 
+	if t.BootCode != nil {
+		bootCode := make([]byte, bootCodeSize)
+		copy(bootCode, t.BootCode)
+		written, err := f.WriteAt(bootCode, 0)
+		if err != nil {
+			return fmt.Errorf("error writing boot code to disk: %v", err)
+		}
+		if written != len(bootCode) {
+			return fmt.Errorf("boot code wrote %d bytes to disk instead of the expected %d", written, len(bootCode))
+		}
+	}
+	if t.DiskSignature != 0 || t.ClearDiskSignature {
+		// the disk signature is followed by two reserved bytes, normally zero
+		signature := make([]byte, partitionEntriesStart-diskSignatureStart)
+		binary.LittleEndian.PutUint32(signature, t.DiskSignature)
+		written, err := f.WriteAt(signature, diskSignatureStart)
+		if err != nil {
+			return fmt.Errorf("error writing disk signature to disk: %v", err)
+		}
+		if written != len(signature) {
+			return fmt.Errorf("disk signature wrote %d bytes to disk instead of the expected %d", written, len(signature))
+		}
+	}
+
 	written, err := f.WriteAt(b, partitionEntriesStart)
 	if err != nil {
 		return fmt.Errorf("error writing partition table to disk: %v", err)
@@ -165,6 +248,15 @@ func (t *Table) Write(f util.File, size int64) error {
 	if written != len(b) {
 		return fmt.Errorf("partition table wrote %d bytes to disk instead of the expected %d", written, len(b))
 	}
+	for _, r := range records {
+		written, err := f.WriteAt(r.b, int64(r.sector)*int64(t.LogicalSectorSize))
+		if err != nil {
+			return fmt.Errorf("error writing extended boot record at sector %d to disk: %v", r.sector, err)
+		}
+		if written != len(r.b) {
+			return fmt.Errorf("extended boot record at sector %d wrote %d bytes to disk instead of the expected %d", r.sector, written, len(r.b))
+		}
+	}
 	return nil
 }
 
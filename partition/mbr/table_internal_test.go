@@ -6,6 +6,8 @@ import (
 	"os"
 	"strings"
 	"testing"
+
+	"github.com/diskfs/go-diskfs/testhelper"
 )
 
 const (
@@ -91,3 +93,24 @@ func TestTableFromBytes(t *testing.T) {
 		}
 	})
 }
+
+func TestReadLogicalPartitionsLoop(t *testing.T) {
+	// an extended boot record whose link points back at itself
+	record := newEBRBytes(&Partition{Type: Linux, Start: 2048, Size: 2048}, &Partition{Type: ExtendedCHS, Start: 0, Size: 4096})
+	table := &Table{
+		LogicalSectorSize:  512,
+		PhysicalSectorSize: 512,
+		Partitions: []*Partition{
+			{Type: ExtendedLBA, Start: 2048, Size: 8192},
+		},
+	}
+	f := &testhelper.FileImpl{
+		Reader: func(b []byte, offset int64) (int, error) {
+			return copy(b, record), nil
+		},
+	}
+	err := table.readLogicalPartitions(f)
+	if err == nil || !strings.Contains(err.Error(), "linked more than once") {
+		t.Errorf("returned error %v instead of loop error", err)
+	}
+}
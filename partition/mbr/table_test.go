@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"crypto/rand"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
@@ -340,6 +341,254 @@ func TestTableWrite(t *testing.T) {
 		}
 	})
 }
+func TestLogicalPartitions(t *testing.T) {
+	newTable := func() *mbr.Table {
+		return &mbr.Table{
+			LogicalSectorSize:  512,
+			PhysicalSectorSize: 512,
+			Partitions: []*mbr.Partition{
+				{Type: mbr.Linux, Start: 2048, Size: 2048},
+				{Type: mbr.ExtendedLBA, Start: 4096, Size: 16384},
+				{Type: mbr.Empty},
+				{Type: mbr.Empty},
+				{Type: mbr.Linux, Start: 6144, Size: 2048},
+				{Type: mbr.LinuxSwap, Start: 10240, Size: 4096},
+				{Type: mbr.Fat32LBA, Start: 16384, Size: 4096},
+			},
+		}
+	}
+	t.Run("write and read", func(t *testing.T) {
+		f, err := tmpDisk("", tenMB)
+		if err != nil {
+			t.Fatalf("error creating new temporary disk: %v", err)
+		}
+		defer f.Close()
+		defer os.Remove(f.Name())
+
+		table := newTable()
+		if err := table.Write(f, tenMB); err != nil {
+			t.Fatalf("unexpected error writing table: %v", err)
+		}
+		// the second record follows the first logical partition, with a start relative to itself
+		// and a link relative to the start of the extended partition
+		b := make([]byte, 512)
+		if _, err := f.ReadAt(b, 4096*512); err != nil {
+			t.Fatalf("error reading first extended boot record: %v", err)
+		}
+		if start := binary.LittleEndian.Uint32(b[446+8:]); start != 2048 {
+			t.Errorf("first logical partition has relative start %d instead of %d", start, 2048)
+		}
+		if start := binary.LittleEndian.Uint32(b[446+16+8:]); start != 4096 {
+			t.Errorf("link to second extended boot record has relative start %d instead of %d", start, 4096)
+		}
+		if _, err := f.ReadAt(b, 8192*512); err != nil {
+			t.Fatalf("error reading second extended boot record: %v", err)
+		}
+		if start := binary.LittleEndian.Uint32(b[446+8:]); start != 2048 {
+			t.Errorf("second logical partition has relative start %d instead of %d", start, 2048)
+		}
+
+		read, err := mbr.Read(f, 512, 512)
+		if err != nil {
+			t.Fatalf("unexpected error reading table: %v", err)
+		}
+		if !read.Equal(table) {
+			t.Errorf("actual table was %v instead of expected %v", read, table)
+		}
+		if errs := read.CHSErrors(); len(errs) != 0 {
+			t.Errorf("unexpected CHS errors %v", errs)
+		}
+		if len(read.LogicalPartitions()) != 3 {
+			t.Errorf("read %d logical partitions instead of %d", len(read.LogicalPartitions()), 3)
+		}
+		if start := read.GetPartitions()[5].GetStart(); start != 10240*512 {
+			t.Errorf("partition 6 starts at %d instead of %d", start, 10240*512)
+		}
+	})
+	t.Run("empty extended partition", func(t *testing.T) {
+		f, err := tmpDisk("", tenMB)
+		if err != nil {
+			t.Fatalf("error creating new temporary disk: %v", err)
+		}
+		defer f.Close()
+		defer os.Remove(f.Name())
+
+		table := newTable()
+		if err := table.Write(f, tenMB); err != nil {
+			t.Fatalf("unexpected error writing table: %v", err)
+		}
+		table.Partitions = table.Partitions[:4]
+		if err := table.Write(f, tenMB); err != nil {
+			t.Fatalf("unexpected error writing table: %v", err)
+		}
+		read, err := mbr.Read(f, 512, 512)
+		if err != nil {
+			t.Fatalf("unexpected error reading table: %v", err)
+		}
+		if len(read.LogicalPartitions()) != 0 {
+			t.Errorf("stale logical partitions %v were read", read.LogicalPartitions())
+		}
+	})
+	t.Run("invalid", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			modify func(*mbr.Table)
+			err    string
+		}{
+			{"no extended partition", func(table *mbr.Table) { table.Partitions[1].Type = mbr.Linux }, "no extended partition"},
+			{"two extended partitions", func(table *mbr.Table) { table.Partitions[2] = &mbr.Partition{Type: mbr.ExtendedCHS, Start: 20480} }, "second extended partition"},
+			{"no room for record", func(table *mbr.Table) { table.Partitions[5].Start = 8192 }, "leaving no room"},
+			{"beyond extended partition", func(table *mbr.Table) { table.Partitions[6].Size = 8192 }, "beyond the end"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				table := newTable()
+				tt.modify(table)
+				f := &testhelper.FileImpl{
+					Writer: func(b []byte, offset int64) (int, error) {
+						t.Fatalf("wrote to disk at %d despite invalid table", offset)
+						return 0, nil
+					},
+				}
+				err := table.Write(f, tenMB)
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("returned error %v instead of expected %s", err, tt.err)
+				}
+			})
+		}
+	})
+}
+
+func TestBootCode(t *testing.T) {
+	f, err := tmpDisk("", tenMB)
+	if err != nil {
+		t.Fatalf("error creating new temporary disk: %v", err)
+	}
+	defer f.Close()
+	defer os.Remove(f.Name())
+
+	bootCode := bytes.Repeat([]byte{0xfa, 0x31, 0xc0}, 100)
+	table := &mbr.Table{
+		LogicalSectorSize:  512,
+		PhysicalSectorSize: 512,
+		BootCode:           bootCode,
+		DiskSignature:      0x12345678,
+		Partitions: []*mbr.Partition{
+			{Type: mbr.Linux, Start: 2048, Size: 2048, Bootable: true},
+		},
+	}
+	if err := table.Write(f, tenMB); err != nil {
+		t.Fatalf("unexpected error writing table: %v", err)
+	}
+	b := make([]byte, 512)
+	if _, err := f.ReadAt(b, 0); err != nil {
+		t.Fatalf("error reading MBR: %v", err)
+	}
+	if !bytes.Equal(b[:len(bootCode)], bootCode) || !bytes.Equal(b[len(bootCode):440], make([]byte, 440-len(bootCode))) {
+		t.Errorf("boot code was not written padded to 440 bytes")
+	}
+	if !bytes.Equal(b[440:444], []byte{0x78, 0x56, 0x34, 0x12}) {
+		t.Errorf("disk signature written as % x", b[440:444])
+	}
+
+	read, err := mbr.Read(f, 512, 512)
+	if err != nil {
+		t.Fatalf("unexpected error reading table: %v", err)
+	}
+	if read.DiskSignature != table.DiskSignature {
+		t.Errorf("read disk signature %x instead of %x", read.DiskSignature, table.DiskSignature)
+	}
+	if len(read.BootCode) != 440 || !bytes.Equal(read.BootCode[:len(bootCode)], bootCode) {
+		t.Errorf("read boot code % x instead of % x", read.BootCode, bootCode)
+	}
+
+	// a table without boot code or disk signature leaves those on disk alone
+	table = &mbr.Table{
+		Partitions: []*mbr.Partition{
+			{Type: mbr.Linux, Start: 4096, Size: 2048},
+		},
+	}
+	if err := table.Write(f, tenMB); err != nil {
+		t.Fatalf("unexpected error writing table: %v", err)
+	}
+	read, err = mbr.Read(f, 512, 512)
+	if err != nil {
+		t.Fatalf("unexpected error reading table: %v", err)
+	}
+	if read.DiskSignature != 0x12345678 || len(read.BootCode) != 440 || !bytes.Equal(read.BootCode[:len(bootCode)], bootCode) {
+		t.Errorf("boot code or disk signature were not preserved, signature %x", read.DiskSignature)
+	}
+
+	// clearing them has to be asked for
+	table.BootCode = []byte{}
+	table.ClearDiskSignature = true
+	if err := table.Write(f, tenMB); err != nil {
+		t.Fatalf("unexpected error writing table: %v", err)
+	}
+	if _, err := f.ReadAt(b, 0); err != nil {
+		t.Fatalf("error reading MBR: %v", err)
+	}
+	if !bytes.Equal(b[:446], make([]byte, 446)) {
+		t.Errorf("boot code and disk signature were not cleared")
+	}
+
+	table.BootCode = make([]byte, 446)
+	if err := table.Write(f, tenMB); err == nil {
+		t.Errorf("writing 446 bytes of boot code did not return an error")
+	}
+}
+
+func TestCHS(t *testing.T) {
+	f, err := tmpDisk("", tenMB)
+	if err != nil {
+		t.Fatalf("error creating new temporary disk: %v", err)
+	}
+	defer f.Close()
+	defer os.Remove(f.Name())
+
+	table := &mbr.Table{
+		Partitions: []*mbr.Partition{
+			{Type: mbr.Linux, Start: 2048, Size: 16384},
+		},
+	}
+	if err := table.Write(f, tenMB); err != nil {
+		t.Fatalf("unexpected error writing table: %v", err)
+	}
+	b := make([]byte, 16)
+	if _, err := f.ReadAt(b, 446); err != nil {
+		t.Fatalf("error reading partition entry: %v", err)
+	}
+	// 2048 is 0/32/33 and 18431 is 1/37/36 with 255 heads and 63 sectors per track
+	expected := []byte{0, 32, 33, 0, 0x83, 37, 36, 1}
+	if !bytes.Equal(b[:8], expected) {
+		t.Errorf("partition entry starts with % x instead of % x", b[:8], expected)
+	}
+	read, err := mbr.Read(f, 512, 512)
+	if err != nil {
+		t.Fatalf("unexpected error reading table: %v", err)
+	}
+	if errs := read.CHSErrors(); len(errs) != 0 {
+		t.Errorf("unexpected CHS errors %v", errs)
+	}
+
+	// change the end head
+	if _, err := f.WriteAt([]byte{38}, 446+5); err != nil {
+		t.Fatalf("error changing partition entry: %v", err)
+	}
+	read, err = mbr.Read(f, 512, 512)
+	if err != nil {
+		t.Fatalf("unexpected error reading table: %v", err)
+	}
+	if errs := read.CHSErrors(); len(errs) != 1 || !strings.HasPrefix(errs[0].Error(), "partition 1: end CHS 1/38/36") {
+		t.Errorf("returned CHS errors %v instead of one for the end of partition 1", errs)
+	}
+
+	table.Geometry = mbr.Geometry{Heads: 256, SectorsPerTrack: 63}
+	if err := table.Write(f, tenMB); err == nil {
+		t.Errorf("writing a table with 256 heads did not return an error")
+	}
+}
+
 func TestGetPartitionSize(t *testing.T) {
 	table := mbr.GetValidTable()
 	maxPart := len(table.Partitions)
@@ -23,7 +23,10 @@ const (
 	LinuxExtended Type = 0x85
 	LinuxLVM      Type = 0x8e
 	Iso9660       Type = 0x96
+	FreeBSD       Type = 0xa5
+	OpenBSD       Type = 0xa6
 	MacOSXUFS     Type = 0xa8
+	NetBSD        Type = 0xa9
 	MacOSXBoot    Type = 0xab
 	HFS           Type = 0xaf
 	Solaris8Boot  Type = 0xbe
@@ -0,0 +1,81 @@
+package mbr
+
+import (
+	"fmt"
+
+	"github.com/diskfs/go-diskfs/partition/part"
+)
+
+// maxSectors the number of sectors an MBR can address
+const maxSectors = 1 << 32
+
+// Verify check the table for problems that would make it invalid when written to a disk of diskSize bytes:
+// partitions that overwrite the MBR, lie beyond the end of the disk or beyond what an MBR can address,
+// overlap each other, or logical partitions that do not fit in the extended partition. It returns nothing
+// if the table is valid.
+//
+// Like Write, which does not need the size of the disk, a diskSize of 0 skips the check against the end of the disk.
+func (t *Table) Verify(diskSize int64) []part.Problem {
+	var problems []part.Problem
+	addProblem := func(partition int, format string, a ...interface{}) {
+		problems = append(problems, part.Problem{Partition: partition, Description: fmt.Sprintf(format, a...)})
+	}
+
+	sectorSize := t.LogicalSectorSize
+	if sectorSize == 0 {
+		sectorSize = logicalSectorSize
+	}
+	diskSectors := uint64(maxSectors)
+	if diskSize != 0 {
+		diskSectors = uint64(diskSize) / uint64(sectorSize)
+	}
+	if diskSize < 0 || diskSectors == 0 {
+		addProblem(0, "invalid disk size %d", diskSize)
+		return problems
+	}
+	if len(t.BootCode) > bootCodeSize {
+		addProblem(0, "boot code is %d bytes, more than the maximum %d", len(t.BootCode), bootCodeSize)
+	}
+	if t.Geometry != (Geometry{}) {
+		if err := t.Geometry.valid(); err != nil {
+			addProblem(0, "invalid geometry: %v", err)
+		}
+	}
+	if _, err := t.extendedBootRecords(); err != nil {
+		addProblem(0, "invalid logical partitions: %v", err)
+	}
+
+	type extent struct {
+		number     int
+		start, end uint64
+		extended   bool
+	}
+	var extents []extent
+	for i, p := range t.Partitions {
+		number := i + 1
+		if p == nil || p.Type == Empty || p.Size == 0 {
+			continue
+		}
+		start, end := uint64(p.Start), uint64(p.Start)+uint64(p.Size)-1
+		switch {
+		case start == 0:
+			addProblem(number, "starts at sector 0, overwriting the MBR")
+		case end >= maxSectors:
+			addProblem(number, "ends at sector %d, beyond the last sector %d an MBR can address", end, uint64(maxSectors-1))
+		case end >= diskSectors:
+			addProblem(number, "ends at sector %d, beyond the end of the disk at sector %d", end, diskSectors-1)
+		}
+		logical := i >= partitionEntriesCount
+		for _, e := range extents {
+			// logical partitions are meant to be inside the extended partition
+			if logical && e.extended {
+				continue
+			}
+			if start <= e.end && e.start <= end {
+				addProblem(number, "overlaps partition %d", e.number)
+			}
+		}
+		extents = append(extents, extent{number: number, start: start, end: end, extended: p.Type.isExtended()})
+	}
+	return problems
+}
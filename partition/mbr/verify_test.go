@@ -0,0 +1,55 @@
+package mbr_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/diskfs/go-diskfs/partition/mbr"
+)
+
+func TestVerify(t *testing.T) {
+	newTable := func() *mbr.Table {
+		return &mbr.Table{
+			LogicalSectorSize:  512,
+			PhysicalSectorSize: 512,
+			Partitions: []*mbr.Partition{
+				{Type: mbr.Linux, Start: 2048, Size: 2048},
+				{Type: mbr.ExtendedLBA, Start: 4096, Size: 8192},
+				{Type: mbr.Empty},
+				{Type: mbr.Empty},
+				{Type: mbr.Linux, Start: 6144, Size: 2048},
+				{Type: mbr.LinuxSwap, Start: 10240, Size: 2048},
+			},
+		}
+	}
+	tests := []struct {
+		name     string
+		modify   func(*mbr.Table)
+		size     int64
+		problems []string
+	}{
+		{"valid", func(*mbr.Table) {}, tenMB, nil},
+		{"unknown disk size", func(*mbr.Table) {}, 0, nil},
+		{"overwrites MBR", func(t *mbr.Table) { t.Partitions[0].Start = 0 }, tenMB, []string{"partition 1: starts at sector 0"}},
+		{"beyond end of disk", func(t *mbr.Table) { t.Partitions[2] = &mbr.Partition{Type: mbr.Linux, Start: 20000, Size: 2048} }, tenMB, []string{"partition 3: ends at sector 22047, beyond the end of the disk at sector 20479"}},
+		{"beyond MBR", func(t *mbr.Table) { t.Partitions[2] = &mbr.Partition{Type: mbr.Linux, Start: 1<<32 - 100, Size: 2048} }, 0, []string{"partition 3: ends at sector 4294969243, beyond the last sector 4294967295"}},
+		{"overlapping primary", func(t *mbr.Table) { t.Partitions[2] = &mbr.Partition{Type: mbr.Linux, Start: 3000, Size: 2048} }, tenMB, []string{"partition 3: overlaps partition 1", "partition 3: overlaps partition 2"}},
+		{"overlapping logical", func(t *mbr.Table) { t.Partitions[5].Start = 8000 }, tenMB, []string{"invalid logical partitions", "partition 6: overlaps partition 5"}},
+		{"long boot code", func(t *mbr.Table) { t.BootCode = make([]byte, 441) }, tenMB, []string{"boot code is 441 bytes"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := newTable()
+			tt.modify(table)
+			problems := table.Verify(tt.size)
+			if len(problems) != len(tt.problems) {
+				t.Fatalf("returned problems %v instead of %v", problems, tt.problems)
+			}
+			for i, p := range problems {
+				if !strings.HasPrefix(p.String(), tt.problems[i]) {
+					t.Errorf("returned problem %q instead of %q", p, tt.problems[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package part
+
+import "fmt"
+
+// Problem an inconsistency found when verifying a partition table, which would make it invalid if written to disk
+type Problem struct {
+	Partition   int    // number of the partition with the problem, starting at 1, or 0 for the table as a whole
+	Description string // what is wrong
+}
+
+func (p Problem) String() string {
+	if p.Partition == 0 {
+		return p.Description
+	}
+	return fmt.Sprintf("partition %d: %s", p.Partition, p.Description)
+}
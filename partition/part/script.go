@@ -0,0 +1,222 @@
+package part
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ScriptField a named value in a script, a header line like "label: gpt", or a field of a partition line
+// like "start=2048". A partition field without a value, like "bootable", has an empty Value.
+type ScriptField struct {
+	Name  string
+	Value string
+}
+
+// ScriptPartition a partition line in a script
+type ScriptPartition struct {
+	Number int // number of the partition, from the trailing digits of the device name, or 0 if there is none
+	Fields []ScriptField
+}
+
+// Script a partition table in the script format of sfdisk, as written by sfdisk --dump and read by sfdisk.
+// Only the named field format is supported, e.g. "start=2048, size=4096, type=83", not the positional one.
+type Script struct {
+	Header     []ScriptField
+	Partitions []ScriptPartition
+}
+
+// quotedScriptFields fields whose values are quoted when written, as sfdisk does
+var quotedScriptFields = map[string]bool{"name": true, "attrs": true}
+
+func getField(fields []ScriptField, name string) (string, bool) {
+	for _, f := range fields {
+		if f.Name == name {
+			return f.Value, true
+		}
+	}
+	return "", false
+}
+
+// Get the value of a header line, and whether it is present
+func (s *Script) Get(name string) (string, bool) {
+	return getField(s.Header, name)
+}
+
+// Get the value of a field, and whether it is present
+func (p ScriptPartition) Get(name string) (string, bool) {
+	return getField(p.Fields, name)
+}
+
+// Write the script: the header lines, a blank line, and the partition lines, each named after its number
+func (s *Script) Write(w io.Writer) error {
+	var b strings.Builder
+	for _, h := range s.Header {
+		fmt.Fprintf(&b, "%s: %s\n", h.Name, h.Value)
+	}
+	b.WriteString("\n")
+	for _, p := range s.Partitions {
+		if p.Number > 0 {
+			fmt.Fprintf(&b, "%d : ", p.Number)
+		}
+		for i, f := range p.Fields {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(f.Name)
+			switch {
+			case quotedScriptFields[f.Name]:
+				b.WriteString("=" + quoteScriptValue(f.Value))
+			case f.Value != "":
+				b.WriteString("=" + f.Value)
+			}
+		}
+		b.WriteString("\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// quoteScriptValue quote a value, escaping quotes, backslashes and control characters as sfdisk does
+func quoteScriptValue(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c == '"' || c == '\\' {
+			fmt.Fprintf(&b, "\\x%02x", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// ParseScript parse a script in the format of sfdisk. Comments and blank lines are skipped. Header lines
+// must come before the partition lines.
+func ParseScript(r io.Reader) (*Script, error) {
+	s := &Script{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		colon, equals := strings.Index(line, ":"), strings.Index(line, "=")
+		// a header has no fields, a partition line may start with a device name before a colon
+		if colon >= 0 && equals < 0 {
+			if len(s.Partitions) > 0 {
+				return nil, fmt.Errorf("line %d: header %q after the partitions", n, line)
+			}
+			s.Header = append(s.Header, ScriptField{
+				Name:  strings.TrimSpace(line[:colon]),
+				Value: strings.TrimSpace(line[colon+1:]),
+			})
+			continue
+		}
+		p := ScriptPartition{}
+		if colon >= 0 && colon < equals {
+			number, err := partitionNumber(strings.TrimSpace(line[:colon]))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			p.Number = number
+			line = line[colon+1:]
+		}
+		fields, err := parseScriptFields(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		p.Fields = fields
+		s.Partitions = append(s.Partitions, p)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading script: %v", err)
+	}
+	return s, nil
+}
+
+// partitionNumber the partition number at the end of a device name, e.g. 2 for /dev/sda2
+func partitionNumber(device string) (int, error) {
+	i := len(device)
+	for i > 0 && device[i-1] >= '0' && device[i-1] <= '9' {
+		i--
+	}
+	number, err := strconv.Atoi(device[i:])
+	if err != nil || number < 1 {
+		return 0, fmt.Errorf("device %q does not end in a partition number", device)
+	}
+	return number, nil
+}
+
+// parseScriptFields parse the fields of a partition line, separated by commas or blanks
+func parseScriptFields(line string) ([]ScriptField, error) {
+	var fields []ScriptField
+	isSeparator := func(c byte) bool { return c == ',' || c == ' ' || c == '\t' }
+	for i := 0; i < len(line); {
+		if isSeparator(line[i]) {
+			i++
+			continue
+		}
+		start := i
+		for i < len(line) && line[i] != '=' && !isSeparator(line[i]) {
+			i++
+		}
+		field := ScriptField{Name: line[start:i]}
+		for i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+			i++
+		}
+		if i >= len(line) || line[i] != '=' {
+			fields = append(fields, field)
+			continue
+		}
+		// skip the = and any blanks after it, as sfdisk pads numbers
+		i++
+		for i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+			i++
+		}
+		if i < len(line) && line[i] == '"' {
+			value, n, err := unquoteScriptValue(line[i:])
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %v", field.Name, err)
+			}
+			field.Value = value
+			i += n
+		} else {
+			start = i
+			for i < len(line) && !isSeparator(line[i]) {
+				i++
+			}
+			field.Value = line[start:i]
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// unquoteScriptValue read a quoted value at the start of s, returning it and the number of bytes it took
+func unquoteScriptValue(s string) (string, int, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			return b.String(), i + 1, nil
+		case c == '\\' && i+3 < len(s) && s[i+1] == 'x':
+			v, err := strconv.ParseUint(s[i+2:i+4], 16, 8)
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid escape %q", s[i:i+4])
+			}
+			b.WriteByte(byte(v))
+			i += 3
+		case c == '\\' && i+1 < len(s):
+			b.WriteByte(s[i+1])
+			i++
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("missing closing quote")
+}
@@ -5,22 +5,58 @@ package partition
 import (
 	"fmt"
 
+	"github.com/diskfs/go-diskfs/partition/apm"
+	"github.com/diskfs/go-diskfs/partition/bsd"
 	"github.com/diskfs/go-diskfs/partition/gpt"
 	"github.com/diskfs/go-diskfs/partition/mbr"
 	"github.com/diskfs/go-diskfs/util"
 )
 
+// gptSectorSizes logical sector sizes to probe for a GPT, if there is none with the logical block size given
+var gptSectorSizes = []int{512, 4096}
+
 // Read read a partition table from a disk
 func Read(f util.File, logicalBlocksize, physicalBlocksize int) (Table, error) {
-	// just try each type
+	table, _, err := ReadDetectSectorSize(f, logicalBlocksize, physicalBlocksize)
+	return table, err
+}
+
+// ReadDetectSectorSize read a partition table from a disk, like Read, and return the logical sector size
+// that the table uses. A GPT is looked for with logicalBlocksize first, and then with 512 and 4096 byte
+// sectors, so that the GPT of an image made for a 4Kn drive is found even with 512 byte sectors, or
+// the other way around. Other tables are only looked for with logicalBlocksize.
+func ReadDetectSectorSize(f util.File, logicalBlocksize, physicalBlocksize int) (Table, int, error) {
+	// just try each type, a GPT first, as its protective MBR also is a valid MBR
 	gptTable, err := gpt.Read(f, logicalBlocksize, physicalBlocksize)
 	if err == nil {
-		return gptTable, nil
+		return gptTable, logicalBlocksize, nil
+	}
+	for _, size := range gptSectorSizes {
+		if size == logicalBlocksize {
+			continue
+		}
+		pbs := physicalBlocksize
+		if pbs < size {
+			pbs = size
+		}
+		if gptTable, err := gpt.Read(f, size, pbs); err == nil {
+			return gptTable, size, nil
+		}
 	}
 	mbrTable, err := mbr.Read(f, logicalBlocksize, physicalBlocksize)
 	if err == nil {
-		return mbrTable, nil
+		return mbrTable, logicalBlocksize, nil
+	}
+	// a hybrid disk with both an MBR and an APM is read as MBR above; use apm.Read for its APM
+	apmTable, err := apm.Read(f, logicalBlocksize, physicalBlocksize)
+	if err == nil {
+		return apmTable, logicalBlocksize, nil
+	}
+	// only a disklabel on the whole disk; one inside an MBR slice is read with bsd.ReadFromMBR
+	bsdTable, err := bsd.Read(f, logicalBlocksize, physicalBlocksize)
+	if err == nil {
+		return bsdTable, logicalBlocksize, nil
 	}
 	// we are out
-	return nil, fmt.Errorf("unknown disk partition type")
+	return nil, 0, fmt.Errorf("unknown disk partition type")
 }
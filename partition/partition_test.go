@@ -12,6 +12,8 @@ import (
 	"testing"
 
 	"github.com/diskfs/go-diskfs/partition"
+	"github.com/diskfs/go-diskfs/partition/apm"
+	"github.com/diskfs/go-diskfs/partition/gpt"
 )
 
 func TestRead(t *testing.T) {
@@ -65,3 +67,100 @@ func TestRead(t *testing.T) {
 		})
 	}
 }
+
+func TestReadAPM(t *testing.T) {
+	f, err := os.CreateTemp("", "partition_test")
+	if err != nil {
+		t.Fatalf("Failed to create tempfile: %v", err)
+	}
+	defer f.Close()
+	defer os.Remove(f.Name())
+	size := int64(10 * 1024 * 1024)
+	if err := f.Truncate(size); err != nil {
+		t.Fatalf("Failed to truncate tempfile: %v", err)
+	}
+	table := &apm.Table{
+		Partitions: []*apm.Partition{
+			{Start: 1, Size: 63, Name: "Apple", Type: apm.PartitionMap},
+			{Start: 64, Size: 20416, Name: "Macintosh HD", Type: apm.HFS},
+		},
+	}
+	if err := table.Write(f, size); err != nil {
+		t.Fatalf("unexpected error writing table: %v", err)
+	}
+	read, err := partition.Read(f, 512, 512)
+	if err != nil {
+		t.Fatalf("unexpected error reading table: %v", err)
+	}
+	if read.Type() != "apm" {
+		t.Errorf("read table of type %s instead of apm", read.Type())
+	}
+}
+
+func TestReadDetectSectorSize(t *testing.T) {
+	for _, sectorSize := range []int{512, 4096} {
+		t.Run(fmt.Sprintf("%d", sectorSize), func(t *testing.T) {
+			f, err := os.CreateTemp("", "partition_test")
+			if err != nil {
+				t.Fatalf("Failed to create tempfile: %v", err)
+			}
+			defer f.Close()
+			defer os.Remove(f.Name())
+			size := int64(10 * 1024 * 1024)
+			if err := f.Truncate(size); err != nil {
+				t.Fatalf("Failed to truncate tempfile: %v", err)
+			}
+			table := &gpt.Table{
+				LogicalSectorSize:  sectorSize,
+				PhysicalSectorSize: sectorSize,
+				ProtectiveMBR:      true,
+				Partitions: []*gpt.Partition{
+					{Start: uint64(1024 * 1024 / sectorSize), Size: 1024 * 1024, Type: gpt.LinuxFilesystem},
+				},
+			}
+			if err := table.Write(f, size); err != nil {
+				t.Fatalf("unexpected error writing table: %v", err)
+			}
+			// whichever sector size is given, the GPT is found with the one it was written with
+			for _, given := range []int{512, 4096} {
+				read, detected, err := partition.ReadDetectSectorSize(f, given, given)
+				if err != nil {
+					t.Fatalf("unexpected error reading table with sector size %d: %v", given, err)
+				}
+				if read.Type() != "gpt" || detected != sectorSize {
+					t.Errorf("read table of type %s with sector size %d instead of gpt with %d", read.Type(), detected, sectorSize)
+				}
+				if start := read.GetPartitions()[0].GetStart(); start != 1024*1024 {
+					t.Errorf("partition starts at %d instead of %d", start, 1024*1024)
+				}
+			}
+		})
+	}
+}
+
+func TestParseScript(t *testing.T) {
+	tests := []struct {
+		script    string
+		tableType string
+		err       string
+	}{
+		{"label: gpt\nsize=2048\n", "gpt", ""},
+		{"label: dos\nstart=2048, size=2048\n", "mbr", ""},
+		{"start=2048, size=2048\n", "mbr", ""},
+		{"label: sun\n", "", `unsupported partition table label "sun"`},
+		{"label: gpt\nsize=2048, type=83\n", "", "partition 1: invalid type=83"},
+	}
+	for _, tt := range tests {
+		table, err := partition.ParseScript(strings.NewReader(tt.script))
+		switch {
+		case tt.err != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.err)):
+			t.Errorf("%q returned error %v instead of %s", tt.script, err, tt.err)
+		case tt.err != "" && table != nil:
+			t.Errorf("%q returned a table with error %v", tt.script, err)
+		case tt.err == "" && err != nil:
+			t.Errorf("%q returned unexpected error: %v", tt.script, err)
+		case tt.err == "" && table.Type() != tt.tableType:
+			t.Errorf("%q returned a table of type %s instead of %s", tt.script, table.Type(), tt.tableType)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package partition
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/diskfs/go-diskfs/partition/gpt"
+	"github.com/diskfs/go-diskfs/partition/mbr"
+	"github.com/diskfs/go-diskfs/partition/part"
+)
+
+// ParseScript read a partition table from an sfdisk script, as written by sfdisk --dump or by the Dump of
+// a gpt.Table or mbr.Table. The label header picks the type of table; without one, it is an MBR, as for
+// sfdisk.
+func ParseScript(r io.Reader) (Table, error) {
+	s, err := part.ParseScript(r)
+	if err != nil {
+		return nil, err
+	}
+	var table Table
+	switch label, ok := s.Get("label"); {
+	case label == "gpt":
+		table, err = gpt.TableFromScript(s)
+	case label == "dos" || !ok:
+		table, err = mbr.TableFromScript(s)
+	default:
+		return nil, fmt.Errorf("unsupported partition table label %q", label)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return table, nil
+}
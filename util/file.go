@@ -1,7 +1,11 @@
 // Package util common utilities or other elements shared across github.com/diskfs/go-diskfs packages
 package util
 
-import "io"
+import (
+	"errors"
+	"fmt"
+	"io"
+)
 
 // File interface that can be read from and written to.
 // Normally implemented as actual os.File, but useful as a separate interface so can easily
@@ -11,3 +15,54 @@ type File interface {
 	io.WriterAt
 	io.Seeker
 }
+
+// NewReadOnlyFile adapts an io.ReaderAt of the given size, such as a network-backed reader, to File.
+// Writes return an error, and Seek only tracks a position, with io.SeekEnd relative to size.
+// IsReadOnly reports true for the returned File.
+func NewReadOnlyFile(r io.ReaderAt, size int64) File {
+	return &readOnlyFile{r: r, size: size}
+}
+
+// IsReadOnly reports whether f is known to be read-only, i.e. it has a ReadOnly() method that returns true.
+// Filesystems use it to refuse changes up front, rather than failing partway through writing them.
+func IsReadOnly(f File) bool {
+	ro, ok := f.(interface{ ReadOnly() bool })
+	return ok && ro.ReadOnly()
+}
+
+type readOnlyFile struct {
+	r    io.ReaderAt
+	size int64
+	pos  int64
+}
+
+func (f *readOnlyFile) ReadAt(b []byte, off int64) (int, error) {
+	return f.r.ReadAt(b, off)
+}
+
+func (f *readOnlyFile) ReadOnly() bool {
+	return true
+}
+
+func (f *readOnlyFile) WriteAt(b []byte, off int64) (int, error) {
+	return 0, errors.New("cannot write to a read-only file")
+}
+
+func (f *readOnlyFile) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = f.pos + offset
+	case io.SeekEnd:
+		pos = f.size + offset
+	default:
+		return f.pos, fmt.Errorf("invalid whence %d", whence)
+	}
+	if pos < 0 {
+		return f.pos, fmt.Errorf("cannot seek to negative offset %d", pos)
+	}
+	f.pos = pos
+	return pos, nil
+}